@@ -0,0 +1,163 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	confpkg "mainstay/config"
+	"mainstay/log"
+)
+
+// Attestation admin provides an authenticated HTTP api for operators
+// to control a running attestation service. Requests are converted to
+// attestation commands and handled by the service Run loop
+
+// error / warning consts
+const (
+	ErrorAdminUnauthorized = "Unauthorized"
+	ErrorAdminMethod       = "Method not allowed"
+
+	WarningAdminNoToken = "No admin token set - admin api disabled"
+	WarningAdminServer  = "Admin api server failure"
+)
+
+// admin api timings
+const (
+	// maximum waiting time for the service to handle a command
+	// commands are only handled in between attestation states
+	AdminCommandTimeout = 2 * time.Minute
+
+	// waiting time for pending requests on shutdown
+	AdminShutdownTimeout = 5 * time.Second
+)
+
+// admin api routes and the attestation command each route maps to
+var adminRoutes = map[string]AttestCommandType{
+	"/status": ACommandStatus,
+	"/pause":  ACommandPause,
+	"/resume": ACommandResume,
+	"/attest": ACommandAttest,
+	"/bump":   ACommandBumpFee,
+	"/reset":  ACommandReset,
+}
+
+// AttestAdmin structure
+//
+// Serves the admin api for a single attestation service
+// Requests require an "Authorization: Bearer <token>" header
+type AttestAdmin struct {
+	// context required for safe service cancellation
+	ctx context.Context
+
+	// waitgroup required to maintain all goroutines
+	wg *sync.WaitGroup
+
+	// attestation service receiving commands
+	service *AttestService
+
+	host  string
+	token []byte
+}
+
+// AdminResponse structure
+// Response of all admin api requests
+type AdminResponse struct {
+	Status *AttestStatus `json:"status,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// Return new AttestAdmin instance
+func NewAttestAdmin(ctx context.Context, wg *sync.WaitGroup, service *AttestService, config confpkg.AdminConfig) *AttestAdmin {
+	return &AttestAdmin{
+		ctx:     ctx,
+		wg:      wg,
+		service: service,
+		host:    config.Host,
+		token:   []byte(config.Token),
+	}
+}
+
+// Run admin api server until the context is cancelled
+// The api is not served if no admin token has been set
+func (a *AttestAdmin) Run() {
+	defer a.wg.Done()
+
+	if len(a.token) == 0 {
+		log.Warnln(WarningAdminNoToken)
+		return
+	}
+
+	server := &http.Server{Addr: a.host, Handler: a}
+	go func() {
+		log.Infof("********** serving admin api on: %s\n", a.host)
+		if serveErr := server.ListenAndServe(); serveErr != nil && serveErr != http.ErrServerClosed {
+			log.Warnf("%s %v\n", WarningAdminServer, serveErr)
+		}
+	}()
+
+	<-a.ctx.Done()
+	log.Infoln("Shutting down Attestation Admin...")
+	ctx, cancel := context.WithTimeout(context.Background(), AdminShutdownTimeout)
+	defer cancel()
+	server.Shutdown(ctx)
+}
+
+// Handle admin api request
+// Status is available via GET and all other commands via POST
+func (a *AttestAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	command, ok := adminRoutes[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !a.authorized(r) {
+		writeAdminResponse(w, http.StatusUnauthorized, AdminResponse{Error: ErrorAdminUnauthorized})
+		return
+	}
+
+	if (command == ACommandStatus && r.Method != http.MethodGet) ||
+		(command != ACommandStatus && r.Method != http.MethodPost) {
+		writeAdminResponse(w, http.StatusMethodNotAllowed, AdminResponse{Error: ErrorAdminMethod})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), AdminCommandTimeout)
+	defer cancel()
+	status, commandErr := a.service.SendCommand(ctx, command)
+	if commandErr != nil && (ctx.Err() != nil || a.ctx.Err() != nil) {
+		// command not handled by the service
+		writeAdminResponse(w, http.StatusServiceUnavailable, AdminResponse{Error: commandErr.Error()})
+		return
+	} else if commandErr != nil {
+		writeAdminResponse(w, http.StatusConflict, AdminResponse{Status: &status, Error: commandErr.Error()})
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, AdminResponse{Status: &status})
+}
+
+// Check request bearer token matches the admin token
+func (a *AttestAdmin) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := []byte(strings.TrimPrefix(auth, "Bearer "))
+	return subtle.ConstantTimeCompare(token, a.token) == 1
+}
+
+// Write JSON admin response with status code
+func writeAdminResponse(w http.ResponseWriter, code int, response AdminResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	confpkg "mainstay/config"
+	"mainstay/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test admin api requests and attestation commands
+func TestAttestAdmin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// service without attestation client connectivity
+	// commands handled as in the service Run loop
+	service := &AttestService{
+		ctx:         ctx,
+		config:      &confpkg.Config{},
+		attester:    &AttestClient{Fees: AttestFees{currentFee: 10}},
+		attestation: models.NewAttestationDefault(),
+		state:       AStateNextCommitment,
+		commands:    make(chan attestCommand),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case cmd := <-service.commands:
+				service.handleCommand(cmd)
+			}
+		}
+	}()
+
+	admin := NewAttestAdmin(ctx, nil, service, confpkg.AdminConfig{Host: "127.0.0.1:0", Token: "token"})
+	request := func(method string, path string, token string) (int, AdminResponse) {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, req)
+		var response AdminResponse
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return rec.Code, response
+	}
+
+	// authorization and routes
+	code, response := request(http.MethodGet, "/status", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, ErrorAdminUnauthorized, response.Error)
+	code, _ = request(http.MethodGet, "/status", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = request(http.MethodGet, "/unknown", "token")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = request(http.MethodGet, "/pause", "token")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+	code, _ = request(http.MethodPost, "/status", "token")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+
+	// status
+	code, response = request(http.MethodGet, "/status", "token")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, AStateNextCommitment, response.Status.State)
+	assert.Equal(t, "next_commitment", response.Status.StateName)
+	assert.Equal(t, false, response.Status.Paused)
+	assert.Equal(t, 10, response.Status.Fee)
+
+	// fee bump not allowed when not awaiting confirmation
+	code, response = request(http.MethodPost, "/bump", "token")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, ErrorCommandBumpFeeState+" next_commitment", response.Error)
+	assert.Equal(t, AStateNextCommitment, response.Status.State)
+
+	// pause and resume
+	code, response = request(http.MethodPost, "/pause", "token")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, response.Status.Paused)
+	code, response = request(http.MethodPost, "/attest", "token")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, ErrorCommandPaused, response.Error)
+	code, response = request(http.MethodPost, "/resume", "token")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, false, response.Status.Paused)
+
+	// force attestation
+	code, _ = request(http.MethodPost, "/attest", "token")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, service.isForcedAttestation)
+
+	// force fee bump
+	service.state = AStateAwaitConfirmation
+	code, _ = request(http.MethodPost, "/attest", "token")
+	assert.Equal(t, http.StatusConflict, code)
+	code, response = request(http.MethodPost, "/bump", "token")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, AStateHandleUnconfirmed, response.Status.State)
+
+	// reset
+	code, response = request(http.MethodPost, "/reset", "token")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, AStateInit, response.Status.State)
+	assert.Equal(t, false, service.isForcedAttestation)
+
+	// commands not handled after service shutdown
+	cancel()
+	<-done
+	code, response = request(http.MethodGet, "/status", "token")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, (*AttestStatus)(nil), response.Status)
+}
+
+// Test attestation commands and handling of the current state
+func TestAttestService_Commands(t *testing.T) {
+	service := &AttestService{
+		config:      &confpkg.Config{},
+		attester:    &AttestClient{},
+		attestation: models.NewAttestationDefault(),
+		state:       AStateNextCommitment,
+	}
+
+	doNow, err := service.doCommand(ACommandStatus)
+	assert.Equal(t, false, doNow)
+	assert.Equal(t, nil, err)
+
+	// paused service only handles state after resume
+	doNow, err = service.doCommand(ACommandPause)
+	assert.Equal(t, false, doNow)
+	assert.Equal(t, true, service.paused)
+	doNow, err = service.doCommand(ACommandReset)
+	assert.Equal(t, false, doNow)
+	assert.Equal(t, AStateInit, service.state)
+	doNow, err = service.doCommand(ACommandResume)
+	assert.Equal(t, true, doNow)
+	assert.Equal(t, false, service.paused)
+	doNow, err = service.doCommand(ACommandResume)
+	assert.Equal(t, false, doNow)
+
+	// forced commands handle state immediately
+	service.state = AStateNextCommitment
+	doNow, err = service.doCommand(ACommandAttest)
+	assert.Equal(t, true, doNow)
+	assert.Equal(t, nil, err)
+	service.state = AStateAwaitConfirmation
+	doNow, err = service.doCommand(ACommandBumpFee)
+	assert.Equal(t, true, doNow)
+	assert.Equal(t, AStateHandleUnconfirmed, service.state)
+	doNow, err = service.doCommand(ACommandReset)
+	assert.Equal(t, true, doNow)
+	assert.Equal(t, AStateInit, service.state)
+
+	doNow, err = service.doCommand("unknown")
+	assert.Equal(t, false, doNow)
+	assert.Equal(t, ErrorCommandUnknown+" unknown", err.Error())
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"time"
+
+	"mainstay/log"
+	"mainstay/models"
+
+	"github.com/btcsuite/btcd/btcjson"
+)
+
+// Fee spend accounting of confirmed attestations
+// The fees of attestations confirmed in the current month are checked
+// against the monthly budget after each confirmation and once a new
+// month starts, and once exceeded the service reduces attestation
+// frequency until the next month
+
+// fee budget defaults
+const (
+	// factor the min attestation interval is stretched by
+	// in reduced frequency mode if no interval is configured
+	DefaultBudgetIntervalFactor = 4
+)
+
+// warning consts
+const (
+	WarningFeeSpend              = "Failed getting attestation fee spend"
+	WarningFeeBudgetExceeded     = "Monthly fee budget exceeded - reducing attestation frequency"
+	WarningInvalidATimeBudgetArg = "Budget attestation time lower than min attestation time"
+	WarningAttestationFee        = "Failed getting attestation fee"
+)
+
+// Update attestation info with details from the wallet transaction
+// The fee is calculated from the previous outputs of the attestation
+// inputs, as wallet fees are not available for inputs the wallet does
+// not own. Failures to get the fee are not fatal for attestations
+func (s *AttestService) updateInfo(attestation *models.Attestation, walletTx *btcjson.GetTransactionResult) {
+	prevOuts, prevOutsErr := s.attester.getPrevOuts(&attestation.Tx)
+	if prevOutsErr != nil {
+		log.Warnf("%s %v\n", WarningAttestationFee, prevOutsErr)
+	}
+	attestation.UpdateInfo(walletTx, prevOuts)
+}
+
+// Return interval between attestations, which is stretched
+// to the budget interval if the monthly fee budget is exceeded
+func (s *AttestService) attestationInterval() time.Duration {
+	if s.isBudgetExceeded {
+		return s.atimeBudgetAttestation
+	}
+	return s.atimeMinAttestation
+}
+
+// Return start of the month of the time provided in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Update fee budget if not evaluated for the current month yet, so
+// that reduced frequency mode is switched off once a new month starts
+func (s *AttestService) checkFeeBudget() {
+	if s.feeBudgetMonth != models.FeeSpendPeriodOf(models.FeeSpendPeriodMonth, s.clock.Now()) {
+		s.updateFeeBudget()
+	}
+}
+
+// Return time until the start of the next month
+// Attestations delayed for the budget are delayed until
+// the next month at most, when the budget is evaluated again
+func (s *AttestService) untilNextMonth() time.Duration {
+	now := s.clock.Now()
+	return monthStart(now).AddDate(0, 1, 0).Sub(now)
+}
+
+// Update fees spent by attestations confirmed in the current month
+// and switch reduced frequency mode on or off for the monthly budget
+// Failures to get the fee spend are not fatal for attestations
+func (s *AttestService) updateFeeBudget() {
+	now := s.clock.Now()
+	spend, spendErr := s.server.GetFeeSpend(models.FeeSpendPeriodMonth, monthStart(now))
+	if spendErr != nil {
+		log.Warnf("%s %v\n", WarningFeeSpend, spendErr)
+		return
+	}
+	s.feeBudgetMonth = models.FeeSpendPeriodOf(models.FeeSpendPeriodMonth, now)
+	s.monthlyFeeSpend = 0
+	for _, period := range spend {
+		if period.Period == models.FeeSpendPeriodOf(models.FeeSpendPeriodMonth, now) {
+			s.monthlyFeeSpend = period.Fees
+		}
+	}
+
+	isBudgetExceeded := s.monthlyBudget > 0 && s.monthlyFeeSpend >= s.monthlyBudget
+	s.metrics.SetFeeSpend(s.monthlyFeeSpend, isBudgetExceeded)
+	if isBudgetExceeded == s.isBudgetExceeded {
+		return
+	}
+	s.isBudgetExceeded = isBudgetExceeded
+	if isBudgetExceeded {
+		log.Warnf("%s (%d >= %d)\n", WarningFeeBudgetExceeded, s.monthlyFeeSpend, s.monthlyBudget)
+		s.publishEvent(AEventFeeBudgetExceeded, nil)
+	} else {
+		log.Infof("********** monthly fee budget restored (%d < %d)\n", s.monthlyFeeSpend, s.monthlyBudget)
+		s.publishEvent(AEventFeeBudgetRestored, nil)
+	}
+}
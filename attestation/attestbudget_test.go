@@ -0,0 +1,128 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"testing"
+	"time"
+
+	confpkg "mainstay/config"
+	"mainstay/db"
+	"mainstay/metrics"
+	"mainstay/models"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test monthly fee budget switching reduced frequency mode
+func TestAttestBudget(t *testing.T) {
+	dbFake := db.NewDbFake()
+	clock := NewAttestClockFake(time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC))
+	var events []AttestEventType
+	service := &AttestService{
+		config:                 &confpkg.Config{},
+		server:                 NewAttestServer(dbFake),
+		attester:               &AttestClient{Fees: AttestFees{currentFee: 10}},
+		attestation:            models.NewAttestationDefault(),
+		clock:                  clock,
+		events:                 NewAttestEventBus(),
+		metrics:                metrics.NewStaychainMetrics("budget"),
+		atimeMinAttestation:    time.Hour,
+		atimeBudgetAttestation: 4 * time.Hour,
+		monthlyBudget:          50000,
+	}
+	service.events.Subscribe(attestSubscriberFunc(func(event AttestEvent) {
+		events = append(events, event.Type)
+	}))
+
+	// fees of previous month not included
+	dbFake.SaveAttestationInfo(models.AttestationInfo{Txid: "a", Time: time.Date(2024, 2, 28, 0, 0, 0, 0, time.UTC).Unix(), Fee: 90000})
+	dbFake.SaveAttestationInfo(models.AttestationInfo{Txid: "b", Time: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC).Unix(), Fee: 30000})
+	service.updateFeeBudget()
+	assert.Equal(t, int64(30000), service.monthlyFeeSpend)
+	assert.Equal(t, false, service.isBudgetExceeded)
+	assert.Equal(t, time.Hour, service.attestationInterval())
+	assert.Equal(t, 0, len(events))
+
+	// budget exceeded stretches attestation interval
+	dbFake.SaveAttestationInfo(models.AttestationInfo{Txid: "c", Time: time.Date(2024, 3, 20, 11, 0, 0, 0, time.UTC).Unix(), Fee: 20000})
+	service.updateFeeBudget()
+	assert.Equal(t, int64(50000), service.monthlyFeeSpend)
+	assert.Equal(t, true, service.isBudgetExceeded)
+	assert.Equal(t, 4*time.Hour, service.attestationInterval())
+	assert.Equal(t, []AttestEventType{AEventFeeBudgetExceeded}, events)
+	assert.Equal(t, int64(50000), service.status().MonthlyFeeSpend)
+	assert.Equal(t, true, service.status().BudgetExceeded)
+
+	// event raised once while budget remains exceeded
+	service.updateFeeBudget()
+	assert.Equal(t, 1, len(events))
+
+	// budget restored in the next month
+	clock.Advance(12 * 24 * time.Hour)
+	service.updateFeeBudget()
+	assert.Equal(t, int64(0), service.monthlyFeeSpend)
+	assert.Equal(t, false, service.isBudgetExceeded)
+	assert.Equal(t, time.Hour, service.attestationInterval())
+	assert.Equal(t, []AttestEventType{AEventFeeBudgetExceeded, AEventFeeBudgetRestored}, events)
+
+	// no budget set
+	service.monthlyBudget = 0
+	dbFake.SaveAttestationInfo(models.AttestationInfo{Txid: "d", Time: clock.Now().Unix(), Fee: 80000})
+	service.updateFeeBudget()
+	assert.Equal(t, int64(80000), service.monthlyFeeSpend)
+	assert.Equal(t, false, service.isBudgetExceeded)
+}
+
+// Test reduced frequency mode switched off once a new month starts
+// without waiting for the next attestation confirmation
+func TestAttestBudgetNextMonth(t *testing.T) {
+	dbFake := db.NewDbFake()
+	clock := NewAttestClockFake(time.Date(2024, 3, 31, 22, 0, 0, 0, time.UTC))
+	var events []AttestEventType
+	service := &AttestService{
+		config:                 &confpkg.Config{},
+		server:                 NewAttestServer(dbFake),
+		attester:               &AttestClient{Fees: AttestFees{currentFee: 10}},
+		attestation:            models.NewAttestationDefault(),
+		clock:                  clock,
+		events:                 NewAttestEventBus(),
+		metrics:                metrics.NewStaychainMetrics("budgetmonth"),
+		state:                  AStateNextCommitment,
+		atimeMinAttestation:    time.Hour,
+		atimeBudgetAttestation: 6 * time.Hour,
+		monthlyBudget:          50000,
+	}
+	service.events.Subscribe(attestSubscriberFunc(func(event AttestEvent) {
+		events = append(events, event.Type)
+	}))
+	commitment, _ := chainhash.NewHashFromStr("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	dbFake.SetClientCommitments([]models.ClientCommitment{{Commitment: *commitment, ClientPosition: 0}})
+	dbFake.SaveAttestationInfo(models.AttestationInfo{Txid: "a", Time: clock.Now().Add(-time.Hour).Unix(), Fee: 60000})
+	service.confirmTime = clock.Now().Add(-time.Hour)
+
+	// budget evaluated on first commitment check and
+	// attestation delayed until the start of the next month
+	service.doStateNextCommitment()
+	assert.Equal(t, true, service.isBudgetExceeded)
+	assert.Equal(t, AStateNextCommitment, service.state)
+	assert.Equal(t, 2*time.Hour, service.attestDelay)
+	assert.Equal(t, []AttestEventType{AEventFeeBudgetExceeded}, events)
+
+	// budget not evaluated again within the same month
+	dbFake.AttestationsInfo = nil
+	clock.Advance(time.Hour)
+	service.doStateNextCommitment()
+	assert.Equal(t, true, service.isBudgetExceeded)
+	assert.Equal(t, time.Hour, service.attestDelay)
+
+	// budget restored in the new month and attestation resumed
+	clock.Advance(time.Hour)
+	service.doStateNextCommitment()
+	assert.Equal(t, false, service.isBudgetExceeded)
+	assert.Equal(t, AStateNewAttestation, service.state)
+	assert.Equal(t, []AttestEventType{AEventFeeBudgetExceeded, AEventFeeBudgetRestored}, events)
+}
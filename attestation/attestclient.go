@@ -5,7 +5,9 @@
 package attestation
 
 import (
+	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"math"
 	"fmt"
@@ -25,6 +27,7 @@ import (
 	"github.com/btcsuite/btcd/rpcclient"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 )
 
 // error - warning consts
@@ -47,12 +50,35 @@ const (
 	ErrorInvalidChaincode           = `Invalid chaincode provided`
 	ErrorMissingChaincodes          = `Missing chaincodes for pubkeys`
 	ErrorTopUpScriptNumSigs         = `Different number of signatures in Init script to top-up script`
+	ErrorTestMempoolAccept          = `Attestation transaction rejected by testmempoolaccept`
+	ErrorAnchorMissing              = `Attestation anchor output missing for fee-only child`
+	ErrorTopupKeyMissing            = `Topup private key required for fee-only child`
+	ErrorInsufficientTopupFunds     = `Insufficient topup funds for fee-only child`
+	ErrorSignerSig                  = `Signature invalid for sighash`
+	ErrorSignerPubkey               = `Pubkey does not match tweaked pubkey`
+	ErrorSignerTopupPubkey          = `Pubkey does not match topup address`
+	ErrorSignerRedeemScript         = `Redeem script does not match tweaked redeem script`
+	ErrorTaprootMultisig            = `Taproot staychains do not support multisig init scripts`
 )
 
 // coin in satoshis
 const Coin = 100000000
 
-const signedTxSize = 110 // bytes
+// maximum witness item sizes of signed transaction inputs
+const (
+	witnessSigSize     = 73 // DER signature with sighash type
+	witnessSchnorrSize = 65 // schnorr signature with sighash type
+	witnessPubkeySize  = 33 // compressed pubkey
+
+	witnessScaleFactor = 4 // weight units per non witness byte
+)
+
+// value of the anchor output paying to the topup address that is added
+// to attestations in the cpfp case, allowing fee-only child transactions
+const anchorValue = 1000 // satoshis
+
+// minimum value of fee-only child transaction outputs
+const dustValue = 546 // satoshis
 
 // AttestClient structure
 //
@@ -91,6 +117,9 @@ type AttestClient struct {
 	numOfSigs       int
 	addrTopup       string
 
+	// pay to taproot staychain with pubkey as internal key
+	taproot bool
+
 	// states whether Attest Client struct is used for transaction
 	// signing or simply for address tweaking and transaction creation
 	// in signer case the wallet priv key of the signer is imported
@@ -98,6 +127,10 @@ type AttestClient struct {
 	WalletPriv      *btcutil.WIF
 	WalletPrivTopup *btcutil.WIF
 	WalletChainCode []byte
+
+	// signer of fee-only child topup inputs keeping the topup key,
+	// used if the topup private key is not set in the config
+	TopupSigner AttestTopupSigner
 }
 
 // Parse topup configuration and return private keys related to topup addresses
@@ -131,6 +164,66 @@ func parseMainKeys(config *confpkg.Config, isSigner bool) *btcutil.WIF {
 	return nil
 }
 
+// Parse multisig init script and chaincodes and return the extended
+// base pubkeys of the multisig along with the number of sigs required
+func parseMultisigKeys(script string, chaincodesStr []string) ([]*hdkeychain.ExtendedKey, int) {
+	pubkeys, numOfSigs := crypto.ParseRedeemScript(script)
+
+	// get chaincodes of pubkeys from config
+	if len(chaincodesStr) != len(pubkeys) {
+		log.Errorf("%s %d != %d\n", ErrorMissingChaincodes, len(chaincodesStr), len(pubkeys))
+	}
+
+	// parse extended pubkeys
+	// fields except key/chain code are irrelevant for child derivation
+	var pubkeysExtended []*hdkeychain.ExtendedKey
+	for i, pub := range pubkeys {
+		chaincode, chaincodeErr := hex.DecodeString(chaincodesStr[i])
+		if chaincodeErr != nil || len(chaincode) != 32 {
+			log.Errorf("%s %s\n", ErrorInvalidChaincode, chaincodesStr[i])
+		}
+		pubkeysExtended = append(pubkeysExtended,
+			hdkeychain.NewExtendedKey([]byte{}, pub.SerializeCompressed(), chaincode, []byte{}, 0, 0, false))
+	}
+	return pubkeysExtended, numOfSigs
+}
+
+// Return new AttestClient instance for the multisig case
+// In the signer case the private key provided must correspond to
+// one of the multisig pubkeys and the chaincode of this pubkey is used
+func newMultisigAttestClient(config *confpkg.Config, isSigner bool, wif *btcutil.WIF, wifTopup *btcutil.WIF) *AttestClient {
+	pubkeysExtended, numOfSigs := parseMultisigKeys(config.InitScript(), config.InitChaincodes())
+
+	var walletChaincode []byte
+	if isSigner {
+		myPubkey := wif.PrivKey.PubKey().SerializeCompressed()
+		for _, pubkeyExtended := range pubkeysExtended {
+			pubkey, _ := pubkeyExtended.ECPubKey()
+			if bytes.Equal(myPubkey, pubkey.SerializeCompressed()) {
+				walletChaincode = pubkeyExtended.ChainCode()
+				break
+			}
+		}
+		if walletChaincode == nil {
+			log.Errorf("%s %s\n", ErrorMissingAddress, hex.EncodeToString(myPubkey))
+		}
+	}
+
+	return &AttestClient{
+		MainClient:      config.MainClient(),
+		MainChainCfg:    config.MainChainCfg(),
+		Fees:            NewAttestFees(config.FeesConfig(), NewFeeEstimator(config)),
+		txid0:           config.InitTx(),
+		pubkeysExtended: pubkeysExtended,
+		pubkey:          nil,
+		chaincode:       nil,
+		numOfSigs:       numOfSigs,
+		addrTopup:       config.TopupAddress(),
+		WalletPriv:      wif,
+		WalletPrivTopup: wifTopup,
+		WalletChainCode: walletChaincode}
+}
+
 // Return new AttestClient instance for the non multisig case
 // Any multisig related parameters are irrelevant and set to nil
 func newNonMultisigAttestClient(config *confpkg.Config, isSigner bool, wif *btcutil.WIF, wifTopup *btcutil.WIF) *AttestClient {
@@ -143,13 +236,14 @@ func newNonMultisigAttestClient(config *confpkg.Config, isSigner bool, wif *btcu
 	return &AttestClient{
 		MainClient:      config.MainClient(),
 		MainChainCfg:    config.MainChainCfg(),
-		Fees:            NewAttestFees(config.FeesConfig()),
+		Fees:            NewAttestFees(config.FeesConfig(), NewFeeEstimator(config)),
 		txid0:           config.InitTx(),
 		pubkeysExtended: nil,
 		pubkey:          publickey,
 		chaincode:       chaincode,
 		numOfSigs:       1,
 		addrTopup:       config.TopupAddress(),
+		taproot:         config.Taproot(),
 		WalletPriv:      wif,
 		WalletPrivTopup: wifTopup,
 		WalletChainCode: chaincode}
@@ -174,7 +268,8 @@ func NewAttestClient(config *confpkg.Config, signerFlag ...bool) *AttestClient {
 		if importErr != nil {
 			log.Warnf("%s (%s)\n%v\n", WarningFailureImportingTopupAddress, topupAddrStr, importErr)
 		}
-		pkWifTopup = parseTopupKeys(config, isSigner)
+		// topup key also required for fee-only child transactions in the cpfp case
+		pkWifTopup = parseTopupKeys(config, isSigner || config.FeesConfig().BumpStrategy == FeeBumpCPFP)
 	} else {
 		log.Warnln(WarningTopupInfoMissing)
 	}
@@ -182,6 +277,12 @@ func NewAttestClient(config *confpkg.Config, signerFlag ...bool) *AttestClient {
 	// main config
 	var pkWif = parseMainKeys(config, isSigner)
 
+	if config.InitScript() != "" {
+		if config.Taproot() {
+			log.Error(ErrorTaprootMultisig)
+		}
+		return newMultisigAttestClient(config, isSigner, pkWif, pkWifTopup)
+	}
 	return newNonMultisigAttestClient(config, isSigner, pkWif, pkWifTopup)
 }
 
@@ -195,6 +296,12 @@ func (w *AttestClient) GetNextAttestationKey(hash chainhash.Hash) (*btcutil.WIF,
 		return nil, nil
 	}
 
+	// taproot key path spending key tweaked with the commitment
+	if w.taproot {
+		return btcutil.NewWIF(crypto.TweakTaprootPrivKey(w.WalletPriv.PrivKey, hash.CloneBytes()),
+			w.MainChainCfg, w.WalletPriv.CompressPubKey)
+	}
+
 	// get extended key from wallet priv to do tweaking
 	// pseudo bip-32 child derivation to do priv key tweaking
 	// fields except key/chain code are irrelevant for child derivation
@@ -223,11 +330,70 @@ func (w *AttestClient) GetNextAttestationKey(hash chainhash.Hash) (*btcutil.WIF,
 	return tweakedWalletPriv, nil
 }
 
+// Return whether the attestation client is used for a multisig staychain
+func (w *AttestClient) isMultisig() bool {
+	return len(w.pubkeysExtended) > 0
+}
+
+// Return whether the attestation client is used for a taproot staychain
+func (w *AttestClient) isTaproot() bool {
+	return w.taproot
+}
+
+// Tweak extended pubkeys with the commitment hash provided
+// The base pubkeys are returned for the zero hash of the initial staychain tx
+func tweakPubkeys(pubkeysExtended []*hdkeychain.ExtendedKey, hash chainhash.Hash) ([]*btcec.PublicKey, error) {
+	isBase := hash.IsEqual(&chainhash.Hash{})
+	var tweakedPubs []*btcec.PublicKey
+	for _, pubkeyExtended := range pubkeysExtended {
+		tweakedKey := pubkeyExtended
+		if !isBase {
+			// pseudo bip-32 child derivation to do pub key tweaking
+			var tweakErr error
+			tweakedKey, tweakErr = crypto.TweakExtendedKey(pubkeyExtended, hash.CloneBytes())
+			if tweakErr != nil {
+				return nil, tweakErr
+			}
+		}
+		tweakedPub, tweakPubErr := tweakedKey.ECPubKey()
+		if tweakPubErr != nil {
+			return nil, tweakPubErr
+		}
+		tweakedPubs = append(tweakedPubs, tweakedPub)
+	}
+	return tweakedPubs, nil
+}
+
+// Get next multisig attestation P2WSH address and redeem script by
+// tweaking the multisig base pubkeys with the commitment hash provided
+func (w *AttestClient) GetNextAttestationScript(hash chainhash.Hash) (btcutil.Address, string, error) {
+	tweakedPubs, tweakErr := tweakPubkeys(w.pubkeysExtended, hash)
+	if tweakErr != nil {
+		return nil, "", tweakErr
+	}
+	multisigAddr, redeemScript := crypto.CreateMultisigWitness(tweakedPubs, w.numOfSigs, w.MainChainCfg)
+	return multisigAddr, redeemScript, nil
+}
+
 // Get next attestation address using the commitment hash provided
 // In case of single key - attest client signer case the privkey is used
+// In the multisig case the tweaked multisig P2WSH address is always used
+// In the taproot case the P2TR address of the pubkey tap tweaked with
+// the commitment is always used
 // TODO: error handling
 func (w *AttestClient) GetNextAttestationAddr(key *btcutil.WIF, hash chainhash.Hash) (
-	*btcutil.AddressWitnessPubKeyHash, error) {
+	btcutil.Address, error) {
+	if w.isMultisig() {
+		multisigAddr, _, multisigErr := w.GetNextAttestationScript(hash)
+		return multisigAddr, multisigErr
+	}
+	if w.isTaproot() {
+		taprootAddr, taprootErr := crypto.GetTaprootAddress(w.pubkey, hash.CloneBytes(), w.MainChainCfg)
+		if taprootErr != nil {
+			return nil, taprootErr
+		}
+		return taprootAddr, nil
+	}
 	if key == nil {
 		pubkeyExtended := hdkeychain.NewExtendedKey([]byte{}, w.pubkey.SerializeCompressed(), w.WalletChainCode, []byte{}, 0, 0, false)
 		tweakedKey, tweakErr := crypto.TweakExtendedKey(pubkeyExtended, hash.CloneBytes())
@@ -306,8 +472,16 @@ func (w *AttestClient) createAttestation(paytoaddr btcutil.Address, unspent []bt
 	// TODO: ? - currently only set RBF flag for attestation vin
 	msgTx.TxIn[0].Sequence = uint32(math.Pow(2, float64(32))) - 3
 
+	// add anchor output for fee-only child transactions in the cpfp case
+	if w.Fees.BumpStrategy() == FeeBumpCPFP {
+		if anchorErr := w.addAnchorOutput(msgTx); anchorErr != nil {
+			return nil, anchorErr
+		}
+	}
+
 	// return error if txout value is less than maxFee target
-	maxFee := calcSignedTxFee(w.Fees.maxFee)
+	vsize := w.estimateSignedTxVsize(msgTx)
+	maxFee := calcSignedTxFee(w.Fees.maxFee, vsize)
 	if msgTx.TxOut[0].Value < 5*maxFee {
 		return nil, errors.New(ErrorInsufficientFunds)
 	}
@@ -319,12 +493,226 @@ func (w *AttestClient) createAttestation(paytoaddr btcutil.Address, unspent []bt
 
 	// add fees using best fee-per-byte estimate
 	feePerByte := w.Fees.GetFee()
-	fee := calcSignedTxFee(feePerByte)
+	fee := calcSignedTxFee(feePerByte, vsize)
+	msgTx.TxOut[0].Value -= fee
+
+	return msgTx, nil
+}
+
+// Add anchor output paying to the topup address to an attestation transaction
+// The anchor output can be spent by the topup key before the attestation is
+// confirmed, in order to bump the attestation fee with a fee-only child
+func (w *AttestClient) addAnchorOutput(msgTx *wire.MsgTx) error {
+	if w.addrTopup == "" {
+		log.Warnln(WarningTopupInfoMissing)
+		return nil
+	}
+	topupAddr, topupAddrErr := btcutil.DecodeAddress(w.addrTopup, w.MainChainCfg)
+	if topupAddrErr != nil {
+		return topupAddrErr
+	}
+	topupScript, topupScriptErr := txscript.PayToAddrScript(topupAddr)
+	if topupScriptErr != nil {
+		return topupScriptErr
+	}
+	msgTx.TxOut[0].Value -= anchorValue
+	msgTx.AddTxOut(wire.NewTxOut(anchorValue, topupScript))
+	return nil
+}
+
+// Create new child attestation transaction spending the attestation output of
+// an unconfirmed parent attestation and paying to the tweaked address provided
+// The child fee pays for all unconfirmed ancestors at the incremented fee, so
+// that the parent attestation is confirmed along with the child (child-pays-for-parent)
+func (w *AttestClient) createChildAttestation(paytoaddr btcutil.Address, parentTx *wire.MsgTx, isFeeBumped bool) (
+	*wire.MsgTx, error) {
+
+	parentTxid := parentTx.TxHash()
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&parentTxid, 0), nil, nil))
+
+	paytoaddrScript, err := txscript.PayToAddrScript(paytoaddr)
+	if err != nil {
+		return nil, err
+	}
+	msgTx.AddTxOut(wire.NewTxOut(parentTx.TxOut[0].Value, paytoaddrScript))
+
+	// set replace-by-fee flag
+	msgTx.TxIn[0].Sequence = uint32(math.Pow(2, float64(32))) - 3
+
+	// add anchor output for further fee-only child transactions
+	if anchorErr := w.addAnchorOutput(msgTx); anchorErr != nil {
+		return nil, anchorErr
+	}
+
+	// return error if txout value is less than maxFee target
+	vsize := w.estimateSignedTxVsize(msgTx)
+	if msgTx.TxOut[0].Value < 5*calcSignedTxFee(w.Fees.maxFee, vsize) {
+		return nil, errors.New(ErrorInsufficientFunds)
+	}
+
+	// bump fees unless already bumped in a previous attempt
+	if !isFeeBumped {
+		w.Fees.BumpFee()
+	}
+	fee, feeErr := w.calcChildFee(parentTxid, vsize)
+	if feeErr != nil {
+		return nil, feeErr
+	}
 	msgTx.TxOut[0].Value -= fee
 
 	return msgTx, nil
 }
 
+// Create new fee-only child transaction spending the anchor output of an
+// unconfirmed parent attestation along with all topup unspents, paying back
+// to the topup address. The transaction is signed with the topup private key
+// or by the topup signer, and does not require any signatures from the
+// attestation signers
+// A previous fee-only child of the same parent is replaced by fee (BIP125),
+// spending the same inputs along with any new topup unspents and paying at
+// least the previous child fee plus the min relay fee increment
+// The fee paid by the child transaction is returned along with it
+func (w *AttestClient) createFeeChild(parentTx *wire.MsgTx, prevChildTx *wire.MsgTx) (*wire.MsgTx, int64, error) {
+	if w.WalletPrivTopup == nil && w.TopupSigner == nil {
+		return nil, 0, errors.New(ErrorTopupKeyMissing)
+	}
+	topupAddr, topupAddrErr := btcutil.DecodeAddress(w.addrTopup, w.MainChainCfg)
+	if topupAddrErr != nil {
+		return nil, 0, topupAddrErr
+	}
+	topupScript, topupScriptErr := txscript.PayToAddrScript(topupAddr)
+	if topupScriptErr != nil {
+		return nil, 0, topupScriptErr
+	}
+	if len(parentTx.TxOut) < 2 || !bytes.Equal(parentTx.TxOut[1].PkScript, topupScript) {
+		return nil, 0, errors.New(ErrorAnchorMissing)
+	}
+
+	// spend parent anchor output first so that the child is not part of the subchain
+	parentTxid := parentTx.TxHash()
+	anchorOutPoint := wire.NewOutPoint(&parentTxid, 1)
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(anchorOutPoint, nil, nil))
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	prevOuts.AddPrevOut(*anchorOutPoint, parentTx.TxOut[1])
+	totalAmount := parentTx.TxOut[1].Value
+
+	// re-spend topup inputs of the previous child of the same parent
+	var prevChildFee int64
+	isReplacement := prevChildTx != nil && len(prevChildTx.TxIn) > 0 &&
+		prevChildTx.TxIn[0].PreviousOutPoint == *anchorOutPoint
+	if isReplacement {
+		prevChildOuts, prevChildOutsErr := w.getPrevOuts(prevChildTx)
+		if prevChildOutsErr != nil {
+			return nil, 0, prevChildOutsErr
+		}
+		prevChildFee = parentTx.TxOut[1].Value - prevChildTx.TxOut[0].Value
+		for i, txIn := range prevChildTx.TxIn[1:] {
+			msgTx.AddTxIn(wire.NewTxIn(&txIn.PreviousOutPoint, nil, nil))
+			prevOuts.AddPrevOut(txIn.PreviousOutPoint, prevChildOuts[i+1])
+			totalAmount += prevChildOuts[i+1].Value
+			prevChildFee += prevChildOuts[i+1].Value
+		}
+		log.Infof("*Client* replacing fee-only child: %s\n", prevChildTx.TxHash().String())
+	}
+
+	// add topup unspents to pay for the child fee
+	topupUnspents, topupUnspentsErr := w.findTopupUnspents()
+	if topupUnspentsErr != nil {
+		return nil, 0, topupUnspentsErr
+	}
+	for _, topupUnspent := range topupUnspents {
+		log.Infof("*Client* found topup unspent: %s\n", topupUnspent.TxID)
+		topupHash, hashErr := chainhash.NewHashFromStr(topupUnspent.TxID)
+		if hashErr != nil {
+			return nil, 0, hashErr
+		}
+		topupIn := wire.NewTxIn(wire.NewOutPoint(topupHash, topupUnspent.Vout), nil, nil)
+		if prevOuts.FetchPrevOutput(topupIn.PreviousOutPoint) != nil ||
+			(isReplacement && *topupHash == prevChildTx.TxHash()) {
+			continue // spent or paid by the previous child
+		}
+		msgTx.AddTxIn(topupIn)
+		topupAmount := int64(math.Round(topupUnspent.Amount * Coin))
+		prevOuts.AddPrevOut(topupIn.PreviousOutPoint, wire.NewTxOut(topupAmount, topupScript))
+		totalAmount += topupAmount
+	}
+
+	// set replace-by-fee flag on all inputs
+	for _, txIn := range msgTx.TxIn {
+		txIn.Sequence = wire.MaxTxInSequenceNum - 2
+	}
+
+	// all inputs are signed by the topup key
+	msgTx.AddTxOut(wire.NewTxOut(totalAmount, topupScript))
+	witness := make([]wire.TxWitness, len(msgTx.TxIn))
+	for i := range witness {
+		witness[i] = keyWitnessTemplate()
+	}
+	vsize := estimateVsize(msgTx, witness)
+	fee, feeErr := w.calcChildFee(parentTxid, vsize)
+	if feeErr != nil {
+		return nil, 0, feeErr
+	}
+	if isReplacement && fee < prevChildFee+MinRelayFeeIncrement*vsize {
+		fee = prevChildFee + MinRelayFeeIncrement*vsize
+	}
+	if totalAmount-fee < dustValue {
+		return nil, 0, errors.New(ErrorInsufficientTopupFunds)
+	}
+	msgTx.TxOut[0].Value = totalAmount - fee
+
+	// sign all inputs with the topup key
+	sigHashes := txscript.NewTxSigHashes(msgTx, prevOuts)
+	for i, txIn := range msgTx.TxIn {
+		prevOut := prevOuts.FetchPrevOutput(txIn.PreviousOutPoint)
+		sigHash, sigHashErr := txscript.CalcWitnessSigHash(prevOut.PkScript, sigHashes, txscript.SigHashAll,
+			msgTx, i, prevOut.Value)
+		if sigHashErr != nil {
+			return nil, 0, sigHashErr
+		}
+		witness, signErr := w.signTopup(sigHash)
+		if signErr != nil {
+			return nil, 0, signErr
+		}
+		msgTx.TxIn[i].Witness = witness
+	}
+
+	return msgTx, fee, nil
+}
+
+// Return witness of the topup key signature of the sighash provided
+// signed with the topup key of the config or by the topup signer
+func (w *AttestClient) signTopup(sigHash []byte) (wire.TxWitness, error) {
+	if w.WalletPrivTopup == nil {
+		return w.TopupSigner.SignTopup(sigHash)
+	}
+	sig := ecdsa.Sign(w.WalletPrivTopup.PrivKey, sigHash)
+	return wire.TxWitness{append(sig.Serialize(), byte(1)),
+		w.WalletPrivTopup.PrivKey.PubKey().SerializeCompressed()}, nil
+}
+
+// Calculate the fee of a child transaction of vsize childSize spending the
+// unconfirmed parent transaction provided, so that the child and all of the
+// unconfirmed ancestors in the mempool are paid at the current fee per byte
+func (w *AttestClient) calcChildFee(parentTxid chainhash.Hash, childSize int64) (int64, error) {
+	parentEntry, entryErr := w.MainClient.GetMempoolEntry(parentTxid.String())
+	if entryErr != nil {
+		return 0, entryErr
+	}
+	feePerByte := int64(w.Fees.GetFee())
+	ancestorFee := int64(math.Round(parentEntry.Fees.Ancestor * Coin))
+	fee := feePerByte*(parentEntry.AncestorSize+childSize) - ancestorFee
+
+	// child always pays at least its own fee
+	if fee < feePerByte*childSize {
+		fee = feePerByte * childSize
+	}
+	log.Infof("*Client* child fee for %d unconfirmed ancestors: %d\n", parentEntry.AncestorCount, fee)
+	return fee, nil
+}
+
 // Create new attestation transaction by removing sigs and
 // bumping fee of existing transaction with incremented fee
 // The latest fee is fetched from the AttestFees API, which
@@ -346,23 +734,100 @@ func (w *AttestClient) bumpAttestationFees(msgTx *wire.MsgTx, isFeeBumped bool)
 	feePerByteIncrement := w.Fees.GetFee() - prevFeePerByte
 
 	// increase tx fees by fee difference
-	feeIncrement := calcSignedTxFee(feePerByteIncrement)
+	feeIncrement := calcSignedTxFee(feePerByteIncrement, w.estimateSignedTxVsize(msgTx))
 	msgTx.TxOut[0].Value -= feeIncrement
 
 	return nil
 }
 
-// Calculate the actual fee of an unsigned transaction by taking into consideration
-// the size of the script and the number of signatures required and calculating the
-// aggregated transaction size with the fee per byte provided
-func calcSignedTxFee(feePerByte int) int64 {
-	return int64(feePerByte * signedTxSize)
+// Calculate the actual fee of an unsigned transaction of the estimated
+// virtual size of the signed transaction with the fee per byte provided
+func calcSignedTxFee(feePerByte int, vsize int64) int64 {
+	return int64(feePerByte) * vsize
+}
+
+// Estimate the virtual size of an attestation transaction once signed
+// The witness of the attestation input depends on the staychain type,
+// while topup inputs are P2WPKH inputs signed by the topup key
+func (w *AttestClient) estimateSignedTxVsize(msgTx *wire.MsgTx) int64 {
+	witness := make([]wire.TxWitness, len(msgTx.TxIn))
+	for i := range witness {
+		witness[i] = keyWitnessTemplate()
+	}
+	if len(witness) > 0 {
+		witness[0] = w.attestationWitnessTemplate()
+	}
+	return estimateVsize(msgTx, witness)
+}
+
+// Estimate the virtual size of a signed attestation transaction with the
+// number of inputs provided paying to the staychain attestation output
+// and the anchor output in the cpfp case
+func (w *AttestClient) estimateAttestationVsize(numOfInputs int) int64 {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	for i := 0; i < numOfInputs; i++ {
+		msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	}
+
+	// P2WSH and P2TR outputs pay to a 32 byte program, P2WPKH to 20 bytes
+	programSize := 20
+	if w.isMultisig() || w.isTaproot() {
+		programSize = 32
+	}
+	msgTx.AddTxOut(wire.NewTxOut(0, make([]byte, 2+programSize)))
+	if w.Fees.BumpStrategy() == FeeBumpCPFP && w.addrTopup != "" {
+		msgTx.AddTxOut(wire.NewTxOut(anchorValue, make([]byte, 22)))
+	}
+	return w.estimateSignedTxVsize(msgTx)
+}
+
+// Return witness template of the attestation input with items of the
+// maximum size of the signatures, pubkeys and scripts of the staychain
+func (w *AttestClient) attestationWitnessTemplate() wire.TxWitness {
+	if w.isTaproot() {
+		return wire.TxWitness{make([]byte, witnessSchnorrSize)}
+	}
+	if w.isMultisig() {
+		// empty item, m signatures and m-of-n redeem script
+		witness := wire.TxWitness{[]byte{}}
+		for i := 0; i < w.numOfSigs; i++ {
+			witness = append(witness, make([]byte, witnessSigSize))
+		}
+		return append(witness, make([]byte, 3+len(w.pubkeysExtended)*(1+witnessPubkeySize)))
+	}
+	return keyWitnessTemplate()
+}
+
+// Return witness template of a P2WPKH input
+func keyWitnessTemplate() wire.TxWitness {
+	return wire.TxWitness{make([]byte, witnessSigSize), make([]byte, witnessPubkeySize)}
+}
+
+// Estimate the virtual size of a transaction with the witness provided
+// for each input, where witness bytes are discounted by the witness scale
+func estimateVsize(msgTx *wire.MsgTx, witness []wire.TxWitness) int64 {
+	signedTx := msgTx.Copy()
+	for i := range signedTx.TxIn {
+		signedTx.TxIn[i].SignatureScript = nil
+		signedTx.TxIn[i].Witness = nil
+		if i < len(witness) {
+			signedTx.TxIn[i].Witness = witness[i]
+		}
+	}
+	weight := int64(signedTx.SerializeSizeStripped()*(witnessScaleFactor-1) + signedTx.SerializeSize())
+	return (weight + witnessScaleFactor - 1) / witnessScaleFactor
 }
 
 // Given a commitment hash return the corresponding client private key tweaked
 // This method should only be used in the attestation client signer case
 // Error handling excluded here as method is only for testing purposes
 func (w *AttestClient) GetKeyFromHash(hash chainhash.Hash) *btcutil.WIF {
+	if w.isTaproot() {
+		// taproot key path spending key tweaked with the commitment
+		tweakedKey, _ := btcutil.NewWIF(crypto.TweakTaprootPrivKey(w.WalletPriv.PrivKey, hash.CloneBytes()),
+			w.MainChainCfg, w.WalletPriv.CompressPubKey)
+		return tweakedKey
+	}
 	if !hash.IsEqual(&chainhash.Hash{}) {
 		// get extended key from wallet priv to do tweaking
 		// pseudo bip-32 child derivation to do priv key tweaking
@@ -422,19 +887,28 @@ func (w *AttestClient) SignTransaction(hash chainhash.Hash, msgTx wire.MsgTx) (
         return nil, errors.New(ErrorInputMissingForTx)
     }
 
-	sigHashes, err := w.calculateSighashes(&msgTx)
+	sigHashes, err := w.calculateSighashes(&msgTx, hash)
 	if err != nil {
 		log.Infof("Sighash err %v", err)
 	}
-	sig := ecdsa.Sign(key.PrivKey, sigHashes[0])
-	sigBytes := append(sig.Serialize(), []byte{byte(1)}...)
-	msgTx.TxIn[0].Witness = wire.TxWitness{sigBytes, key.PrivKey.PubKey().SerializeCompressed()}
+	if w.isTaproot() {
+		// schnorr key path spend with explicit sighash all type
+		sig, sigErr := schnorr.Sign(key.PrivKey, sigHashes[0])
+		if sigErr != nil {
+			return nil, sigErr
+		}
+		msgTx.TxIn[0].Witness = wire.TxWitness{append(sig.Serialize(), []byte{byte(1)}...)}
+	} else {
+		sig := ecdsa.Sign(key.PrivKey, sigHashes[0])
+		sigBytes := append(sig.Serialize(), []byte{byte(1)}...)
+		msgTx.TxIn[0].Witness = wire.TxWitness{sigBytes, key.PrivKey.PubKey().SerializeCompressed()}
+	}
 
-    if len(msgTx.TxIn) > 1 {
-		sig = ecdsa.Sign(w.WalletPrivTopup.PrivKey, sigHashes[1])
-		sigBytes = append(sig.Serialize(), []byte{byte(1)}...)
-		msgTx.TxIn[1].Witness = wire.TxWitness{sigBytes, w.WalletPrivTopup.PrivKey.PubKey().SerializeCompressed()}
-    }
+	for i := 1; i < len(msgTx.TxIn); i++ {
+		sig := ecdsa.Sign(w.WalletPrivTopup.PrivKey, sigHashes[i])
+		sigBytes := append(sig.Serialize(), []byte{byte(1)}...)
+		msgTx.TxIn[i].Witness = wire.TxWitness{sigBytes, w.WalletPrivTopup.PrivKey.PubKey().SerializeCompressed()}
+	}
 
     return &msgTx, nil
 }
@@ -457,38 +931,210 @@ func (w *AttestClient) signAttestation(msgtx *wire.MsgTx, witness []wire.TxWitne
 		for i := 0; i < len(msgtx.TxIn) && i < len(witness); i++ {
 			signedMsgTx.TxIn[i].Witness = witness[i]
 		}
+		// taproot key path witness consists of the signature only
+		if w.isTaproot() && len(witness) > 0 && len(witness[0]) > 0 {
+			signedMsgTx.TxIn[0].Witness = wire.TxWitness{witness[0][0]}
+		}
 	}
 	return signedMsgTx, nil
 }
 
-func (w *AttestClient) calculateSighashes(msgTx *wire.MsgTx) ([][]byte, error) {
+// Verify the witness received from a signer for each transaction input
+// Signatures are verified against the sighash of each input, while the pubkeys
+// must match the keys tweaked with the commitment hash for the attestation
+// input and the topup address for any remaining topup input
+func (w *AttestClient) verifyWitness(witness []wire.TxWitness, sigHashes [][]byte, hash chainhash.Hash,
+	signer string) error {
+	for i, sigHash := range sigHashes {
+		if i >= len(witness) || len(witness[i]) == 0 {
+			return &AttestSignerError{signer, i, ErrorSigsMissingForVin}
+		}
+		var verifyErr error
+		if i > 0 {
+			verifyErr = verifyTopupWitness(witness[i], sigHash, w.addrTopup, w.MainChainCfg)
+		} else if w.isMultisig() {
+			verifyErr = w.verifyMultisigWitness(witness[i], sigHash, hash)
+		} else if w.isTaproot() {
+			verifyErr = w.verifyTaprootWitness(witness[i], sigHash, hash)
+		} else {
+			verifyErr = w.verifyKeyWitness(witness[i], sigHash, hash)
+		}
+		if verifyErr != nil {
+			return &AttestSignerError{signer, i, verifyErr.Error()}
+		}
+	}
+	return nil
+}
 
-	var sigHashesBytes [][]byte
-	prevTxId := msgTx.TxIn[0].PreviousOutPoint.Hash
-    prevTx, prevTxErr := w.MainClient.GetRawTransaction(&prevTxId)
-    if prevTxErr != nil {
-		return nil, prevTxErr
-    }
-	txOut := wire.NewTxOut(prevTx.MsgTx().TxOut[0].Value, prevTx.MsgTx().TxOut[0].PkScript)
-    a := txscript.NewCannedPrevOutputFetcher(txOut.PkScript, txOut.Value)
-    sigHashes := txscript.NewTxSigHashes(msgTx, a)
-	sigHashBytes, err := txscript.CalcWitnessSigHash(txOut.PkScript, sigHashes, txscript.SigHashAll, msgTx, 0, txOut.Value)
-	if err != nil {
-		return nil, err
+// Verify single key witness of the attestation input against the
+// client pubkey tweaked with the commitment hash provided
+func (w *AttestClient) verifyKeyWitness(witness wire.TxWitness, sigHash []byte, hash chainhash.Hash) error {
+	pubkey, sigErr := verifySigWitness(witness, sigHash)
+	if sigErr != nil {
+		return sigErr
+	}
+	pubkeyExtended := hdkeychain.NewExtendedKey([]byte{}, w.pubkey.SerializeCompressed(), w.WalletChainCode, []byte{}, 0, 0, false)
+	tweakedPubs, tweakErr := tweakPubkeys([]*hdkeychain.ExtendedKey{pubkeyExtended}, hash)
+	if tweakErr != nil {
+		return tweakErr
+	}
+	if !bytes.Equal(tweakedPubs[0].SerializeCompressed(), pubkey.SerializeCompressed()) {
+		return errors.New(ErrorSignerPubkey)
 	}
-	sigHashesBytes = append(sigHashesBytes, sigHashBytes)
+	return nil
+}
 
-	if len(msgTx.TxIn) > 1 {
-		topupTxId := msgTx.TxIn[1].PreviousOutPoint.Hash
-		topupTxIndex := msgTx.TxIn[1].PreviousOutPoint.Index
-		topupTx, topupTxErr := w.MainClient.GetRawTransaction(&topupTxId)
-		if topupTxErr != nil {
-			return nil, topupTxErr
-		}
-		topupTxOut := wire.NewTxOut(topupTx.MsgTx().TxOut[topupTxIndex].Value, topupTx.MsgTx().TxOut[topupTxIndex].PkScript)
-        a = txscript.NewCannedPrevOutputFetcher(topupTxOut.PkScript, topupTxOut.Value)
-		sigHashes = txscript.NewTxSigHashes(msgTx, a)
-		sigHashBytes, err = txscript.CalcWitnessSigHash(topupTxOut.PkScript, sigHashes, txscript.SigHashAll, msgTx, 1, topupTxOut.Value)
+// Verify taproot witness of the attestation input consisting of a schnorr
+// signature with sighash all type and the pubkey, which must be the taproot
+// output key of the client pubkey tweaked with the commitment hash provided
+// Pubkeys are accepted either in x-only or in compressed format
+func (w *AttestClient) verifyTaprootWitness(witness wire.TxWitness, sigHash []byte, hash chainhash.Hash) error {
+	if len(witness) != 2 || len(witness[0]) != schnorr.SignatureSize+1 ||
+		witness[0][schnorr.SignatureSize] != byte(txscript.SigHashAll) {
+		return errors.New(ErrorSignerWitness)
+	}
+	pubkeyBytes := witness[1]
+	if len(pubkeyBytes) == btcec.PubKeyBytesLenCompressed {
+		pubkeyBytes = pubkeyBytes[1:]
+	}
+	outputKey := crypto.GetTaprootOutputKey(w.pubkey, hash.CloneBytes())
+	if !bytes.Equal(schnorr.SerializePubKey(outputKey), pubkeyBytes) {
+		return errors.New(ErrorSignerPubkey)
+	}
+	sig, sigErr := schnorr.ParseSignature(witness[0][:schnorr.SignatureSize])
+	if sigErr != nil {
+		return errors.New(ErrorSignerWitness)
+	}
+	if !sig.Verify(sigHash, outputKey) {
+		return errors.New(ErrorSignerSig)
+	}
+	return nil
+}
+
+// Verify multisig witness of the attestation input consisting of an empty
+// element, the signatures in the order of the pubkeys and the redeem script
+// The redeem script must be the multisig tweaked with the commitment hash
+func (w *AttestClient) verifyMultisigWitness(witness wire.TxWitness, sigHash []byte, hash chainhash.Hash) error {
+	if len(witness) != w.numOfSigs+2 || len(witness[0]) != 0 {
+		return errors.New(ErrorSignerWitness)
+	}
+	tweakedPubs, tweakErr := tweakPubkeys(w.pubkeysExtended, hash)
+	if tweakErr != nil {
+		return tweakErr
+	}
+	_, redeemScript := crypto.CreateMultisig(tweakedPubs, w.numOfSigs, w.MainChainCfg)
+	if hex.EncodeToString(witness[len(witness)-1]) != redeemScript {
+		return errors.New(ErrorSignerRedeemScript)
+	}
+
+	// each signature must match one of the remaining pubkeys in order
+	pubIndex := 0
+	for _, sigBytes := range witness[1 : len(witness)-1] {
+		if len(sigBytes) < 2 {
+			return errors.New(ErrorSignerWitness)
+		}
+		sig, sigErr := ecdsa.ParseDERSignature(sigBytes[:len(sigBytes)-1])
+		if sigErr != nil {
+			return errors.New(ErrorSignerWitness)
+		}
+		for pubIndex < len(tweakedPubs) && !sig.Verify(sigHash, tweakedPubs[pubIndex]) {
+			pubIndex++
+		}
+		if pubIndex >= len(tweakedPubs) {
+			return errors.New(ErrorSignerSig)
+		}
+		pubIndex++
+	}
+	return nil
+}
+
+// Verify witness of a topup input against the topup address provided
+func verifyTopupWitness(witness wire.TxWitness, sigHash []byte, addrTopup string, chainCfg *chaincfg.Params) error {
+	pubkey, sigErr := verifySigWitness(witness, sigHash)
+	if sigErr != nil {
+		return sigErr
+	}
+	addr, addrErr := crypto.GetAddressFromPubKey(pubkey, chainCfg)
+	if addrErr != nil || addr.String() != addrTopup {
+		return errors.New(ErrorSignerTopupPubkey)
+	}
+	return nil
+}
+
+// Verify a signature / pubkey witness against the sighash provided
+// and return the pubkey of the witness if the signature is valid
+func verifySigWitness(witness wire.TxWitness, sigHash []byte) (*btcec.PublicKey, error) {
+	if len(witness) != 2 || len(witness[0]) < 2 {
+		return nil, errors.New(ErrorSignerWitness)
+	}
+	pubkey, pubkeyErr := btcec.ParsePubKey(witness[1])
+	if pubkeyErr != nil {
+		return nil, errors.New(ErrorSignerWitness)
+	}
+	// remove sighash type byte before parsing
+	sig, sigErr := ecdsa.ParseDERSignature(witness[0][:len(witness[0])-1])
+	if sigErr != nil {
+		return nil, errors.New(ErrorSignerWitness)
+	}
+	if !sig.Verify(sigHash, pubkey) {
+		return nil, errors.New(ErrorSignerSig)
+	}
+	return pubkey, nil
+}
+
+// Fetch the previous outputs spent by each of the transaction inputs
+func (w *AttestClient) getPrevOuts(msgTx *wire.MsgTx) ([]*wire.TxOut, error) {
+	prevOuts := make([]*wire.TxOut, len(msgTx.TxIn))
+	for i, txIn := range msgTx.TxIn {
+		prevTx, prevTxErr := w.MainClient.GetRawTransaction(&txIn.PreviousOutPoint.Hash)
+		if prevTxErr != nil {
+			return nil, prevTxErr
+		}
+		if int(txIn.PreviousOutPoint.Index) >= len(prevTx.MsgTx().TxOut) {
+			return nil, errors.New(ErrorInputMissingForTx)
+		}
+		prevOut := prevTx.MsgTx().TxOut[txIn.PreviousOutPoint.Index]
+		prevOuts[i] = wire.NewTxOut(prevOut.Value, prevOut.PkScript)
+	}
+	return prevOuts, nil
+}
+
+// Calculate the sighash of each transaction input, using the commitment hash
+// provided to generate the tweaked redeem script of the first input in the
+// multisig case, as the redeem script is the script code of P2WSH inputs
+// In the taproot case the BIP-341 sighash of the first input is calculated,
+// which commits to the previous outputs of all transaction inputs
+func (w *AttestClient) calculateSighashes(msgTx *wire.MsgTx, hash chainhash.Hash) ([][]byte, error) {
+
+	// fetch previous outputs of all inputs
+	prevOuts, prevOutsErr := w.getPrevOuts(msgTx)
+	if prevOutsErr != nil {
+		return nil, prevOutsErr
+	}
+	prevOutFetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for i, txIn := range msgTx.TxIn {
+		prevOutFetcher.AddPrevOut(txIn.PreviousOutPoint, prevOuts[i])
+	}
+	sigHashes := txscript.NewTxSigHashes(msgTx, prevOutFetcher)
+
+	var sigHashesBytes [][]byte
+	for i, prevOut := range prevOuts {
+		var sigHashBytes []byte
+		var err error
+		if i == 0 && w.isTaproot() {
+			sigHashBytes, err = txscript.CalcTaprootSignatureHash(sigHashes, txscript.SigHashAll, msgTx, 0, prevOutFetcher)
+		} else {
+			// topup inputs and attestation input in the P2WPKH / P2WSH case
+			scriptCode := prevOut.PkScript
+			if i == 0 && w.isMultisig() {
+				_, redeemScript, scriptErr := w.GetNextAttestationScript(hash)
+				if scriptErr != nil {
+					return nil, scriptErr
+				}
+				scriptCode, _ = hex.DecodeString(redeemScript)
+			}
+			sigHashBytes, err = txscript.CalcWitnessSigHash(scriptCode, sigHashes, txscript.SigHashAll, msgTx, i, prevOut.Value)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -516,6 +1162,41 @@ func (w *AttestClient) sendAttestation(msgtx *wire.MsgTx) (chainhash.Hash, error
 	return *txhash, nil
 }
 
+// testmempoolaccept rpc result for a single transaction
+type testMempoolAcceptResult struct {
+	Txid         string `json:"txid"`
+	Allowed      bool   `json:"allowed"`
+	RejectReason string `json:"reject-reason"`
+}
+
+// Test that a signed attestation would be accepted to the mempool
+// of the main client without broadcasting it to the network
+func (w *AttestClient) testAttestation(msgtx *wire.MsgTx) (chainhash.Hash, error) {
+	var buf bytes.Buffer
+	if err := msgtx.Serialize(&buf); err != nil {
+		return chainhash.Hash{}, err
+	}
+	rawTxs, _ := json.Marshal([]string{hex.EncodeToString(buf.Bytes())})
+
+	resp, errTest := w.MainClient.RawRequest("testmempoolaccept", []json.RawMessage{rawTxs})
+	if errTest != nil {
+		return chainhash.Hash{}, errTest
+	}
+	var results []testMempoolAcceptResult
+	if err := json.Unmarshal(resp, &results); err != nil {
+		return chainhash.Hash{}, err
+	}
+	if len(results) != 1 || !results[0].Allowed {
+		var rejectReason string
+		if len(results) > 0 {
+			rejectReason = results[0].RejectReason
+		}
+		return chainhash.Hash{}, errors.New(fmt.Sprintf("%s %s", ErrorTestMempoolAccept, rejectReason))
+	}
+
+	return msgtx.TxHash(), nil
+}
+
 // Verify that an unspent vout is on the tip of the subchain attestations
 func (w *AttestClient) verifyTxOnSubchain(txid chainhash.Hash) bool {
 	if txid.String() == w.txid0 { // genesis transaction
@@ -528,8 +1209,12 @@ func (w *AttestClient) verifyTxOnSubchain(txid chainhash.Hash) bool {
 			return false
 		}
 
-		prevtxid := txraw.MsgTx().TxIn[0].PreviousOutPoint.Hash
-		return w.verifyTxOnSubchain(prevtxid)
+		// attestations always spend the first output of the previous attestation
+		prevOutPoint := txraw.MsgTx().TxIn[0].PreviousOutPoint
+		if prevOutPoint.Index != 0 && prevOutPoint.Hash.String() != w.txid0 {
+			return false
+		}
+		return w.verifyTxOnSubchain(prevOutPoint.Hash)
 	}
 	return false
 }
@@ -541,6 +1226,10 @@ func (w *AttestClient) findLastUnspent() (bool, btcjson.ListUnspentResult, error
 		return false, btcjson.ListUnspentResult{}, err
 	}
 	for _, vout := range unspent {
+		// exclude anchor outputs of attestations paying to the topup address
+		if vout.Address == w.addrTopup && vout.TxID != w.txid0 {
+			continue
+		}
 		txhash, _ := chainhash.NewHashFromStr(vout.TxID)
 		if w.verifyTxOnSubchain(*txhash) {
 			//theoretically only one unspent vout, but check anyway
@@ -566,6 +1255,21 @@ func (w *AttestClient) findTopupUnspent() (bool, btcjson.ListUnspentResult, erro
 	return false, btcjson.ListUnspentResult{}, nil
 }
 
+// Find all unspent vouts for topup address specified in attestation client init
+func (w *AttestClient) findTopupUnspents() ([]btcjson.ListUnspentResult, error) {
+	unspent, err := w.MainClient.ListUnspent()
+	if err != nil {
+		return nil, err
+	}
+	var topupUnspents []btcjson.ListUnspentResult
+	for _, u := range unspent {
+		if u.Address == w.addrTopup && u.TxID != w.txid0 {
+			topupUnspents = append(topupUnspents, u)
+		}
+	}
+	return topupUnspents, nil
+}
+
 // Find any previously unconfirmed transactions in the client
 func (w *AttestClient) getUnconfirmedTx() (bool, chainhash.Hash, error) {
 	mempool, err := w.MainClient.GetRawMempool()
@@ -5,6 +5,8 @@
 package attestation
 
 import (
+	"bytes"
+	"encoding/hex"
 	"errors"
 	"math"
 	"testing"
@@ -14,8 +16,13 @@ import (
 	"mainstay/models"
 	testpkg "mainstay/test"
 
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/stretchr/testify/assert"
@@ -68,7 +75,7 @@ func verifyFirstUnspent(t *testing.T, client *AttestClient) btcjson.ListUnspentR
 }
 
 // verify key derivation and return address
-func verifyKeysAndAddr(t *testing.T, client *AttestClient, hash chainhash.Hash) (*btcutil.AddressWitnessPubKeyHash) {
+func verifyKeysAndAddr(t *testing.T, client *AttestClient, hash chainhash.Hash) btcutil.Address {
 	// test getting next attestation key
 	key, errKey := client.GetNextAttestationKey(hash)
 	assert.Equal(t, nil, errKey)
@@ -481,8 +488,8 @@ func TestAttestClient_FeeBumping(t *testing.T) {
 
 		newFee := client.Fees.GetFee()
 		newValue := tx2.TxOut[0].Value
-		newTxFee := calcSignedTxFee(newFee)
-		currentTxFee := calcSignedTxFee(currentFee)
+		newTxFee := calcSignedTxFee(newFee, client.estimateSignedTxVsize(tx2))
+		currentTxFee := calcSignedTxFee(currentFee, client.estimateSignedTxVsize(tx2))
 		assert.Equal(t, newTxFee-currentTxFee, currentValue+topupValue-newValue)
 		assert.Equal(t, client.Fees.minFee+client.Fees.feeIncrement, newFee)
 
@@ -522,20 +529,181 @@ func TestAttestClient_FeeBumping(t *testing.T) {
 // Test fee calculation for an unsigned transaction
 func TestAttestClient_feeCalculation(t *testing.T) {
 	feePerByte := 10
+	assert.Equal(t, int64(1100), calcSignedTxFee(feePerByte, 110))
+
+	client := &AttestClient{numOfSigs: 1, Fees: AttestFees{bumpStrategy: FeeBumpRBF}}
+	pkScript := make([]byte, 22)
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(0, pkScript))
+
+	// P2WPKH attestation input
+	assert.Equal(t, int64(110), client.estimateSignedTxVsize(msgTx))
+	assert.Equal(t, int64(110), client.estimateAttestationVsize(1))
+
+	// signed witness replaced by template
+	msgTx.TxIn[0].Witness = wire.TxWitness{make([]byte, 71), make([]byte, 33)}
+	assert.Equal(t, int64(110), client.estimateSignedTxVsize(msgTx))
+
+	// topup inputs discounted by the witness scale
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	assert.Equal(t, int64(178), client.estimateSignedTxVsize(msgTx))
+	assert.Equal(t, int64(178), client.estimateAttestationVsize(2))
+
+	// anchor output in the cpfp case
+	client.Fees.bumpStrategy = FeeBumpCPFP
+	client.addrTopup = testpkg.TopupAddress
+	assert.Equal(t, int64(141), client.estimateAttestationVsize(1))
+	client.Fees.bumpStrategy = FeeBumpRBF
+
+	// taproot key path signature
+	client.taproot = true
+	assert.Equal(t, int64(112), client.estimateAttestationVsize(1))
+	client.taproot = false
+
+	// 2-of-3 multisig signatures and redeem script
+	client.numOfSigs = 2
+	client.pubkeysExtended = make([]*hdkeychain.ExtendedKey, 3)
+	assert.Equal(t, int64(159), client.estimateAttestationVsize(1))
+	assert.Equal(t, 4, len(client.attestationWitnessTemplate()))
+	assert.Equal(t, 105, len(client.attestationWitnessTemplate()[3]))
+}
+
+// Test verification of signer witness for single key and multisig clients
+func TestAttestClient_VerifyWitness(t *testing.T) {
+	chainCfg := &chaincfg.RegressionNetParams
+	wif, _ := btcutil.DecodeWIF(testpkg.PrivMain)
+	wifTopup, _ := btcutil.DecodeWIF(testpkg.TopupPrivMain)
+	chaincode, _ := hex.DecodeString(testpkg.InitChaincode)
+	client := &AttestClient{
+		MainChainCfg:    chainCfg,
+		pubkey:          wif.PrivKey.PubKey(),
+		chaincode:       chaincode,
+		numOfSigs:       1,
+		addrTopup:       testpkg.TopupAddress,
+		WalletPriv:      wif,
+		WalletChainCode: chaincode}
+
+	sigHashes := [][]byte{bytes.Repeat([]byte{0xaa}, 32), bytes.Repeat([]byte{0xbb}, 32)}
+	signWitness := func(priv *btcec.PrivateKey, sigHash []byte) wire.TxWitness {
+		sigBytes := append(ecdsa.Sign(priv, sigHash).Serialize(), byte(1))
+		return wire.TxWitness{sigBytes, priv.PubKey().SerializeCompressed()}
+	}
+
+	// valid witness for tweaked and base keys
+	hash, _ := chainhash.NewHashFromStr("aaaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	for _, h := range []chainhash.Hash{*hash, chainhash.Hash{}} {
+		witness := []wire.TxWitness{
+			signWitness(client.GetKeyFromHash(h).PrivKey, sigHashes[0]),
+			signWitness(wifTopup.PrivKey, sigHashes[1])}
+		assert.Equal(t, nil, client.verifyWitness(witness, sigHashes, h, "signer"))
+	}
 
-	assert.Equal(t, 110, signedTxSize)
-	assert.Equal(t, int64(1100), calcSignedTxFee(feePerByte))
-	assert.Equal(t, 10, int(calcSignedTxFee(feePerByte))/signedTxSize)
+	// signed with untweaked key
+	witness := []wire.TxWitness{
+		signWitness(wif.PrivKey, sigHashes[0]),
+		signWitness(wifTopup.PrivKey, sigHashes[1])}
+	assert.Equal(t, &AttestSignerError{"signer", 0, ErrorSignerPubkey},
+		client.verifyWitness(witness, sigHashes, *hash, "signer"))
+
+	// signature for the wrong sighash
+	witness[0] = signWitness(wif.PrivKey, sigHashes[1])
+	assert.Equal(t, &AttestSignerError{"signer", 0, ErrorSignerSig},
+		client.verifyWitness(witness, sigHashes, chainhash.Hash{}, "signer"))
+
+	// malformed witness
+	witness[0] = wire.TxWitness{[]byte{0x30, 0x01}, wif.PrivKey.PubKey().SerializeCompressed()}
+	assert.Equal(t, &AttestSignerError{"signer", 0, ErrorSignerWitness},
+		client.verifyWitness(witness, sigHashes, chainhash.Hash{}, "signer"))
+
+	// topup input signed with key not paying to topup address
+	witness[0] = signWitness(wif.PrivKey, sigHashes[0])
+	witness[1] = signWitness(wif.PrivKey, sigHashes[1])
+	assert.Equal(t, &AttestSignerError{"signer", 1, ErrorSignerTopupPubkey},
+		client.verifyWitness(witness, sigHashes, chainhash.Hash{}, "signer"))
+
+	// missing topup witness
+	assert.Equal(t, &AttestSignerError{"signer", 1, ErrorSigsMissingForVin},
+		client.verifyWitness(witness[:1], sigHashes, chainhash.Hash{}, "signer"))
+
+	// 2-of-2 multisig of main and topup keys
+	var pubkeysExtended []*hdkeychain.ExtendedKey
+	for _, key := range []*btcutil.WIF{wif, wifTopup} {
+		pubkeysExtended = append(pubkeysExtended,
+			hdkeychain.NewExtendedKey([]byte{}, key.PrivKey.PubKey().SerializeCompressed(), chaincode, []byte{}, 0, 0, false))
+	}
+	client.pubkeysExtended = pubkeysExtended
+	client.numOfSigs = 2
+	_, redeemScript, _ := client.GetNextAttestationScript(*hash)
+	redeemScriptBytes, _ := hex.DecodeString(redeemScript)
+	var multisigWitness wire.TxWitness
+	for _, key := range []*btcutil.WIF{wif, wifTopup} {
+		client.WalletPriv = key
+		multisigWitness = append(multisigWitness, signWitness(client.GetKeyFromHash(*hash).PrivKey, sigHashes[0])[0])
+	}
 
-	assert.Equal(t, 110, signedTxSize)
-	assert.Equal(t, int64(1100), calcSignedTxFee(feePerByte))
-	assert.Equal(t, 10, int(calcSignedTxFee(feePerByte))/signedTxSize)
+	witness = []wire.TxWitness{append(wire.TxWitness{[]byte{}}, append(multisigWitness, redeemScriptBytes)...)}
+	assert.Equal(t, nil, client.verifyWitness(witness, sigHashes[:1], *hash, "signer"))
+
+	// sigs not in the order of pubkeys
+	witness = []wire.TxWitness{wire.TxWitness{[]byte{}, multisigWitness[1], multisigWitness[0], redeemScriptBytes}}
+	assert.Equal(t, &AttestSignerError{"signer", 0, ErrorSignerSig},
+		client.verifyWitness(witness, sigHashes[:1], *hash, "signer"))
+
+	// redeem script of base pubkeys
+	_, baseScript, _ := client.GetNextAttestationScript(chainhash.Hash{})
+	baseScriptBytes, _ := hex.DecodeString(baseScript)
+	witness = []wire.TxWitness{wire.TxWitness{[]byte{}, multisigWitness[0], multisigWitness[1], baseScriptBytes}}
+	assert.Equal(t, &AttestSignerError{"signer", 0, ErrorSignerRedeemScript},
+		client.verifyWitness(witness, sigHashes[:1], *hash, "signer"))
+
+	// missing signature
+	witness = []wire.TxWitness{wire.TxWitness{[]byte{}, multisigWitness[0], redeemScriptBytes}}
+	assert.Equal(t, &AttestSignerError{"signer", 0, ErrorSignerWitness},
+		client.verifyWitness(witness, sigHashes[:1], *hash, "signer"))
+}
 
-	assert.Equal(t, 110, signedTxSize)
-	assert.Equal(t, int64(1100), calcSignedTxFee(feePerByte))
-	assert.Equal(t, 10, int(calcSignedTxFee(feePerByte))/signedTxSize)
+// Test verification of signer witness for taproot clients
+func TestAttestClient_VerifyWitnessTaproot(t *testing.T) {
+	chainCfg := &chaincfg.RegressionNetParams
+	wif, _ := btcutil.DecodeWIF(testpkg.PrivMain)
+	client := &AttestClient{
+		MainChainCfg: chainCfg,
+		pubkey:       wif.PrivKey.PubKey(),
+		numOfSigs:    1,
+		taproot:      true,
+		WalletPriv:   wif}
+
+	sigHash := bytes.Repeat([]byte{0xaa}, 32)
+	signWitness := func(priv *btcec.PrivateKey, sigHash []byte) wire.TxWitness {
+		sig, _ := schnorr.Sign(priv, sigHash)
+		return wire.TxWitness{append(sig.Serialize(), byte(1)), schnorr.SerializePubKey(priv.PubKey())}
+	}
 
-	assert.Equal(t, 110, signedTxSize)
-	assert.Equal(t, int64(1100), calcSignedTxFee(feePerByte))
-	assert.Equal(t, 10, int(calcSignedTxFee(feePerByte))/signedTxSize)
+	// valid witness for tweaked and base keys paying to the taproot address
+	hash, _ := chainhash.NewHashFromStr("aaaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	for _, h := range []chainhash.Hash{*hash, chainhash.Hash{}} {
+		key := client.GetKeyFromHash(h).PrivKey
+		addr, addrErr := client.GetNextAttestationAddr(nil, h)
+		assert.Equal(t, nil, addrErr)
+		assert.Equal(t, schnorr.SerializePubKey(key.PubKey()), addr.ScriptAddress())
+		assert.Equal(t, nil, client.verifyWitness([]wire.TxWitness{signWitness(key, sigHash)}, [][]byte{sigHash}, h, "signer"))
+	}
+	assert.NotEqual(t, client.GetKeyFromHash(*hash).PrivKey.Serialize(), client.GetKeyFromHash(chainhash.Hash{}).PrivKey.Serialize())
+
+	// signed with key tweaked with another commitment
+	witness := []wire.TxWitness{signWitness(client.GetKeyFromHash(chainhash.Hash{}).PrivKey, sigHash)}
+	assert.Equal(t, &AttestSignerError{"signer", 0, ErrorSignerPubkey},
+		client.verifyWitness(witness, [][]byte{sigHash}, *hash, "signer"))
+
+	// signature for the wrong sighash
+	witness = []wire.TxWitness{signWitness(client.GetKeyFromHash(*hash).PrivKey, bytes.Repeat([]byte{0xbb}, 32))}
+	assert.Equal(t, &AttestSignerError{"signer", 0, ErrorSignerSig},
+		client.verifyWitness(witness, [][]byte{sigHash}, *hash, "signer"))
+
+	// ecdsa witness
+	ecdsaSig := append(ecdsa.Sign(client.GetKeyFromHash(*hash).PrivKey, sigHash).Serialize(), byte(1))
+	witness = []wire.TxWitness{wire.TxWitness{ecdsaSig, client.GetKeyFromHash(*hash).PrivKey.PubKey().SerializeCompressed()}}
+	assert.Equal(t, &AttestSignerError{"signer", 0, ErrorSignerWitness},
+		client.verifyWitness(witness, [][]byte{sigHash}, *hash, "signer"))
 }
@@ -0,0 +1,74 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"time"
+)
+
+// AttestClock interface
+//
+// Provides the interface for all time related
+// functionality used by the attestation service:
+// - getting the current time
+// - getting the time elapsed since a given time
+// - scheduling the next attestation state via timers
+//
+// This interface allows building a fake clock for
+// testing that can be advanced manually
+type AttestClock interface {
+	Now() time.Time
+	Since(time.Time) time.Duration
+	NewTimer(time.Duration) AttestTimer
+}
+
+// AttestTimer interface
+//
+// Timer returned by AttestClock that delivers
+// the current time on its channel once expired
+type AttestTimer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// AttestClockSystem struct
+//
+// Implements AttestClock interface using the system clock
+type AttestClockSystem struct{}
+
+// Return new AttestClockSystem instance
+func NewAttestClockSystem() *AttestClockSystem {
+	return &AttestClockSystem{}
+}
+
+// Return current system time
+func (c *AttestClockSystem) Now() time.Time {
+	return time.Now()
+}
+
+// Return system time elapsed since t
+func (c *AttestClockSystem) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+// Return new system timer expiring after d
+func (c *AttestClockSystem) NewTimer(d time.Duration) AttestTimer {
+	return &attestTimerSystem{time.NewTimer(d)}
+}
+
+// attestTimerSystem wraps time.Timer to implement AttestTimer interface
+type attestTimerSystem struct {
+	timer *time.Timer
+}
+
+// Return timer channel
+func (t *attestTimerSystem) C() <-chan time.Time {
+	return t.timer.C
+}
+
+// Stop timer
+func (t *attestTimerSystem) Stop() bool {
+	return t.timer.Stop()
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"sync"
+	"time"
+)
+
+// AttestClockFake struct
+//
+// Implements AttestClock interface and provides
+// a mock clock that only moves forward when
+// manually advanced, firing any expired timers
+type AttestClockFake struct {
+	mtx    *sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*attestTimerFake
+}
+
+// Return new AttestClockFake instance set to time provided
+func NewAttestClockFake(now time.Time) *AttestClockFake {
+	mtx := &sync.Mutex{}
+	return &AttestClockFake{mtx: mtx, cond: sync.NewCond(mtx), now: now}
+}
+
+// Return current fake time
+func (c *AttestClockFake) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+// Return fake time elapsed since t
+func (c *AttestClockFake) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Return new fake timer expiring after d
+// Timers with non positive duration fire immediately
+func (c *AttestClockFake) NewTimer(d time.Duration) AttestTimer {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	timer := &attestTimerFake{clock: c, deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		timer.c <- c.now
+		return timer
+	}
+	c.timers = append(c.timers, timer)
+	c.cond.Broadcast()
+	return timer
+}
+
+// Move fake time forward by d and fire all expired timers
+func (c *AttestClockFake) Advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.now = c.now.Add(d)
+	var pending []*attestTimerFake
+	for _, timer := range c.timers {
+		if !timer.deadline.After(c.now) {
+			timer.c <- c.now
+		} else {
+			pending = append(pending, timer)
+		}
+	}
+	c.timers = pending
+}
+
+// Block until at least n timers are pending
+// Allows tests to wait for the service to schedule
+// its next state before advancing the clock
+func (c *AttestClockFake) BlockUntil(n int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+// Remove timer from pending timers
+func (c *AttestClockFake) removeTimer(timer *attestTimerFake) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for i, pendingTimer := range c.timers {
+		if pendingTimer == timer {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// attestTimerFake implements AttestTimer interface for AttestClockFake
+type attestTimerFake struct {
+	clock    *AttestClockFake
+	deadline time.Time
+	c        chan time.Time
+}
+
+// Return timer channel
+func (t *attestTimerFake) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop timer - returns false if timer already fired or stopped
+func (t *attestTimerFake) Stop() bool {
+	return t.clock.removeTimer(t)
+}
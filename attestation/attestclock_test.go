@@ -0,0 +1,53 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test fake clock timers firing when clock advanced
+func TestAttestClockFake(t *testing.T) {
+	now := time.Unix(1542121293, 0)
+	clock := NewAttestClockFake(now)
+	assert.Equal(t, now, clock.Now())
+
+	timer0 := clock.NewTimer(ATimeFixed)
+	timer1 := clock.NewTimer(ATimeSigs)
+	timer2 := clock.NewTimer(ATimeConfirmation)
+	clock.BlockUntil(3)
+
+	// no timer expired
+	clock.Advance(ATimeFixed - time.Nanosecond)
+	assert.Equal(t, ATimeFixed-time.Nanosecond, clock.Since(now))
+	assert.Equal(t, 0, len(timer0.C()))
+
+	// first timer expired
+	clock.Advance(time.Nanosecond)
+	assert.Equal(t, now.Add(ATimeFixed), <-timer0.C())
+	assert.Equal(t, 0, len(timer1.C()))
+	assert.Equal(t, false, timer0.Stop())
+
+	// stopped timer never fires
+	assert.Equal(t, true, timer2.Stop())
+	clock.Advance(ATimeConfirmation)
+	assert.Equal(t, now.Add(ATimeFixed+ATimeConfirmation), <-timer1.C())
+	assert.Equal(t, 0, len(timer2.C()))
+
+	// timer with no delay fires immediately
+	timer3 := clock.NewTimer(0)
+	assert.Equal(t, clock.Now(), <-timer3.C())
+
+	// blocking until a timer is created
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		clock.NewTimer(ATimeSkip)
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(ATimeSkip)
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mainstay/log"
+)
+
+// Attestation commands allow operators to control a running attestation
+// service. Commands are sent through a channel and handled by the service
+// Run loop in between attestation states, so that no state is modified
+// while an attestation state is being processed
+
+// Attestation command type
+type AttestCommandType string
+
+// Attestation commands
+const (
+	ACommandStatus  AttestCommandType = "status"
+	ACommandPause   AttestCommandType = "pause"
+	ACommandResume  AttestCommandType = "resume"
+	ACommandAttest  AttestCommandType = "attest"
+	ACommandBumpFee AttestCommandType = "bump"
+	ACommandReset   AttestCommandType = "reset"
+)
+
+// error consts
+const (
+	ErrorCommandUnknown         = "Unknown attestation command"
+	ErrorCommandPaused          = "Attestation service is paused"
+	ErrorCommandAttestState     = "Attestation can only be forced when waiting for the next commitment - current state"
+	ErrorCommandBumpFeeState    = "Fee bump can only be forced when awaiting confirmation - current state"
+	ErrorCommandServiceShutdown = "Attestation service shutting down"
+)
+
+// Attestation state names
+var attestationStateNames = map[AttestationState]string{
+	AStateError:             "error",
+	AStateInit:              "init",
+	AStateNextCommitment:    "next_commitment",
+	AStateNewAttestation:    "new_attestation",
+	AStateSignAttestation:   "sign_attestation",
+	AStatePreSendStore:      "pre_send_store",
+	AStateSendAttestation:   "send_attestation",
+	AStateAwaitConfirmation: "await_confirmation",
+	AStateHandleUnconfirmed: "handle_unconfirmed",
+}
+
+// Return attestation state name
+func (a AttestationState) String() string {
+	if name, ok := attestationStateNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(a))
+}
+
+// AttestStatus structure
+// Snapshot of the attestation service state returned by commands
+type AttestStatus struct {
+	Staychain  string           `json:"staychain"`
+	State      AttestationState `json:"state"`
+	StateName  string           `json:"state_name"`
+	Paused     bool             `json:"paused"`
+	Txid       string           `json:"txid"`
+	MerkleRoot string           `json:"merkle_root"`
+	Confirmed  bool             `json:"confirmed"`
+	Fee        int              `json:"fee"`
+	FeeBumped  bool             `json:"fee_bumped"`
+	NextState  time.Time        `json:"next_state"`
+
+	MonthlyFeeSpend int64        `json:"monthly_fee_spend"`
+	BudgetExceeded  bool         `json:"budget_exceeded"`
+	Runway          AttestRunway `json:"runway"`
+}
+
+// attestCommand structure
+// Command sent to the service Run loop with a channel for the response
+type attestCommand struct {
+	command AttestCommandType
+	reply   chan attestCommandReply
+}
+
+// attestCommandReply structure
+// Command response with the service status after handling the command
+type attestCommandReply struct {
+	status AttestStatus
+	err    error
+}
+
+// Send command to the attestation service and wait for the response
+// Returns the service status after the command has been handled
+func (s *AttestService) SendCommand(ctx context.Context, command AttestCommandType) (AttestStatus, error) {
+	cmd := attestCommand{command: command, reply: make(chan attestCommandReply, 1)}
+	select {
+	case s.commands <- cmd:
+	case <-ctx.Done():
+		return AttestStatus{}, ctx.Err()
+	case <-s.ctx.Done():
+		return AttestStatus{}, errors.New(ErrorCommandServiceShutdown)
+	}
+
+	select {
+	case reply := <-cmd.reply:
+		return reply.status, reply.err
+	case <-ctx.Done():
+		return AttestStatus{}, ctx.Err()
+	case <-s.ctx.Done():
+		return AttestStatus{}, errors.New(ErrorCommandServiceShutdown)
+	}
+}
+
+// Handle command received in the Run loop and reply with the service status
+// Returns true if the current attestation state should be handled immediately
+func (s *AttestService) handleCommand(cmd attestCommand) bool {
+	doNow, err := s.doCommand(cmd.command)
+	if err != nil {
+		log.Warnf("*AttestService* command %s failed: %v\n", cmd.command, err)
+	}
+	cmd.reply <- attestCommandReply{status: s.status(), err: err}
+	return doNow
+}
+
+// Apply command to the attestation service
+func (s *AttestService) doCommand(command AttestCommandType) (bool, error) {
+	switch command {
+	case ACommandStatus:
+		return false, nil
+
+	case ACommandPause:
+		log.Infoln("*AttestService* PAUSED")
+		s.paused = true
+		return false, nil
+
+	case ACommandResume:
+		if !s.paused {
+			return false, nil
+		}
+		log.Infoln("*AttestService* RESUMED")
+		s.paused = false
+		return true, nil
+
+	case ACommandAttest:
+		if s.paused {
+			return false, errors.New(ErrorCommandPaused)
+		} else if s.state != AStateNextCommitment {
+			return false, errors.New(fmt.Sprintf("%s %s", ErrorCommandAttestState, s.state))
+		}
+		log.Infoln("*AttestService* FORCING ATTESTATION")
+		s.isForcedAttestation = true
+		return true, nil
+
+	case ACommandBumpFee:
+		if s.paused {
+			return false, errors.New(ErrorCommandPaused)
+		} else if s.state != AStateAwaitConfirmation {
+			return false, errors.New(fmt.Sprintf("%s %s", ErrorCommandBumpFeeState, s.state))
+		}
+		log.Infoln("*AttestService* FORCING FEE BUMP")
+		s.state = AStateHandleUnconfirmed
+		return true, nil
+
+	case ACommandReset:
+		log.Infoln("*AttestService* RESETTING")
+		s.state = AStateInit
+		s.isForcedAttestation = false
+		return !s.paused, nil
+	}
+	return false, errors.New(fmt.Sprintf("%s %s", ErrorCommandUnknown, command))
+}
+
+// Return status of the attestation service
+func (s *AttestService) status() AttestStatus {
+	return AttestStatus{
+		Staychain:  s.config.Name(),
+		State:      s.state,
+		StateName:  s.state.String(),
+		Paused:     s.paused,
+		Txid:       s.attestation.Txid.String(),
+		MerkleRoot: s.attestation.CommitmentHash().String(),
+		Confirmed:  s.attestation.Confirmed,
+		Fee:        s.attester.Fees.GetFee(),
+		FeeBumped:  s.isFeeBumped,
+		NextState:  s.nextStateTime,
+
+		MonthlyFeeSpend: s.monthlyFeeSpend,
+		BudgetExceeded:  s.isBudgetExceeded,
+		Runway:          s.runway,
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"sync"
+	"time"
+)
+
+// Attestation event type
+type AttestEventType string
+
+// Attestation event types
+const (
+	AEventAttestationSent      AttestEventType = "attestation_sent"
+	AEventAttestationConfirmed AttestEventType = "attestation_confirmed"
+	AEventAttestationFeeBumped AttestEventType = "attestation_fee_bumped"
+	AEventAttestationFailed    AttestEventType = "attestation_failed"
+	AEventFeeBudgetExceeded    AttestEventType = "fee_budget_exceeded"
+	AEventFeeBudgetRestored    AttestEventType = "fee_budget_restored"
+	AEventRunwayLow            AttestEventType = "runway_low"
+)
+
+// AttestEvent structure
+// Event emitted by the attestation service on state transitions
+// Includes attestation txid, merkle root, fee and service state
+type AttestEvent struct {
+	Type       AttestEventType  `json:"type"`
+	Staychain  string           `json:"staychain,omitempty"`
+	Txid       string           `json:"txid"`
+	MerkleRoot string           `json:"merkle_root"`
+	Fee        int              `json:"fee"`
+	State      AttestationState `json:"state"`
+	Error      string           `json:"error,omitempty"`
+	Time       time.Time        `json:"time"`
+
+	// runway of runway_low alerts with the threshold crossed
+	// and alert level escalating with each lower threshold
+	RunwayDays      float64 `json:"runway_days,omitempty"`
+	RunwayThreshold int     `json:"runway_threshold,omitempty"`
+	RunwayLevel     int     `json:"runway_level,omitempty"`
+}
+
+// AttestSubscriber interface
+//
+// Provides the interface for receiving attestation
+// service events. Events are delivered synchronously
+// from the attestation service, therefore subscribers
+// should not block when handling events
+type AttestSubscriber interface {
+	HandleEvent(AttestEvent)
+}
+
+// AttestEventBus structure
+// Publishes attestation events to all subscribers
+type AttestEventBus struct {
+	mtx         sync.Mutex
+	subscribers []AttestSubscriber
+}
+
+// Return new AttestEventBus instance
+func NewAttestEventBus() *AttestEventBus {
+	return &AttestEventBus{}
+}
+
+// Add subscriber to receive all published events
+func (b *AttestEventBus) Subscribe(subscriber AttestSubscriber) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.subscribers = append(b.subscribers, subscriber)
+}
+
+// Publish event to all subscribers
+func (b *AttestEventBus) Publish(event AttestEvent) {
+	b.mtx.Lock()
+	subscribers := b.subscribers
+	b.mtx.Unlock()
+
+	for _, subscriber := range subscribers {
+		subscriber.HandleEvent(event)
+	}
+}
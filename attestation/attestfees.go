@@ -5,14 +5,16 @@
 package attestation
 
 import (
-	"encoding/json"
-	"net/http"
+	"fmt"
+	"math"
+	"time"
 
 	"mainstay/config"
 	"mainstay/log"
+	"mainstay/models"
 )
 
-// Utility functions to get best bitcoin fees from a remote API
+// Utility functions to get best bitcoin fees from a fee estimator
 // Provide min/max values from config and increment fee based
 // on schedule, timing and upper/lower limits
 
@@ -23,22 +25,64 @@ const (
 	DefaultFeeIncrement = 5
 )
 
-// warnings for arguments
+// fee bumping strategies for unconfirmed attestations
 const (
-	WarningInvalidMinFeeArg       = "Invalid min fee config value"
-	WarningInvalidMaxFeeArg       = "Invalid max fee config value"
-	WarningInvalidFeeIncrementArg = "Invalid fee increment config value"
+	// replace-by-fee - re-sign attestation with a higher fee
+	FeeBumpRBF = "rbf"
+
+	// child-pays-for-parent - spend unconfirmed attestation with a higher fee child
+	FeeBumpCPFP = "cpfp"
+
+	DefaultFeeBumpStrategy = FeeBumpRBF
 )
 
-// fee api config
+// fee bump policies deciding the fee of each fee bump
 const (
-	// response format:
-	// { "fastestFee": 40, "halfHourFee": 20, "hourFee": 10 }
-	FeeApiUrl = "https://bitcoinfees.earn.com/api/v1/fees/recommended"
+	// constant fee increment on each bump
+	FeeBumpPolicyIncrement = "increment"
+
+	// re-estimate fee for the bump confirmation target
+	FeeBumpPolicyTarget = "target"
+
+	// multiply previous fee by the bump factor
+	FeeBumpPolicyMultiply = "multiply"
+
+	// escalate fee so that the attestation confirms before
+	// the bump deadline elapses since it was first sent
+	FeeBumpPolicyDeadline = "deadline"
+
+	DefaultFeeBumpPolicy = FeeBumpPolicyIncrement
+)
+
+// fee bump policy defaults
+const (
+	DefaultBumpFactor     = 1.5
+	DefaultBumpConfTarget = 2
+	DefaultBumpDeadline   = 3 * time.Hour
+
+	// BIP125 minimum increment of replacement fees per byte, which is
+	// the default incremental relay fee of 1 sat/vbyte in bitcoind
+	MinRelayFeeIncrement = 1
+
+	// expected interval between blocks used to convert deadlines to targets
+	BlockInterval = 10 * time.Minute
+)
+
+// warnings for arguments
+const (
+	WarningInvalidMinFeeArg         = "Invalid min fee config value"
+	WarningInvalidMaxFeeArg         = "Invalid max fee config value"
+	WarningInvalidFeeIncrementArg   = "Invalid fee increment config value"
+	WarningInvalidBumpStrategyArg   = "Invalid fee bump strategy config value"
+	WarningInvalidBumpPolicyArg     = "Invalid fee bump policy config value"
+	WarningInvalidBumpFactorArg     = "Invalid fee bump factor config value"
+	WarningInvalidBumpConfTargetArg = "Invalid fee bump confirmation target config value"
+	WarningInvalidBumpDeadlineArg   = "Invalid fee bump deadline config value"
+)
 
-	// default fee type to use from response
-	// options: fastestFee, halfHourFee, hourFee
-	DefaultBestFeeType = "hourFee"
+// warning consts
+const (
+	WarningMaxFeeReached = "Max fee reached - fee can not be bumped further"
 )
 
 // AttestFees struct
@@ -57,12 +101,32 @@ type AttestFees struct {
 
 	// previous fee used for attestation transactions
 	prevFee int
+
+	// strategy used for bumping fees of unconfirmed attestations
+	bumpStrategy string
+
+	// estimator of the best fee and number of blocks to confirm within
+	estimator  FeeEstimator
+	confTarget int
+
+	// policy deciding bumped fees and its parameters
+	bumpPolicy     string
+	bumpFactor     float64
+	bumpConfTarget int
+	bumpDeadline   time.Duration
+
+	// time the attestation was first sent, used for bump deadlines
+	sentTime time.Time
+	clock    AttestClock
+
+	// latest fee bump decision
+	lastBump models.FeeBump
 }
 
 // New AttestFees instance
 // Limit values taken from configuration
-// Current fee value reset from api
-func NewAttestFees(feesConfig config.FeesConfig) AttestFees {
+// Current fee value reset from the fee estimator
+func NewAttestFees(feesConfig config.FeesConfig, estimator FeeEstimator) AttestFees {
 
 	// min fee with upper limit max_fee default
 	minFee := DefaultMinFee
@@ -91,11 +155,71 @@ func NewAttestFees(feesConfig config.FeesConfig) AttestFees {
 	}
 	log.Infof("*Fees* Fee increment set to: %d\n", feeIncrement)
 
+	// fee bump strategy either rbf or cpfp
+	bumpStrategy := DefaultFeeBumpStrategy
+	if feesConfig.BumpStrategy == FeeBumpRBF || feesConfig.BumpStrategy == FeeBumpCPFP {
+		bumpStrategy = feesConfig.BumpStrategy
+	} else {
+		log.Warnf("%s (%s)\n", WarningInvalidBumpStrategyArg, feesConfig.BumpStrategy)
+	}
+	log.Infof("*Fees* Fee bump strategy set to: %s\n", bumpStrategy)
+
+	// confirmation target with lower limit 1 block
+	confTarget := DefaultFeeConfTarget
+	if feesConfig.ConfTarget > 0 {
+		confTarget = feesConfig.ConfTarget
+	} else {
+		log.Warnf("%s (%d)\n", WarningInvalidConfTargetArg, feesConfig.ConfTarget)
+	}
+	log.Infof("*Fees* Fee confirmation target set to: %d\n", confTarget)
+
+	// fee bump policy with default constant increment
+	bumpPolicy := DefaultFeeBumpPolicy
+	switch feesConfig.BumpPolicy {
+	case FeeBumpPolicyIncrement, FeeBumpPolicyTarget, FeeBumpPolicyMultiply, FeeBumpPolicyDeadline:
+		bumpPolicy = feesConfig.BumpPolicy
+	default:
+		log.Warnf("%s (%s)\n", WarningInvalidBumpPolicyArg, feesConfig.BumpPolicy)
+	}
+	log.Infof("*Fees* Fee bump policy set to: %s\n", bumpPolicy)
+
+	// bump factor with lower limit 1
+	bumpFactor := DefaultBumpFactor
+	if feesConfig.BumpFactor > 1 {
+		bumpFactor = feesConfig.BumpFactor
+	} else if bumpPolicy == FeeBumpPolicyMultiply {
+		log.Warnf("%s (%v)\n", WarningInvalidBumpFactorArg, feesConfig.BumpFactor)
+	}
+
+	// bump confirmation target with lower limit 1 block
+	bumpConfTarget := DefaultBumpConfTarget
+	if feesConfig.BumpConfTarget > 0 {
+		bumpConfTarget = feesConfig.BumpConfTarget
+	} else if bumpPolicy == FeeBumpPolicyTarget {
+		log.Warnf("%s (%d)\n", WarningInvalidBumpConfTargetArg, feesConfig.BumpConfTarget)
+	}
+
+	// bump deadline with lower limit 1 minute
+	bumpDeadline := DefaultBumpDeadline
+	if feesConfig.BumpDeadlineMinutes > 0 {
+		bumpDeadline = time.Duration(feesConfig.BumpDeadlineMinutes) * time.Minute
+	} else if bumpPolicy == FeeBumpPolicyDeadline {
+		log.Warnf("%s (%d)\n", WarningInvalidBumpDeadlineArg, feesConfig.BumpDeadlineMinutes)
+	}
+
 	attestFees := AttestFees{
-		minFee:       minFee,
-		maxFee:       maxFee,
-		feeIncrement: feeIncrement,
-		prevFee:      0}
+		minFee:         minFee,
+		maxFee:         maxFee,
+		feeIncrement:   feeIncrement,
+		prevFee:        0,
+		bumpStrategy:   bumpStrategy,
+		estimator:      estimator,
+		confTarget:     confTarget,
+		bumpPolicy:     bumpPolicy,
+		bumpFactor:     bumpFactor,
+		bumpConfTarget: bumpConfTarget,
+		bumpDeadline:   bumpDeadline,
+		clock:          NewAttestClockSystem()}
 
 	attestFees.ResetFee()
 	return attestFees
@@ -107,20 +231,35 @@ func (a AttestFees) GetFee() int {
 	return a.currentFee
 }
 
+// Get fee bump strategy
+func (a AttestFees) BumpStrategy() string {
+	return a.bumpStrategy
+}
+
+// Get fee bump policy
+func (a AttestFees) BumpPolicy() string {
+	return a.bumpPolicy
+}
+
+// Get latest fee bump decision
+func (a AttestFees) LastBump() models.FeeBump {
+	return a.lastBump
+}
+
 // Get previous fee
 func (a AttestFees) GetPrevFee() int {
 	log.Infof("*Fees* Previous fee value: %d\n", a.prevFee)
 	return a.prevFee
 }
 
-// Reset current fee, getting latest best value from API
+// Reset current fee, getting latest best value from the fee estimator
 // Minimum option value to set current fee to minFee
 func (a *AttestFees) ResetFee(useMinimum ...bool) {
 	var fee int
 	if len(useMinimum) > 0 && useMinimum[0] {
 		fee = a.minFee
 	} else {
-		fee = getBestFee()
+		fee = a.getBestFee()
 		if fee < a.minFee {
 			fee = a.minFee
 		} else if fee > a.maxFee {
@@ -132,15 +271,85 @@ func (a *AttestFees) ResetFee(useMinimum ...bool) {
 	log.Infof("*Fees* Current fee set to value: %d\n", a.currentFee)
 }
 
-// Bump fee upon request using increment value and not allowing values higher than max configured fee
-func (a *AttestFees) BumpFee() {
+// Return true if the fee can be bumped by at least the BIP125
+// minimum relay increment without exceeding the max fee
+func (a *AttestFees) CanBumpFee() bool {
+	return a.currentFee+MinRelayFeeIncrement <= a.maxFee
+}
+
+// Bump fee upon request using the fee bump policy and not allowing values higher than max configured fee
+// Bumped fees are at least the BIP125 minimum relay increment higher than the previous fee
+// The decision and its reason are kept as the latest fee bump for the attestation record
+// Returns false without bumping if the max fee has been reached, as a replacement
+// paying the same fee would be rejected
+func (a *AttestFees) BumpFee() bool {
+	if !a.CanBumpFee() {
+		log.Warnf("%s (%d)\n", WarningMaxFeeReached, a.currentFee)
+		return false
+	}
 	a.prevFee = a.currentFee
-	a.currentFee += a.feeIncrement
-	log.Infof("*Fees* Bumping fee value to: %d\n", a.currentFee)
-	if a.currentFee > a.maxFee {
-		log.Infof("*Fees* Max allowed fee value reached: %d\n", a.currentFee)
-		a.currentFee = a.maxFee
+	fee, reason := a.policyFee()
+
+	minFee := a.prevFee + MinRelayFeeIncrement
+	if fee < minFee {
+		fee = minFee
+		reason += fmt.Sprintf("; raised to BIP125 min relay increment %d", minFee)
 	}
+	if fee > a.maxFee {
+		log.Infof("*Fees* Max allowed fee value reached: %d\n", fee)
+		fee = a.maxFee
+		reason += fmt.Sprintf("; capped at max fee %d", a.maxFee)
+	}
+	a.currentFee = fee
+	a.lastBump = models.FeeBump{
+		Time:    a.clock.Now().Unix(),
+		Policy:  a.bumpPolicy,
+		PrevFee: a.prevFee,
+		Fee:     a.currentFee,
+		Reason:  reason}
+	log.Infof("*Fees* Bumping fee value to: %d (%s)\n", a.currentFee, reason)
+	return true
+}
+
+// Return bumped fee of the fee bump policy and reason for the fee
+// Policies relying on fee estimates fall back to the constant
+// increment, or interpolation to the max fee for deadlines,
+// if the estimate is not available
+func (a *AttestFees) policyFee() (int, string) {
+	switch a.bumpPolicy {
+	case FeeBumpPolicyMultiply:
+		return int(math.Ceil(float64(a.prevFee) * a.bumpFactor)),
+			fmt.Sprintf("multiplied by factor %v", a.bumpFactor)
+	case FeeBumpPolicyTarget:
+		if fee := a.estimateFee(a.bumpConfTarget); fee > 0 {
+			return fee, fmt.Sprintf("estimated for target %d blocks", a.bumpConfTarget)
+		}
+		return a.prevFee + a.feeIncrement,
+			fmt.Sprintf("estimate unavailable, incremented by %d", a.feeIncrement)
+	case FeeBumpPolicyDeadline:
+		elapsed := a.clock.Since(a.sentTime)
+		remaining := a.bumpDeadline - elapsed
+		if a.sentTime.IsZero() || remaining <= 0 {
+			return a.maxFee, fmt.Sprintf("deadline %v elapsed", a.bumpDeadline)
+		}
+		target := int(remaining / BlockInterval)
+		if target < 1 {
+			target = 1
+		}
+		if fee := a.estimateFee(target); fee > 0 {
+			return fee, fmt.Sprintf("estimated for target %d blocks with %v to deadline",
+				target, remaining.Round(time.Minute))
+		}
+		fee := a.prevFee + int(math.Ceil(float64(a.maxFee-a.prevFee)*float64(elapsed)/float64(a.bumpDeadline)))
+		return fee, fmt.Sprintf("estimate unavailable, interpolated to max fee with %v to deadline",
+			remaining.Round(time.Minute))
+	}
+	return a.prevFee + a.feeIncrement, fmt.Sprintf("incremented by %d", a.feeIncrement)
+}
+
+// Set time the attestation was first sent, from which bump deadlines apply
+func (a *AttestFees) setSentTime(sentTime time.Time) {
+	a.sentTime = sentTime
 }
 
 // Manually force set current fee regardless of max, min values
@@ -149,39 +358,28 @@ func (a *AttestFees) setCurrentFee(fee int) {
 	log.Infof("*Fees* Current value set to: %d\n", a.currentFee)
 }
 
-// getBestFee returns the best fee for the type requested from the API
-func getBestFee(customFeeType ...string) int {
-	var feeType = DefaultBestFeeType
-	if len(customFeeType) > 0 {
-		feeType = customFeeType[0]
-	}
-
-	fee := getFeeFromAPI(feeType)
-	return fee
+// Manually force set previous fee, used when restoring fee bumping history
+func (a *AttestFees) setPrevFee(fee int) {
+	a.prevFee = fee
+	log.Infof("*Fees* Previous value set to: %d\n", a.prevFee)
 }
 
-// GetFeeFromAPI attempts to get the best bitcoinfee from the fee API specified
-func getFeeFromAPI(feeType string) int {
-	resp, getErr := http.Get(FeeApiUrl)
-	if getErr != nil {
-		log.Infoln("*Fees* API request failed")
-		return -1
-	}
+// getBestFee returns the best fee for the confirmation target from the estimator
+// Returns -1 if no estimator is set or the estimate failed
+func (a *AttestFees) getBestFee() int {
+	return a.estimateFee(a.confTarget)
+}
 
-	defer resp.Body.Close()
-	dec := json.NewDecoder(resp.Body)
-	var respJson map[string]float64
-	decErr := dec.Decode(&respJson)
-	if decErr != nil {
-		log.Infoln("*Fees* API response decoding failed")
+// estimateFee returns the fee estimate for the target provided
+// Returns -1 if no estimator is set or the estimate failed
+func (a *AttestFees) estimateFee(confTarget int) int {
+	if a.estimator == nil {
 		return -1
 	}
-
-	fee, ok := respJson[feeType]
-	if !ok {
-		log.Infoln("*Fees* API response incorrect format")
+	fee, estimateErr := a.estimator.EstimateFee(confTarget)
+	if estimateErr != nil {
+		log.Infof("*Fees* %s fee estimate failed (%v)\n", a.estimator.Name(), estimateErr)
 		return -1
 	}
-
-	return int(fee)
+	return fee
 }
@@ -0,0 +1,270 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	confpkg "mainstay/config"
+	"mainstay/log"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+// Fee estimators providing the fee per byte of attestation transactions
+// for a confirmation target, combined by their median if several are set
+
+// fee estimator names
+const (
+	// bitcoind estimatesmartfee through the main rpc client
+	FeeEstimateBitcoind = "bitcoind"
+
+	// mempool.space style rest api of recommended fees
+	FeeEstimateMempool = "mempool"
+
+	// static fee from config
+	FeeEstimateStatic = "static"
+
+	DefaultFeeEstimate = FeeEstimateBitcoind
+)
+
+// fee estimator defaults
+const (
+	// response format:
+	// { "fastestFee": 40, "halfHourFee": 20, "hourFee": 10, "economyFee": 5, "minimumFee": 1 }
+	DefaultFeeEstimatorUrl = "https://mempool.space/api/v1/fees/recommended"
+
+	// default number of blocks fees should confirm within
+	DefaultFeeConfTarget = 6
+
+	// timeout of fee estimate api requests
+	FeeEstimatorTimeout = 10 * time.Second
+)
+
+// error / warning consts
+const (
+	ErrorFeeEstimateFailed      = "Fee estimate failed"
+	ErrorFeeEstimateMissing     = "Fee estimate not available"
+	ErrorFeeEstimatesFailed     = "All fee estimators failed"
+	WarningInvalidEstimatorArg  = "Invalid fee estimator config value"
+	WarningInvalidConfTargetArg = "Invalid fee confirmation target config value"
+	WarningInvalidStaticFeeArg  = "Invalid static fee config value"
+)
+
+// FeeEstimator interface
+//
+// Estimators return the fee per byte in satoshis for attestation
+// transactions to confirm within the confirmation target in blocks
+// An error is returned if no estimate is available
+type FeeEstimator interface {
+	EstimateFee(confTarget int) (int, error)
+	Name() string
+}
+
+// Return new fee estimator for the fees config estimators
+// Several estimators are combined by the median of their estimates
+func NewFeeEstimator(config *confpkg.Config) FeeEstimator {
+	feesConfig := config.FeesConfig()
+	names := feesConfig.Estimators
+	if len(names) == 0 {
+		names = []string{DefaultFeeEstimate}
+	}
+
+	var estimators []FeeEstimator
+	for _, name := range names {
+		switch name {
+		case FeeEstimateBitcoind:
+			estimators = append(estimators, NewFeeEstimatorBitcoind(config.MainClient()))
+		case FeeEstimateMempool:
+			estimators = append(estimators, NewFeeEstimatorMempool(feesConfig.EstimatorUrl))
+		case FeeEstimateStatic:
+			staticFee := feesConfig.StaticFee
+			if staticFee <= 0 {
+				log.Warnf("%s (%d)\n", WarningInvalidStaticFeeArg, staticFee)
+				staticFee = DefaultMinFee
+			}
+			estimators = append(estimators, NewFeeEstimatorStatic(staticFee))
+		default:
+			log.Warnf("%s (%s)\n", WarningInvalidEstimatorArg, name)
+		}
+	}
+	if len(estimators) == 0 {
+		estimators = append(estimators, NewFeeEstimatorBitcoind(config.MainClient()))
+	}
+	if len(estimators) == 1 {
+		log.Infof("*Fees* Fee estimator set to: %s\n", estimators[0].Name())
+		return estimators[0]
+	}
+	estimator := NewFeeEstimatorMedian(estimators)
+	log.Infof("*Fees* Fee estimator set to: %s\n", estimator.Name())
+	return estimator
+}
+
+// FeeEstimatorBitcoind struct
+//
+// Implements FeeEstimator interface using the estimatesmartfee
+// rpc of the main bitcoind client, converting the BTC/kvB feerate
+type FeeEstimatorBitcoind struct {
+	client *rpcclient.Client
+}
+
+// Return new FeeEstimatorBitcoind instance for the rpc client
+func NewFeeEstimatorBitcoind(client *rpcclient.Client) *FeeEstimatorBitcoind {
+	return &FeeEstimatorBitcoind{client: client}
+}
+
+// Return estimator name
+func (b *FeeEstimatorBitcoind) Name() string {
+	return FeeEstimateBitcoind
+}
+
+// Return estimatesmartfee fee per byte for the confirmation target
+func (b *FeeEstimatorBitcoind) EstimateFee(confTarget int) (int, error) {
+	if b.client == nil {
+		return -1, errors.New(ErrorFeeEstimateMissing)
+	}
+	mode := btcjson.EstimateModeConservative
+	result, estimateErr := b.client.EstimateSmartFee(int64(confTarget), &mode)
+	if estimateErr != nil {
+		return -1, errors.New(fmt.Sprintf("%s %v", ErrorFeeEstimateFailed, estimateErr))
+	}
+	if result.FeeRate == nil || *result.FeeRate <= 0 {
+		return -1, errors.New(fmt.Sprintf("%s %s", ErrorFeeEstimateMissing, strings.Join(result.Errors, ", ")))
+	}
+	return int(math.Ceil(*result.FeeRate * Coin / 1000)), nil
+}
+
+// FeeEstimatorMempool struct
+//
+// Implements FeeEstimator interface using a mempool.space style api
+// of recommended fees, picking the recommendation for the target
+type FeeEstimatorMempool struct {
+	url    string
+	client *http.Client
+}
+
+// Return new FeeEstimatorMempool instance for the api url
+// The default mempool.space api is used if no url is set
+func NewFeeEstimatorMempool(url string) *FeeEstimatorMempool {
+	if url == "" {
+		url = DefaultFeeEstimatorUrl
+	}
+	return &FeeEstimatorMempool{url: url, client: &http.Client{Timeout: FeeEstimatorTimeout}}
+}
+
+// Return estimator name
+func (m *FeeEstimatorMempool) Name() string {
+	return FeeEstimateMempool
+}
+
+// Return recommended fee per byte for the confirmation target
+// Next block, half hour, hour and economy fees are recommended for
+// targets up to 1, 3, 6 and more blocks respectively
+func (m *FeeEstimatorMempool) EstimateFee(confTarget int) (int, error) {
+	resp, getErr := m.client.Get(m.url)
+	if getErr != nil {
+		return -1, errors.New(fmt.Sprintf("%s %v", ErrorFeeEstimateFailed, getErr))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return -1, errors.New(fmt.Sprintf("%s %s", ErrorFeeEstimateFailed, resp.Status))
+	}
+
+	var fees map[string]float64
+	if decErr := json.NewDecoder(resp.Body).Decode(&fees); decErr != nil {
+		return -1, errors.New(fmt.Sprintf("%s %v", ErrorFeeEstimateFailed, decErr))
+	}
+
+	feeType := "economyFee"
+	if confTarget <= 1 {
+		feeType = "fastestFee"
+	} else if confTarget <= 3 {
+		feeType = "halfHourFee"
+	} else if confTarget <= 6 {
+		feeType = "hourFee"
+	}
+	fee, ok := fees[feeType]
+	if !ok || fee <= 0 {
+		return -1, errors.New(fmt.Sprintf("%s %s", ErrorFeeEstimateMissing, feeType))
+	}
+	return int(math.Ceil(fee)), nil
+}
+
+// FeeEstimatorStatic struct
+//
+// Implements FeeEstimator interface returning a static fee
+// regardless of the confirmation target
+type FeeEstimatorStatic struct {
+	fee int
+}
+
+// Return new FeeEstimatorStatic instance for the fee per byte
+func NewFeeEstimatorStatic(fee int) *FeeEstimatorStatic {
+	return &FeeEstimatorStatic{fee: fee}
+}
+
+// Return estimator name
+func (s *FeeEstimatorStatic) Name() string {
+	return FeeEstimateStatic
+}
+
+// Return static fee per byte
+func (s *FeeEstimatorStatic) EstimateFee(confTarget int) (int, error) {
+	return s.fee, nil
+}
+
+// FeeEstimatorMedian struct
+//
+// Implements FeeEstimator interface combining the estimates of several
+// estimators by their median, so that a single estimator returning
+// outlier values or failing does not affect attestation fees
+type FeeEstimatorMedian struct {
+	estimators []FeeEstimator
+}
+
+// Return new FeeEstimatorMedian instance for the estimators provided
+func NewFeeEstimatorMedian(estimators []FeeEstimator) *FeeEstimatorMedian {
+	return &FeeEstimatorMedian{estimators: estimators}
+}
+
+// Return estimator name listing the names of the estimators combined
+func (m *FeeEstimatorMedian) Name() string {
+	var names []string
+	for _, estimator := range m.estimators {
+		names = append(names, estimator.Name())
+	}
+	return "median:" + strings.Join(names, ",")
+}
+
+// Return median fee per byte of the estimators that return an estimate
+// The median of an even number of estimates is the mean of the middle two
+func (m *FeeEstimatorMedian) EstimateFee(confTarget int) (int, error) {
+	var fees []int
+	for _, estimator := range m.estimators {
+		fee, estimateErr := estimator.EstimateFee(confTarget)
+		if estimateErr != nil {
+			log.Warnf("*Fees* %s fee estimate failed (%v)\n", estimator.Name(), estimateErr)
+			continue
+		}
+		fees = append(fees, fee)
+	}
+	if len(fees) == 0 {
+		return -1, errors.New(ErrorFeeEstimatesFailed)
+	}
+	sort.Ints(fees)
+	mid := len(fees) / 2
+	if len(fees)%2 == 0 {
+		return (fees[mid-1] + fees[mid] + 1) / 2, nil
+	}
+	return fees[mid], nil
+}
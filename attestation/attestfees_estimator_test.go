@@ -0,0 +1,179 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	confpkg "mainstay/config"
+
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// Return fake mempool.space recommended fees api
+func newFeeApiFake(status int, response string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+}
+
+// Return fake bitcoind rpc server replying to estimatesmartfee with the result
+// provided and rpc client connected to it, recording the requested targets
+func newFeeRpcFake(result string, targets *[]float64) (*httptest.Server, *rpcclient.Client) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var request struct {
+			Id     interface{}   `json:"id"`
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		json.Unmarshal(body, &request)
+		if request.Method == "estimatesmartfee" && len(request.Params) > 0 {
+			*targets = append(*targets, request.Params[0].(float64))
+		}
+		id, _ := json.Marshal(request.Id)
+		fmt.Fprintf(w, `{"result": %s, "error": null, "id": %s}`, result, id)
+	}))
+	client, _ := rpcclient.New(&rpcclient.ConnConfig{
+		Host:         strings.TrimPrefix(server.URL, "http://"),
+		User:         "user",
+		Pass:         "pass",
+		HTTPPostMode: true,
+		DisableTLS:   true}, nil)
+	return server, client
+}
+
+// Test bitcoind estimator converting estimatesmartfee feerate
+func TestFeeEstimatorBitcoind(t *testing.T) {
+	var targets []float64
+	server, client := newFeeRpcFake(`{"feerate": 0.00012345, "blocks": 3}`, &targets)
+	defer server.Close()
+	defer client.Shutdown()
+
+	estimator := NewFeeEstimatorBitcoind(client)
+	assert.Equal(t, FeeEstimateBitcoind, estimator.Name())
+	fee, err := estimator.EstimateFee(3)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 13, fee)
+	assert.Equal(t, []float64{3}, targets)
+
+	// no estimate available
+	errServer, errClient := newFeeRpcFake(`{"errors": ["Insufficient data or no feerate found"], "blocks": 0}`, &targets)
+	defer errServer.Close()
+	defer errClient.Shutdown()
+	fee, err = NewFeeEstimatorBitcoind(errClient).EstimateFee(6)
+	assert.Equal(t, -1, fee)
+	assert.Equal(t, errors.New(fmt.Sprintf("%s %s", ErrorFeeEstimateMissing,
+		"Insufficient data or no feerate found")), err)
+
+	// no rpc client
+	_, err = NewFeeEstimatorBitcoind(nil).EstimateFee(6)
+	assert.Equal(t, errors.New(ErrorFeeEstimateMissing), err)
+}
+
+// Test mempool estimator picking recommended fee for each target
+func TestFeeEstimatorMempool(t *testing.T) {
+	server := newFeeApiFake(http.StatusOK,
+		`{"fastestFee": 40, "halfHourFee": 20, "hourFee": 10.2, "economyFee": 5, "minimumFee": 1}`)
+	defer server.Close()
+
+	estimator := NewFeeEstimatorMempool(server.URL)
+	assert.Equal(t, FeeEstimateMempool, estimator.Name())
+	for target, expected := range map[int]int{0: 40, 1: 40, 2: 20, 3: 20, 4: 11, 6: 11, 7: 5, 144: 5} {
+		fee, err := estimator.EstimateFee(target)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, expected, fee)
+	}
+	assert.Equal(t, DefaultFeeEstimatorUrl, NewFeeEstimatorMempool("").url)
+
+	// fee missing from response
+	missingServer := newFeeApiFake(http.StatusOK, `{"fastestFee": 40}`)
+	defer missingServer.Close()
+	_, err := NewFeeEstimatorMempool(missingServer.URL).EstimateFee(6)
+	assert.Equal(t, errors.New(fmt.Sprintf("%s %s", ErrorFeeEstimateMissing, "hourFee")), err)
+
+	// api errors
+	errServer := newFeeApiFake(http.StatusServiceUnavailable, ``)
+	defer errServer.Close()
+	fee, err := NewFeeEstimatorMempool(errServer.URL).EstimateFee(6)
+	assert.Equal(t, -1, fee)
+	assert.Equal(t, errors.New(fmt.Sprintf("%s %s", ErrorFeeEstimateFailed, "503 Service Unavailable")), err)
+	invalidServer := newFeeApiFake(http.StatusOK, `invalid`)
+	defer invalidServer.Close()
+	_, err = NewFeeEstimatorMempool(invalidServer.URL).EstimateFee(6)
+	assert.NotEqual(t, nil, err)
+}
+
+// Test median estimator ignoring failing estimators
+func TestFeeEstimatorMedian(t *testing.T) {
+	server := newFeeApiFake(http.StatusOK, `{"fastestFee": 40, "halfHourFee": 20, "hourFee": 10, "economyFee": 5}`)
+	defer server.Close()
+	errServer := newFeeApiFake(http.StatusInternalServerError, ``)
+	defer errServer.Close()
+
+	estimator := NewFeeEstimatorMedian([]FeeEstimator{
+		NewFeeEstimatorStatic(12), NewFeeEstimatorMempool(server.URL), NewFeeEstimatorStatic(100)})
+	assert.Equal(t, "median:static,mempool,static", estimator.Name())
+	fee, err := estimator.EstimateFee(6)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 12, fee)
+	fee, err = estimator.EstimateFee(1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 40, fee)
+
+	// even number of estimates after failure
+	estimator.estimators[2] = NewFeeEstimatorMempool(errServer.URL)
+	fee, err = estimator.EstimateFee(6)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 11, fee)
+
+	// all estimators failing
+	estimator = NewFeeEstimatorMedian([]FeeEstimator{NewFeeEstimatorMempool(errServer.URL)})
+	fee, err = estimator.EstimateFee(6)
+	assert.Equal(t, -1, fee)
+	assert.Equal(t, errors.New(ErrorFeeEstimatesFailed), err)
+}
+
+// Test fee estimator set from fees config
+func TestFeeEstimatorConfig(t *testing.T) {
+	config := &confpkg.Config{}
+	assert.Equal(t, FeeEstimateBitcoind, NewFeeEstimator(config).Name())
+
+	config.SetFeesConfig(confpkg.FeesConfig{MinFee: -1, MaxFee: -1, FeeIncrement: -1,
+		Estimators: []string{"static"}, ConfTarget: -1, StaticFee: 15, BumpFactor: -1,
+		BumpConfTarget: -1, BumpDeadlineMinutes: -1, MonthlyBudget: -1})
+	estimator := NewFeeEstimator(config)
+	fee, err := estimator.EstimateFee(6)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 15, fee)
+
+	config.SetFeesConfig(confpkg.FeesConfig{MinFee: -1, MaxFee: -1, FeeIncrement: -1,
+		Estimators: []string{"static"}, ConfTarget: -1, StaticFee: -1, BumpFactor: -1,
+		BumpConfTarget: -1, BumpDeadlineMinutes: -1, MonthlyBudget: -1})
+	fee, _ = NewFeeEstimator(config).EstimateFee(6)
+	assert.Equal(t, DefaultMinFee, fee)
+
+	config.SetFeesConfig(confpkg.FeesConfig{MinFee: -1, MaxFee: -1, FeeIncrement: -1,
+		Estimators: []string{"bitcoind", "mempool", "invalid"}, EstimatorUrl: "http://localhost/fees",
+		ConfTarget: -1, StaticFee: -1, BumpFactor: -1, BumpConfTarget: -1, BumpDeadlineMinutes: -1,
+		MonthlyBudget: -1})
+	estimator = NewFeeEstimator(config)
+	assert.Equal(t, "median:bitcoind,mempool", estimator.Name())
+	assert.Equal(t, "http://localhost/fees", estimator.(*FeeEstimatorMedian).estimators[1].(*FeeEstimatorMempool).url)
+
+	config.SetFeesConfig(confpkg.FeesConfig{MinFee: -1, MaxFee: -1, FeeIncrement: -1,
+		Estimators: []string{"invalid"}, ConfTarget: -1, StaticFee: -1, BumpFactor: -1,
+		BumpConfTarget: -1, BumpDeadlineMinutes: -1, MonthlyBudget: -1})
+	assert.Equal(t, FeeEstimateBitcoind, NewFeeEstimator(config).Name())
+}
@@ -6,8 +6,10 @@ package attestation
 
 import (
 	"testing"
+	"time"
 
 	"mainstay/config"
+	"mainstay/models"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -15,7 +17,9 @@ import (
 // Attest Fees test
 func TestAttestFees(t *testing.T) {
 
-	attestFees := NewAttestFees(config.FeesConfig{-1, -1, -1})
+	attestFees := NewAttestFees(config.FeesConfig{MinFee: -1, MaxFee: -1, FeeIncrement: -1,
+		ConfTarget: -1, StaticFee: -1, BumpFactor: -1, BumpConfTarget: -1, BumpDeadlineMinutes: -1,
+		MonthlyBudget: -1}, nil)
 	assert.Equal(t, 0, attestFees.GetPrevFee())
 
 	// test reset to minimum
@@ -56,34 +60,45 @@ func TestAttestFees(t *testing.T) {
 func TestAttestFeesWithConfig(t *testing.T) {
 
 	// test attest fees with new config
-	attestFees := NewAttestFees(config.FeesConfig{0, 10, 20})
+	attestFees := NewAttestFees(config.FeesConfig{MaxFee: 10, FeeIncrement: 20, ConfTarget: -1,
+		StaticFee: -1, BumpFactor: -1, BumpConfTarget: -1, BumpDeadlineMinutes: -1,
+		MonthlyBudget: -1}, nil)
 	assert.Equal(t, DefaultMinFee, attestFees.minFee)
 	assert.Equal(t, DefaultMaxFee, attestFees.maxFee)
 	assert.Equal(t, 20, attestFees.feeIncrement)
+	assert.Equal(t, FeeBumpRBF, attestFees.BumpStrategy())
 
 	attestFees.ResetFee(true)
 	assert.Equal(t, DefaultMinFee, attestFees.GetFee())
 
 	// test attest fees with new config
-	attestFees = NewAttestFees(config.FeesConfig{10, 5, 20})
+	attestFees = NewAttestFees(config.FeesConfig{MinFee: 10, MaxFee: 5, FeeIncrement: 20,
+		BumpStrategy: "cpfp", ConfTarget: -1, StaticFee: -1, BumpFactor: -1, BumpConfTarget: -1,
+		BumpDeadlineMinutes: -1, MonthlyBudget: -1}, nil)
 	assert.Equal(t, 10, attestFees.minFee)
 	assert.Equal(t, DefaultMaxFee, attestFees.maxFee)
 	assert.Equal(t, 20, attestFees.feeIncrement)
+	assert.Equal(t, FeeBumpCPFP, attestFees.BumpStrategy())
 
 	attestFees.ResetFee(true)
 	assert.Equal(t, 10, attestFees.GetFee())
 
 	// test attest fees with new config
-	attestFees = NewAttestFees(config.FeesConfig{10, 30, 0})
+	attestFees = NewAttestFees(config.FeesConfig{MinFee: 10, MaxFee: 30, BumpStrategy: "invalid",
+		ConfTarget: -1, StaticFee: -1, BumpFactor: -1, BumpConfTarget: -1, BumpDeadlineMinutes: -1,
+		MonthlyBudget: -1}, nil)
 	assert.Equal(t, 10, attestFees.minFee)
 	assert.Equal(t, 30, attestFees.maxFee)
 	assert.Equal(t, DefaultFeeIncrement, attestFees.feeIncrement)
+	assert.Equal(t, DefaultFeeBumpStrategy, attestFees.BumpStrategy())
 
 	attestFees.ResetFee(true)
 	assert.Equal(t, 10, attestFees.GetFee())
 
 	// test attest fees with new config
-	attestFees = NewAttestFees(config.FeesConfig{10, 0, 40})
+	attestFees = NewAttestFees(config.FeesConfig{MinFee: 10, FeeIncrement: 40, ConfTarget: -1,
+		StaticFee: -1, BumpFactor: -1, BumpConfTarget: -1, BumpDeadlineMinutes: -1,
+		MonthlyBudget: -1}, nil)
 	assert.Equal(t, 10, attestFees.minFee)
 	assert.Equal(t, DefaultMaxFee, attestFees.maxFee)
 	assert.Equal(t, 40, attestFees.feeIncrement)
@@ -92,11 +107,140 @@ func TestAttestFeesWithConfig(t *testing.T) {
 	assert.Equal(t, 10, attestFees.GetFee())
 
 	// test attest fees with new config
-	attestFees = NewAttestFees(config.FeesConfig{110, 110, -30})
+	attestFees = NewAttestFees(config.FeesConfig{MinFee: 110, MaxFee: 110, FeeIncrement: -30,
+		ConfTarget: -1, StaticFee: -1, BumpFactor: -1, BumpConfTarget: -1, BumpDeadlineMinutes: -1,
+		MonthlyBudget: -1}, nil)
 	assert.Equal(t, DefaultMinFee, attestFees.minFee)
 	assert.Equal(t, DefaultMaxFee, attestFees.maxFee)
 	assert.Equal(t, DefaultFeeIncrement, attestFees.feeIncrement)
 
 	attestFees.ResetFee(true)
 	assert.Equal(t, DefaultMinFee, attestFees.GetFee())
+
+	// test reset with fee estimator and confirmation target
+	attestFees = NewAttestFees(config.FeesConfig{MinFee: 5, MaxFee: 50, FeeIncrement: 5,
+		ConfTarget: 2, StaticFee: -1, BumpFactor: -1, BumpConfTarget: -1, BumpDeadlineMinutes: -1,
+		MonthlyBudget: -1}, NewFeeEstimatorStatic(20))
+	assert.Equal(t, 2, attestFees.confTarget)
+	attestFees.ResetFee()
+	assert.Equal(t, 20, attestFees.GetFee())
+	attestFees.ResetFee(true)
+	assert.Equal(t, 5, attestFees.GetFee())
+
+	// test estimates outside limits
+	attestFees.estimator = NewFeeEstimatorStatic(500)
+	attestFees.ResetFee()
+	assert.Equal(t, 50, attestFees.GetFee())
+	attestFees.estimator = NewFeeEstimatorMedian(nil)
+	attestFees.ResetFee()
+	assert.Equal(t, 5, attestFees.GetFee())
+	assert.Equal(t, DefaultFeeConfTarget, NewAttestFees(config.FeesConfig{MinFee: -1, MaxFee: -1,
+		FeeIncrement: -1, StaticFee: -1, BumpFactor: -1, BumpConfTarget: -1, BumpDeadlineMinutes: -1,
+		MonthlyBudget: -1}, nil).confTarget)
+}
+
+// Attest Fees bump policies test
+func TestAttestFeesBumpPolicy(t *testing.T) {
+	clock := NewAttestClockFake(time.Unix(1542121293, 0))
+
+	// test policy config defaults
+	attestFees := NewAttestFees(config.FeesConfig{MinFee: 10, MaxFee: 50, FeeIncrement: 5,
+		ConfTarget: -1, StaticFee: -1, BumpPolicy: "invalid", BumpFactor: 0.5,
+		MonthlyBudget: -1}, nil)
+	assert.Equal(t, DefaultFeeBumpPolicy, attestFees.BumpPolicy())
+	assert.Equal(t, DefaultBumpFactor, attestFees.bumpFactor)
+	assert.Equal(t, DefaultBumpConfTarget, attestFees.bumpConfTarget)
+	assert.Equal(t, DefaultBumpDeadline, attestFees.bumpDeadline)
+
+	// test increment policy recording bump decision
+	attestFees.clock = clock
+	attestFees.ResetFee(true)
+	attestFees.BumpFee()
+	assert.Equal(t, models.FeeBump{Time: 1542121293, Policy: FeeBumpPolicyIncrement, PrevFee: 10, Fee: 15,
+		Reason: "incremented by 5"}, attestFees.LastBump())
+
+	// test multiply policy rounding up and capped at max fee
+	attestFees = NewAttestFees(config.FeesConfig{MinFee: 10, MaxFee: 50, FeeIncrement: 5,
+		ConfTarget: -1, StaticFee: -1, BumpPolicy: "multiply", BumpFactor: 1.25, BumpConfTarget: -1,
+		BumpDeadlineMinutes: -1, MonthlyBudget: -1}, nil)
+	attestFees.clock = clock
+	attestFees.ResetFee(true)
+	for _, fee := range []int{13, 17, 22, 28, 35, 44, 50} {
+		attestFees.BumpFee()
+		assert.Equal(t, fee, attestFees.GetFee())
+	}
+	assert.Equal(t, "multiplied by factor 1.25; capped at max fee 50", attestFees.LastBump().Reason)
+
+	// test no bump once max fee reached as the replacement would pay the same fee
+	lastBump := attestFees.LastBump()
+	assert.Equal(t, false, attestFees.CanBumpFee())
+	assert.Equal(t, false, attestFees.BumpFee())
+	assert.Equal(t, 50, attestFees.GetFee())
+	assert.Equal(t, 44, attestFees.GetPrevFee())
+	assert.Equal(t, lastBump, attestFees.LastBump())
+
+	// test target policy estimates and BIP125 minimum increment
+	estimator := NewFeeEstimatorStatic(30)
+	attestFees = NewAttestFees(config.FeesConfig{MinFee: 10, MaxFee: 50, FeeIncrement: 5,
+		ConfTarget: -1, StaticFee: -1, BumpPolicy: "target", BumpFactor: -1, BumpConfTarget: 1,
+		BumpDeadlineMinutes: -1, MonthlyBudget: -1}, estimator)
+	attestFees.clock = clock
+	attestFees.ResetFee(true)
+	attestFees.BumpFee()
+	assert.Equal(t, 30, attestFees.GetFee())
+	assert.Equal(t, "estimated for target 1 blocks", attestFees.LastBump().Reason)
+	attestFees.BumpFee()
+	assert.Equal(t, 31, attestFees.GetFee())
+	assert.Equal(t, 30, attestFees.LastBump().PrevFee)
+	assert.Equal(t, "estimated for target 1 blocks; raised to BIP125 min relay increment 31",
+		attestFees.LastBump().Reason)
+
+	// test target policy falling back to increment without estimates
+	attestFees.estimator = NewFeeEstimatorMedian(nil)
+	attestFees.BumpFee()
+	assert.Equal(t, 36, attestFees.GetFee())
+	assert.Equal(t, "estimate unavailable, incremented by 5", attestFees.LastBump().Reason)
+
+	// test deadline policy estimating for blocks left to deadline
+	var targets []int
+	attestFees = NewAttestFees(config.FeesConfig{MinFee: 10, MaxFee: 50, FeeIncrement: 5,
+		ConfTarget: -1, StaticFee: -1, BumpPolicy: "deadline", BumpFactor: -1, BumpConfTarget: -1,
+		BumpDeadlineMinutes: 120, MonthlyBudget: -1},
+		feeEstimatorFunc(func(confTarget int) (int, error) {
+			targets = append(targets, confTarget)
+			return 10 + 40/confTarget, nil
+		}))
+	attestFees.clock = clock
+	attestFees.ResetFee(true)
+	attestFees.setSentTime(clock.Now())
+	targets = nil
+	clock.Advance(time.Hour)
+	attestFees.BumpFee()
+	assert.Equal(t, 16, attestFees.GetFee())
+	assert.Equal(t, "estimated for target 6 blocks with 1h0m0s to deadline", attestFees.LastBump().Reason)
+	clock.Advance(55 * time.Minute)
+	attestFees.BumpFee()
+	assert.Equal(t, 50, attestFees.GetFee())
+	assert.Equal(t, []int{6, 1}, targets)
+
+	// test deadline policy interpolating to max fee without estimates
+	attestFees.estimator = NewFeeEstimatorMedian(nil)
+	attestFees.ResetFee(true)
+	attestFees.setSentTime(clock.Now().Add(-30 * time.Minute))
+	attestFees.BumpFee()
+	assert.Equal(t, 20, attestFees.GetFee())
+	assert.Equal(t, "estimate unavailable, interpolated to max fee with 1h30m0s to deadline",
+		attestFees.LastBump().Reason)
+
+	// test deadline policy using max fee once deadline elapsed
+	clock.Advance(2 * time.Hour)
+	attestFees.BumpFee()
+	assert.Equal(t, 50, attestFees.GetFee())
+	assert.Equal(t, "deadline 2h0m0s elapsed", attestFees.LastBump().Reason)
 }
+
+// fee estimator calling the function provided
+type feeEstimatorFunc func(confTarget int) (int, error)
+
+func (f feeEstimatorFunc) EstimateFee(confTarget int) (int, error) { return f(confTarget) }
+func (f feeEstimatorFunc) Name() string                            { return "func" }
@@ -0,0 +1,139 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"sort"
+	"time"
+
+	"mainstay/log"
+	"mainstay/models"
+)
+
+// Runway projection of the staychain funds
+// The value of the staychain unspent and any topup unspent is projected
+// in attestations and days at the average fee of recent attestations,
+// and escalating alerts are raised as the runway falls below each of
+// the configured thresholds so that operators can top up in time
+
+// runway defaults
+const (
+	// period of recent attestations used for the average fee and frequency
+	RunwayWindow = 30 * 24 * time.Hour
+)
+
+// default runway days below which alerts are raised
+var DefaultRunwayAlertDays = []int{30, 14, 7}
+
+// warning consts
+const (
+	WarningRunwayLow             = "Staychain funds running low - top up required"
+	WarningInvalidRunwayAlertArg = "Invalid runway alert days config value"
+)
+
+// AttestRunway structure
+// Projection of the attestations and days the staychain funds can pay for
+type AttestRunway struct {
+	Value        int64   `json:"value"`
+	AvgFee       int64   `json:"avg_fee"`
+	PerDay       float64 `json:"attestations_per_day"`
+	Attestations int64   `json:"attestations"`
+	Days         float64 `json:"days"`
+}
+
+// Return runway alert thresholds in days from config ordered
+// from the highest to the lowest, ignoring invalid values
+func runwayAlertDays(alertDays []int) []int {
+	if len(alertDays) == 0 {
+		alertDays = DefaultRunwayAlertDays
+	}
+	var days []int
+	for _, d := range alertDays {
+		if d <= 0 {
+			log.Warnf("%s (%d)\n", WarningInvalidRunwayAlertArg, d)
+			continue
+		}
+		days = append(days, d)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(days)))
+	return days
+}
+
+// Project runway of the staychain funds value provided
+// The average fee and number of attestations per day are taken from
+// attestations confirmed within the runway window, or from the current
+// fee estimate and the attestation interval if there are no recent fees
+func (s *AttestService) projectRunway(value int64) AttestRunway {
+	runway := AttestRunway{Value: value}
+
+	now := s.clock.Now()
+	spend, spendErr := s.server.GetFeeSpend(models.FeeSpendPeriodDay, now.Add(-RunwayWindow))
+	if spendErr != nil {
+		log.Warnf("%s %v\n", WarningFeeSpend, spendErr)
+	}
+	var fees, count int64
+	for _, period := range spend {
+		fees += period.Fees
+		count += period.Count
+	}
+	if fees > 0 && count > 0 {
+		runway.AvgFee = fees / count
+
+		// attestation frequency over the days with recent fees
+		first, _ := time.Parse(models.FeeSpendFormat(models.FeeSpendPeriodDay), spend[0].Period)
+		days := now.Sub(first).Hours() / 24
+		if days < 1 {
+			days = 1
+		}
+		runway.PerDay = float64(count) / days
+	} else {
+		runway.AvgFee = calcSignedTxFee(s.attester.Fees.currentFee, s.attester.estimateAttestationVsize(1))
+		if interval := s.attestationInterval(); interval > 0 {
+			runway.PerDay = float64(24*time.Hour) / float64(interval)
+		}
+	}
+
+	if runway.AvgFee > 0 {
+		runway.Attestations = value / runway.AvgFee
+	}
+	if runway.PerDay > 0 {
+		runway.Days = float64(runway.Attestations) / runway.PerDay
+	}
+	return runway
+}
+
+// Update staychain funds runway and raise an alert each time the
+// runway falls below a lower threshold than previously alerted
+// Alerts are reset once the staychain is topped up, and not raised
+// if the runway cannot be projected without a fee or attestation interval
+func (s *AttestService) updateRunway(value int64) {
+	s.runway = s.projectRunway(value)
+	s.metrics.SetUnspent(s.runway.Value, s.runway.Attestations)
+	s.metrics.SetRunwayDays(s.runway.Days)
+	log.Infof("********** staychain runway: %d attestations, %.1f days at avg fee %d\n",
+		s.runway.Attestations, s.runway.Days, s.runway.AvgFee)
+	if s.runway.AvgFee == 0 || s.runway.PerDay == 0 {
+		return // alert level kept until the runway can be projected
+	}
+
+	level := 0
+	for i, days := range s.runwayAlertDays {
+		if s.runway.Days < float64(days) {
+			level = i + 1
+		}
+	}
+	if level < s.runwayAlertLevel {
+		log.Infof("********** staychain runway restored above %d days\n", s.runwayAlertDays[level])
+	} else if level > s.runwayAlertLevel {
+		threshold := s.runwayAlertDays[level-1]
+		log.Warnf("%s (%.1f days < %d days)\n", WarningRunwayLow, s.runway.Days, threshold)
+		event := s.newEvent(AEventRunwayLow, nil)
+		event.RunwayDays = s.runway.Days
+		event.RunwayThreshold = threshold
+		event.RunwayLevel = level
+		s.events.Publish(event)
+	}
+	s.runwayAlertLevel = level
+}
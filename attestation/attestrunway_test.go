@@ -0,0 +1,132 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	confpkg "mainstay/config"
+	"mainstay/db"
+	"mainstay/metrics"
+	"mainstay/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test runway projection of staychain funds and escalating alerts
+func TestAttestRunway(t *testing.T) {
+	dbFake := db.NewDbFake()
+	clock := NewAttestClockFake(time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC))
+	var events []AttestEvent
+	service := &AttestService{
+		config:              &confpkg.Config{},
+		server:              NewAttestServer(dbFake),
+		attester:            &AttestClient{Fees: AttestFees{currentFee: 10}},
+		attestation:         models.NewAttestationDefault(),
+		clock:               clock,
+		events:              NewAttestEventBus(),
+		metrics:             metrics.NewStaychainMetrics("runway"),
+		atimeMinAttestation: time.Hour,
+		runwayAlertDays:     runwayAlertDays(nil),
+	}
+	service.events.Subscribe(attestSubscriberFunc(func(event AttestEvent) {
+		events = append(events, event)
+	}))
+
+	// no recent fees - current fee of 110 vbyte attestations every hour
+	service.updateRunway(1100 * 24 * 40)
+	assert.Equal(t, AttestRunway{Value: 1100 * 24 * 40, AvgFee: 1100, PerDay: 24, Attestations: 960, Days: 40},
+		service.runway)
+	assert.Equal(t, 0, len(events))
+
+	// recent fees of two attestations a day over the last 10 days
+	// fees older than the runway window not included
+	dbFake.SaveAttestationInfo(models.AttestationInfo{Txid: "old", Time: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC).Unix(), Fee: 100000})
+	for day := 11; day <= 20; day++ {
+		for i := 0; i < 2; i++ {
+			dbFake.SaveAttestationInfo(models.AttestationInfo{Txid: fmt.Sprintf("%d-%d", day, i),
+				Time: time.Date(2024, 3, day, 2+i, 0, 0, 0, time.UTC).Unix(), Fee: 2000})
+		}
+	}
+	service.updateRunway(2000 * 40)
+	assert.Equal(t, int64(2000), service.runway.AvgFee)
+	assert.Equal(t, int64(40), service.runway.Attestations)
+	assert.InDelta(t, 20/9.5, service.runway.PerDay, 0.001)
+	assert.InDelta(t, 19, service.runway.Days, 0.001)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, AEventRunwayLow, events[0].Type)
+	assert.Equal(t, 30, events[0].RunwayThreshold)
+	assert.Equal(t, 1, events[0].RunwayLevel)
+
+	// alert escalates to the lowest threshold crossed
+	service.updateRunway(2000 * 10)
+	assert.InDelta(t, 4.75, service.runway.Days, 0.001)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, 7, events[1].RunwayThreshold)
+	assert.Equal(t, 3, events[1].RunwayLevel)
+	assert.InDelta(t, 4.75, events[1].RunwayDays, 0.001)
+	assert.Equal(t, service.runway, service.status().Runway)
+
+	// no repeated alerts at the same level
+	service.updateRunway(2000 * 9)
+	assert.Equal(t, 2, len(events))
+
+	// alerts reset after top up
+	service.updateRunway(2000 * 1000)
+	assert.Equal(t, 0, service.runwayAlertLevel)
+	service.updateRunway(2000 * 25)
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, 14, events[2].RunwayThreshold)
+}
+
+// Test no runway alerts without a fee or attestation interval to project from
+func TestAttestRunway_Unknown(t *testing.T) {
+	var events []AttestEvent
+	service := &AttestService{
+		config:          &confpkg.Config{},
+		server:          NewAttestServer(db.NewDbFake()),
+		attester:        &AttestClient{Fees: AttestFees{currentFee: 10}},
+		attestation:     models.NewAttestationDefault(),
+		clock:           NewAttestClockFake(time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC)),
+		events:          NewAttestEventBus(),
+		metrics:         metrics.NewStaychainMetrics("runwayunknown"),
+		runwayAlertDays: runwayAlertDays(nil),
+	}
+	service.events.Subscribe(attestSubscriberFunc(func(event AttestEvent) {
+		events = append(events, event)
+	}))
+
+	// no attestation interval
+	service.updateRunway(1100 * 24 * 40)
+	assert.Equal(t, int64(1100), service.runway.AvgFee)
+	assert.Equal(t, float64(0), service.runway.PerDay)
+	assert.Equal(t, 0, service.runwayAlertLevel)
+	assert.Equal(t, 0, len(events))
+
+	// no current fee
+	service.atimeMinAttestation = time.Hour
+	service.attester.Fees.currentFee = 0
+	service.updateRunway(1100 * 24 * 40)
+	assert.Equal(t, int64(0), service.runway.AvgFee)
+	assert.Equal(t, float64(24), service.runway.PerDay)
+	assert.Equal(t, 0, service.runwayAlertLevel)
+	assert.Equal(t, 0, len(events))
+
+	// alerts raised once the runway can be projected
+	service.attester.Fees.currentFee = 10
+	service.updateRunway(1100 * 24 * 10)
+	assert.InDelta(t, 10, service.runway.Days, 0.001)
+	assert.Equal(t, 2, service.runwayAlertLevel)
+	assert.Equal(t, 1, len(events))
+}
+
+// Test runway alert thresholds from config
+func TestAttestRunway_AlertDays(t *testing.T) {
+	assert.Equal(t, DefaultRunwayAlertDays, runwayAlertDays(nil))
+	assert.Equal(t, []int{30, 14, 7}, runwayAlertDays([]int{7, 30, -1, 14}))
+	assert.Equal(t, []int(nil), runwayAlertDays([]int{0}))
+}
@@ -5,6 +5,9 @@
 package attestation
 
 import (
+	"context"
+	"time"
+
 	"mainstay/db"
 	"mainstay/models"
 
@@ -68,6 +71,28 @@ func (s *AttestServer) UpdateLatestAttestation(attestation models.Attestation) e
 	return nil
 }
 
+// Roll back a confirmed attestation that is no longer part of the best chain
+// Attestation is stored as unconfirmed and its attestation info removed
+func (s *AttestServer) RollbackAttestation(attestation models.Attestation) error {
+	attestation.Confirmed = false
+	errSave := s.dbInterface.SaveAttestation(attestation)
+	if errSave != nil {
+		return errSave
+	}
+	return s.dbInterface.DeleteAttestationInfo(attestation.Txid)
+}
+
+// Update attestation service checkpoint in the server
+func (s *AttestServer) UpdateCheckpoint(checkpoint models.AttestationCheckpoint) error {
+	return s.dbInterface.SaveAttestationCheckpoint(checkpoint)
+}
+
+// Return latest attestation service checkpoint stored in the server
+// A nil checkpoint is returned if the service has not stored any yet
+func (s *AttestServer) GetCheckpoint() (*models.AttestationCheckpoint, error) {
+	return s.dbInterface.GetAttestationCheckpoint()
+}
+
 // Return Commitment hash of latest Attestation stored in the server
 func (s *AttestServer) GetLatestAttestationCommitmentHash(confirmed ...bool) (chainhash.Hash, error) {
 	// optional param to set confirmed flag - looks for confirmed only by default
@@ -90,6 +115,31 @@ func (s *AttestServer) GetLatestAttestationCommitmentHash(confirmed ...bool) (ch
 	return *commitmentHash, nil
 }
 
+// Update webhook outbox event in the server
+func (s *AttestServer) UpdateWebhookEvent(event models.WebhookEvent) error {
+	return s.dbInterface.SaveWebhookEvent(event)
+}
+
+// Save fee bump decision of an attestation in the server
+func (s *AttestServer) SaveFeeBump(feeBump models.FeeBump) error {
+	return s.dbInterface.SaveFeeBump(feeBump)
+}
+
+// Return webhook outbox events pending delivery
+func (s *AttestServer) GetPendingWebhookEvents() ([]models.WebhookEvent, error) {
+	return s.dbInterface.GetPendingWebhookEvents()
+}
+
+// Return fees of confirmed attestations since the time provided per day or month
+func (s *AttestServer) GetFeeSpend(period string, from time.Time) ([]models.FeeSpend, error) {
+	return s.dbInterface.GetFeeSpend(period, from)
+}
+
+// Return channel notified when client commitments are updated in the server
+func (s *AttestServer) WatchClientCommitments(ctx context.Context) (<-chan struct{}, error) {
+	return s.dbInterface.WatchClientCommitments(ctx)
+}
+
 // Return latest commitment stored in the server
 func (s *AttestServer) GetClientCommitment() (models.Commitment, error) {
 
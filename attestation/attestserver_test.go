@@ -7,6 +7,7 @@ package attestation
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"mainstay/db"
 	"mainstay/models"
@@ -483,3 +484,31 @@ func TestAttestServerGetAttestationCommitment(t *testing.T) {
 	commitment, err = server.GetAttestationCommitment(chainhash.Hash{}, false)
 	assert.Equal(t, errors.New(models.ErrorCommitmentListEmpty), err)
 }
+
+// Test fee spend aggregated per day and month
+func TestAttestServerFeeSpend(t *testing.T) {
+	dbFake := db.NewDbFake()
+	server := NewAttestServer(dbFake)
+	for i, info := range []struct {
+		day int
+		fee int64
+	}{{1, 1000}, {1, 1500}, {2, 2000}, {31, 500}} {
+		dbFake.SaveAttestationInfo(models.AttestationInfo{Txid: string(rune('a' + i)),
+			Time: time.Date(2024, 1, info.day, 10, 0, 0, 0, time.UTC).Unix(), Fee: info.fee})
+	}
+	dbFake.SaveAttestationInfo(models.AttestationInfo{Txid: "e",
+		Time: time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC).Unix(), Fee: 700})
+
+	spend, err := server.GetFeeSpend(models.FeeSpendPeriodDay, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []models.FeeSpend{
+		{Period: "2024-01-02", Fees: 2000, Count: 1},
+		{Period: "2024-01-31", Fees: 500, Count: 1},
+		{Period: "2024-02-01", Fees: 700, Count: 1}}, spend)
+
+	spend, err = server.GetFeeSpend(models.FeeSpendPeriodMonth, time.Time{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []models.FeeSpend{
+		{Period: "2024-01", Fees: 5000, Count: 4},
+		{Period: "2024-02", Fees: 700, Count: 1}}, spend)
+}
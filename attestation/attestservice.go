@@ -7,12 +7,16 @@ package attestation
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"math"
 	"sync"
 	"time"
 
 	confpkg "mainstay/config"
 	"mainstay/log"
+	"mainstay/metrics"
 	"mainstay/models"
 
 	"github.com/btcsuite/btcd/btcjson"
@@ -43,9 +47,20 @@ const (
 // error / warning consts
 const (
 	ErroUnspentNotFound = "No valid unspent found"
+	ErrorSignerSigs     = "Failed getting signatures from signers"
+	ErrorSigsMissing    = "Signatures missing"
+	ErrorSigsTimeout    = "Signatures not received from signers in time"
 
 	WarningInvalidATimeNewAttestationArg    = "Invalid new attestation time config value"
 	WarningInvalidATimeHandleUnconfirmedArg = "Invalid handle unconfirmed time config value"
+	WarningInvalidATimeMaxAttestationArg    = "Max attestation time lower than min attestation time"
+	WarningCommitmentWatch                  = "Client commitment notifications not available - polling"
+	WarningInvalidConfirmationDepthArg      = "Invalid confirmation depth config value"
+	WarningCheckpointSave                   = "Failed storing attestation checkpoint"
+	WarningCheckpointRestore                = "Failed restoring attestation checkpoint"
+	WarningDryRun                           = "Dry run mode - attestations will not be broadcast or stored"
+	WarningChildSigsMissing                 = "Signatures missing for child attestation - sending fee-only child"
+	WarningFeeBumpSave                      = "Failed storing fee bump"
 )
 
 // waiting time schedules
@@ -56,6 +71,9 @@ const (
 	// waiting time for sigs to arrive from multisig nodes
 	ATimeSigs = 1 * time.Minute
 
+	// waiting time between polls for sigs of streaming signers
+	ATimeSigsPoll = 5 * time.Second
+
 	// waiting time to next attestation attempt when skipping already attested commitment
 	ATimeSkip = 1 * time.Minute
 
@@ -63,13 +81,21 @@ const (
 	ATimeConfirmation = 15 * time.Minute
 
 	// waiting time between consecutive attestations after one was confirmed
+	// also used as the default minimum interval between attestations
 	DefaultATimeNewAttestation = 60 * time.Minute
 
+	// maximum waiting time until attesting an unchanged commitment
+	// heartbeat attestations are disabled by default
+	DefaultATimeMaxAttestation = 0 * time.Minute
+
 	// waiting time until we handle an attestation that has not been confirmed
 	// usually by increasing the fee of the previous transcation to speed up confirmation
 	DefaultATimeHandleUnconfirmed = 60 * time.Minute
 )
 
+// number of confirmations required before an attestation is considered final
+const DefaultConfirmationDepth = 1
+
 // AttestationService structure
 // Encapsulates Attest Client and connectivity
 // to a AttestServer for updates and requests
@@ -92,27 +118,61 @@ type AttestService struct {
 	// interface to signers to send commitments/transactions and receive signatures
 	signer AttestSigner
 
+	// clock used for all service timing and scheduling
+	clock AttestClock
+
+	// event bus publishing attestation events to subscribers
+	events *AttestEventBus
+
+	// prometheus metrics of the staychain
+	metrics *metrics.StaychainMetrics
+
 	// mainstain current attestation state, model and error state
 	state       AttestationState
 	attestation *models.Attestation
 	errorState  error
 	isRegtest   bool
-}
+	isDryRun    bool // build and sign attestations without broadcasting or storing them
 
-var (
 	atimeNewAttestation    time.Duration // delay between attestations - DEFAULTS to DefaultATimeNewAttestation
 	atimeHandleUnconfirmed time.Duration // delay until handling unconfirmed - DEFAULTS to DefaultATimeHandleUnconfirmed
+	atimeMinAttestation    time.Duration // min interval between attestations - DEFAULTS to atimeNewAttestation
+	atimeMaxAttestation    time.Duration // max interval until heartbeat attestation - DEFAULTS to DefaultATimeMaxAttestation
+	atimeBudgetAttestation time.Duration // min interval once the monthly fee budget is exceeded - DEFAULTS to DefaultBudgetIntervalFactor * atimeMinAttestation
+
+	monthlyBudget    int64  // fees in satoshis attestations can spend each month - DEFAULTS to no budget
+	monthlyFeeSpend  int64  // fees spent by attestations confirmed in the current month
+	isBudgetExceeded bool   // flag to keep track if attestation frequency is reduced for the budget
+	feeBudgetMonth   string // month the fee budget was last evaluated for
+
+	runway           AttestRunway // latest runway projection of the staychain funds
+	runwayAlertDays  []int        // runway days below which alerts are raised - DEFAULTS to DefaultRunwayAlertDays
+	runwayAlertLevel int          // number of runway alert thresholds crossed
+
+	commitmentNotify chan struct{} // notifications of new client commitments
 
-	attestDelay time.Duration // handle state delay
-	confirmTime time.Time     // handle confirmation timing
+	commands            chan attestCommand // operator commands handled in the Run loop
+	paused              bool               // flag to keep track if attestation has been paused
+	isForcedAttestation bool               // flag to attest next commitment regardless of intervals
+
+	confirmationDepth int64 // confirmations required for attestations - DEFAULTS to DefaultConfirmationDepth
+
+	attestDelay   time.Duration // handle state delay
+	confirmTime   time.Time     // handle confirmation timing
+	nextStateTime time.Time     // time next state is handled
 
 	isFeeBumped bool // flag to keep track if the fee has already been bumped
 	sigs        []wire.TxWitness
-)
+	spendHash   *chainhash.Hash // commitment hash the spent attestation output is tweaked with, set when sigs are requested
+
+	feeChildTx *wire.MsgTx // last fee-only child sent, replaced by further fee-only children of the same parent
+
+	sigsRequestTime time.Time // time sigs were requested from streaming signers
+}
 
 // NewAttestService returns a pointer to an AttestService instance
 // Initiates Attest Client and Attest AttestServer
-func NewAttestService(ctx context.Context, wg *sync.WaitGroup, server *AttestServer, signer AttestSigner, config *confpkg.Config) *AttestService {
+func NewAttestService(ctx context.Context, wg *sync.WaitGroup, server *AttestServer, signer AttestSigner, clock AttestClock, config *confpkg.Config) *AttestService {
 	// Check init txid validity
 	_, errInitTx := chainhash.NewHashFromStr(config.InitTx())
 	if errInitTx != nil {
@@ -121,51 +181,216 @@ func NewAttestService(ctx context.Context, wg *sync.WaitGroup, server *AttestSer
 
 	// initiate attestation client
 	attester := NewAttestClient(config)
-	isFeeBumped = false
+	attester.Fees.clock = clock // fee bump deadlines timed by the service clock
+	// topup inputs of fee-only child transactions are signed in the keystore
+	if keystoreSigner, ok := signer.(*AttestSignerKeystore); ok && attester.WalletPrivTopup == nil &&
+		keystoreSigner.topup != nil {
+		attester.TopupSigner = keystoreSigner
+	}
 
 	// initiate timing schedules
-	atimeNewAttestation = DefaultATimeNewAttestation
+	atimeNewAttestation := DefaultATimeNewAttestation
 	if config.TimingConfig().NewAttestationMinutes > 0 {
 		atimeNewAttestation = time.Duration(config.TimingConfig().NewAttestationMinutes) * time.Minute
 	} else {
 		log.Warnf("%s (%v)\n", WarningInvalidATimeNewAttestationArg, config.TimingConfig().NewAttestationMinutes)
 	}
 	log.Infof("Time new attestation set to: %v\n", atimeNewAttestation)
-	atimeHandleUnconfirmed = DefaultATimeHandleUnconfirmed
+	atimeHandleUnconfirmed := DefaultATimeHandleUnconfirmed
 	if config.TimingConfig().HandleUnconfirmedMinutes > 0 {
 		atimeHandleUnconfirmed = time.Duration(config.TimingConfig().HandleUnconfirmedMinutes) * time.Minute
 	} else {
 		log.Warnf("%s (%v)\n", WarningInvalidATimeHandleUnconfirmedArg, config.TimingConfig().HandleUnconfirmedMinutes)
 	}
 	log.Infof("Time handle unconfirmed set to: %v\n", atimeHandleUnconfirmed)
+	atimeMinAttestation := atimeNewAttestation
+	if config.TimingConfig().MinAttestationMinutes > 0 {
+		atimeMinAttestation = time.Duration(config.TimingConfig().MinAttestationMinutes) * time.Minute
+	}
+	log.Infof("Time min attestation set to: %v\n", atimeMinAttestation)
+	atimeMaxAttestation := DefaultATimeMaxAttestation
+	if config.TimingConfig().MaxAttestationMinutes > 0 {
+		atimeMaxAttestation = time.Duration(config.TimingConfig().MaxAttestationMinutes) * time.Minute
+		if atimeMaxAttestation < atimeMinAttestation {
+			log.Warnf("%s (%v)\n", WarningInvalidATimeMaxAttestationArg, config.TimingConfig().MaxAttestationMinutes)
+			atimeMaxAttestation = atimeMinAttestation
+		}
+	}
+	log.Infof("Time max attestation set to: %v\n", atimeMaxAttestation)
+	atimeBudgetAttestation := DefaultBudgetIntervalFactor * atimeMinAttestation
+	if config.TimingConfig().BudgetAttestationMinutes > 0 {
+		atimeBudgetAttestation = time.Duration(config.TimingConfig().BudgetAttestationMinutes) * time.Minute
+		if atimeBudgetAttestation < atimeMinAttestation {
+			log.Warnf("%s (%v)\n", WarningInvalidATimeBudgetArg, config.TimingConfig().BudgetAttestationMinutes)
+			atimeBudgetAttestation = atimeMinAttestation
+		}
+	}
+	monthlyBudget := int64(0)
+	if config.FeesConfig().MonthlyBudget > 0 {
+		monthlyBudget = int64(config.FeesConfig().MonthlyBudget)
+		log.Infof("Monthly fee budget set to: %d\n", monthlyBudget)
+		log.Infof("Time budget attestation set to: %v\n", atimeBudgetAttestation)
+	}
+
+	// initiate confirmation depth
+	confirmationDepth := int64(DefaultConfirmationDepth)
+	if config.ConfirmationDepth() > 0 {
+		confirmationDepth = int64(config.ConfirmationDepth())
+	} else {
+		log.Warnf("%s (%v)\n", WarningInvalidConfirmationDepthArg, config.ConfirmationDepth())
+	}
+	log.Infof("Confirmation depth set to: %d\n", confirmationDepth)
+
+	if config.DryRun() {
+		log.Warnln(WarningDryRun)
+	}
 
-	return &AttestService{ctx, wg, config, attester, server, signer, AStateInit, models.NewAttestationDefault(), nil, config.Regtest()}
+	return &AttestService{
+		ctx:                    ctx,
+		wg:                     wg,
+		config:                 config,
+		attester:               attester,
+		server:                 server,
+		signer:                 signer,
+		clock:                  clock,
+		events:                 NewAttestEventBus(),
+		metrics:                metrics.NewStaychainMetrics(config.Name()),
+		state:                  AStateInit,
+		attestation:            models.NewAttestationDefault(),
+		errorState:             nil,
+		isRegtest:              config.Regtest(),
+		isDryRun:               config.DryRun(),
+		atimeNewAttestation:    atimeNewAttestation,
+		atimeHandleUnconfirmed: atimeHandleUnconfirmed,
+		atimeMinAttestation:    atimeMinAttestation,
+		atimeMaxAttestation:    atimeMaxAttestation,
+		atimeBudgetAttestation: atimeBudgetAttestation,
+		monthlyBudget:          monthlyBudget,
+		runwayAlertDays:        runwayAlertDays(config.FeesConfig().RunwayAlertDays),
+		commitmentNotify:       make(chan struct{}, 1),
+		commands:               make(chan attestCommand),
+		confirmationDepth:      confirmationDepth,
+		isFeeBumped:            false,
+	}
 }
 
 // Run Attest Service
 func (s *AttestService) Run() {
 	defer s.wg.Done()
 
-	attestDelay = 10 * time.Second // add some delay for subscribers to have time to set up
+	s.attestDelay = 10 * time.Second // add some delay for subscribers to have time to set up
+
+	// resume from the latest checkpoint if the service was previously stopped
+	s.restoreCheckpoint()
 
+	// get notified of new client commitments
+	s.watchCommitments()
+
+	s.nextStateTime = s.clock.Now().Add(s.attestDelay)
+	timer := s.clock.NewTimer(s.attestDelay)
 	for { //Doing attestations using attestation client and waiting for transaction confirmation
-		timer := time.NewTimer(attestDelay)
 		select {
 		case <-s.ctx.Done():
+			timer.Stop()
 			log.Infoln("Shutting down Attestation Service...")
 			return
-		case <-timer.C:
-			// do next attestation state
+		case <-s.commitmentNotify:
+			// new commitments only handled when waiting for the next commitment
+			if s.paused || s.state != AStateNextCommitment {
+				continue
+			}
+			log.Infoln("********** received client commitment notification")
+			timer.Stop()
 			s.doAttestation()
-
-			// for testing - overwrite delay
-			if s.isRegtest {
-				attestDelay = 5 * time.Second
+		case cmd := <-s.commands:
+			// handle operator command and current state if required
+			if !s.handleCommand(cmd) {
+				if s.paused {
+					timer.Stop()
+				}
+				continue
 			}
+			timer.Stop()
+			s.doAttestation()
+		case <-timer.C():
+			// attestation states not handled while paused
+			if s.paused {
+				continue
+			}
+			// do next attestation state
+			s.doAttestation()
+		}
 
-			log.Infof("********** sleeping for: %s ...\n", attestDelay.String())
+		// for testing - overwrite delay
+		if s.isRegtest {
+			s.attestDelay = 5 * time.Second
 		}
+
+		log.Infof("********** sleeping for: %s ...\n", s.attestDelay.String())
+		s.nextStateTime = s.clock.Now().Add(s.attestDelay)
+		timer = s.clock.NewTimer(s.attestDelay)
+	}
+}
+
+// Subscribe to attestation events published by the service
+func (s *AttestService) Subscribe(subscriber AttestSubscriber) {
+	s.events.Subscribe(subscriber)
+}
+
+// Publish attestation event for the current attestation and service state
+func (s *AttestService) publishEvent(eventType AttestEventType, err error) {
+	s.events.Publish(s.newEvent(eventType, err))
+}
+
+// Return new event of the event type and error provided for the current attestation
+func (s *AttestService) newEvent(eventType AttestEventType, err error) AttestEvent {
+	event := AttestEvent{
+		Type:       eventType,
+		Staychain:  s.config.Name(),
+		Txid:       s.attestation.Txid.String(),
+		MerkleRoot: s.attestation.CommitmentHash().String(),
+		Fee:        s.attester.Fees.GetFee(),
+		State:      s.state,
+		Time:       s.clock.Now(),
+	}
+	if err != nil {
+		event.Error = err.Error()
 	}
+	return event
+}
+
+// Notify service of new client commitments
+// Allows attesting new commitments as soon as the min attestation
+// interval has passed instead of waiting for the next polling attempt
+func (s *AttestService) NotifyCommitment() {
+	select {
+	case s.commitmentNotify <- struct{}{}:
+	default: // notification already pending
+	}
+}
+
+// Forward client commitment updates from the server to the service
+// If notifications are not supported the service falls back to polling
+func (s *AttestService) watchCommitments() {
+	watch, watchErr := s.server.WatchClientCommitments(s.ctx)
+	if watchErr != nil {
+		log.Warnf("%s %v\n", WarningCommitmentWatch, watchErr)
+		return
+	}
+	go func() {
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case _, ok := <-watch:
+				if !ok {
+					log.Warnln(WarningCommitmentWatch)
+					return
+				}
+				s.NotifyCommitment()
+			}
+		}
+	}()
 }
 
 // AStateError
@@ -202,12 +427,14 @@ func (s *AttestService) stateInitUnconfirmed(unconfirmedTxid chainhash.Hash) {
 		log.Info("********** failed to find unconfirmed transaction in mempool, re-initialising attestation")
 		return // will rebound to init
 	}
-	confirmTime = time.Unix(walletTx.Time, 0)
+	s.confirmTime = time.Unix(walletTx.Time, 0)
+	s.attester.Fees.setSentTime(s.confirmTime)
 
 	//set fee to unconfirmed tx's fee
-	feePerByte := int(walletTx.Fee*float64(Coin)) / s.attestation.Tx.SerializeSize() // fee in satoshis / tx size
+	vsize := s.attester.estimateSignedTxVsize(&s.attestation.Tx)
+	feePerByte := int(math.Round(walletTx.Fee*Coin) / float64(vsize)) // fee in satoshis / estimated tx vsize
 	s.attester.Fees.setCurrentFee(feePerByte)
-	isFeeBumped = false // in case we bumped fees but then attestation creation/signing/sending failed
+	s.isFeeBumped = false // in case we bumped fees but then attestation creation/signing/sending failed
 }
 
 // part of AStateInit
@@ -226,24 +453,37 @@ func (s *AttestService) stateInitUnspent(unspent btcjson.ListUnspentResult) {
 		s.attestation.Confirmed = true
 		rawTx, _ := s.config.MainClient().GetRawTransaction(unspentTxid)
 		walletTx, _ := s.config.MainClient().GetTransaction(unspentTxid)
-		s.attestation.Tx = *rawTx.MsgTx()  // set msgTx
-		s.attestation.UpdateInfo(walletTx) // set tx info
+		s.attestation.Tx = *rawTx.MsgTx()     // set msgTx
+		s.updateInfo(s.attestation, walletTx) // set tx info
+		s.metrics.SetLastConfirmed(time.Unix(walletTx.BlockTime, 0))
 
-		errUpdate := s.server.UpdateLatestAttestation(*s.attestation)
+		errParent := s.confirmParentAttestation()
+		if s.setFailure(errParent) {
+			return // will rebound to init
+		}
+		errUpdate := s.updateLatestAttestation()
 		if s.setFailure(errUpdate) {
 			return // will rebound to init
 		}
 
 		s.attester.Fees.ResetFee(s.isRegtest) // reset client fees
-		// set delay to the difference between atimeNewAttestation and time since last attestation
-		lastDelay := time.Since(time.Unix(s.attestation.Info.Time, 0))
-		if atimeNewAttestation > lastDelay {
-			attestDelay = atimeNewAttestation - lastDelay
+		s.updateFeeBudget()                   // check monthly fee budget
+		// set delay to the difference between the attestation interval and time since last attestation
+		s.confirmTime = time.Unix(s.attestation.Info.Time, 0)
+		lastDelay := s.clock.Since(s.confirmTime)
+		if s.attestationInterval() > lastDelay {
+			s.attestDelay = s.attestationInterval() - lastDelay
 		}
 	} else {
 		log.Infoln("********** found unspent transaction, initiating staychain")
 		s.attestation = models.NewAttestationDefault()
 	}
+	// project runway of the staychain unspent and any topup unspent
+	unspentList := []btcjson.ListUnspentResult{unspent}
+	if topupFound, topupUnspent, topupErr := s.attester.findTopupUnspent(); topupErr == nil && topupFound {
+		unspentList = append(unspentList, topupUnspent)
+	}
+	s.updateUnspentRunway(unspentList)
 
 	confirmedHash := s.attestation.CommitmentHash()
 	if s.attester.txid0 == unspentTxid.String() {
@@ -276,7 +516,7 @@ func (s *AttestService) stateInitWalletFailure() {
 	}
 
 	log.Infof("********** importing latest confirmed addr: %s ...\n", paytoaddr.String())
-	importErr := s.attester.ImportAttestationAddr(paytoaddr)
+	importErr := s.importAttestationAddr(paytoaddr)
 	if s.setFailure(importErr) {
 		return // will rebound to init
 	}
@@ -293,7 +533,7 @@ func (s *AttestService) stateInitWalletFailure() {
 		return // will rebound to init
 	}
 	log.Infof("********** importing latest unconfirmed addr: %s ...\n", paytoaddr.String())
-	importErr = s.attester.ImportAttestationAddr(paytoaddr)
+	importErr = s.importAttestationAddr(paytoaddr)
 	if s.setFailure(importErr) {
 		return // will rebound to init
 	}
@@ -305,7 +545,7 @@ func (s *AttestService) stateInitWalletFailure() {
 	}
 
 	log.Infof("********** importing base init addr: %s ...\n", paytoaddr.String())
-	importErr = s.attester.ImportAttestationAddr(paytoaddr)
+	importErr = s.importAttestationAddr(paytoaddr)
 	if s.setFailure(importErr) {
 		return // will rebound to init
 	}
@@ -346,27 +586,124 @@ func (s *AttestService) doStateInit() {
 	}
 }
 
+// part of AStateNextCommitment
+// check that the latest confirmed attestation is still part of the best chain
+// if its block has been reorged out roll back the attestation to unconfirmed
+// re-broadcast the attestation if required and set state to AStateAwaitConfirmation
+// returns true if the service state has changed
+func (s *AttestService) stateNextCommitmentReorg() bool {
+	if !s.attestation.Confirmed || s.attestation.Info.Blockhash == "" {
+		return false
+	}
+
+	walletTx, getTxErr := s.config.MainClient().GetTransaction(&s.attestation.Txid)
+	if s.setFailure(getTxErr) {
+		return true // will rebound to init
+	}
+	if walletTx.BlockHash != "" && walletTx.Confirmations > 0 {
+		// attestation included in a different block after a reorg
+		if walletTx.BlockHash != s.attestation.Info.Blockhash {
+			log.Warnf("********** attestation moved to block: %s\n", walletTx.BlockHash)
+			s.updateInfo(s.attestation, walletTx)
+			errUpdate := s.updateLatestAttestation()
+			if s.setFailure(errUpdate) {
+				return true // will rebound to init
+			}
+		}
+		return false
+	}
+
+	log.Warnf("********** attestation block no longer in best chain: %s\n", s.attestation.Info.Blockhash)
+	if !s.isDryRun {
+		rollbackErr := s.server.RollbackAttestation(*s.attestation)
+		if s.setFailure(rollbackErr) {
+			return true // will rebound to init
+		}
+	}
+	s.attestation.Confirmed = false
+	s.attestation.Info = models.AttestationInfo{}
+
+	// update clients with last confirmed commitment
+	lastCommitmentHash, latestErr := s.server.GetLatestAttestationCommitmentHash()
+	if s.setFailure(latestErr) {
+		return true // will rebound to init
+	}
+	s.signer.SendConfirmedHash((&lastCommitmentHash).CloneBytes())
+
+	// re-broadcast attestation if not returned to the mempool
+	_, mempoolErr := s.config.MainClient().GetMempoolEntry(s.attestation.Txid.String())
+	if mempoolErr != nil && !s.isDryRun {
+		log.Infof("********** re-broadcasting attestation txid: %s\n", s.attestation.Txid.String())
+		_, sendErr := s.attester.sendAttestation(&s.attestation.Tx)
+		if s.setFailure(sendErr) {
+			return true // will rebound to init
+		}
+	}
+
+	s.state = AStateAwaitConfirmation // update attestation state
+	s.attestDelay = ATimeConfirmation // add confirmation waiting time
+	s.confirmTime = s.clock.Now()     // set time for awaiting confirmation
+	s.isFeeBumped = false             // reset fee bumped flag
+	return true
+}
+
 // AStateNextCommitment
+// - Check latest attestation has not been reorged out
 // - Get latest commitment from server
 // - Check if commitment has already been attested
+// - Check min attestation interval has passed for new commitments
+// - Check max attestation interval has passed for heartbeat attestations
+// - Skip interval checks if attestation has been forced by operator
 // - Send commitment to client signers
 // - Initialise new attestation
 func (s *AttestService) doStateNextCommitment() {
 	log.Infoln("*AttestService* NEW ATTESTATION COMMITMENT")
 
+	// forced attestations only apply to the current attempt
+	isForcedAttestation := s.isForcedAttestation
+	s.isForcedAttestation = false
+
+	// handle latest attestation reorged out of the best chain
+	if s.stateNextCommitmentReorg() {
+		return
+	}
+
+	// re-evaluate monthly fee budget once a new month starts
+	s.checkFeeBudget()
+
 	// get latest commitment hash from server
 	latestCommitment, latestErr := s.server.GetClientCommitment()
 	if s.setFailure(latestErr) {
 		return // will rebound to init
 	}
 	latestCommitmentHash := latestCommitment.GetCommitmentHash()
+	s.metrics.SetClientSlots(activeClientSlots(latestCommitment))
+
+	// time since last attestation including signature waiting time
+	// so that attestations are sent ~atimeMinAttestation apart
+	lastDelay := s.clock.Since(s.confirmTime) + ATimeSigs
 
 	// check if commitment has already been attested
 	log.Infof("********** received commitment hash: %s\n", latestCommitmentHash.String())
-	if latestCommitmentHash == s.attestation.CommitmentHash() {
-		log.Infof("********** Skipping attestation - Client commitment already attested")
-		attestDelay = ATimeSkip // sleep
-		return                  // will remain at the same state
+	if isForcedAttestation {
+		log.Infof("********** Forced attestation - Skipping attestation interval checks")
+	} else if latestCommitmentHash == s.attestation.CommitmentHash() {
+		if s.atimeMaxAttestation == 0 || lastDelay < s.atimeMaxAttestation {
+			log.Infof("********** Skipping attestation - Client commitment already attested")
+			s.attestDelay = ATimeSkip // sleep
+			if s.atimeMaxAttestation > 0 && s.atimeMaxAttestation-lastDelay < s.attestDelay {
+				s.attestDelay = s.atimeMaxAttestation - lastDelay
+			}
+			return // will remain at the same state
+		}
+		log.Infof("********** Heartbeat attestation - Client commitment unchanged for %s\n", lastDelay.String())
+	} else if lastDelay < s.attestationInterval() {
+		log.Infof("********** Delaying attestation - Min attestation time not reached")
+		s.attestDelay = s.attestationInterval() - lastDelay // sleep
+		if s.isBudgetExceeded && s.untilNextMonth() < s.attestDelay {
+			s.attestDelay = s.untilNextMonth() // re-evaluate budget in the new month
+		}
+		return // will remain at the same state
 	}
 
 	// initialise new attestation with commitment
@@ -395,7 +732,7 @@ func (s *AttestService) doStateNewAttestation() {
 		return // will rebound to init
 	}
 	log.Infof("********** importing pay-to addr: %s ...\n", paytoaddr.String())
-	importErr := s.attester.ImportAttestationAddr(paytoaddr, false) // no rescan needed here
+	importErr := s.importAttestationAddr(paytoaddr, false) // no rescan needed here
 	if s.setFailure(importErr) {
 		return // will rebound to init
 	}
@@ -416,6 +753,7 @@ func (s *AttestService) doStateNewAttestation() {
 			log.Infof("********** found topup unspent: %s\n", topupUnspent.TxID)
 			unspentList = append(unspentList, topupUnspent)
 		}
+		s.updateUnspentRunway(unspentList)
 
 		// create attestation transaction for the list of unspents paying to addr generated
 		newTx, createErr := s.attester.createAttestation(paytoaddr, unspentList)
@@ -438,35 +776,28 @@ func (s *AttestService) doStateNewAttestation() {
 			lastCommitmentHash = chainhash.Hash{}
 		}
 
-		// publish pre signed transaction
-		txPreImages, getPreImagesErr := s.attester.getTransactionPreImages(lastCommitmentHash, newTx)
-		if s.setFailure(getPreImagesErr) {
-			return // will rebound to init
-		}
-		// get pre image bytes
-		var txPreImageBytes [][]byte
-		for _, txPreImage := range txPreImages {
-			var txBytesBuffer bytes.Buffer
-			txPreImage.Serialize(&txBytesBuffer)
-			txPreImageBytes = append(txPreImageBytes, txBytesBuffer.Bytes())
-		}
-		s.signer.ReSubscribe()
-		s.signer.SendTxPreImages(txPreImageBytes)
+		s.spendHash = &lastCommitmentHash
 
-		merkle_root := lastCommitmentHash.String()
-		sigHashes, err := s.attester.calculateSighashes(newTx)
-		if err != nil {
-			log.Infof("Error in calculating sighash %v", err)
+		// publish pre signed transaction to streaming signers
+		// signatures are collected in AStateSignAttestation once ready
+		isStream, streamErr := s.requestSigsStream(newTx, lastCommitmentHash)
+		if s.setFailure(streamErr) {
+			return // will rebound to init
+		} else if isStream {
+			s.state = AStateSignAttestation // update attestation state
+			s.attestDelay = ATimeSigsPoll   // poll for sigs
+			return
 		}
-		sigs = s.signer.GetSigs(sigHashes, merkle_root)
 
-		for sigForInput, _ := range sigs {
-			log.Infof("********** received %d signatures for input %d \n",
-				len(sigs[sigForInput]), sigForInput)
+		// publish pre signed transaction and get signatures
+		sigs, sigsErr := s.requestSigs(newTx, lastCommitmentHash)
+		if s.setFailure(sigsErr) {
+			return // will rebound to init
 		}
+		s.sigs = sigs
 
 		s.state = AStateSignAttestation // update attestation state
-		attestDelay = ATimeSigs         // add sigs waiting time
+		s.attestDelay = ATimeSigs       // add sigs waiting time
 	} else {
 		s.setFailure(errors.New(ErroUnspentNotFound))
 		return // will rebound to init
@@ -475,23 +806,32 @@ func (s *AttestService) doStateNewAttestation() {
 
 // AStateSignAttestation
 // - Collect signatures from client signers
+// - Poll streaming signers until signatures are ready
 // - Combine signatures them and sign the attestation transaction
 func (s *AttestService) doStateSignAttestation() {
 	log.Infoln("*AttestService* SIGN ATTESTATION")
 
-	// get last confirmed commitment from server
-	lastCommitmentHash, latestErr := s.server.GetLatestAttestationCommitmentHash()
-	if s.setFailure(latestErr) {
+	// get commitment hash the spent output is tweaked with, which is the
+	// unconfirmed parent commitment for child attestations
+	spendHash, spendErr := s.getSpendHash()
+	if s.setFailure(spendErr) {
 		return // will rebound to init
 	}
 
-	if s.attester.txid0 == s.attestation.Tx.TxIn[0].PreviousOutPoint.Hash.String() {
-		log.Infoln("********** base transaction, zero tweaking for signature")
-		lastCommitmentHash = chainhash.Hash{}
+	// collect signatures of streaming signers once these are ready
+	if s.sigs == nil {
+		sigs, isReady, collectErr := s.collectSigsStream(spendHash)
+		if s.setFailure(collectErr) {
+			return // will rebound to init
+		} else if !isReady {
+			s.attestDelay = ATimeSigsPoll
+			return // will remain at the same state
+		}
+		s.sigs = sigs
 	}
 
-	// sign attestation with combined sigs and last commitment
-	signedTx, signErr := s.attester.signAttestation(&s.attestation.Tx, sigs, lastCommitmentHash)
+	// sign attestation with combined sigs and spent output commitment
+	signedTx, signErr := s.attester.signAttestation(&s.attestation.Tx, s.sigs, spendHash)
 	if s.setFailure(signErr) {
 		log.Infof("********** signer failure. resubscribing to signers...")
 		s.signer.ReSubscribe()
@@ -503,13 +843,31 @@ func (s *AttestService) doStateSignAttestation() {
 	s.state = AStatePreSendStore // update attestation state
 }
 
+// Return commitment hash the output spent by the attestation is tweaked
+// with, as set when sigs were requested, or the last confirmed commitment
+// hash if not set, e.g. when resuming from checkpoints stored without it
+func (s *AttestService) getSpendHash() (chainhash.Hash, error) {
+	if s.spendHash != nil {
+		return *s.spendHash, nil
+	}
+	lastCommitmentHash, latestErr := s.server.GetLatestAttestationCommitmentHash()
+	if latestErr != nil {
+		return chainhash.Hash{}, latestErr
+	}
+	if s.attester.txid0 == s.attestation.Tx.TxIn[0].PreviousOutPoint.Hash.String() {
+		log.Infoln("********** base transaction, zero tweaking for signature")
+		return chainhash.Hash{}, nil
+	}
+	return lastCommitmentHash, nil
+}
+
 // AStatePreSendStore
 // - Store unconfirmed attestation to server prior to sending
 func (s *AttestService) doStatePreSendStore() {
 	log.Infoln("*AttestService* PRE SEND STORE")
 
 	// update server with latest unconfirmed attestation, in case the service fails
-	errUpdate := s.server.UpdateLatestAttestation(*s.attestation)
+	errUpdate := s.updateLatestAttestation()
 	if s.setFailure(errUpdate) {
 		return // will rebound to init
 	}
@@ -517,13 +875,41 @@ func (s *AttestService) doStatePreSendStore() {
 	s.state = AStateSendAttestation // update attestation state
 }
 
+// part of AStateSendAttestation
+// handle dry run mode by testing the signed attestation with testmempoolaccept
+// without broadcasting it and logging the signed transaction
+// set service state to AStateNextCommitment as if the attestation was confirmed
+func (s *AttestService) stateSendAttestationDryRun() {
+	txid, testErr := s.attester.testAttestation(&s.attestation.Tx)
+	if s.setFailure(testErr) {
+		return // will rebound to init
+	}
+	var txBytesBuffer bytes.Buffer
+	s.attestation.Tx.Serialize(&txBytesBuffer)
+	log.Infof("********** dry run attestation accepted with txid: (%s)\n", txid)
+	log.Infof("********** dry run attestation tx: %s\n", hex.EncodeToString(txBytesBuffer.Bytes()))
+
+	s.attester.Fees.ResetFee(s.isRegtest) // reset client fees
+
+	s.state = AStateNextCommitment // update attestation state
+	s.confirmTime = s.clock.Now()  // next attestation timed from the dry run
+	s.isFeeBumped = false          // reset fee bumped flag
+	s.attestDelay = s.atimeMinAttestation - ATimeSigs
+}
+
 // AStateSendAttestation
 // - Send attestation transaction through the client to the network
+// - In dry run mode only test the attestation against the mempool
 // - add ATimeConfirmation waiting time
 // - start time for confirmation time
 func (s *AttestService) doStateSendAttestation() {
 	log.Infoln("*AttestService* SEND ATTESTATION")
 
+	if s.isDryRun {
+		s.stateSendAttestationDryRun()
+		return
+	}
+
 	// sign attestation with combined signatures and send through client to network
 	txid, attestationErr := s.attester.sendAttestation(&s.attestation.Tx)
 	if s.setFailure(attestationErr) {
@@ -532,44 +918,56 @@ func (s *AttestService) doStateSendAttestation() {
 	s.attestation.Txid = txid
 	log.Infof("********** attestation transaction committed with txid: (%s)\n", txid)
 
+	// bump deadlines apply from the first time the attestation is sent
+	if len(s.attestation.Info.FeeBumps) == 0 {
+		s.attester.Fees.setSentTime(s.clock.Now())
+	}
+
 	s.state = AStateAwaitConfirmation // update attestation state
-	attestDelay = ATimeConfirmation   // add confirmation waiting time
-	confirmTime = time.Now()          // set time for awaiting confirmation
-	isFeeBumped = false               // reset fee bumped flag
+	s.attestDelay = ATimeConfirmation // add confirmation waiting time
+	s.confirmTime = s.clock.Now()     // set time for awaiting confirmation
+	s.isFeeBumped = false             // reset fee bumped flag
+
+	s.clearFailure()
+	s.publishEvent(AEventAttestationSent, nil)
 }
 
 // AStateAwaitConfirmation
-// - Check if the attestation transaction has been confirmed in the main network
-// - If confirmed, initiate new attestation, update server and signer clients
-// - Check if ATIME_HANDLE_UNCONFIRMED has elapsed since attestation was sent
-// - add ATIME_NEW_ATTESTATION if confirmed or ATimeConfirmation if not to waiting time
+//   - Check if the attestation transaction has been confirmed in the main network
+//   - If confirmed with the required confirmation depth, initiate new attestation,
+//     update server and signer clients
+//   - Check if ATIME_HANDLE_UNCONFIRMED has elapsed since attestation was sent
+//   - add ATIME_NEW_ATTESTATION if confirmed or ATimeConfirmation if not to waiting time
 func (s *AttestService) doStateAwaitConfirmation() {
 	log.Infof("*AttestService* AWAITING CONFIRMATION \ntxid: (%s)\ncommitment: (%s)\n", s.attestation.Txid.String(), s.attestation.CommitmentHash().String())
 
-	// if attestation has been unconfirmed for too long
-	// set to handle unconfirmed state
-	if time.Since(confirmTime) > atimeHandleUnconfirmed {
-		s.state = AStateHandleUnconfirmed
-		return
-	}
-
 	newTx, err := s.config.MainClient().GetTransaction(&s.attestation.Txid)
 	if s.setFailure(err) {
 		return // will rebound to init
 	}
 
-	if newTx.BlockHash != "" {
+	if newTx.BlockHash != "" && newTx.Confirmations < s.confirmationDepth {
+		// attestation included in a block - wait for confirmation depth
+		log.Infof("********** attestation confirmations: %d/%d\n", newTx.Confirmations, s.confirmationDepth)
+		s.attestDelay = ATimeConfirmation // add confirmation waiting time
+	} else if newTx.BlockHash != "" {
 		log.Infof("********** attestation confirmed with txid: (%s)\n", s.attestation.Txid.String())
 
 		// update server with latest confirmed attestation
 		s.attestation.Confirmed = true
-		s.attestation.UpdateInfo(newTx)
-		errUpdate := s.server.UpdateLatestAttestation(*s.attestation)
+		s.updateInfo(s.attestation, newTx)
+		s.metrics.SetLastConfirmed(time.Unix(newTx.BlockTime, 0))
+		errParent := s.confirmParentAttestation()
+		if s.setFailure(errParent) {
+			return // will rebound to init
+		}
+		errUpdate := s.updateLatestAttestation()
 		if s.setFailure(errUpdate) {
 			return // will rebound to init
 		}
 
 		s.attester.Fees.ResetFee(s.isRegtest) // reset client fees
+		s.updateFeeBudget()                   // check monthly fee budget
 
 		confirmedHash := s.attestation.CommitmentHash()
 		if s.attester.txid0 == s.attestation.Txid.String() {
@@ -577,28 +975,177 @@ func (s *AttestService) doStateAwaitConfirmation() {
 		}
 		s.signer.SendConfirmedHash((&confirmedHash).CloneBytes()) // update clients
 
+		s.clearFailure()
+		s.publishEvent(AEventAttestationConfirmed, nil)
+
 		s.state = AStateNextCommitment // update attestation state
 		// add new attestation waiting time with confimation time and signature
 		// waiting time subtracted so that attestations are ~1 hour apart
-		attestDelay = atimeNewAttestation - time.Since(confirmTime) - ATimeSigs
+		s.attestDelay = s.attestationInterval() - s.clock.Since(s.confirmTime) - ATimeSigs
+	} else if s.clock.Since(s.confirmTime) > s.atimeHandleUnconfirmed {
+		// if attestation has been unconfirmed for too long
+		// set to handle unconfirmed state
+		s.state = AStateHandleUnconfirmed
 	} else {
-		attestDelay = ATimeConfirmation // add confirmation waiting time
+		s.attestDelay = ATimeConfirmation // add confirmation waiting time
+	}
+}
+
+// part of AStateHandleUnconfirmed
+// handle unconfirmed attestation with child-pays-for-parent
+// create a child attestation of the latest commitment spending the unconfirmed
+// attestation with a higher fee and get child signatures from signers
+// if signatures are not available send a fee-only child signed with the topup key
+func (s *AttestService) stateHandleUnconfirmedCPFP() {
+	log.Infof("********** creating child for attestation txid: %s\n", s.attestation.Txid.String())
+
+	// get latest commitment to attest in child attestation
+	latestCommitment, latestErr := s.server.GetClientCommitment()
+	if s.setFailure(latestErr) {
+		return // will rebound to init
+	}
+	latestCommitmentHash := latestCommitment.GetCommitmentHash()
+
+	// get key and address for child attestation using client commitment
+	key, keyErr := s.attester.GetNextAttestationKey(latestCommitmentHash)
+	if s.setFailure(keyErr) {
+		return // will rebound to init
+	}
+	paytoaddr, addrErr := s.attester.GetNextAttestationAddr(key, latestCommitmentHash)
+	if s.setFailure(addrErr) {
+		return // will rebound to init
+	}
+	log.Infof("********** importing pay-to addr: %s ...\n", paytoaddr.String())
+	importErr := s.importAttestationAddr(paytoaddr, false) // no rescan needed here
+	if s.setFailure(importErr) {
+		return // will rebound to init
+	}
+
+	childTx, createErr := s.attester.createChildAttestation(paytoaddr, &s.attestation.Tx, s.isFeeBumped)
+	if s.setFailure(createErr) {
+		return // will rebound to init
+	}
+	if !s.isFeeBumped {
+		s.recordFeeBump() // record bump decision
+	}
+	s.isFeeBumped = true
+	log.Infof("********** child pre-sign txid: %s\n", childTx.TxHash().String())
+
+	// child attestation spends the parent attestation output
+	// which is tweaked with the unconfirmed parent commitment
+	parentCommitmentHash := s.attestation.CommitmentHash()
+
+	// publish pre signed child transaction and get signatures
+	// fall back to fee-only child if signers are not available
+	sigs, sigsErr := s.requestSigs(childTx, parentCommitmentHash)
+	if sigsErr != nil {
+		log.Warnf("%s %v\n", WarningChildSigsMissing, sigsErr)
+		s.stateHandleUnconfirmedFeeChild()
+		return
+	}
+	s.publishEvent(AEventAttestationFeeBumped, nil)
+
+	// initialise child attestation with commitment
+	// carrying over the fee bumps of the unconfirmed parent
+	feeBumps := s.attestation.Info.FeeBumps
+	s.attestation = models.NewAttestationDefault()
+	s.attestation.SetCommitment(&latestCommitment)
+	s.attestation.Tx = *childTx
+	s.attestation.Info.FeeBumps = feeBumps
+	s.sigs = sigs
+	s.spendHash = &parentCommitmentHash
+
+	s.state = AStateSignAttestation // update attestation state
+	s.attestDelay = ATimeSigs       // add sigs waiting time
+}
+
+// part of AStateHandleUnconfirmed
+// handle unconfirmed attestation with a fee-only child transaction
+// spending the attestation anchor output and topup funds with the topup key
+// and set service state to AStateAwaitConfirmation for the same attestation
+func (s *AttestService) stateHandleUnconfirmedFeeChild() {
+	feeChildTx, feeChildFee, createErr := s.attester.createFeeChild(&s.attestation.Tx, s.feeChildTx)
+	if s.setFailure(createErr) {
+		return // will rebound to init
+	}
+
+	var txid chainhash.Hash
+	var sendErr error
+	if s.isDryRun {
+		txid, sendErr = s.attester.testAttestation(feeChildTx)
+	} else {
+		txid, sendErr = s.attester.sendAttestation(feeChildTx)
+	}
+	if s.setFailure(sendErr) {
+		return // will rebound to init
+	}
+	log.Infof("********** fee-only child committed with txid: (%s)\n", txid)
+	s.feeChildTx = feeChildTx
+	s.attestation.SetChildFee(feeChildFee) // fee paid on confirmation of the attestation
+	s.publishEvent(AEventAttestationFeeBumped, nil)
+
+	s.state = AStateAwaitConfirmation // update attestation state
+	s.attestDelay = ATimeConfirmation // add confirmation waiting time
+	s.confirmTime = s.clock.Now()     // set time for awaiting confirmation
+	s.isFeeBumped = false             // reset fee bumped flag
+}
+
+// part of AStateHandleUnconfirmed
+// handle unconfirmed attestation already paying the max fee, which can not
+// be replaced by a transaction paying the same fee, by waiting for the
+// attestation to confirm and set service state to AStateAwaitConfirmation
+func (s *AttestService) stateHandleUnconfirmedMaxFee() {
+	log.Warnf("%s (%d) - awaiting confirmation of attestation txid: %s\n",
+		WarningMaxFeeReached, s.attester.Fees.GetFee(), s.attestation.Txid.String())
+
+	s.state = AStateAwaitConfirmation // update attestation state
+	s.attestDelay = ATimeConfirmation // add confirmation waiting time
+	s.confirmTime = s.clock.Now()     // set time for awaiting confirmation
+}
+
+// Record latest fee bump decision for the attestation and save it in
+// the server straight away, so that bumps of attestations that are
+// later replaced or rolled back are kept. Saving failures are not fatal
+func (s *AttestService) recordFeeBump() {
+	feeBump := s.attester.Fees.LastBump()
+	feeBump.Txid = s.attestation.Txid.String()
+	s.attestation.AddFeeBump(feeBump)
+	if s.isDryRun {
+		return
+	}
+	if saveErr := s.server.SaveFeeBump(feeBump); saveErr != nil {
+		log.Warnf("%s %v\n", WarningFeeBumpSave, saveErr)
 	}
 }
 
 // AStateHandleUnconfirmed
 // - Handle attestations that have been unconfirmed for too long
 // - Bump attestation fees and re-initiate sign and send process
+// - In the cpfp case create a child of the unconfirmed attestation instead
 func (s *AttestService) doStateHandleUnconfirmed() {
 	log.Infoln("*AttestService* HANDLE UNCONFIRMED")
 
+	if !s.isFeeBumped && !s.attester.Fees.CanBumpFee() {
+		s.stateHandleUnconfirmedMaxFee()
+		return
+	}
+
+	if s.attester.Fees.BumpStrategy() == FeeBumpCPFP {
+		s.stateHandleUnconfirmedCPFP()
+		return
+	}
+
 	log.Infof("********** bumping fees for attestation txid: %s\n", s.attestation.Tx.TxHash().String())
 	currentTx := &s.attestation.Tx
-	bumpErr := s.attester.bumpAttestationFees(currentTx, isFeeBumped)
+	bumpErr := s.attester.bumpAttestationFees(currentTx, s.isFeeBumped)
 	if s.setFailure(bumpErr) {
 		return // will rebound to init
 	}
-	isFeeBumped = true
+	if !s.isFeeBumped {
+		s.recordFeeBump() // record bump decision
+	}
+	s.isFeeBumped = true
+	s.publishEvent(AEventAttestationFeeBumped, nil)
 
 	s.attestation.Tx = *currentTx
 	log.Infof("********** new pre-sign txid: %s\n", s.attestation.Tx.TxHash().String())
@@ -614,35 +1161,27 @@ func (s *AttestService) doStateHandleUnconfirmed() {
 		lastCommitmentHash = chainhash.Hash{}
 	}
 
-	// re-publish pre signed transaction
-	txPreImages, getPreImagesErr := s.attester.getTransactionPreImages(lastCommitmentHash, currentTx)
-	if s.setFailure(getPreImagesErr) {
-		return // will rebound to init
-	}
-	// get pre image bytes
-	var txPreImageBytes [][]byte
-	for _, txPreImage := range txPreImages {
-		var txBytesBuffer bytes.Buffer
-		txPreImage.Serialize(&txBytesBuffer)
-		txPreImageBytes = append(txPreImageBytes, txBytesBuffer.Bytes())
-	}
-	s.signer.ReSubscribe()
-	s.signer.SendTxPreImages(txPreImageBytes)
+	s.spendHash = &lastCommitmentHash
 
-	merkle_root := lastCommitmentHash.String()
-	sigHashes, err := s.attester.calculateSighashes(currentTx)
-	if err != nil {
-		log.Infof("Error in calculating sighash %v", err)
+	// re-publish pre signed transaction to streaming signers
+	isStream, streamErr := s.requestSigsStream(currentTx, lastCommitmentHash)
+	if s.setFailure(streamErr) {
+		return // will rebound to init
+	} else if isStream {
+		s.state = AStateSignAttestation // update attestation state
+		s.attestDelay = ATimeSigsPoll   // poll for sigs
+		return
 	}
-	sigs = s.signer.GetSigs(sigHashes, merkle_root)
 
-	for sigForInput, _ := range sigs {
-		log.Infof("********** received %d signatures for input %d \n",
-			len(sigs[sigForInput]), sigForInput)
+	// re-publish pre signed transaction and get signatures
+	sigs, sigsErr := s.requestSigs(currentTx, lastCommitmentHash)
+	if s.setFailure(sigsErr) {
+		return // will rebound to init
 	}
+	s.sigs = sigs
 
 	s.state = AStateSignAttestation // update attestation state
-	attestDelay = ATimeSigs         // add sigs waiting time
+	s.attestDelay = ATimeSigs       // add sigs waiting time
 }
 
 //Main attestation service method - cycles through AttestationStates
@@ -650,7 +1189,7 @@ func (s *AttestService) doAttestation() {
 
 	// fixed waiting time between states specific states might
 	// re-write this to set specific waiting times
-	attestDelay = ATimeFixed
+	s.attestDelay = ATimeFixed
 
 	switch s.state {
 
@@ -681,14 +1220,315 @@ func (s *AttestService) doAttestation() {
 	case AStateHandleUnconfirmed:
 		s.doStateHandleUnconfirmed()
 	}
+
+	// store checkpoint of the new state
+	s.saveCheckpoint()
+
+	s.updateMetrics()
+}
+
+// Store a checkpoint of the current attestation state to the server
+// This includes the attestation, fee levels, sigs and confirm timing
+// so that the service can resume from the same state after a restart
+func (s *AttestService) saveCheckpoint() {
+	if s.isDryRun {
+		return // checkpoints of the live service not overwritten
+	}
+
+	checkpoint := models.AttestationCheckpoint{
+		State:       int(s.state),
+		Attestation: *s.attestation,
+		Fee:         s.attester.Fees.currentFee,
+		PrevFee:     s.attester.Fees.prevFee,
+		IsFeeBumped: s.isFeeBumped,
+		Sigs:        s.sigs,
+		SpendHash:   s.spendHash,
+		ConfirmTime: s.confirmTime,
+		SentTime:    s.attester.Fees.sentTime,
+	}
+	checkpoint.Attestation.Tx = *s.attestation.Tx.Copy() // avoid sharing tx inputs
+
+	errSave := s.server.UpdateCheckpoint(checkpoint)
+	if errSave != nil {
+		log.Warnf("%s %v\n", WarningCheckpointSave, errSave)
+	}
+}
+
+// Restore attestation state from the latest checkpoint stored in the server
+// If no checkpoint is found, or checkpoint state is AStateInit/AStateError,
+// the service remains at AStateInit and rebuilds state from the wallet
+func (s *AttestService) restoreCheckpoint() {
+	if s.isDryRun {
+		return // always start from the wallet state in dry run mode
+	}
+
+	checkpoint, errCheckpoint := s.server.GetCheckpoint()
+	if errCheckpoint != nil {
+		log.Warnf("%s %v\n", WarningCheckpointRestore, errCheckpoint)
+		return
+	} else if checkpoint == nil {
+		return
+	}
+
+	state := AttestationState(checkpoint.State)
+	if state == AStateInit || state == AStateError {
+		return
+	}
+
+	// get last confirmed commitment from server to update signers
+	lastCommitmentHash, latestErr := s.server.GetLatestAttestationCommitmentHash()
+	if latestErr != nil {
+		log.Warnf("%s %v\n", WarningCheckpointRestore, latestErr)
+		return
+	}
+
+	log.Infof("********** resuming attestation from checkpoint state %d with txid: %s\n",
+		state, checkpoint.Attestation.Txid.String())
+
+	attestation := checkpoint.Attestation
+	s.attestation = &attestation
+	s.state = state
+
+	// restore fee bumping history
+	if checkpoint.Fee > 0 {
+		s.attester.Fees.setCurrentFee(checkpoint.Fee)
+		s.attester.Fees.setPrevFee(checkpoint.PrevFee)
+	}
+	s.isFeeBumped = checkpoint.IsFeeBumped
+	s.sigs = checkpoint.Sigs
+	s.spendHash = checkpoint.SpendHash
+	s.confirmTime = checkpoint.ConfirmTime
+	s.attester.Fees.setSentTime(checkpoint.SentTime)
+
+	s.signer.SendConfirmedHash((&lastCommitmentHash).CloneBytes()) // update clients
+}
+
+// Confirm unconfirmed parent attestation of a child-pays-for-parent attestation
+// The parent is confirmed in the server prior to the child attestation
+func (s *AttestService) confirmParentAttestation() error {
+	if s.attester.Fees.BumpStrategy() != FeeBumpCPFP || len(s.attestation.Tx.TxIn) == 0 {
+		return nil
+	}
+
+	// check if parent is an attestation that is not the latest confirmed
+	parentTxid := s.attestation.Tx.TxIn[0].PreviousOutPoint.Hash
+	parentCommitment, commitmentErr := s.server.GetAttestationCommitment(parentTxid)
+	if commitmentErr != nil {
+		return commitmentErr
+	}
+	lastCommitmentHash, latestErr := s.server.GetLatestAttestationCommitmentHash()
+	if latestErr != nil {
+		return latestErr
+	}
+	parentCommitmentHash := parentCommitment.GetCommitmentHash()
+	if parentCommitmentHash == (chainhash.Hash{}) || parentCommitmentHash == lastCommitmentHash {
+		return nil
+	}
+
+	log.Infof("********** parent attestation confirmed with txid: (%s)\n", parentTxid.String())
+	parentRawTx, rawTxErr := s.config.MainClient().GetRawTransaction(&parentTxid)
+	if rawTxErr != nil {
+		return rawTxErr
+	}
+	parentWalletTx, walletTxErr := s.config.MainClient().GetTransaction(&parentTxid)
+	if walletTxErr != nil {
+		return walletTxErr
+	}
+	parent := models.NewAttestation(parentTxid, &parentCommitment)
+	parent.Confirmed = true
+	parent.Tx = *parentRawTx.MsgTx()
+	s.updateInfo(parent, parentWalletTx)
+	if s.isDryRun {
+		return nil
+	}
+	return s.server.UpdateLatestAttestation(*parent)
+}
+
+// Publish pre signed transaction to signers and get signatures for
+// all transaction inputs, using the commitment hash for key tweaking
+// Returns an error if signers fail or signatures are missing for any input
+func (s *AttestService) requestSigs(msgTx *wire.MsgTx, hash chainhash.Hash) ([]wire.TxWitness, error) {
+	sigHashes, sendErr := s.sendTxPreImages(msgTx, hash)
+	if sendErr != nil {
+		return nil, sendErr
+	}
+	sigs, sigsErr := s.signer.GetSigs(sigHashes, hash.String())
+	if sigsErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorSignerSigs, sigsErr))
+	}
+	return s.checkSigs(msgTx, sigs, sigHashes, hash)
+}
+
+// Publish pre signed transaction to streaming signers and request signatures
+// without waiting for these, so that signatures are collected once ready
+// Returns false if the signer does not stream signatures
+func (s *AttestService) requestSigsStream(msgTx *wire.MsgTx, hash chainhash.Hash) (bool, error) {
+	streamSigner, isStream := s.signer.(AttestSignerStream)
+	if !isStream {
+		return false, nil
+	}
+	sigHashes, sendErr := s.sendTxPreImages(msgTx, hash)
+	if sendErr != nil {
+		return true, sendErr
+	}
+	streamSigner.RequestSigs(sigHashes, hash.String())
+	s.sigs = nil
+	s.sigsRequestTime = s.clock.Now()
+	return true, nil
+}
+
+// Collect signatures requested from streaming signers
+// Returns false while signatures are pending and fails if signatures are
+// not received within ATimeSigs. Signatures are requested again if there
+// is no pending request, i.e. after resuming from a checkpoint
+func (s *AttestService) collectSigsStream(hash chainhash.Hash) ([]wire.TxWitness, bool, error) {
+	streamSigner, isStream := s.signer.(AttestSignerStream)
+	if !isStream {
+		return nil, false, errors.New(ErrorSigsMissing)
+	}
+	if s.sigsRequestTime.IsZero() {
+		_, requestErr := s.requestSigsStream(&s.attestation.Tx, hash)
+		return nil, false, requestErr
+	}
+
+	sigs, isReady, pollErr := streamSigner.PollSigs()
+	if pollErr != nil {
+		s.sigsRequestTime = time.Time{}
+		return nil, false, errors.New(fmt.Sprintf("%s %v", ErrorSignerSigs, pollErr))
+	} else if !isReady {
+		if s.clock.Since(s.sigsRequestTime) >= ATimeSigs {
+			s.sigsRequestTime = time.Time{}
+			return nil, false, errors.New(ErrorSigsTimeout)
+		}
+		return nil, false, nil
+	}
+	s.sigsRequestTime = time.Time{}
+
+	sigHashes, sigHashesErr := s.attester.calculateSighashes(&s.attestation.Tx, hash)
+	if sigHashesErr != nil {
+		return nil, false, sigHashesErr
+	}
+	sigs, checkErr := s.checkSigs(&s.attestation.Tx, sigs, sigHashes, hash)
+	return sigs, checkErr == nil, checkErr
+}
+
+// Publish pre images of the pre signed transaction to signers
+// and return the sighashes of all transaction inputs
+func (s *AttestService) sendTxPreImages(msgTx *wire.MsgTx, hash chainhash.Hash) ([][]byte, error) {
+	txPreImages, getPreImagesErr := s.attester.getTransactionPreImages(hash, msgTx)
+	if getPreImagesErr != nil {
+		return nil, getPreImagesErr
+	}
+	// get pre image bytes
+	var txPreImageBytes [][]byte
+	for _, txPreImage := range txPreImages {
+		var txBytesBuffer bytes.Buffer
+		txPreImage.Serialize(&txBytesBuffer)
+		txPreImageBytes = append(txPreImageBytes, txBytesBuffer.Bytes())
+	}
+	s.signer.ReSubscribe()
+	if sendErr := s.signer.SendTxPreImages(txPreImageBytes); sendErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorSignerSigs, sendErr))
+	}
+
+	return s.attester.calculateSighashes(msgTx, hash)
+}
+
+// Check signatures received for all transaction inputs and verify
+// signatures and pubkeys before these are added to the transaction
+func (s *AttestService) checkSigs(msgTx *wire.MsgTx, sigs []wire.TxWitness, sigHashes [][]byte,
+	hash chainhash.Hash) ([]wire.TxWitness, error) {
+	for sigForInput, _ := range sigs {
+		log.Infof("********** received %d signatures for input %d \n",
+			len(sigs[sigForInput]), sigForInput)
+	}
+	if len(sigs) < len(msgTx.TxIn) {
+		return nil, errors.New(ErrorSigsMissing)
+	}
+	for i := range msgTx.TxIn {
+		if len(sigs[i]) == 0 {
+			return nil, errors.New(fmt.Sprintf("%s for input %d", ErrorSigsMissing, i))
+		}
+	}
+
+	// verify signatures and pubkeys before these are added to the transaction
+	if verifyErr := s.attester.verifyWitness(sigs, sigHashes, hash, s.signer.Name()); verifyErr != nil {
+		return nil, verifyErr
+	}
+	return sigs, nil
+}
+
+// Update server with latest attestation
+// Attestations are never stored in dry run mode
+func (s *AttestService) updateLatestAttestation() error {
+	if s.isDryRun {
+		log.Infof("********** dry run - not storing attestation: %s\n", s.attestation.Txid.String())
+		return nil
+	}
+	return s.server.UpdateLatestAttestation(*s.attestation)
+}
+
+// Import attestation address to the wallet
+// Addresses are never imported in dry run mode
+func (s *AttestService) importAttestationAddr(addr btcutil.Address, rescan ...bool) error {
+	if s.isDryRun {
+		log.Infof("********** dry run - not importing addr: %s\n", addr.String())
+		return nil
+	}
+	return s.attester.ImportAttestationAddr(addr, rescan...)
+}
+
+// Update attestation state, fee and pending attestation metrics
+func (s *AttestService) updateMetrics() {
+	s.metrics.SetAttestationState(int(s.state))
+	s.metrics.SetFees(s.attester.Fees.currentFee, s.attester.Fees.prevFee)
+	if s.state == AStateAwaitConfirmation || s.state == AStateHandleUnconfirmed {
+		s.metrics.SetPending(s.confirmTime)
+	} else {
+		s.metrics.SetPending(time.Time{})
+	}
+}
+
+// Update staychain unspent value and runway projection of the unspents
+func (s *AttestService) updateUnspentRunway(unspentList []btcjson.ListUnspentResult) {
+	var value int64
+	for _, unspent := range unspentList {
+		value += int64(math.Round(unspent.Amount * Coin))
+	}
+	s.updateRunway(value)
+}
+
+// Return number of client slots with a non zero commitment
+func activeClientSlots(commitment models.Commitment) int {
+	slots := 0
+	for _, merkleCommitment := range commitment.GetMerkleCommitments() {
+		if (merkleCommitment.Commitment != chainhash.Hash{}) {
+			slots++
+		}
+	}
+	return slots
 }
 
 // Check if there is an error and set error state
+// Failure events are only published when the error differs from the
+// previous error state, so that a failure repeated on every retry
+// is published once until the service recovers
 func (s *AttestService) setFailure(err error) bool {
 	if err != nil {
+		if s.errorState == nil || s.errorState.Error() != err.Error() {
+			s.publishEvent(AEventAttestationFailed, err)
+		}
 		s.errorState = err
 		s.state = AStateError
 		return true
 	}
 	return false
 }
+
+// Clear error state once attestations are sent or confirmed again
+func (s *AttestService) clearFailure() {
+	if s.errorState != nil {
+		log.Infof("********** attestation service recovered from failure: %v\n", s.errorState)
+		s.errorState = nil
+	}
+}
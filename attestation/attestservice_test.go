@@ -5,17 +5,25 @@
 package attestation
 
 import (
+	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	confpkg "mainstay/config"
+	"mainstay/crypto"
 	"mainstay/db"
+	"mainstay/metrics"
 	"mainstay/models"
 	"mainstay/test"
 
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/stretchr/testify/assert"
 )
@@ -44,7 +52,7 @@ func verifyStateInitToNextCommitment(t *testing.T, attestService *AttestService)
 	assert.Equal(t, chainhash.Hash{}, attestService.attestation.Txid)
 	assert.Equal(t, false, attestService.attestation.Confirmed)
 	assert.Equal(t, models.AttestationInfo{}, attestService.attestation.Info)
-	assert.Equal(t, ATimeFixed, attestDelay)
+	assert.Equal(t, ATimeFixed, attestService.attestDelay)
 }
 
 // verify AStateInit to AStateAwaitConfirmation
@@ -55,7 +63,7 @@ func verifyStateInitToAwaitConfirmation(t *testing.T, attestService *AttestServi
 	assert.Equal(t, latestCommitment.GetCommitmentHash(), attestService.attestation.CommitmentHash())
 	assert.Equal(t, txid, attestService.attestation.Txid)
 	assert.Equal(t, false, attestService.attestation.Confirmed)
-	assert.Equal(t, walletTx.Time, confirmTime.Unix())
+	assert.Equal(t, walletTx.Time, attestService.confirmTime.Unix())
 	assert.Equal(t, models.AttestationInfo{}, attestService.attestation.Info)
 }
 
@@ -65,9 +73,14 @@ func verifyStateNextCommitmentToNewAttestation(t *testing.T, attestService *Atte
 	latestCommitments := []models.ClientCommitment{models.ClientCommitment{*hash, 0}}
 	dbFake.SetClientCommitments(latestCommitments)
 	attestService.doAttestation()
+	// wait for min attestation time to pass if not reached yet
+	if attestService.state == AStateNextCommitment {
+		attestService.clock.(*AttestClockFake).Advance(attestService.attestDelay)
+		attestService.doAttestation()
+	}
 	assert.Equal(t, AStateNewAttestation, attestService.state)
 	assert.Equal(t, latestCommitment.GetCommitmentHash(), attestService.attestation.CommitmentHash())
-	assert.Equal(t, ATimeFixed, attestDelay)
+	assert.Equal(t, ATimeFixed, attestService.attestDelay)
 
 	return latestCommitment
 }
@@ -80,7 +93,7 @@ func verifyStateNewAttestationToSignAttestation(t *testing.T, attestService *Att
 	assert.Equal(t, 1, len(attestService.attestation.Tx.TxIn))
 	assert.Equal(t, 1, len(attestService.attestation.Tx.TxOut))
 	assert.Equal(t, 0, len(attestService.attestation.Tx.TxIn[0].SignatureScript))
-	assert.Equal(t, ATimeSigs, attestDelay)
+	assert.Equal(t, ATimeSigs, attestService.attestDelay)
 }
 
 // verify AStateSignAttestation to AStatePreSendStore
@@ -88,21 +101,21 @@ func verifyStateSignAttestationToPreSendStore(t *testing.T, attestService *Attes
 	attestService.doAttestation()
 	assert.Equal(t, AStatePreSendStore, attestService.state)
 	assert.Equal(t, false, len(attestService.attestation.Tx.TxIn[0].SignatureScript) > 0)
-	assert.Equal(t, ATimeFixed, attestDelay)
+	assert.Equal(t, ATimeFixed, attestService.attestDelay)
 }
 
 // verify AStatePreSendStore to AStateSendAttestation
 func verifyStatePreSendStoreToSendAttestation(t *testing.T, attestService *AttestService) {
 	attestService.doAttestation()
 	assert.Equal(t, AStateSendAttestation, attestService.state)
-	assert.Equal(t, ATimeFixed, attestDelay)
+	assert.Equal(t, ATimeFixed, attestService.attestDelay)
 }
 
 // verify AStateSendAttestation to AStateAwaitConfirmation
 func verifyStateSendAttestationToAwaitConfirmation(t *testing.T, attestService *AttestService) chainhash.Hash {
 	attestService.doAttestation()
 	assert.Equal(t, AStateAwaitConfirmation, attestService.state)
-	assert.Equal(t, ATimeConfirmation, attestDelay)
+	assert.Equal(t, ATimeConfirmation, attestService.attestDelay)
 	return attestService.attestation.Txid
 }
 
@@ -110,7 +123,7 @@ func verifyStateSendAttestationToAwaitConfirmation(t *testing.T, attestService *
 func verifyStateAwaitConfirmationToAwaitConfirmation(t *testing.T, attestService *AttestService) {
 	attestService.doAttestation()
 	assert.Equal(t, AStateAwaitConfirmation, attestService.state)
-	assert.Equal(t, ATimeConfirmation, attestDelay)
+	assert.Equal(t, ATimeConfirmation, attestService.attestDelay)
 }
 
 // verify AStateAwaitConfirmation to AStateNextCommitment
@@ -123,8 +136,8 @@ func verifyStateAwaitConfirmationToNextCommitment(t *testing.T, attestService *A
 	assert.Equal(t, AStateNextCommitment, attestService.state)
 	assert.Equal(t, true, attestService.attestation.Confirmed)
 	assert.Equal(t, txid, attestService.attestation.Txid)
-	assert.Equal(t, true, attestDelay < timeNew)
-	assert.Equal(t, true, attestDelay+ATimeSigs > (timeNew-time.Since(confirmTime)))
+	assert.Equal(t, true, attestService.attestDelay < timeNew)
+	assert.Equal(t, true, attestService.attestDelay+ATimeSigs > (timeNew-attestService.clock.Since(attestService.confirmTime)))
 	assert.Equal(t,
 		models.AttestationInfo{
 			Txid:      txid.String(),
@@ -149,7 +162,7 @@ func verifyStateHandleUnconfirmedToSignAttestation(t *testing.T, attestService *
 	assert.Equal(t, 1, len(attestService.attestation.Tx.TxIn))
 	assert.Equal(t, 1, len(attestService.attestation.Tx.TxOut))
 	assert.Equal(t, 0, len(attestService.attestation.Tx.TxIn[0].SignatureScript))
-	assert.Equal(t, ATimeSigs, attestDelay)
+	assert.Equal(t, ATimeSigs, attestService.attestDelay)
 	// assert.Equal(t, attestService.attester.Fees.minFee+attestService.attester.Fees.feeIncrement,
 	// 	attestService.attester.Fees.GetFee())
 }
@@ -165,12 +178,13 @@ func TestAttestService_Regular(t *testing.T) {
 
 	// randomly test with invalid config here
 	// timing config no effect on server
-	timingConfig := confpkg.TimingConfig{-1, -1}
+	timingConfig := confpkg.TimingConfig{NewAttestationMinutes: -1, HandleUnconfirmedMinutes: -1,
+		MinAttestationMinutes: -1, MaxAttestationMinutes: -1, BudgetAttestationMinutes: -1}
 	config.SetTimingConfig(timingConfig)
 
 	dbFake := db.NewDbFake()
 	server := NewAttestServer(dbFake)
-	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 
 	// Test initial state of attest service
 	verifyStateInit(t, attestService)
@@ -183,7 +197,7 @@ func TestAttestService_Regular(t *testing.T) {
 	attestService.doAttestation()
 	assert.Equal(t, AStateError, attestService.state)
 	assert.Equal(t, errors.New(models.ErrorCommitmentListEmpty), attestService.errorState)
-	assert.Equal(t, ATimeFixed, attestDelay)
+	assert.Equal(t, ATimeFixed, attestService.attestDelay)
 
 	// Test AStateError -> AStateInit -> AStateNextCommitment again
 	attestService.doAttestation()
@@ -215,7 +229,7 @@ func TestAttestService_Regular(t *testing.T) {
 	attestService.doAttestation()
 	assert.Equal(t, AStateNextCommitment, attestService.state)
 	assert.Equal(t, latestCommitment.GetCommitmentHash(), attestService.attestation.CommitmentHash())
-	assert.Equal(t, ATimeSkip, attestDelay)
+	assert.Equal(t, ATimeSkip, attestService.attestDelay)
 
 	// Test AStateNextCommitment -> AStateNewAttestation
 	// stuck in next commitment
@@ -246,12 +260,14 @@ func TestAttestService_Unconfirmed(t *testing.T) {
 	// randomly test custom config here
 	customAtimeNewAttestation := 5
 	customAtimeHandleUnconfirmed := 10
-	timingConfig := confpkg.TimingConfig{customAtimeNewAttestation, customAtimeHandleUnconfirmed}
+	timingConfig := confpkg.TimingConfig{NewAttestationMinutes: customAtimeNewAttestation, HandleUnconfirmedMinutes: customAtimeHandleUnconfirmed,
+		MinAttestationMinutes: -1, MaxAttestationMinutes: -1, BudgetAttestationMinutes: -1}
 	config.SetTimingConfig(timingConfig)
 
 	dbFake := db.NewDbFake()
 	server := NewAttestServer(dbFake)
-	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+	clock := NewAttestClockFake(time.Now())
+	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), clock, config)
 
 	attestService.attester.Fees.ResetFee(true)
 
@@ -275,8 +291,8 @@ func TestAttestService_Unconfirmed(t *testing.T) {
 	// Test AStateSendAttestation -> AStateAwaitConfirmation
 	txid := verifyStateSendAttestationToAwaitConfirmation(t, attestService)
 
-	// set confirm time back to test what happens in handle unconfirmed case
-	confirmTime = confirmTime.Add(-time.Duration(customAtimeHandleUnconfirmed) * time.Minute)
+	// advance clock to test what happens in handle unconfirmed case
+	clock.Advance(time.Duration(customAtimeHandleUnconfirmed) * time.Minute)
 
 	// Test AStateAwaitConfirmation -> AStateHandleUnconfirmed
 	verifyStateAwaitConfirmationToHandleUnconfirmed(t, attestService)
@@ -314,7 +330,7 @@ func TestAttestService_Unconfirmed(t *testing.T) {
 	assert.Equal(t, 1, len(attestService.attestation.Tx.TxOut))
 	assert.Equal(t, 0, len(attestService.attestation.Tx.TxIn[0].SignatureScript))
 	assert.Equal(t, 0, len(attestService.attestation.Tx.TxIn[1].SignatureScript))
-	assert.Equal(t, ATimeSigs, attestDelay)
+	assert.Equal(t, ATimeSigs, attestService.attestDelay)
 	assert.Equal(t, attestService.attester.Fees.minFee, attestService.attester.Fees.GetFee())
 	// Test AStateSignAttestation -> AStatePreSendStore
 	verifyStateSignAttestationToPreSendStore(t, attestService)
@@ -323,8 +339,8 @@ func TestAttestService_Unconfirmed(t *testing.T) {
 	// Test AStateSendAttestation -> AStateAwaitConfirmation
 	txid = verifyStateSendAttestationToAwaitConfirmation(t, attestService)
 
-	// set confirm time back to test what happens in handle unconfirmed case
-	confirmTime = confirmTime.Add(-time.Duration(customAtimeHandleUnconfirmed) * time.Minute)
+	// advance clock to test what happens in handle unconfirmed case
+	clock.Advance(time.Duration(customAtimeHandleUnconfirmed) * time.Minute)
 
 	// Test AStateAwaitConfirmation -> AStateHandleUnconfirmed
 	verifyStateAwaitConfirmationToHandleUnconfirmed(t, attestService)
@@ -336,7 +352,7 @@ func TestAttestService_Unconfirmed(t *testing.T) {
 	assert.Equal(t, 1, len(attestService.attestation.Tx.TxOut))
 	assert.Equal(t, 0, len(attestService.attestation.Tx.TxIn[0].SignatureScript))
 	assert.Equal(t, 0, len(attestService.attestation.Tx.TxIn[1].SignatureScript))
-	assert.Equal(t, ATimeSigs, attestDelay)
+	assert.Equal(t, ATimeSigs, attestService.attestDelay)
 	assert.Equal(t, attestService.attester.Fees.minFee+attestService.attester.Fees.feeIncrement,
 		attestService.attester.Fees.GetFee())
 
@@ -362,12 +378,13 @@ func TestAttestService_WithTopup(t *testing.T) {
 
 	// randomly test with invalid config here
 	// timing config no effect on server
-	timingConfig := confpkg.TimingConfig{-1, -1}
+	timingConfig := confpkg.TimingConfig{NewAttestationMinutes: -1, HandleUnconfirmedMinutes: -1,
+		MinAttestationMinutes: -1, MaxAttestationMinutes: -1, BudgetAttestationMinutes: -1}
 	config.SetTimingConfig(timingConfig)
 
 	dbFake := db.NewDbFake()
 	server := NewAttestServer(dbFake)
-	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 
 	// Test initial state of attest service
 	verifyStateInit(t, attestService)
@@ -413,7 +430,7 @@ func TestAttestService_WithTopup(t *testing.T) {
 	assert.Equal(t, 1, len(attestService.attestation.Tx.TxOut))
 	assert.Equal(t, 0, len(attestService.attestation.Tx.TxIn[0].SignatureScript))
 	assert.Equal(t, 0, len(attestService.attestation.Tx.TxIn[1].SignatureScript))
-	assert.Equal(t, ATimeSigs, attestDelay)
+	assert.Equal(t, ATimeSigs, attestService.attestDelay)
 
 	// Test AStateSignAttestation -> AStatePreSendStore
 	verifyStateSignAttestationToPreSendStore(t, attestService)
@@ -458,7 +475,7 @@ func TestAttestService_FailureInit(t *testing.T) {
 
 	dbFake := db.NewDbFake()
 	server := NewAttestServer(dbFake)
-	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 
 	// Test initial state of attest service
 	verifyStateInit(t, attestService)
@@ -467,7 +484,7 @@ func TestAttestService_FailureInit(t *testing.T) {
 	verifyStateInitToNextCommitment(t, attestService)
 
 	// failure - re init attestation service with restart
-	attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+	attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 	// Test AStateInit -> AStateNextCommitment again
 	verifyStateInitToNextCommitment(t, attestService)
 
@@ -488,7 +505,7 @@ func TestAttestService_FailureNextCommitment(t *testing.T) {
 
 	dbFake := db.NewDbFake()
 	server := NewAttestServer(dbFake)
-	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 
 	// Test initial state of attest service
 	verifyStateInit(t, attestService)
@@ -502,7 +519,7 @@ func TestAttestService_FailureNextCommitment(t *testing.T) {
 	latestCommitment := verifyStateNextCommitmentToNewAttestation(t, attestService, dbFake, hashX)
 
 	// failure - re init attestation service
-	attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+	attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 	// Test AStateInit -> AStateNextCommitment
 	verifyStateInitToNextCommitment(t, attestService)
 	// Test AStateNextCommitment -> AStateNewAttestation
@@ -531,7 +548,7 @@ func TestAttestService_FailureNewAttestation(t *testing.T) {
 
 	dbFake := db.NewDbFake()
 	server := NewAttestServer(dbFake)
-	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 
 	// Test initial state of attest service
 	verifyStateInit(t, attestService)
@@ -548,7 +565,7 @@ func TestAttestService_FailureNewAttestation(t *testing.T) {
 	verifyStateNewAttestationToSignAttestation(t, attestService)
 
 	// failure - re init attestation service
-	attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+	attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 	// Test AStateInit -> AStateNextCommitment
 	verifyStateInitToNextCommitment(t, attestService)
 	// Test AStateNextCommitment -> AStateNewAttestation
@@ -576,7 +593,7 @@ func TestAttestService_FailureSignAttestation(t *testing.T) {
 
 	dbFake := db.NewDbFake()
 	server := NewAttestServer(dbFake)
-	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 
 	// Test initial state of attest service
 	verifyStateInit(t, attestService)
@@ -596,7 +613,7 @@ func TestAttestService_FailureSignAttestation(t *testing.T) {
 	verifyStateSignAttestationToPreSendStore(t, attestService)
 
 	// failure - re init attestation service
-	attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+	attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 
 	// Test AStateInit -> AStateNextCommitment
 	verifyStateInitToNextCommitment(t, attestService)
@@ -627,7 +644,7 @@ func TestAttestService_FailurePreSendStore(t *testing.T) {
 
 	dbFake := db.NewDbFake()
 	server := NewAttestServer(dbFake)
-	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 
 	// Test initial state of attest service
 	verifyStateInit(t, attestService)
@@ -649,7 +666,7 @@ func TestAttestService_FailurePreSendStore(t *testing.T) {
 	verifyStatePreSendStoreToSendAttestation(t, attestService)
 
 	// failure - re init attestation service
-	attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+	attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 
 	// Test AStateInit -> AStateNextCommitment
 	verifyStateInitToNextCommitment(t, attestService)
@@ -685,7 +702,7 @@ func TestAttestService_FailureSendAttestation(t *testing.T) {
 
 	prevAttestation := models.NewAttestationDefault()
 	for i := range []int{1, 2, 3} {
-		attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+		attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 
 		// manually set fee to test pick up of unconfirmedtx fee after restart
 		if i == 0 {
@@ -702,10 +719,10 @@ func TestAttestService_FailureSendAttestation(t *testing.T) {
 		assert.Equal(t, prevAttestation.Confirmed, attestService.attestation.Confirmed)
 		assert.Equal(t, prevAttestation.Info, attestService.attestation.Info)
 		if attestService.attestation.Info.Time == 0 {
-			assert.Equal(t, ATimeFixed, attestDelay)
+			assert.Equal(t, ATimeFixed, attestService.attestDelay)
 		} else {
-			assert.Empty(t, attestDelay < ATimeFixed)
-			assert.Empty(t, atimeNewAttestation < attestDelay)
+			assert.Empty(t, attestService.attestDelay < ATimeFixed)
+			assert.Empty(t, attestService.atimeNewAttestation < attestService.attestDelay)
 		}
 
 		// Test AStateNextCommitment -> AStateNewAttestation
@@ -723,7 +740,7 @@ func TestAttestService_FailureSendAttestation(t *testing.T) {
 		txid := verifyStateSendAttestationToAwaitConfirmation(t, attestService)
 
 		// failure - re init attestation service
-		attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+		attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 
 		// Test AStateInit -> AStateAwaitConfirmation
 		verifyStateInitToAwaitConfirmation(t, attestService, config, latestCommitment, txid)
@@ -789,7 +806,7 @@ func TestAttestService_FailureAwaitConfirmation(t *testing.T) {
 
 	dbFake := db.NewDbFake()
 	server := NewAttestServer(dbFake)
-	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 
 	// Test initial state of attest service
 	verifyStateInit(t, attestService)
@@ -830,7 +847,7 @@ func TestAttestService_FailureAwaitConfirmation(t *testing.T) {
 	)
 
 	// failure - re init attestation service
-	attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+	attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 	// Test AStateInit -> AStateNextCommitment
 	attestService.doAttestation()
 	assert.Equal(t, AStateNextCommitment, attestService.state)
@@ -878,7 +895,7 @@ func TestAttestService_FailureHandleUnconfirmed(t *testing.T) {
 
 	prevAttestation := models.NewAttestationDefault()
 	for i := range []int{1, 2, 3} {
-		attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+		attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 
 		attestService.attester.Fees.ResetFee(true)
 
@@ -892,10 +909,10 @@ func TestAttestService_FailureHandleUnconfirmed(t *testing.T) {
 		assert.Equal(t, prevAttestation.Confirmed, attestService.attestation.Confirmed)
 		assert.Equal(t, prevAttestation.Info, attestService.attestation.Info)
 		if attestService.attestation.Info.Time == 0 {
-			assert.Equal(t, ATimeFixed, attestDelay)
+			assert.Equal(t, ATimeFixed, attestService.attestDelay)
 		} else {
-			assert.Empty(t, attestDelay < ATimeFixed)
-			assert.Empty(t, atimeNewAttestation < attestDelay)
+			assert.Empty(t, attestService.attestDelay < ATimeFixed)
+			assert.Empty(t, attestService.atimeNewAttestation < attestService.attestDelay)
 		}
 
 		// Test AStateNextCommitment -> AStateNewAttestation
@@ -914,7 +931,7 @@ func TestAttestService_FailureHandleUnconfirmed(t *testing.T) {
 		txid := verifyStateSendAttestationToAwaitConfirmation(t, attestService)
 
 		// set confirm time back to test what happens in handle unconfirmed case
-		confirmTime = confirmTime.Add(-DefaultATimeHandleUnconfirmed)
+		attestService.confirmTime = attestService.confirmTime.Add(-DefaultATimeHandleUnconfirmed)
 
 		// Test AStateAwaitConfirmation -> AStateHandleUnconfirmed
 		verifyStateAwaitConfirmationToHandleUnconfirmed(t, attestService)
@@ -929,14 +946,14 @@ func TestAttestService_FailureHandleUnconfirmed(t *testing.T) {
 			verifyStateInitToAwaitConfirmation(t, attestService, config, latestCommitment, txid)
 		} else {
 			// failure - re init attestation service with restart
-			attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+			attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 			attestService.attester.Fees.ResetFee(true)
 			// Test AStateInit -> AStateAwaitConfirmation
 			verifyStateInitToAwaitConfirmation(t, attestService, config, latestCommitment, txid)
 		}
 
 		// set confirm time back to test what happens in handle unconfirmed case
-		confirmTime = confirmTime.Add(-DefaultATimeHandleUnconfirmed)
+		attestService.confirmTime = attestService.confirmTime.Add(-DefaultATimeHandleUnconfirmed)
 
 		// Test AStateAwaitConfirmation -> AStateHandleUnconfirmed
 		verifyStateAwaitConfirmationToHandleUnconfirmed(t, attestService)
@@ -949,7 +966,7 @@ func TestAttestService_FailureHandleUnconfirmed(t *testing.T) {
 		verifyStatePreSendStoreToSendAttestation(t, attestService)
 
 		// failure - re init attestation service with restart
-		attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), config)
+		attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
 		attestService.attester.Fees.ResetFee(true)
 
 		// Test AStateInit -> AStateAwaitConfirmation
@@ -963,10 +980,10 @@ func TestAttestService_FailureHandleUnconfirmed(t *testing.T) {
 
 		// second time bump fee manually and set is fee bumped flag
 		attestService.attester.Fees.BumpFee()
-		isFeeBumped = true
+		attestService.isFeeBumped = true
 
 		// set confirm time back to test what happens in handle unconfirmed case
-		confirmTime = confirmTime.Add(-DefaultATimeHandleUnconfirmed)
+		attestService.confirmTime = attestService.confirmTime.Add(-DefaultATimeHandleUnconfirmed)
 
 		// Test AStateAwaitConfirmation -> AStateHandleUnconfirmed
 		verifyStateAwaitConfirmationToHandleUnconfirmed(t, attestService)
@@ -1014,6 +1031,864 @@ func TestAttestService_FailureHandleUnconfirmed(t *testing.T) {
 	}
 }
 
+// Test Attest Service resuming from a stored checkpoint
+// Service is restarted after collecting sigs and should
+// resume at AStateSignAttestation without requesting new sigs
+func TestAttestService_Checkpoint(t *testing.T) {
+
+	// Test INIT
+	test := test.NewTest(false, false)
+	config := test.Config
+
+	dbFake := db.NewDbFake()
+	server := NewAttestServer(dbFake)
+	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
+
+	// no checkpoint stored - remain at AStateInit
+	attestService.restoreCheckpoint()
+	verifyStateInit(t, attestService)
+
+	// Test AStateInit -> AStateNextCommitment
+	verifyStateInitToNextCommitment(t, attestService)
+
+	// Test AStateNextCommitment -> AStateNewAttestation
+	hashX, _ := chainhash.NewHashFromStr("aaaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	latestCommitment := verifyStateNextCommitmentToNewAttestation(t, attestService, dbFake, hashX)
+
+	// Test AStateNewAttestation -> AStateSignAttestation
+	verifyStateNewAttestationToSignAttestation(t, attestService)
+	unsignedTx := attestService.attestation.Tx
+	checkpointSigs := attestService.sigs
+	attestService.attester.Fees.setCurrentFee(23)
+	attestService.attester.Fees.setPrevFee(18)
+	attestService.isFeeBumped = true
+	attestService.saveCheckpoint()
+
+	// restart - resume at AStateSignAttestation with same tx and sigs
+	attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
+	attestService.restoreCheckpoint()
+	assert.Equal(t, AStateSignAttestation, attestService.state)
+	assert.Equal(t, latestCommitment.GetCommitmentHash(), attestService.attestation.CommitmentHash())
+	assert.Equal(t, unsignedTx.TxHash(), attestService.attestation.Tx.TxHash())
+	assert.Equal(t, checkpointSigs, attestService.sigs)
+	assert.Equal(t, true, attestService.isFeeBumped)
+	assert.Equal(t, 23, attestService.attester.Fees.GetFee())
+	assert.Equal(t, 18, attestService.attester.Fees.GetPrevFee())
+
+	// Test AStateSignAttestation -> AStatePreSendStore
+	verifyStateSignAttestationToPreSendStore(t, attestService)
+	// Test AStatePreSendStore -> AStateSendAttestation
+	verifyStatePreSendStoreToSendAttestation(t, attestService)
+	// Test AStateSendAttestation -> AStateAwaitConfirmation
+	txid := verifyStateSendAttestationToAwaitConfirmation(t, attestService)
+
+	// restart - resume at AStateAwaitConfirmation with same confirm time
+	prevConfirmTime := attestService.confirmTime
+	attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
+	attestService.restoreCheckpoint()
+	assert.Equal(t, AStateAwaitConfirmation, attestService.state)
+	assert.Equal(t, txid, attestService.attestation.Txid)
+	assert.Equal(t, prevConfirmTime.Unix(), attestService.confirmTime.Unix())
+
+	// Test AStateAwaitConfirmation -> AStateNextCommitment
+	config.MainClient().Generate(1)
+	verifyStateAwaitConfirmationToNextCommitment(t, attestService, config, txid, DefaultATimeNewAttestation)
+
+	// error state checkpoint - restart from AStateInit
+	attestService.setFailure(errors.New("failure"))
+	attestService.saveCheckpoint()
+	attestService = NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
+	attestService.restoreCheckpoint()
+	verifyStateInit(t, attestService)
+}
+
+// Test Attest Service Run with a fake clock
+// Full attestation cycle including fee bumping after
+// the handle unconfirmed timeout runs deterministically
+func TestAttestService_Run(t *testing.T) {
+
+	// Test INIT
+	test := test.NewTest(false, false)
+	config := test.Config
+
+	dbFake := db.NewDbFake()
+	server := NewAttestServer(dbFake)
+	clock := NewAttestClockFake(time.Now())
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	attestService := NewAttestService(ctx, wg, server, NewAttestSignerFake([]*confpkg.Config{config}), clock, config)
+	attestService.isRegtest = false // use service delays instead of the regtest delay
+	attestService.attester.Fees.ResetFee(true)
+
+	hashX, _ := chainhash.NewHashFromStr("aaaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	dbFake.SetClientCommitments([]models.ClientCommitment{models.ClientCommitment{Commitment: *hashX, ClientPosition: 0}})
+
+	wg.Add(1)
+	go attestService.Run()
+
+	// advance clock by the scheduled delay and wait for the next state to be scheduled
+	nextState := func() {
+		clock.Advance(attestService.attestDelay)
+		clock.BlockUntil(1)
+	}
+	clock.BlockUntil(1)
+	assert.Equal(t, AStateInit, attestService.state)
+
+	// Test AStateInit -> AStateNextCommitment
+	nextState()
+	assert.Equal(t, AStateNextCommitment, attestService.state)
+	// Test AStateNextCommitment -> AStateNewAttestation
+	nextState()
+	assert.Equal(t, AStateNewAttestation, attestService.state)
+	// Test AStateNewAttestation -> AStateSignAttestation
+	nextState()
+	assert.Equal(t, AStateSignAttestation, attestService.state)
+	assert.Equal(t, ATimeSigs, attestService.attestDelay)
+	// Test AStateSignAttestation -> AStatePreSendStore
+	nextState()
+	assert.Equal(t, AStatePreSendStore, attestService.state)
+	// Test AStatePreSendStore -> AStateSendAttestation
+	nextState()
+	assert.Equal(t, AStateSendAttestation, attestService.state)
+	// Test AStateSendAttestation -> AStateAwaitConfirmation
+	nextState()
+	assert.Equal(t, AStateAwaitConfirmation, attestService.state)
+	assert.Equal(t, clock.Now(), attestService.confirmTime)
+	txid := attestService.attestation.Txid
+
+	// Test AStateAwaitConfirmation -> AStateAwaitConfirmation
+	// until the handle unconfirmed time has elapsed
+	for clock.Since(attestService.confirmTime) <= DefaultATimeHandleUnconfirmed {
+		nextState()
+		assert.Equal(t, AStateAwaitConfirmation, attestService.state)
+		assert.Equal(t, ATimeConfirmation, attestService.attestDelay)
+	}
+
+	// Test AStateAwaitConfirmation -> AStateHandleUnconfirmed
+	nextState()
+	assert.Equal(t, AStateHandleUnconfirmed, attestService.state)
+	// Test AStateHandleUnconfirmed -> AStateSignAttestation
+	nextState()
+	assert.Equal(t, AStateSignAttestation, attestService.state)
+	assert.Equal(t, true, attestService.isFeeBumped)
+	assert.Equal(t, attestService.attester.Fees.minFee+attestService.attester.Fees.feeIncrement,
+		attestService.attester.Fees.GetFee())
+	assert.Equal(t, FeeBumpPolicyIncrement, attestService.attestation.Info.FeeBumps[0].Policy)
+	assert.Equal(t, txid.String(), attestService.attestation.Info.FeeBumps[0].Txid)
+	assert.Equal(t, attestService.attestation.Info.FeeBumps, dbFake.FeeBumps) // saved when decided
+
+	// Test AStateSignAttestation -> AStatePreSendStore
+	nextState()
+	assert.Equal(t, AStatePreSendStore, attestService.state)
+	// Test AStatePreSendStore -> AStateSendAttestation
+	nextState()
+	assert.Equal(t, AStateSendAttestation, attestService.state)
+	// Test AStateSendAttestation -> AStateAwaitConfirmation
+	nextState()
+	assert.Equal(t, AStateAwaitConfirmation, attestService.state)
+	assert.Equal(t, false, txid == attestService.attestation.Txid)
+
+	// Test AStateAwaitConfirmation -> AStateNextCommitment
+	config.MainClient().Generate(1)
+	nextState()
+	assert.Equal(t, AStateNextCommitment, attestService.state)
+	assert.Equal(t, true, attestService.attestation.Confirmed)
+	assert.Equal(t, DefaultATimeNewAttestation-ATimeConfirmation-ATimeSigs, attestService.attestDelay)
+
+	// Test service shutdown
+	cancel()
+	wg.Wait()
+}
+
+// Test Attest Service handling unconfirmed attestations at the max fee
+// Attestations are not replaced once the max fee is reached, as a
+// replacement paying the same fee would be rejected
+func TestAttestService_HandleUnconfirmedMaxFee(t *testing.T) {
+	dbFake := db.NewDbFake()
+	clock := NewAttestClockFake(time.Now())
+	attestService := &AttestService{
+		config:      &confpkg.Config{},
+		server:      NewAttestServer(dbFake),
+		attester:    &AttestClient{Fees: AttestFees{minFee: 10, maxFee: 50, currentFee: 50, prevFee: 44}},
+		attestation: models.NewAttestationDefault(),
+		clock:       clock,
+		events:      NewAttestEventBus(),
+		metrics:     metrics.NewStaychainMetrics("maxfee"),
+		state:       AStateHandleUnconfirmed,
+	}
+
+	// Test AStateHandleUnconfirmed -> AStateAwaitConfirmation
+	clock.Advance(time.Hour)
+	attestService.doStateHandleUnconfirmed()
+	assert.Equal(t, AStateAwaitConfirmation, attestService.state)
+	assert.Equal(t, ATimeConfirmation, attestService.attestDelay)
+	assert.Equal(t, clock.Now(), attestService.confirmTime)
+	assert.Equal(t, false, attestService.isFeeBumped)
+	assert.Equal(t, 50, attestService.attester.Fees.GetFee())
+	assert.Equal(t, 0, len(attestService.attestation.Info.FeeBumps))
+	assert.Equal(t, 0, len(dbFake.FeeBumps))
+}
+
+// Test Attest Service publishing failure events once per distinct failure
+// Failures repeated on every retry are published once until recovery
+func TestAttestService_FailureEvents(t *testing.T) {
+	attestService := &AttestService{
+		config:      &confpkg.Config{},
+		server:      NewAttestServer(db.NewDbFake()),
+		attester:    &AttestClient{Fees: AttestFees{currentFee: 10}},
+		attestation: models.NewAttestationDefault(),
+		clock:       NewAttestClockFake(time.Now()),
+		events:      NewAttestEventBus(),
+		metrics:     metrics.NewStaychainMetrics("failures"),
+	}
+	var events []AttestEvent
+	attestService.events.Subscribe(attestSubscriberFunc(func(event AttestEvent) {
+		events = append(events, event)
+	}))
+
+	// two identical consecutive failures publish a single event
+	assert.Equal(t, true, attestService.setFailure(errors.New("rpc failure")))
+	attestService.doStateError()
+	assert.Equal(t, true, attestService.setFailure(errors.New("rpc failure")))
+	assert.Equal(t, AStateError, attestService.state)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, AEventAttestationFailed, events[0].Type)
+	assert.Equal(t, "rpc failure", events[0].Error)
+
+	// a different failure is published
+	attestService.setFailure(errors.New("db failure"))
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "db failure", events[1].Error)
+
+	// the same failure is published again after recovery
+	attestService.clearFailure()
+	assert.Equal(t, nil, attestService.errorState)
+	attestService.setFailure(errors.New("db failure"))
+	assert.Equal(t, 3, len(events))
+
+	// no failure
+	assert.Equal(t, false, attestService.setFailure(nil))
+	assert.Equal(t, 3, len(events))
+}
+
+// Test Attest Service spend tweak used for signing
+// Children of unconfirmed parents are signed with the parent commitment
+// stored when sigs are requested instead of the last confirmed commitment
+func TestAttestService_SpendHash(t *testing.T) {
+	dbFake := db.NewDbFake()
+	confirmedCommitment, _ := models.NewCommitment([]chainhash.Hash{chainhash.HashH([]byte("confirmed"))})
+	confirmedAttestation := models.NewAttestation(chainhash.HashH([]byte("confirmedtx")), confirmedCommitment)
+	confirmedAttestation.Confirmed = true
+	dbFake.SaveAttestation(*confirmedAttestation)
+
+	parentTxid := chainhash.HashH([]byte("parenttx"))
+	attestation := models.NewAttestationDefault()
+	attestation.Tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&parentTxid, 0), nil, nil))
+	attestService := &AttestService{
+		config:      &confpkg.Config{},
+		server:      NewAttestServer(dbFake),
+		signer:      NewAttestSignerFake(nil),
+		attester:    &AttestClient{Fees: AttestFees{currentFee: 10}},
+		attestation: attestation,
+		clock:       NewAttestClockFake(time.Now()),
+		events:      NewAttestEventBus(),
+		metrics:     metrics.NewStaychainMetrics("spendhash"),
+		state:       AStateSignAttestation,
+	}
+
+	// no spend tweak stored - last confirmed commitment used
+	spendHash, spendErr := attestService.getSpendHash()
+	assert.Equal(t, nil, spendErr)
+	assert.Equal(t, confirmedCommitment.GetCommitmentHash(), spendHash)
+
+	// base transaction not tweaked
+	attestService.attester.txid0 = parentTxid.String()
+	spendHash, spendErr = attestService.getSpendHash()
+	assert.Equal(t, nil, spendErr)
+	assert.Equal(t, chainhash.Hash{}, spendHash)
+
+	// stored unconfirmed parent commitment used
+	parentCommitmentHash := chainhash.HashH([]byte("parent"))
+	attestService.spendHash = &parentCommitmentHash
+	spendHash, spendErr = attestService.getSpendHash()
+	assert.Equal(t, nil, spendErr)
+	assert.Equal(t, parentCommitmentHash, spendHash)
+
+	// stored spend tweak kept across restarts
+	attestService.saveCheckpoint()
+	restoredService := &AttestService{
+		config:      &confpkg.Config{},
+		server:      NewAttestServer(dbFake),
+		signer:      NewAttestSignerFake(nil),
+		attester:    &AttestClient{Fees: AttestFees{currentFee: 10}},
+		attestation: models.NewAttestationDefault(),
+		clock:       NewAttestClockFake(time.Now()),
+		events:      NewAttestEventBus(),
+		metrics:     metrics.NewStaychainMetrics("spendhashrestored"),
+	}
+	restoredService.restoreCheckpoint()
+	assert.Equal(t, AStateSignAttestation, restoredService.state)
+	spendHash, spendErr = restoredService.getSpendHash()
+	assert.Equal(t, nil, spendErr)
+	assert.Equal(t, parentCommitmentHash, spendHash)
+}
+
+// Test Attest Service min and max attestation times
+// New commitments attested after the min attestation time
+// and unchanged commitments re-attested after the max time
+func TestAttestService_MinMaxAttestation(t *testing.T) {
+
+	// Test INIT
+	test := test.NewTest(false, false)
+	config := test.Config
+
+	timingConfig := confpkg.TimingConfig{NewAttestationMinutes: -1, HandleUnconfirmedMinutes: -1,
+		MinAttestationMinutes: 10, MaxAttestationMinutes: 30, BudgetAttestationMinutes: -1}
+	config.SetTimingConfig(timingConfig)
+
+	dbFake := db.NewDbFake()
+	server := NewAttestServer(dbFake)
+	clock := NewAttestClockFake(time.Now())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	attestService := NewAttestService(ctx, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), clock, config)
+	assert.Equal(t, 10*time.Minute, attestService.atimeMinAttestation)
+	assert.Equal(t, 30*time.Minute, attestService.atimeMaxAttestation)
+
+	// Test initial state of attest service
+	verifyStateInit(t, attestService)
+	// Test AStateInit -> AStateNextCommitment
+	verifyStateInitToNextCommitment(t, attestService)
+
+	// Test AStateNextCommitment -> AStateNewAttestation
+	hashX, _ := chainhash.NewHashFromStr("aaaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	_ = verifyStateNextCommitmentToNewAttestation(t, attestService, dbFake, hashX)
+	// Test AStateNewAttestation -> AStateSignAttestation
+	verifyStateNewAttestationToSignAttestation(t, attestService)
+	// Test AStateSignAttestation -> AStatePreSendStore
+	verifyStateSignAttestationToPreSendStore(t, attestService)
+	// Test AStatePreSendStore -> AStateSendAttestation
+	verifyStatePreSendStoreToSendAttestation(t, attestService)
+	// Test AStateSendAttestation -> AStateAwaitConfirmation
+	txid := verifyStateSendAttestationToAwaitConfirmation(t, attestService)
+	// Test AStateAwaitConfirmation -> AStateNextCommitment
+	config.MainClient().Generate(1)
+	verifyStateAwaitConfirmationToNextCommitment(t, attestService, config, txid, 10*time.Minute)
+	assert.Equal(t, 10*time.Minute-ATimeSigs, attestService.attestDelay)
+
+	// Test new commitment notification forwarded to service
+	attestService.watchCommitments()
+	hashY, _ := chainhash.NewHashFromStr("baaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	latestCommitment, _ := models.NewCommitment([]chainhash.Hash{*hashY})
+	dbFake.SetClientCommitments([]models.ClientCommitment{models.ClientCommitment{Commitment: *hashY, ClientPosition: 0}})
+	<-attestService.commitmentNotify
+
+	// Test AStateNextCommitment -> AStateNextCommitment
+	// new commitment delayed until min attestation time
+	attestService.doAttestation()
+	assert.Equal(t, AStateNextCommitment, attestService.state)
+	assert.Equal(t, 10*time.Minute-ATimeSigs, attestService.attestDelay)
+
+	// Test AStateNextCommitment -> AStateNewAttestation
+	clock.Advance(attestService.attestDelay)
+	attestService.doAttestation()
+	assert.Equal(t, AStateNewAttestation, attestService.state)
+	assert.Equal(t, latestCommitment.GetCommitmentHash(), attestService.attestation.CommitmentHash())
+	// Test AStateNewAttestation -> AStateSignAttestation
+	verifyStateNewAttestationToSignAttestation(t, attestService)
+	// Test AStateSignAttestation -> AStatePreSendStore
+	verifyStateSignAttestationToPreSendStore(t, attestService)
+	// Test AStatePreSendStore -> AStateSendAttestation
+	verifyStatePreSendStoreToSendAttestation(t, attestService)
+	// Test AStateSendAttestation -> AStateAwaitConfirmation
+	txid = verifyStateSendAttestationToAwaitConfirmation(t, attestService)
+	// Test AStateAwaitConfirmation -> AStateNextCommitment
+	config.MainClient().Generate(1)
+	verifyStateAwaitConfirmationToNextCommitment(t, attestService, config, txid, 10*time.Minute)
+
+	// Test AStateNextCommitment -> AStateNextCommitment
+	// unchanged commitment skipped until max attestation time
+	attestService.doAttestation()
+	assert.Equal(t, AStateNextCommitment, attestService.state)
+	assert.Equal(t, ATimeSkip, attestService.attestDelay)
+	clock.Advance(28*time.Minute + 30*time.Second)
+	attestService.doAttestation()
+	assert.Equal(t, AStateNextCommitment, attestService.state)
+	assert.Equal(t, 30*time.Second, attestService.attestDelay)
+
+	// Test AStateNextCommitment -> AStateNewAttestation
+	// heartbeat attestation of unchanged commitment
+	clock.Advance(attestService.attestDelay)
+	attestService.doAttestation()
+	assert.Equal(t, AStateNewAttestation, attestService.state)
+	assert.Equal(t, latestCommitment.GetCommitmentHash(), attestService.attestation.CommitmentHash())
+	// Test AStateNewAttestation -> AStateSignAttestation
+	verifyStateNewAttestationToSignAttestation(t, attestService)
+	// Test AStateSignAttestation -> AStatePreSendStore
+	verifyStateSignAttestationToPreSendStore(t, attestService)
+	// Test AStatePreSendStore -> AStateSendAttestation
+	verifyStatePreSendStoreToSendAttestation(t, attestService)
+	// Test AStateSendAttestation -> AStateAwaitConfirmation
+	heartbeatTxid := verifyStateSendAttestationToAwaitConfirmation(t, attestService)
+	assert.Equal(t, false, txid == heartbeatTxid)
+	// Test AStateAwaitConfirmation -> AStateNextCommitment
+	config.MainClient().Generate(1)
+	verifyStateAwaitConfirmationToNextCommitment(t, attestService, config, heartbeatTxid, 10*time.Minute)
+}
+
+// Test Attest Service confirmation depth and reorg handling
+// Attestations are only confirmed after the confirmation depth is reached
+// and are rolled back to unconfirmed if their block leaves the best chain
+func TestAttestService_ConfirmationDepthReorg(t *testing.T) {
+
+	// Test INIT
+	test := test.NewTest(false, false)
+	config := test.Config
+	config.SetConfirmationDepth(2)
+
+	dbFake := db.NewDbFake()
+	server := NewAttestServer(dbFake)
+	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
+	assert.Equal(t, int64(2), attestService.confirmationDepth)
+
+	// Test initial state of attest service
+	verifyStateInit(t, attestService)
+	// Test AStateInit -> AStateNextCommitment
+	verifyStateInitToNextCommitment(t, attestService)
+
+	// Test AStateNextCommitment -> AStateNewAttestation
+	hashX, _ := chainhash.NewHashFromStr("aaaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	latestCommitment := verifyStateNextCommitmentToNewAttestation(t, attestService, dbFake, hashX)
+	// Test AStateNewAttestation -> AStateSignAttestation
+	verifyStateNewAttestationToSignAttestation(t, attestService)
+	// Test AStateSignAttestation -> AStatePreSendStore
+	verifyStateSignAttestationToPreSendStore(t, attestService)
+	// Test AStatePreSendStore -> AStateSendAttestation
+	verifyStatePreSendStoreToSendAttestation(t, attestService)
+	// Test AStateSendAttestation -> AStateAwaitConfirmation
+	txid := verifyStateSendAttestationToAwaitConfirmation(t, attestService)
+
+	// Test AStateAwaitConfirmation -> AStateAwaitConfirmation
+	// attestation in block but confirmation depth not reached
+	config.MainClient().Generate(1)
+	verifyStateAwaitConfirmationToAwaitConfirmation(t, attestService)
+	assert.Equal(t, false, attestService.attestation.Confirmed)
+
+	// Test AStateAwaitConfirmation -> AStateNextCommitment
+	config.MainClient().Generate(1)
+	verifyStateAwaitConfirmationToNextCommitment(t, attestService, config, txid, DefaultATimeNewAttestation)
+	assert.Equal(t, 1, len(dbFake.AttestationsInfo))
+
+	// Test AStateNextCommitment -> AStateNextCommitment
+	// attestation still part of best chain
+	attestService.doAttestation()
+	assert.Equal(t, AStateNextCommitment, attestService.state)
+	assert.Equal(t, true, attestService.attestation.Confirmed)
+
+	// invalidate attestation block to move attestation back to mempool
+	blockhash, _ := chainhash.NewHashFromStr(attestService.attestation.Info.Blockhash)
+	invalidateErr := config.MainClient().InvalidateBlock(blockhash)
+	assert.Equal(t, nil, invalidateErr)
+
+	// Test AStateNextCommitment -> AStateAwaitConfirmation
+	attestService.doAttestation()
+	assert.Equal(t, AStateAwaitConfirmation, attestService.state)
+	assert.Equal(t, ATimeConfirmation, attestService.attestDelay)
+	assert.Equal(t, txid, attestService.attestation.Txid)
+	assert.Equal(t, false, attestService.attestation.Confirmed)
+	assert.Equal(t, models.AttestationInfo{}, attestService.attestation.Info)
+	assert.Equal(t, latestCommitment.GetCommitmentHash(), attestService.attestation.CommitmentHash())
+	assert.Equal(t, 0, len(dbFake.AttestationsInfo))
+	lastCommitmentHash, _ := server.GetLatestAttestationCommitmentHash()
+	assert.Equal(t, chainhash.Hash{}, lastCommitmentHash)
+
+	// Test AStateAwaitConfirmation -> AStateNextCommitment
+	config.MainClient().Generate(2)
+	verifyStateAwaitConfirmationToNextCommitment(t, attestService, config, txid, DefaultATimeNewAttestation)
+	assert.Equal(t, 1, len(dbFake.AttestationsInfo))
+	lastCommitmentHash, _ = server.GetLatestAttestationCommitmentHash()
+	assert.Equal(t, latestCommitment.GetCommitmentHash(), lastCommitmentHash)
+}
+
+// Test Attest Service in dry run mode
+// Attestations are built, signed and tested but never sent or stored
+func TestAttestService_DryRun(t *testing.T) {
+
+	// Test INIT
+	test := test.NewTest(false, false)
+	config := test.Config
+	config.SetDryRun(true)
+
+	dbFake := db.NewDbFake()
+	server := NewAttestServer(dbFake)
+	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
+	assert.Equal(t, true, attestService.isDryRun)
+
+	// Test initial state of attest service
+	verifyStateInit(t, attestService)
+	// Test AStateInit -> AStateNextCommitment
+	verifyStateInitToNextCommitment(t, attestService)
+
+	// Test AStateNextCommitment -> AStateNewAttestation
+	hashX, _ := chainhash.NewHashFromStr("aaaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	latestCommitment := verifyStateNextCommitmentToNewAttestation(t, attestService, dbFake, hashX)
+	// Test AStateNewAttestation -> AStateSignAttestation
+	verifyStateNewAttestationToSignAttestation(t, attestService)
+	// Test AStateSignAttestation -> AStatePreSendStore
+	verifyStateSignAttestationToPreSendStore(t, attestService)
+	// Test AStatePreSendStore -> AStateSendAttestation
+	verifyStatePreSendStoreToSendAttestation(t, attestService)
+	assert.Equal(t, 0, len(dbFake.Attestations))
+
+	// Test AStateSendAttestation -> AStateNextCommitment
+	// attestation accepted by testmempoolaccept but not broadcast
+	attestService.doAttestation()
+	assert.Equal(t, AStateNextCommitment, attestService.state)
+	assert.Equal(t, attestService.atimeMinAttestation-ATimeSigs, attestService.attestDelay)
+	assert.Equal(t, latestCommitment.GetCommitmentHash(), attestService.attestation.CommitmentHash())
+	assert.Equal(t, false, attestService.attestation.Confirmed)
+	mempool, _ := config.MainClient().GetRawMempool()
+	assert.Equal(t, 0, len(mempool))
+	assert.Equal(t, 0, len(dbFake.Attestations))
+	checkpoint, _ := dbFake.GetAttestationCheckpoint()
+	assert.Equal(t, (*models.AttestationCheckpoint)(nil), checkpoint)
+
+	// Test AStateNextCommitment -> AStateNextCommitment
+	// dry run attestation commitment not attested again
+	attestService.doAttestation()
+	assert.Equal(t, AStateNextCommitment, attestService.state)
+	assert.Equal(t, ATimeSkip, attestService.attestDelay)
+
+	// Test AStateSendAttestation -> AStateError
+	// attestation rejected by testmempoolaccept
+	attestService.state = AStateSendAttestation
+	attestService.attestation.Tx.TxIn[0].Witness = wire.TxWitness{}
+	attestService.doAttestation()
+	assert.Equal(t, AStateError, attestService.state)
+	assert.Equal(t, true, attestService.errorState != nil)
+}
+
+// Test Attest Service with child-pays-for-parent fee bumping
+// Child attestations when signers are available and
+// fee-only child transactions signed with the topup key otherwise
+func TestAttestService_CPFP(t *testing.T) {
+
+	// Test INIT
+	test := test.NewTest(false, false)
+	config := test.Config
+	config.SetFeesConfig(confpkg.FeesConfig{MinFee: -1, MaxFee: -1, FeeIncrement: -1,
+		BumpStrategy: FeeBumpCPFP, ConfTarget: -1, StaticFee: -1, BumpFactor: -1, BumpConfTarget: -1,
+		BumpDeadlineMinutes: -1, MonthlyBudget: -1})
+	customAtimeNewAttestation := 5
+	customAtimeHandleUnconfirmed := 10
+	config.SetTimingConfig(confpkg.TimingConfig{NewAttestationMinutes: customAtimeNewAttestation, HandleUnconfirmedMinutes: customAtimeHandleUnconfirmed,
+		MinAttestationMinutes: -1, MaxAttestationMinutes: -1, BudgetAttestationMinutes: -1})
+
+	dbFake := db.NewDbFake()
+	server := NewAttestServer(dbFake)
+	clock := NewAttestClockFake(time.Now())
+	attestService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), clock, config)
+	assert.Equal(t, FeeBumpCPFP, attestService.attester.Fees.BumpStrategy())
+	assert.Equal(t, true, attestService.attester.WalletPrivTopup != nil)
+
+	attestService.attester.Fees.ResetFee(true)
+
+	// Test initial state of attest service
+	verifyStateInit(t, attestService)
+	// Test AStateInit -> AStateNextCommitment
+	verifyStateInitToNextCommitment(t, attestService)
+
+	// Test AStateNextCommitment -> AStateNewAttestation
+	hashX, _ := chainhash.NewHashFromStr("aaaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	_ = verifyStateNextCommitmentToNewAttestation(t, attestService, dbFake, hashX)
+
+	// Test AStateNewAttestation -> AStateSignAttestation
+	// attestation includes anchor output paying to the topup address
+	attestService.doAttestation()
+	assert.Equal(t, AStateSignAttestation, attestService.state)
+	assert.Equal(t, 1, len(attestService.attestation.Tx.TxIn))
+	assert.Equal(t, 2, len(attestService.attestation.Tx.TxOut))
+	assert.Equal(t, int64(anchorValue), attestService.attestation.Tx.TxOut[1].Value)
+
+	// Test AStateSignAttestation -> AStatePreSendStore
+	verifyStateSignAttestationToPreSendStore(t, attestService)
+	// Test AStatePreSendStore -> AStateSendAttestation
+	verifyStatePreSendStoreToSendAttestation(t, attestService)
+	// Test AStateSendAttestation -> AStateAwaitConfirmation
+	parentTxid := verifyStateSendAttestationToAwaitConfirmation(t, attestService)
+
+	// Test AStateAwaitConfirmation -> AStateHandleUnconfirmed
+	clock.Advance(time.Duration(customAtimeHandleUnconfirmed) * time.Minute)
+	verifyStateAwaitConfirmationToHandleUnconfirmed(t, attestService)
+
+	// Test AStateHandleUnconfirmed -> AStateSignAttestation
+	// child attestation of latest commitment spending unconfirmed parent
+	hashY, _ := chainhash.NewHashFromStr("baaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	latestCommitment, _ := models.NewCommitment([]chainhash.Hash{*hashY})
+	dbFake.SetClientCommitments([]models.ClientCommitment{models.ClientCommitment{Commitment: *hashY, ClientPosition: 0}})
+	parentCommitmentHash := attestService.attestation.CommitmentHash()
+	attestService.doAttestation()
+	assert.Equal(t, AStateSignAttestation, attestService.state)
+	assert.Equal(t, ATimeSigs, attestService.attestDelay)
+	assert.Equal(t, latestCommitment.GetCommitmentHash(), attestService.attestation.CommitmentHash())
+
+	// child spends the output tweaked with the unconfirmed parent commitment
+	// which differs from the last confirmed commitment
+	confirmedCommitmentHash, _ := server.GetLatestAttestationCommitmentHash()
+	assert.NotEqual(t, confirmedCommitmentHash, parentCommitmentHash)
+	assert.Equal(t, parentCommitmentHash, *attestService.spendHash)
+
+	// spend tweak kept across restarts
+	attestService.saveCheckpoint()
+	restoredService := NewAttestService(nil, nil, server, NewAttestSignerFake([]*confpkg.Config{config}), NewAttestClockFake(time.Now()), config)
+	restoredService.restoreCheckpoint()
+	assert.Equal(t, AStateSignAttestation, restoredService.state)
+	assert.Equal(t, parentCommitmentHash, *restoredService.spendHash)
+	assert.Equal(t, 1, len(attestService.attestation.Tx.TxIn))
+	assert.Equal(t, *wire.NewOutPoint(&parentTxid, 0), attestService.attestation.Tx.TxIn[0].PreviousOutPoint)
+	assert.Equal(t, 2, len(attestService.attestation.Tx.TxOut))
+	assert.Equal(t, attestService.attester.Fees.minFee+attestService.attester.Fees.feeIncrement,
+		attestService.attester.Fees.GetFee())
+
+	// Test AStateSignAttestation -> AStatePreSendStore
+	verifyStateSignAttestationToPreSendStore(t, attestService)
+	// Test AStatePreSendStore -> AStateSendAttestation
+	verifyStatePreSendStoreToSendAttestation(t, attestService)
+	// Test AStateSendAttestation -> AStateAwaitConfirmation
+	childTxid := verifyStateSendAttestationToAwaitConfirmation(t, attestService)
+	mempool, _ := config.MainClient().GetRawMempool()
+	assert.Equal(t, 2, len(mempool))
+
+	// Test AStateAwaitConfirmation -> AStateNextCommitment
+	// parent attestation confirmed along with the child
+	config.MainClient().Generate(1)
+	verifyStateAwaitConfirmationToNextCommitment(t, attestService, config, childTxid,
+		time.Duration(customAtimeNewAttestation)*time.Minute)
+	assert.Equal(t, 2, len(dbFake.Attestations))
+	assert.Equal(t, true, dbFake.Attestations[0].Confirmed)
+	assert.Equal(t, true, dbFake.Attestations[1].Confirmed)
+	assert.Equal(t, 2, len(dbFake.AttestationsInfo))
+	assert.Equal(t, parentTxid.String(), dbFake.AttestationsInfo[0].Txid)
+	lastCommitmentHash, _ := server.GetLatestAttestationCommitmentHash()
+	assert.Equal(t, latestCommitment.GetCommitmentHash(), lastCommitmentHash)
+
+	// create top up unspent for fee-only child
+	_ = createTopupUnspent(t, config)
+	config.MainClient().Generate(1)
+
+	// Test AStateNextCommitment -> AStateNewAttestation
+	hashZ, _ := chainhash.NewHashFromStr("caaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	_ = verifyStateNextCommitmentToNewAttestation(t, attestService, dbFake, hashZ)
+	// Test AStateNewAttestation -> AStateSignAttestation
+	attestService.doAttestation()
+	assert.Equal(t, AStateSignAttestation, attestService.state)
+	assert.Equal(t, 2, len(attestService.attestation.Tx.TxOut))
+	// Test AStateSignAttestation -> AStatePreSendStore
+	verifyStateSignAttestationToPreSendStore(t, attestService)
+	// Test AStatePreSendStore -> AStateSendAttestation
+	verifyStatePreSendStoreToSendAttestation(t, attestService)
+	// Test AStateSendAttestation -> AStateAwaitConfirmation
+	txid := verifyStateSendAttestationToAwaitConfirmation(t, attestService)
+
+	// Test AStateAwaitConfirmation -> AStateHandleUnconfirmed
+	clock.Advance(time.Duration(customAtimeHandleUnconfirmed) * time.Minute)
+	verifyStateAwaitConfirmationToHandleUnconfirmed(t, attestService)
+
+	// Test AStateHandleUnconfirmed -> AStateAwaitConfirmation
+	// signers not available - fee-only child sent with topup key
+	attestService.signer = NewAttestSignerFake([]*confpkg.Config{})
+	attestService.doAttestation()
+	assert.Equal(t, AStateAwaitConfirmation, attestService.state)
+	assert.Equal(t, ATimeConfirmation, attestService.attestDelay)
+	assert.Equal(t, txid, attestService.attestation.Txid)
+	assert.Equal(t, false, attestService.isFeeBumped)
+	mempool, _ = config.MainClient().GetRawMempool()
+	assert.Equal(t, 2, len(mempool))
+
+	// fee-only child not part of the staychain
+	_, unconfirmedTxid, _ := attestService.attester.getUnconfirmedTx()
+	assert.Equal(t, txid, unconfirmedTxid)
+	feeChildTx := attestService.feeChildTx
+	feeChildFee := attestService.attestation.Info.ChildFee
+	for _, txIn := range feeChildTx.TxIn {
+		assert.Equal(t, uint32(wire.MaxTxInSequenceNum-2), txIn.Sequence)
+	}
+
+	// Test AStateAwaitConfirmation -> AStateHandleUnconfirmed
+	clock.Advance(time.Duration(customAtimeHandleUnconfirmed) * time.Minute)
+	verifyStateAwaitConfirmationToHandleUnconfirmed(t, attestService)
+
+	// Test AStateHandleUnconfirmed -> AStateAwaitConfirmation
+	// second fee-only child of the same parent replaces the first by fee
+	attestService.doAttestation()
+	assert.Equal(t, AStateAwaitConfirmation, attestService.state)
+	assert.Equal(t, txid, attestService.attestation.Txid)
+	assert.NotEqual(t, feeChildTx.TxHash(), attestService.feeChildTx.TxHash())
+	assert.Equal(t, len(feeChildTx.TxIn), len(attestService.feeChildTx.TxIn))
+	for i, txIn := range feeChildTx.TxIn {
+		assert.Equal(t, txIn.PreviousOutPoint, attestService.feeChildTx.TxIn[i].PreviousOutPoint)
+	}
+	assert.Equal(t, true, attestService.feeChildTx.TxOut[0].Value < feeChildTx.TxOut[0].Value)
+	mempool, _ = config.MainClient().GetRawMempool()
+	assert.Equal(t, 2, len(mempool))
+	feeChildTxid := attestService.feeChildTx.TxHash()
+	assert.Contains(t, []chainhash.Hash{*mempool[0], *mempool[1]}, feeChildTxid)
+	assert.Equal(t, feeChildFee+feeChildTx.TxOut[0].Value-attestService.feeChildTx.TxOut[0].Value,
+		attestService.attestation.Info.ChildFee)
+
+	// Test AStateAwaitConfirmation -> AStateNextCommitment
+	config.MainClient().Generate(1)
+	verifyStateAwaitConfirmationToNextCommitment(t, attestService, config, txid,
+		time.Duration(customAtimeNewAttestation)*time.Minute)
+	success, unspent, _ := attestService.attester.findLastUnspent()
+	assert.Equal(t, true, success)
+	assert.Equal(t, txid.String(), unspent.TxID)
+	assert.Equal(t, uint32(0), unspent.Vout)
+}
+
+// attestSignerErr implements AttestSigner failing all signature requests
+type attestSignerErr struct {
+	*AttestSignerFake
+}
+
+// Return signer error for all signature requests
+func (f attestSignerErr) GetSigs(sigHashes [][]byte, merkle_root string) ([]wire.TxWitness, error) {
+	return nil, errors.New(ErrorSignerRequest)
+}
+
+// Test Attest Service signer failures
+// Signer errors and missing signatures move the service to the error state
+func TestAttestService_SignerFailure(t *testing.T) {
+
+	// Test INIT
+	test := test.NewTest(false, false)
+	config := test.Config
+
+	dbFake := db.NewDbFake()
+	server := NewAttestServer(dbFake)
+	attestService := NewAttestService(nil, nil, server, attestSignerErr{NewAttestSignerFake([]*confpkg.Config{config})},
+		NewAttestClockFake(time.Now()), config)
+
+	// Test initial state of attest service
+	verifyStateInit(t, attestService)
+	// Test AStateInit -> AStateNextCommitment
+	verifyStateInitToNextCommitment(t, attestService)
+
+	// Test AStateNextCommitment -> AStateNewAttestation
+	hashX, _ := chainhash.NewHashFromStr("aaaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	_ = verifyStateNextCommitmentToNewAttestation(t, attestService, dbFake, hashX)
+
+	// Test AStateNewAttestation -> AStateError
+	// signer request failure
+	attestService.doAttestation()
+	assert.Equal(t, AStateError, attestService.state)
+	assert.Equal(t, errors.New(fmt.Sprintf("%s %s", ErrorSignerSigs, ErrorSignerRequest)), attestService.errorState)
+	assert.Equal(t, 0, len(attestService.sigs))
+
+	// Test AStateError -> AStateInit -> AStateNextCommitment
+	attestService.signer = NewAttestSignerFake([]*confpkg.Config{})
+	attestService.doAttestation()
+	assert.Equal(t, AStateInit, attestService.state)
+	verifyStateInitToNextCommitment(t, attestService)
+
+	// Test AStateNextCommitment -> AStateNewAttestation
+	_ = verifyStateNextCommitmentToNewAttestation(t, attestService, dbFake, hashX)
+
+	// Test AStateNewAttestation -> AStateError
+	// signer returns no signatures
+	attestService.doAttestation()
+	assert.Equal(t, AStateError, attestService.state)
+	assert.Equal(t, errors.New(fmt.Sprintf("%s for input %d", ErrorSigsMissing, 0)), attestService.errorState)
+	assert.Equal(t, 0, len(dbFake.Attestations))
+}
+
+// Test Attest Service with a 2-of-2 P2WSH multisig staychain
+// Signatures are gathered from a separate signer for each multisig key
+func TestAttestService_Multisig(t *testing.T) {
+	multisigPks := []string{test.PrivMain, test.TopupPrivMain}
+	multisigChaincodes := []string{test.InitChaincode, test.InitChaincode}
+
+	// Test INIT
+	test := test.NewTest(false, false)
+	config := test.Config
+
+	// multisig of main and topup keys with the same chaincode
+	var pubkeys []*btcec.PublicKey
+	for _, pk := range multisigPks {
+		wif, _ := btcutil.DecodeWIF(pk)
+		pubkeys = append(pubkeys, wif.PrivKey.PubKey())
+	}
+	multisigAddr, multisigScript := crypto.CreateMultisigWitness(pubkeys, 2, config.MainChainCfg())
+	config.SetInitScript(multisigScript)
+	config.SetInitChaincodes(multisigChaincodes)
+
+	// fund base multisig address as the initial staychain transaction
+	config.MainClient().Generate(101)
+	config.MainClient().ImportAddress(multisigAddr.String())
+	balance, _ := config.MainClient().GetBalance("*")
+	txid0, sendErr := config.MainClient().SendToAddressComment(multisigAddr, balance-btcutil.Amount(Coin), "", "")
+	assert.Equal(t, nil, sendErr)
+	config.MainClient().Generate(1)
+	config.SetInitTx(txid0.String())
+
+	// a signer for each of the multisig keys
+	var signers []AttestSigner
+	for _, pk := range multisigPks {
+		signerConfig := *config
+		signerConfig.SetInitPK(pk)
+		signers = append(signers, NewAttestSignerFake([]*confpkg.Config{&signerConfig}))
+	}
+	pubkeysExtended, numOfSigs := parseMultisigKeys(config.InitScript(), config.InitChaincodes())
+	signer := newAttestSignerMultisig(signers, []string{"main", "topup"}, pubkeysExtended, numOfSigs,
+		config.TopupAddress(), config.MainChainCfg())
+
+	dbFake := db.NewDbFake()
+	server := NewAttestServer(dbFake)
+	attestService := NewAttestService(nil, nil, server, signer, NewAttestClockFake(time.Now()), config)
+	assert.Equal(t, 2, attestService.attester.numOfSigs)
+	assert.Equal(t, true, attestService.attester.isMultisig())
+
+	// Test initial state of attest service
+	verifyStateInit(t, attestService)
+	// Test AStateInit -> AStateNextCommitment
+	verifyStateInitToNextCommitment(t, attestService)
+
+	// redeem script of spent output is tweaked with the previous commitment
+	prevHash := chainhash.Hash{}
+	hashes := []string{
+		"aaaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7",
+		"baaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7"}
+	for _, hashStr := range hashes {
+		// Test AStateNextCommitment -> AStateNewAttestation
+		hash, _ := chainhash.NewHashFromStr(hashStr)
+		latestCommitment := verifyStateNextCommitmentToNewAttestation(t, attestService, dbFake, hash)
+
+		// Test AStateNewAttestation -> AStateSignAttestation
+		// attestation pays to the multisig tweaked with the commitment
+		verifyStateNewAttestationToSignAttestation(t, attestService)
+		tweakedAddr, _, _ := attestService.attester.GetNextAttestationScript(latestCommitment.GetCommitmentHash())
+		tweakedScript, _ := txscript.PayToAddrScript(tweakedAddr)
+		assert.Equal(t, tweakedScript, attestService.attestation.Tx.TxOut[0].PkScript)
+
+		// Test AStateSignAttestation -> AStatePreSendStore
+		// multisig witness with both sigs and tweaked redeem script
+		verifyStateSignAttestationToPreSendStore(t, attestService)
+		_, redeemScript, _ := attestService.attester.GetNextAttestationScript(prevHash)
+		witness := attestService.attestation.Tx.TxIn[0].Witness
+		assert.Equal(t, 4, len(witness))
+		assert.Equal(t, redeemScript, hex.EncodeToString(witness[3]))
+
+		// Test AStatePreSendStore -> AStateSendAttestation
+		verifyStatePreSendStoreToSendAttestation(t, attestService)
+		// Test AStateSendAttestation -> AStateAwaitConfirmation
+		txid := verifyStateSendAttestationToAwaitConfirmation(t, attestService)
+		// Test AStateAwaitConfirmation -> AStateNextCommitment
+		config.MainClient().Generate(1)
+		verifyStateAwaitConfirmationToNextCommitment(t, attestService, config, txid, DefaultATimeNewAttestation)
+		prevHash = latestCommitment.GetCommitmentHash()
+	}
+}
+
 // commenting the test for signer
 // func TestAttestService_Regular_With_Signer(t *testing.T) {
 
@@ -1023,12 +1898,12 @@ func TestAttestService_FailureHandleUnconfirmed(t *testing.T) {
 
 // 	// randomly test with invalid config here
 // 	// timing config no effect on server
-// 	timingConfig := confpkg.TimingConfig{-1, -1}
+// 	timingConfig := confpkg.TimingConfig{-1, -1, -1, -1}
 // 	config.SetTimingConfig(timingConfig)
 
 // 	dbFake := db.NewDbFake()
 // 	server := NewAttestServer(dbFake)
-// 	attestService := NewAttestService(nil, nil, server, NewAttestSignerHttp(config.SignerConfig()), config)
+// 	attestService := NewAttestService(nil, nil, server, NewAttestSignerHttp(context.Background(), config.SignerConfig()), NewAttestClockSystem(), config)
 
 // 	// Test initial state of attest service
 // 	verifyStateInit(t, attestService)
@@ -1041,7 +1916,7 @@ func TestAttestService_FailureHandleUnconfirmed(t *testing.T) {
 // 	attestService.doAttestation()
 // 	assert.Equal(t, AStateError, attestService.state)
 // 	assert.Equal(t, errors.New(models.ErrorCommitmentListEmpty), attestService.errorState)
-// 	assert.Equal(t, ATimeFixed, attestDelay)
+// 	assert.Equal(t, ATimeFixed, attestService.attestDelay)
 
 // 	// Test AStateError -> AStateInit -> AStateNextCommitment again
 // 	attestService.doAttestation()
@@ -1073,7 +1948,7 @@ func TestAttestService_FailureHandleUnconfirmed(t *testing.T) {
 // 	attestService.doAttestation()
 // 	assert.Equal(t, AStateNextCommitment, attestService.state)
 // 	assert.Equal(t, latestCommitment.GetCommitmentHash(), attestService.attestation.CommitmentHash())
-// 	assert.Equal(t, ATimeSkip, attestDelay)
+// 	assert.Equal(t, ATimeSkip, attestService.attestDelay)
 
 // 	// Test AStateNextCommitment -> AStateNewAttestation
 // 	// stuck in next commitment
@@ -5,9 +5,28 @@
 package attestation
 
 import (
+	"context"
+	"errors"
+	"fmt"
+
+	confpkg "mainstay/config"
+	"mainstay/log"
+
 	"github.com/btcsuite/btcd/wire"
 )
 
+// signer protocols
+const (
+	SignerProtocolSighash = "sighash"
+	SignerProtocolPsbt    = "psbt"
+	SignerProtocolMusig2  = "musig2"
+)
+
+// warning consts
+const (
+	WarningInvalidSignerProtocol = "Invalid signer protocol - using sighash protocol"
+)
+
 // AttestSigner interface
 //
 // Provides the interface for communication with
@@ -17,12 +36,110 @@ import (
 // - sending the new generated transaction for signing
 // - getting the signatures from signers
 //
+// Sending transactions and getting signatures return
+// an error if signers are not available or responses
+// are invalid, allowing the service to fail cleanly
+//
 // This interface allows building communication with
-// various ways - currently supporting zmq only
+// various ways - currently supporting http and grpc
 // This interface allows building mock struct for testing
 type AttestSigner interface {
 	SendConfirmedHash([]byte)
-	SendTxPreImages([][]byte)
-	GetSigs([][]byte, string) []wire.TxWitness
+	SendTxPreImages([][]byte) error
+	GetSigs([][]byte, string) ([]wire.TxWitness, error)
 	ReSubscribe()
+	Name() string
+}
+
+// AttestSignerStream interface
+//
+// Implemented by signers that stream signatures back as these are ready
+// Signatures are requested without blocking the attestation service,
+// which polls for the signatures until all signers have responded
+type AttestSignerStream interface {
+	RequestSigs([][]byte, string)
+	PollSigs() ([]wire.TxWitness, bool, error)
+}
+
+// AttestTopupSigner interface
+//
+// Implemented by signers keeping the topup key, e.g. the keystore, which
+// sign the topup inputs of fee-only child transactions in place of the
+// client so that the topup key is not copied out of the signer
+type AttestTopupSigner interface {
+	SignTopup([]byte) (wire.TxWitness, error)
+}
+
+// AttestSignerError
+//
+// Error returned when the witness received from a signer
+// for a transaction input fails verification
+type AttestSignerError struct {
+	Signer string
+	Input  int
+	Msg    string
+}
+
+// Implement Error interface method
+func (e *AttestSignerError) Error() string {
+	return fmt.Sprintf("%s for input %d from signer %s", e.Msg, e.Input, e.Signer)
+}
+
+// Return new AttestSigner for the signer config of the staychain
+// Signers are requested through the sighash or psbt protocol and
+// multisig staychains with multiple signer urls gather signatures
+// from each of the signers, while taproot staychains can aggregate
+// a single signature from multiple signers through the musig2 protocol
+// Attestations are signed in-process if a signer keystore is set
+// and signers connect to the service instead if a grpc host is set
+// Http signer requests are cancelled once the service ctx is done
+func NewAttestSigner(ctx context.Context, config *confpkg.Config) (AttestSigner, error) {
+	signerConfig := config.SignerConfig()
+	var signer AttestSigner
+	var signerErr error
+	if signerConfig.Keystore.File != "" {
+		signer, signerErr = NewAttestSignerKeystore(config)
+	} else if signerConfig.GrpcHost != "" {
+		signer, signerErr = NewAttestSignerGrpc(config)
+	} else if signerConfig.Protocol == SignerProtocolPsbt {
+		signer, signerErr = NewAttestSignerPsbt(ctx, config)
+	} else if signerConfig.Protocol == SignerProtocolMusig2 {
+		signer, signerErr = NewAttestSignerMusig2(ctx, config)
+	} else {
+		if signerConfig.Protocol != SignerProtocolSighash && signerConfig.Protocol != "" {
+			log.Warnf("%s (%s)\n", WarningInvalidSignerProtocol, signerConfig.Protocol)
+		}
+		if len(signerConfig.Urls) > 0 {
+			signer, signerErr = NewAttestSignerMultisig(ctx, config)
+		} else {
+			signer, signerErr = NewAttestSignerHttp(ctx, signerConfig)
+		}
+	}
+	if signerErr != nil { // avoid returning a nil signer as a non-nil interface
+		return nil, signerErr
+	}
+	return signer, nil
+}
+
+// Return signer config for the signer url at index i of the signer urls
+// Each signer is authenticated with the auth pubkey at the same index
+func signerUrlConfig(config confpkg.SignerConfig, i int) (confpkg.SignerConfig, error) {
+	signerConfig := config
+	signerConfig.Url = config.Urls[i]
+	if len(config.Auth.Pubkeys) > 0 {
+		if len(config.Auth.Pubkeys) != len(config.Urls) {
+			return confpkg.SignerConfig{}, errors.New(ErrorSignerAuthPubkeys)
+		}
+		signerConfig.Auth.Pubkeys = config.Auth.Pubkeys[i : i+1]
+	}
+	return signerConfig, nil
+}
+
+// Return new http signer for the signer url at index i of the signer urls
+func newAttestSignerHttpUrl(ctx context.Context, config confpkg.SignerConfig, i int) (*AttestSignerHttp, error) {
+	signerConfig, configErr := signerUrlConfig(config, i)
+	if configErr != nil {
+		return nil, configErr
+	}
+	return NewAttestSignerHttp(ctx, signerConfig)
 }
@@ -0,0 +1,277 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	confpkg "mainstay/config"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+)
+
+// Signer channel authentication
+//
+// Requests to signers are signed over a timestamp, a random nonce
+// and the request body. Signers reply with a signature over the
+// request nonce and the response body, binding each response to
+// the request it was sent for. Signatures use either a shared
+// HMAC-SHA256 secret or ECDSA keys of the service and the signers
+// Signers reject requests outside the timestamp window or with a
+// nonce already seen, so that old requests cannot be replayed
+
+// signer auth headers
+const (
+	SignerHeaderTimestamp = "X-Mainstay-Timestamp"
+	SignerHeaderNonce     = "X-Mainstay-Nonce"
+	SignerHeaderSignature = "X-Mainstay-Signature"
+
+	SignerSignatureHmac  = "sha256="
+	SignerSignatureEcdsa = "ecdsa="
+)
+
+// signer auth consts
+const (
+	// maximum difference between request timestamp and signer time
+	SignerAuthWindow = 5 * time.Minute
+
+	// size of random request nonce in bytes
+	signerNonceSize = 16
+)
+
+// error consts
+const (
+	ErrorSignerAuthSignature = "Invalid signer auth signature"
+	ErrorSignerAuthMissing   = "Missing signer auth headers"
+	ErrorSignerAuthTimestamp = "Signer request timestamp outside window"
+	ErrorSignerAuthReplay    = "Signer request nonce already used"
+	ErrorSignerAuthKey       = "Invalid signer auth key"
+	ErrorSignerAuthPubkeys   = "Signer auth pubkeys required for each signer url"
+	ErrorSignerTls           = "Invalid signer tls config"
+)
+
+// SignerAuth struct
+//
+// Signs outgoing messages and verifies incoming messages
+// of the signer channel with a shared HMAC secret or with
+// an ECDSA private key and the ECDSA pubkey of the other side
+type SignerAuth struct {
+	secret []byte
+	priv   *btcec.PrivateKey
+	pub    *btcec.PublicKey
+}
+
+// Return new SignerAuth using an HMAC-SHA256 shared secret
+func NewSignerAuthHmac(secret []byte) *SignerAuth {
+	return &SignerAuth{secret: secret}
+}
+
+// Return new SignerAuth signing with priv and verifying against pub
+func NewSignerAuthEcdsa(priv *btcec.PrivateKey, pub *btcec.PublicKey) *SignerAuth {
+	return &SignerAuth{priv: priv, pub: pub}
+}
+
+// Return SignerAuth from signer auth config or nil if not configured
+// Exactly one signer pubkey is required for ECDSA auth
+func newSignerAuth(config confpkg.SignerAuthConfig) (*SignerAuth, error) {
+	if config.Secret != "" {
+		return NewSignerAuthHmac([]byte(config.Secret)), nil
+	}
+	if config.Key == "" {
+		return nil, nil
+	}
+	if len(config.Pubkeys) != 1 {
+		return nil, errors.New(ErrorSignerAuthPubkeys)
+	}
+	privBytes, privErr := hex.DecodeString(config.Key)
+	if privErr != nil || len(privBytes) != btcec.PrivKeyBytesLen {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorSignerAuthKey, privErr))
+	}
+	priv, _ := btcec.PrivKeyFromBytes(privBytes)
+	pubBytes, pubErr := hex.DecodeString(config.Pubkeys[0])
+	if pubErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorSignerAuthKey, pubErr))
+	}
+	pub, parseErr := btcec.ParsePubKey(pubBytes)
+	if parseErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorSignerAuthKey, parseErr))
+	}
+	return NewSignerAuthEcdsa(priv, pub), nil
+}
+
+// Return client tls config from signer auth config or nil if not configured
+// The client certificate is presented to signers for mTLS and the
+// signer certificates are verified against the CA certificate if set
+func newSignerTlsConfig(config confpkg.SignerAuthConfig) (*tls.Config, error) {
+	if config.TlsCert == "" && config.TlsKey == "" && config.TlsCa == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.TlsCert != "" || config.TlsKey != "" {
+		cert, certErr := tls.LoadX509KeyPair(config.TlsCert, config.TlsKey)
+		if certErr != nil {
+			return nil, errors.New(fmt.Sprintf("%s %v", ErrorSignerTls, certErr))
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if config.TlsCa != "" {
+		caBytes, caErr := ioutil.ReadFile(config.TlsCa)
+		if caErr != nil {
+			return nil, errors.New(fmt.Sprintf("%s %v", ErrorSignerTls, caErr))
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caBytes) {
+			return nil, errors.New(fmt.Sprintf("%s %s", ErrorSignerTls, config.TlsCa))
+		}
+	}
+	return tlsConfig, nil
+}
+
+// Return message signed for signer requests
+func SignerRequestMessage(timestamp string, nonce string, body []byte) []byte {
+	return append([]byte(timestamp+"\n"+nonce+"\n"), body...)
+}
+
+// Return message signed for signer responses
+func SignerResponseMessage(nonce string, body []byte) []byte {
+	return append([]byte(nonce+"\n"), body...)
+}
+
+// Return signature of message
+func (a *SignerAuth) Sign(msg []byte) string {
+	if a.priv != nil {
+		msgHash := sha256.Sum256(msg)
+		return SignerSignatureEcdsa + hex.EncodeToString(ecdsa.Sign(a.priv, msgHash[:]).Serialize())
+	}
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write(msg)
+	return SignerSignatureHmac + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify signature of message
+func (a *SignerAuth) Verify(msg []byte, signature string) error {
+	if a.pub != nil {
+		sigBytes, decodeErr := hex.DecodeString(strings.TrimPrefix(signature, SignerSignatureEcdsa))
+		if decodeErr != nil || !strings.HasPrefix(signature, SignerSignatureEcdsa) {
+			return errors.New(ErrorSignerAuthSignature)
+		}
+		sig, sigErr := ecdsa.ParseDERSignature(sigBytes)
+		msgHash := sha256.Sum256(msg)
+		if sigErr != nil || !sig.Verify(msgHash[:], a.pub) {
+			return errors.New(ErrorSignerAuthSignature)
+		}
+		return nil
+	}
+	if !hmac.Equal([]byte(signature), []byte(a.Sign(msg))) {
+		return errors.New(ErrorSignerAuthSignature)
+	}
+	return nil
+}
+
+// Set auth headers of signer request and return the request nonce
+func (a *SignerAuth) SignRequest(req *http.Request, body []byte) (string, error) {
+	nonceBytes := make([]byte, signerNonceSize)
+	if _, randErr := rand.Read(nonceBytes); randErr != nil {
+		return "", randErr
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set(SignerHeaderTimestamp, timestamp)
+	req.Header.Set(SignerHeaderNonce, nonce)
+	req.Header.Set(SignerHeaderSignature, a.Sign(SignerRequestMessage(timestamp, nonce, body)))
+	return nonce, nil
+}
+
+// Verify signer response signature for the request nonce
+func (a *SignerAuth) VerifyResponse(resp *http.Response, nonce string, body []byte) error {
+	signature := resp.Header.Get(SignerHeaderSignature)
+	if signature == "" {
+		return errors.New(ErrorSignerAuthMissing)
+	}
+	return a.Verify(SignerResponseMessage(nonce, body), signature)
+}
+
+// Verify signer request signature, timestamp and nonce
+// Return the request nonce that the response should be signed for
+func (a *SignerAuth) VerifyRequest(req *http.Request, body []byte, nonces *SignerNonceCache) (string, error) {
+	timestamp := req.Header.Get(SignerHeaderTimestamp)
+	nonce := req.Header.Get(SignerHeaderNonce)
+	signature := req.Header.Get(SignerHeaderSignature)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return "", errors.New(ErrorSignerAuthMissing)
+	}
+	if verifyErr := a.Verify(SignerRequestMessage(timestamp, nonce, body), signature); verifyErr != nil {
+		return "", verifyErr
+	}
+	if nonceErr := nonces.Check(timestamp, nonce, time.Now()); nonceErr != nil {
+		return "", nonceErr
+	}
+	return nonce, nil
+}
+
+// Set response signature header for the request nonce
+func (a *SignerAuth) SignResponse(w http.ResponseWriter, nonce string, body []byte) {
+	w.Header().Set(SignerHeaderSignature, a.Sign(SignerResponseMessage(nonce, body)))
+}
+
+// SignerNonceCache struct
+//
+// Stores the nonces of requests received within the timestamp
+// window so that requests cannot be replayed. Nonces are kept with
+// the request timestamp and dropped once the timestamp is older than
+// the window, as their requests are rejected anyway from then on
+type SignerNonceCache struct {
+	mtx    sync.Mutex
+	window time.Duration
+	nonces map[string]time.Time
+}
+
+// Return new SignerNonceCache instance
+func NewSignerNonceCache(window time.Duration) *SignerNonceCache {
+	return &SignerNonceCache{
+		window: window,
+		nonces: make(map[string]time.Time),
+	}
+}
+
+// Check request timestamp is within window and nonce is unused
+func (c *SignerNonceCache) Check(timestamp string, nonce string, now time.Time) error {
+	unix, parseErr := strconv.ParseInt(timestamp, 10, 64)
+	if parseErr != nil {
+		return errors.New(fmt.Sprintf("%s %v", ErrorSignerAuthTimestamp, parseErr))
+	}
+	requestTime := time.Unix(unix, 0)
+	if requestTime.Before(now.Add(-c.window)) || requestTime.After(now.Add(c.window)) {
+		return errors.New(ErrorSignerAuthTimestamp)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for n, t := range c.nonces {
+		if t.Before(now.Add(-c.window)) { // request time outside window
+			delete(c.nonces, n)
+		}
+	}
+	if _, ok := c.nonces[nonce]; ok {
+		return errors.New(ErrorSignerAuthReplay)
+	}
+	c.nonces[nonce] = requestTime
+	return nil
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	confpkg "mainstay/config"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// Return test server verifying signed requests and signing responses
+func signerAuthTestServer(auth *SignerAuth) *httptest.Server {
+	nonces := NewSignerNonceCache(SignerAuthWindow)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		nonce, authErr := auth.VerifyRequest(r, body, nonces)
+		if authErr != nil {
+			http.Error(w, authErr.Error(), http.StatusUnauthorized)
+			return
+		}
+		response, _ := json.Marshal(ResponseBody{[]string{"3001 02aa"}})
+		auth.SignResponse(w, nonce, response)
+		w.Write(response)
+	}))
+}
+
+// Test http signer request signing and response verification
+func TestAttestSignerAuth(t *testing.T) {
+	servicePriv, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x01}, 32))
+	signerPriv, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x02}, 32))
+
+	for _, auths := range [][]confpkg.SignerAuthConfig{
+		{{Secret: "secret"}, {Secret: "secret"}},
+		{{Key: hex.EncodeToString(servicePriv.Serialize()), Pubkeys: []string{hex.EncodeToString(signerPriv.PubKey().SerializeCompressed())}},
+			{Key: hex.EncodeToString(signerPriv.Serialize()), Pubkeys: []string{hex.EncodeToString(servicePriv.PubKey().SerializeCompressed())}}},
+	} {
+		signerAuth, _ := newSignerAuth(auths[1])
+		server := signerAuthTestServer(signerAuth)
+
+		signer, _ := NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: server.URL, TimeoutSeconds: 1, RetryBaseMillis: 1, Auth: auths[0]})
+		witness, err := signer.GetSigs([][]byte{[]byte{0xaa}}, "root")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, 1, len(witness))
+
+		// signer with other credentials rejected
+		otherAuth := confpkg.SignerAuthConfig{Secret: "other"}
+		if auths[0].Key != "" {
+			otherAuth = confpkg.SignerAuthConfig{Key: hex.EncodeToString(signerPriv.Serialize()), Pubkeys: auths[0].Pubkeys}
+		}
+		signer, _ = NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: server.URL, TimeoutSeconds: 1, RetryBaseMillis: 1, Auth: otherAuth})
+		_, err = signer.GetSigs([][]byte{[]byte{0xaa}}, "root")
+		assert.Contains(t, err.Error(), ErrorSignerResponseStatus)
+
+		// unsigned responses rejected
+		server.Close()
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(ResponseBody{[]string{"3001 02aa"}})
+		}))
+		signer, _ = NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: server.URL, TimeoutSeconds: 1, RetryBaseMillis: 1, Auth: auths[0]})
+		_, err = signer.GetSigs([][]byte{[]byte{0xaa}}, "root")
+		assert.Equal(t, errors.New(ErrorSignerResponse+" "+ErrorSignerAuthMissing), err)
+		server.Close()
+	}
+}
+
+// Test signer request replay and timestamp checks
+func TestAttestSignerAuth_Replay(t *testing.T) {
+	auth := NewSignerAuthHmac([]byte("secret"))
+	nonces := NewSignerNonceCache(SignerAuthWindow)
+	body := []byte("body")
+
+	req, _ := http.NewRequest(http.MethodPost, "http://host", nil)
+	nonce, signErr := auth.SignRequest(req, body)
+	assert.Equal(t, nil, signErr)
+
+	verifiedNonce, err := auth.VerifyRequest(req, body, nonces)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nonce, verifiedNonce)
+
+	// replayed request
+	_, err = auth.VerifyRequest(req, body, nonces)
+	assert.Equal(t, errors.New(ErrorSignerAuthReplay), err)
+
+	// tampered body
+	_, err = auth.VerifyRequest(req, []byte("other"), nonces)
+	assert.Equal(t, errors.New(ErrorSignerAuthSignature), err)
+
+	// missing headers
+	_, err = auth.VerifyRequest(&http.Request{Header: http.Header{}}, body, nonces)
+	assert.Equal(t, errors.New(ErrorSignerAuthMissing), err)
+
+	// timestamps outside window
+	now := time.Now()
+	old := strconv.FormatInt(now.Add(-2*SignerAuthWindow).Unix(), 10)
+	assert.Equal(t, errors.New(ErrorSignerAuthTimestamp), nonces.Check(old, "nonce0", now))
+	future := strconv.FormatInt(now.Add(2*SignerAuthWindow).Unix(), 10)
+	assert.Equal(t, errors.New(ErrorSignerAuthTimestamp), nonces.Check(future, "nonce0", now))
+
+	// expired nonces dropped
+	current := strconv.FormatInt(now.Unix(), 10)
+	assert.Equal(t, nil, nonces.Check(current, "nonce1", now))
+	assert.Equal(t, errors.New(ErrorSignerAuthReplay), nonces.Check(current, "nonce1", now))
+	later := now.Add(2 * SignerAuthWindow)
+	assert.Equal(t, nil, nonces.Check(strconv.FormatInt(later.Unix(), 10), "nonce1", later))
+
+	// future dated request replayed once the window after receiving it passed
+	futureDated := strconv.FormatInt(now.Add(SignerAuthWindow/2).Unix(), 10)
+	assert.Equal(t, nil, nonces.Check(futureDated, "nonce2", now))
+	replayTime := now.Add(SignerAuthWindow + time.Second)
+	assert.Equal(t, errors.New(ErrorSignerAuthReplay), nonces.Check(futureDated, "nonce2", replayTime))
+}
+
+// Test http signer mTLS client certificate and signer CA
+func TestAttestSignerAuth_Tls(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "no client certificate", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(ResponseBody{[]string{"3001 02aa"}})
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	// write server certificate as CA and reuse it as client certificate
+	dir, _ := ioutil.TempDir("", "signertls")
+	defer os.RemoveAll(dir)
+	cert := server.TLS.Certificates[0]
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyBytes, _ := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})
+	ioutil.WriteFile(filepath.Join(dir, "cert.pem"), certPem, 0600)
+	ioutil.WriteFile(filepath.Join(dir, "key.pem"), keyPem, 0600)
+
+	auth := confpkg.SignerAuthConfig{
+		TlsCert: filepath.Join(dir, "cert.pem"),
+		TlsKey:  filepath.Join(dir, "key.pem"),
+		TlsCa:   filepath.Join(dir, "cert.pem"),
+	}
+	signer, _ := NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: server.URL, TimeoutSeconds: 1, RetryBaseMillis: 1, Auth: auth})
+	witness, err := signer.GetSigs([][]byte{[]byte{0xaa}}, "root")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(witness))
+
+	// signer certificate not trusted without CA
+	signer, _ = NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: server.URL, TimeoutSeconds: 1, RetryBaseMillis: 1})
+	_, err = signer.GetSigs([][]byte{[]byte{0xaa}}, "root")
+	assert.Contains(t, err.Error(), ErrorSignerRequest)
+}
+
+// Test invalid signer auth config returned as errors
+func TestAttestSignerAuth_ConfigErrors(t *testing.T) {
+	signerPriv, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x02}, 32))
+	signerPub := hex.EncodeToString(signerPriv.PubKey().SerializeCompressed())
+
+	// ecdsa auth requires a single signer pubkey
+	_, err := NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: "host",
+		Auth: confpkg.SignerAuthConfig{Key: hex.EncodeToString(signerPriv.Serialize())}})
+	assert.Equal(t, errors.New(ErrorSignerAuthPubkeys), err)
+
+	// invalid auth key
+	_, err = NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: "host",
+		Auth: confpkg.SignerAuthConfig{Key: "aa", Pubkeys: []string{signerPub}}})
+	assert.Contains(t, err.Error(), ErrorSignerAuthKey)
+
+	// missing tls certificates
+	_, err = NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: "host",
+		Auth: confpkg.SignerAuthConfig{TlsCa: filepath.Join(t.TempDir(), "missing.pem")}})
+	assert.Contains(t, err.Error(), ErrorSignerTls)
+
+	// auth pubkey required for each signer url
+	_, err = newAttestSignerHttpUrl(context.Background(), confpkg.SignerConfig{Urls: []string{"host0", "host1"},
+		Auth: confpkg.SignerAuthConfig{Key: hex.EncodeToString(signerPriv.Serialize()), Pubkeys: []string{signerPub}}}, 0)
+	assert.Equal(t, errors.New(ErrorSignerAuthPubkeys), err)
+}
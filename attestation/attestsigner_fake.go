@@ -10,6 +10,7 @@ import (
 	"encoding/hex"
 
 	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 )
@@ -20,14 +21,14 @@ import (
 // mock functionality for receiving sigs from signers
 type AttestSignerFake struct {
 	clients []*AttestClient
-}
 
-// store latest hash and transaction
-var signerTxPreImageBytesFake []byte
-var signerConfirmedHashBytesFake []byte
+	// store latest hash and transaction
+	txPreImageBytes    []byte
+	confirmedHashBytes []byte
+}
 
 // Return new AttestSignerFake instance
-func NewAttestSignerFake(configs []*confpkg.Config) AttestSignerFake {
+func NewAttestSignerFake(configs []*confpkg.Config) *AttestSignerFake {
 
 	var clients []*AttestClient
 	for _, config := range configs {
@@ -35,26 +36,32 @@ func NewAttestSignerFake(configs []*confpkg.Config) AttestSignerFake {
 		clients = append(clients, NewAttestClient(config, true))
 	}
 
-	return AttestSignerFake{clients: clients}
+	return &AttestSignerFake{clients: clients}
 }
 
 // Resubscribe - do nothing
-func (f AttestSignerFake) ReSubscribe() {
+func (f *AttestSignerFake) ReSubscribe() {
 	return
 }
 
+// Return signer name
+func (f *AttestSignerFake) Name() string {
+	return "fake"
+}
+
 // Store received confirmed hash
-func (f AttestSignerFake) SendConfirmedHash(hash []byte) {
-	signerConfirmedHashBytesFake = hash
+func (f *AttestSignerFake) SendConfirmedHash(hash []byte) {
+	f.confirmedHashBytes = hash
 }
 
 // Store received new tx
-func (f AttestSignerFake) SendTxPreImages(txs [][]byte) {
-	signerTxPreImageBytesFake = SerializeBytes(txs)
+func (f *AttestSignerFake) SendTxPreImages(txs [][]byte) error {
+	f.txPreImageBytes = SerializeBytes(txs)
+	return nil
 }
 
 // Return signatures for received tx and hashes
-func (f AttestSignerFake) GetSigs(sigHashes [][]byte, merkle_root string) []wire.TxWitness {
+func (f *AttestSignerFake) GetSigs(sigHashes [][]byte, merkle_root string) ([]wire.TxWitness, error) {
 
 	merkle_root_bytes, _ := hex.DecodeString(merkle_root)
 	reversed_merkle_root := make([]byte, len(merkle_root_bytes))
@@ -67,7 +74,7 @@ func (f AttestSignerFake) GetSigs(sigHashes [][]byte, merkle_root string) []wire
 
 	if hashErr != nil {
 		log.Infof("%v\n", hashErr)
-		return nil
+		return nil, hashErr
 	}
 
 	witness := make([]wire.TxWitness, len(sigHashes))
@@ -81,7 +88,13 @@ func (f AttestSignerFake) GetSigs(sigHashes [][]byte, merkle_root string) []wire
 			// any remaining txs with topup key
 			var sig *ecdsa.Signature
 			var sigBytes []byte
-			if i_tx == 0 {
+			if i_tx == 0 && client.isTaproot() {
+				// schnorr signature and x-only pubkey of tweaked output key
+				priv := client.GetKeyFromHash(*hash)
+				schnorrSig, _ := schnorr.Sign(priv.PrivKey, sigHash)
+				sigBytes = append(schnorrSig.Serialize(), []byte{byte(1)}...)
+				witness[i_tx] = wire.TxWitness{sigBytes, schnorr.SerializePubKey(priv.PrivKey.PubKey())}
+			} else if i_tx == 0 {
 				priv := client.GetKeyFromHash(*hash)
 				sig = ecdsa.Sign(priv.PrivKey, sigHash)
 				sigBytes = append(sig.Serialize(), []byte{byte(1)}...)
@@ -94,5 +107,5 @@ func (f AttestSignerFake) GetSigs(sigHashes [][]byte, merkle_root string) []wire
 		}
 	}
 
-	return witness
+	return witness, nil
 }
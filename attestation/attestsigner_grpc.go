@@ -0,0 +1,466 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mainstay/attestation/signerpb"
+	confpkg "mainstay/config"
+	"mainstay/log"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// error / warning consts
+const (
+	ErrorGrpcListen     = "Failed listening for grpc signers"
+	ErrorGrpcNoSigners  = "No grpc signers connected"
+	ErrorGrpcHello      = "Grpc signer hello missing"
+	ErrorGrpcStream     = "Grpc signer stream closed"
+	ErrorGrpcTimeout    = "Grpc signer timed out"
+	ErrorGrpcSigner     = "Grpc signer refused to sign"
+	ErrorGrpcMusig2     = "Grpc signers do not support the musig2 protocol"
+	WarningGrpcSend     = "Failed sending to grpc signer"
+	WarningGrpcReplaced = "Grpc signer reconnected - replacing previous stream"
+	WarningGrpcTls      = "No grpc signer TLS set - signer streams are not authenticated"
+)
+
+// AttestSignerGrpc struct
+//
+// Implements AttestSigner and AttestSignerStream interfaces and serves
+// a grpc api that signers connect to, so that signers can run behind
+// firewalls without accepting incoming connections
+//
+// Each signer opens a bidirectional stream that the service pushes the
+// confirmed hash, transaction pre-images and sign requests to. Signers
+// stream back the signatures of each sign request as soon as these are
+// ready. Signers are identified by the name sent in their hello message
+// and should be authenticated with client certificates (mTLS)
+//
+// Multisig staychains gather partial signatures from all connected
+// signers and assemble the multisig witness once the threshold is reached
+type AttestSignerGrpc struct {
+	signerpb.UnimplementedSignerServer
+
+	server  *grpc.Server
+	addr    net.Addr
+	timeout time.Duration
+
+	// multisig base pubkeys and number of sigs required - nil if not multisig
+	mainChainCfg    *chaincfg.Params
+	pubkeysExtended []*hdkeychain.ExtendedKey
+	numOfSigs       int
+	addrTopup       string
+
+	mtx   sync.Mutex
+	conns map[string]*grpcSignerConn // connected signers by name
+
+	// latest events sent to signers, also sent to signers on connection
+	confirmedHash []byte
+	txPreImages   [][]byte
+
+	// latest signature request streamed to signers
+	request *grpcSigRequest
+}
+
+// signature request result, set once done is closed
+type grpcSigRequest struct {
+	done    chan struct{}
+	witness []wire.TxWitness
+	err     error
+}
+
+// Return new AttestSignerGrpc instance listening for signers
+// at the grpc host of the signer config
+func NewAttestSignerGrpc(config *confpkg.Config) (*AttestSignerGrpc, error) {
+	signerConfig := config.SignerConfig()
+	if signerConfig.Protocol == SignerProtocolMusig2 {
+		return nil, errors.New(ErrorGrpcMusig2)
+	}
+	timeout := ATimeSigs
+	if signerConfig.TimeoutSeconds > 0 {
+		timeout = time.Duration(signerConfig.TimeoutSeconds) * time.Second
+	}
+
+	var pubkeysExtended []*hdkeychain.ExtendedKey
+	var numOfSigs int
+	if config.InitScript() != "" {
+		pubkeysExtended, numOfSigs = parseMultisigKeys(config.InitScript(), config.InitChaincodes())
+	}
+
+	var opts []grpc.ServerOption
+	tlsConfig, tlsErr := newSignerGrpcTlsConfig(signerConfig.Auth)
+	if tlsErr != nil {
+		return nil, tlsErr
+	} else if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else {
+		log.Warnln(WarningGrpcTls)
+	}
+
+	signer, listenErr := newAttestSignerGrpc(signerConfig.GrpcHost, timeout, pubkeysExtended, numOfSigs,
+		config.TopupAddress(), config.MainChainCfg(), opts...)
+	if listenErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorGrpcListen, listenErr))
+	}
+	log.Infof("*Signer* listening for grpc signers at %s\n", signer.addr.String())
+	return signer, nil
+}
+
+// Return new AttestSignerGrpc instance serving signers at the host provided
+func newAttestSignerGrpc(host string, timeout time.Duration, pubkeysExtended []*hdkeychain.ExtendedKey,
+	numOfSigs int, addrTopup string, mainChainCfg *chaincfg.Params, opts ...grpc.ServerOption) (*AttestSignerGrpc, error) {
+	listener, listenErr := net.Listen("tcp", host)
+	if listenErr != nil {
+		return nil, listenErr
+	}
+	g := &AttestSignerGrpc{
+		server:          grpc.NewServer(opts...),
+		addr:            listener.Addr(),
+		timeout:         timeout,
+		mainChainCfg:    mainChainCfg,
+		pubkeysExtended: pubkeysExtended,
+		numOfSigs:       numOfSigs,
+		addrTopup:       addrTopup,
+		conns:           make(map[string]*grpcSignerConn),
+	}
+	signerpb.RegisterSignerServer(g.server, g)
+	go g.server.Serve(listener)
+	return g, nil
+}
+
+// Return server tls config from signer auth config or nil if not configured
+// The certificate is presented to signers and signer client certificates
+// are required and verified against the CA certificate if set
+func newSignerGrpcTlsConfig(config confpkg.SignerAuthConfig) (*tls.Config, error) {
+	tlsConfig, tlsErr := newSignerTlsConfig(config)
+	if tlsConfig == nil {
+		return nil, tlsErr
+	}
+	if tlsConfig.RootCAs != nil {
+		tlsConfig.ClientCAs = tlsConfig.RootCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		tlsConfig.RootCAs = nil
+	}
+	return tlsConfig, nil
+}
+
+// Stop grpc server closing all signer streams
+func (g *AttestSignerGrpc) Stop() {
+	g.server.Stop()
+}
+
+// Handle stream of a connected signer
+// Signatures received are passed to the pending request of the signer
+func (g *AttestSignerGrpc) Connect(stream signerpb.Signer_ConnectServer) error {
+	msg, recvErr := stream.Recv()
+	if recvErr != nil {
+		return recvErr
+	}
+	hello := msg.GetHello()
+	if hello == nil || hello.GetName() == "" {
+		return errors.New(ErrorGrpcHello)
+	}
+	conn := newGrpcSignerConn(hello.GetName(), stream, g.timeout)
+
+	g.mtx.Lock()
+	if prevConn, ok := g.conns[conn.name]; ok {
+		log.Warnf("%s (%s)\n", WarningGrpcReplaced, conn.name)
+		prevConn.close(errors.New(WarningGrpcReplaced))
+	}
+	g.conns[conn.name] = conn
+	confirmedHash, txPreImages := g.confirmedHash, g.txPreImages
+	g.mtx.Unlock()
+	log.Infof("*Signer* grpc signer %s connected\n", conn.name)
+
+	// bring signer up to date with the latest events
+	if confirmedHash != nil {
+		conn.SendConfirmedHash(confirmedHash)
+	}
+	if txPreImages != nil {
+		conn.SendTxPreImages(txPreImages)
+	}
+
+	var streamErr error
+	for {
+		msg, streamErr = stream.Recv()
+		if streamErr != nil {
+			break
+		}
+		if sigs := msg.GetSignatures(); sigs != nil {
+			conn.receive(sigs)
+		}
+	}
+
+	g.mtx.Lock()
+	if g.conns[conn.name] == conn {
+		delete(g.conns, conn.name)
+	}
+	g.mtx.Unlock()
+	conn.close(errors.New(ErrorGrpcStream))
+	return nil
+}
+
+// Return signer combining the signatures of the connected signers
+// Multisig staychains gather partial signatures from all connected
+// signers, while the latest connected signer is used otherwise
+func (g *AttestSignerGrpc) connected() (AttestSigner, error) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if len(g.conns) == 0 {
+		return nil, errors.New(ErrorGrpcNoSigners)
+	}
+
+	var names []string
+	for name := range g.conns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(g.pubkeysExtended) == 0 {
+		latest := g.conns[names[0]]
+		for _, name := range names {
+			if g.conns[name].connectTime.After(latest.connectTime) {
+				latest = g.conns[name]
+			}
+		}
+		return latest, nil
+	}
+
+	var signers []AttestSigner
+	for _, name := range names {
+		signers = append(signers, g.conns[name])
+	}
+	return newAttestSignerMultisig(signers, names, g.pubkeysExtended, g.numOfSigs,
+		g.addrTopup, g.mainChainCfg), nil
+}
+
+// Return signer name listing the names of the connected signers
+func (g *AttestSignerGrpc) Name() string {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	var names []string
+	for name := range g.conns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "grpc:" + strings.Join(names, ",")
+}
+
+// Resubscribe - do nothing as signers reconnect to the service
+func (g *AttestSignerGrpc) ReSubscribe() {
+	return
+}
+
+// Send confirmed hash to all connected signers
+func (g *AttestSignerGrpc) SendConfirmedHash(hash []byte) {
+	g.mtx.Lock()
+	g.confirmedHash = hash
+	g.mtx.Unlock()
+
+	signer, connErr := g.connected()
+	if connErr != nil {
+		return
+	}
+	signer.SendConfirmedHash(hash)
+}
+
+// Send new tx pre images to all connected signers
+func (g *AttestSignerGrpc) SendTxPreImages(txs [][]byte) error {
+	g.mtx.Lock()
+	g.txPreImages = txs
+	g.mtx.Unlock()
+
+	signer, connErr := g.connected()
+	if connErr != nil {
+		return connErr
+	}
+	return signer.SendTxPreImages(txs)
+}
+
+// Return signatures of the connected signers for the sighashes provided
+// Blocks until signatures are received or signers time out
+func (g *AttestSignerGrpc) GetSigs(sigHashes [][]byte, merkle_root string) ([]wire.TxWitness, error) {
+	signer, connErr := g.connected()
+	if connErr != nil {
+		return nil, connErr
+	}
+	return signer.GetSigs(sigHashes, merkle_root)
+}
+
+// Stream sign request to the connected signers without waiting for
+// signatures, replacing any previous request of the service
+func (g *AttestSignerGrpc) RequestSigs(sigHashes [][]byte, merkle_root string) {
+	request := &grpcSigRequest{done: make(chan struct{})}
+	g.mtx.Lock()
+	g.request = request
+	g.mtx.Unlock()
+
+	go func() {
+		request.witness, request.err = g.GetSigs(sigHashes, merkle_root)
+		close(request.done)
+	}()
+}
+
+// Return signatures of the latest sign request and whether all signers
+// have responded. An error is returned if signers failed
+func (g *AttestSignerGrpc) PollSigs() ([]wire.TxWitness, bool, error) {
+	g.mtx.Lock()
+	request := g.request
+	g.mtx.Unlock()
+	if request == nil {
+		return nil, false, errors.New(ErrorGrpcNoSigners)
+	}
+	select {
+	case <-request.done:
+		return request.witness, true, request.err
+	default:
+		return nil, false, nil
+	}
+}
+
+// grpcSignerConn
+//
+// Implements AttestSigner interface for the stream of a connected
+// signer, sending events to the signer and waiting for signatures
+type grpcSignerConn struct {
+	name        string
+	stream      signerpb.Signer_ConnectServer
+	timeout     time.Duration
+	connectTime time.Time
+
+	// streams do not support concurrent sends
+	sendMtx sync.Mutex
+
+	mtx       sync.Mutex
+	requestId uint64
+	pending   map[uint64]chan *signerpb.Signatures
+	closed    chan struct{}
+	closeErr  error
+}
+
+// Return new grpcSignerConn for the stream of the signer
+func newGrpcSignerConn(name string, stream signerpb.Signer_ConnectServer, timeout time.Duration) *grpcSignerConn {
+	return &grpcSignerConn{
+		name:        name,
+		stream:      stream,
+		timeout:     timeout,
+		connectTime: time.Now(),
+		pending:     make(map[uint64]chan *signerpb.Signatures),
+		closed:      make(chan struct{}),
+	}
+}
+
+// Send service message to the signer
+func (c *grpcSignerConn) send(msg *signerpb.ServiceMessage) error {
+	c.sendMtx.Lock()
+	defer c.sendMtx.Unlock()
+	select {
+	case <-c.closed:
+		return c.closeErr
+	default:
+	}
+	return c.stream.Send(msg)
+}
+
+// Pass signatures received to the request waiting for them
+func (c *grpcSignerConn) receive(sigs *signerpb.Signatures) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if response, ok := c.pending[sigs.GetRequestId()]; ok {
+		response <- sigs
+		delete(c.pending, sigs.GetRequestId())
+	}
+}
+
+// Close connection failing any pending requests
+func (c *grpcSignerConn) close(err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	select {
+	case <-c.closed:
+	default:
+		c.closeErr = err
+		close(c.closed)
+	}
+}
+
+// Return signer name
+func (c *grpcSignerConn) Name() string {
+	return c.name
+}
+
+// Resubscribe - do nothing
+func (c *grpcSignerConn) ReSubscribe() {
+	return
+}
+
+// Send confirmed hash to the signer
+func (c *grpcSignerConn) SendConfirmedHash(hash []byte) {
+	if err := c.send(&signerpb.ServiceMessage{Event: &signerpb.ServiceMessage_ConfirmedHash{
+		ConfirmedHash: &signerpb.ConfirmedHash{Hash: hash}}}); err != nil {
+		log.Warnf("%s %s: %v\n", WarningGrpcSend, c.name, err)
+	}
+}
+
+// Send new tx pre images to the signer
+func (c *grpcSignerConn) SendTxPreImages(txs [][]byte) error {
+	return c.send(&signerpb.ServiceMessage{Event: &signerpb.ServiceMessage_TxPreImages{
+		TxPreImages: &signerpb.TxPreImages{TxPreImages: txs}}})
+}
+
+// Send sign request to the signer and wait for the signatures
+func (c *grpcSignerConn) GetSigs(sigHashes [][]byte, merkle_root string) ([]wire.TxWitness, error) {
+	response := make(chan *signerpb.Signatures, 1)
+	c.mtx.Lock()
+	c.requestId++
+	id := c.requestId
+	c.pending[id] = response
+	c.mtx.Unlock()
+	defer func() {
+		c.mtx.Lock()
+		delete(c.pending, id)
+		c.mtx.Unlock()
+	}()
+
+	sendErr := c.send(&signerpb.ServiceMessage{Event: &signerpb.ServiceMessage_SignRequest{
+		SignRequest: &signerpb.SignRequest{Id: id, Sighashes: sigHashes, MerkleRoot: merkle_root}}})
+	if sendErr != nil {
+		return nil, sendErr
+	}
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case sigs := <-response:
+		if sigs.GetError() != "" {
+			return nil, errors.New(fmt.Sprintf("%s: %s", ErrorGrpcSigner, sigs.GetError()))
+		}
+		if len(sigs.GetWitness()) != len(sigHashes) {
+			return nil, errors.New(fmt.Sprintf("%s: %d != %d", ErrorSignerWitnessCount,
+				len(sigs.GetWitness()), len(sigHashes)))
+		}
+		witness := make([]wire.TxWitness, len(sigs.GetWitness()))
+		for i, inputWitness := range sigs.GetWitness() {
+			witness[i] = wire.TxWitness(inputWitness.GetItems())
+		}
+		return witness, nil
+	case <-c.closed:
+		return nil, c.closeErr
+	case <-timer.C:
+		return nil, errors.New(ErrorGrpcTimeout)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"mainstay/attestation/signerpb"
+	"mainstay/crypto"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// test signer connecting to the grpc signer service and signing
+// requests with the stub signer, recording the events received
+type grpcTestSigner struct {
+	stub          *attestSignerStub
+	release       chan struct{} // sign requests wait for release if set
+	cancel        context.CancelFunc
+	confirmedHash chan []byte
+	txPreImages   chan [][]byte
+}
+
+// Connect test signer with the name provided and wait for the connection
+func connectGrpcTestSigner(t *testing.T, g *AttestSignerGrpc, name string, stub *attestSignerStub,
+	release chan struct{}) *grpcTestSigner {
+	conn, dialErr := grpc.Dial(g.addr.String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Equal(t, nil, dialErr)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, streamErr := signerpb.NewSignerClient(conn).Connect(ctx)
+	assert.Equal(t, nil, streamErr)
+	assert.Equal(t, nil, stream.Send(&signerpb.SignerMessage{Event: &signerpb.SignerMessage_Hello{
+		Hello: &signerpb.Hello{Name: name}}}))
+
+	s := &grpcTestSigner{stub: stub, release: release, cancel: func() { cancel(); conn.Close() },
+		confirmedHash: make(chan []byte, 10), txPreImages: make(chan [][]byte, 10)}
+	go func() {
+		for {
+			msg, recvErr := stream.Recv()
+			if recvErr != nil {
+				return
+			}
+			switch event := msg.GetEvent().(type) {
+			case *signerpb.ServiceMessage_ConfirmedHash:
+				s.confirmedHash <- event.ConfirmedHash.GetHash()
+			case *signerpb.ServiceMessage_TxPreImages:
+				s.txPreImages <- event.TxPreImages.GetTxPreImages()
+			case *signerpb.ServiceMessage_SignRequest:
+				if s.release != nil {
+					<-s.release
+				}
+				sigs := &signerpb.Signatures{RequestId: event.SignRequest.GetId()}
+				witness, err := s.stub.GetSigs(event.SignRequest.GetSighashes(), event.SignRequest.GetMerkleRoot())
+				if err != nil {
+					sigs.Error = err.Error()
+				}
+				for _, inputWitness := range witness {
+					sigs.Witness = append(sigs.Witness, &signerpb.Witness{Items: inputWitness})
+				}
+				stream.Send(&signerpb.SignerMessage{Event: &signerpb.SignerMessage_Signatures{Signatures: sigs}})
+			}
+		}
+	}()
+
+	for i := 0; i < 100 && !bytes.Contains([]byte(g.Name()), []byte(name)); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Contains(t, g.Name(), name)
+	return s
+}
+
+// Wait until the signer provided is disconnected from the service
+func waitGrpcDisconnected(g *AttestSignerGrpc, name string) {
+	for i := 0; i < 100 && bytes.Contains([]byte(g.Name()), []byte(name)); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Test grpc signer streaming events and sign requests to a connected signer
+func TestAttestSignerGrpc(t *testing.T) {
+	_, stubs, _ := multisigTestSigners(1)
+	g, err := newAttestSignerGrpc("127.0.0.1:0", time.Second, nil, 0, "", &chaincfg.RegressionNetParams)
+	assert.Equal(t, nil, err)
+	defer g.Stop()
+
+	hash, _ := chainhash.NewHashFromStr("3a7e4ed8ec6c5c5a8b5c9c2e8cbb5ab3d8e2b1e7f7b3c0a2b2c0ac5e8e3c8f9a")
+	sigHashes := [][]byte{bytes.Repeat([]byte{0xaa}, 32), bytes.Repeat([]byte{0xbb}, 32)}
+
+	// no signers connected
+	_, err = g.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, errors.New(ErrorGrpcNoSigners), err)
+	assert.Equal(t, errors.New(ErrorGrpcNoSigners), g.SendTxPreImages([][]byte{[]byte{1}}))
+	g.SendConfirmedHash(hash.CloneBytes())
+
+	// latest events sent on connection
+	signer := connectGrpcTestSigner(t, g, "signer0", stubs[0], nil)
+	defer signer.cancel()
+	assert.Equal(t, "grpc:signer0", g.Name())
+	assert.Equal(t, hash.CloneBytes(), <-signer.confirmedHash)
+	assert.Equal(t, [][]byte{[]byte{1}}, <-signer.txPreImages)
+
+	assert.Equal(t, nil, g.SendTxPreImages([][]byte{[]byte{2}}))
+	assert.Equal(t, [][]byte{[]byte{2}}, <-signer.txPreImages)
+
+	// signatures streamed back
+	expected, _ := stubs[0].GetSigs(sigHashes, hash.String())
+	witness, err := g.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, expected, witness)
+
+	// signer refusing to sign
+	stubs[0].err = errors.New("policy")
+	_, err = g.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, errors.New(fmt.Sprintf("%s: %s", ErrorGrpcSigner, "policy")), err)
+	stubs[0].err = nil
+
+	// signer disconnected
+	signer.cancel()
+	waitGrpcDisconnected(g, "signer0")
+	assert.Equal(t, "grpc:", g.Name())
+	_, err = g.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, errors.New(ErrorGrpcNoSigners), err)
+}
+
+// Test grpc signer requests polled without blocking until signatures arrive
+func TestAttestSignerGrpc_Poll(t *testing.T) {
+	_, stubs, _ := multisigTestSigners(1)
+	g, err := newAttestSignerGrpc("127.0.0.1:0", time.Second, nil, 0, "", &chaincfg.RegressionNetParams)
+	assert.Equal(t, nil, err)
+	defer g.Stop()
+
+	hash, _ := chainhash.NewHashFromStr("3a7e4ed8ec6c5c5a8b5c9c2e8cbb5ab3d8e2b1e7f7b3c0a2b2c0ac5e8e3c8f9a")
+	sigHashes := [][]byte{bytes.Repeat([]byte{0xaa}, 32)}
+
+	// no request made
+	_, ready, err := g.PollSigs()
+	assert.Equal(t, false, ready)
+	assert.Equal(t, errors.New(ErrorGrpcNoSigners), err)
+
+	// request fails with no signers connected
+	g.RequestSigs(sigHashes, hash.String())
+	for i := 0; i < 100 && !ready; i++ {
+		_, ready, err = g.PollSigs()
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, true, ready)
+	assert.Equal(t, errors.New(ErrorGrpcNoSigners), err)
+
+	// signer blocked until signatures are released
+	release := make(chan struct{})
+	signer := connectGrpcTestSigner(t, g, "signer0", stubs[0], release)
+	defer signer.cancel()
+
+	g.RequestSigs(sigHashes, hash.String())
+	_, ready, err = g.PollSigs()
+	assert.Equal(t, false, ready)
+	assert.Equal(t, nil, err)
+	close(release)
+
+	var witness []wire.TxWitness
+	ready = false
+	for i := 0; i < 100 && !ready; i++ {
+		witness, ready, err = g.PollSigs()
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, true, ready)
+	assert.Equal(t, nil, err)
+	expected, _ := stubs[0].GetSigs(sigHashes, hash.String())
+	assert.Equal(t, expected, witness)
+}
+
+// Test grpc signer assembling multisig witness from connected signers
+func TestAttestSignerGrpc_Multisig(t *testing.T) {
+	_, stubs, pubkeysExtended := multisigTestSigners(3)
+	addrTopup, _ := crypto.GetAddressFromPubKey(stubs[0].topup.PubKey(), &chaincfg.RegressionNetParams)
+	g, err := newAttestSignerGrpc("127.0.0.1:0", time.Second, pubkeysExtended, 2, addrTopup.String(),
+		&chaincfg.RegressionNetParams)
+	assert.Equal(t, nil, err)
+	defer g.Stop()
+
+	hash, _ := chainhash.NewHashFromStr("3a7e4ed8ec6c5c5a8b5c9c2e8cbb5ab3d8e2b1e7f7b3c0a2b2c0ac5e8e3c8f9a")
+	sigHashes := [][]byte{bytes.Repeat([]byte{0xaa}, 32), bytes.Repeat([]byte{0xbb}, 32)}
+
+	// threshold not reached with a single signer
+	signer0 := connectGrpcTestSigner(t, g, "signer0", stubs[0], nil)
+	defer signer0.cancel()
+	assert.Equal(t, errors.New(fmt.Sprintf("%s: %d < %d", ErrorSignersPreImages, 1, 2)),
+		g.SendTxPreImages([][]byte{[]byte{1}}))
+	_, err = g.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, errors.New(fmt.Sprintf("%s: %d < %d", ErrorSignerThreshold, 1, 2)), err)
+
+	signer2 := connectGrpcTestSigner(t, g, "signer2", stubs[2], nil)
+	defer signer2.cancel()
+	assert.Equal(t, "grpc:signer0,signer2", g.Name())
+	witness, err := g.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(witness))
+
+	// empty element, 2 sigs and redeem script
+	tweakedPubs, _ := tweakPubkeys(pubkeysExtended, *hash)
+	_, redeemScript := crypto.CreateMultisig(tweakedPubs, 2, &chaincfg.RegressionNetParams)
+	assert.Equal(t, 4, len(witness[0]))
+	assert.Equal(t, redeemScript, fmt.Sprintf("%x", witness[0][3]))
+	assert.Equal(t, nil, verifyTopupWitness(witness[1], sigHashes[1], addrTopup.String(),
+		&chaincfg.RegressionNetParams))
+}
@@ -6,117 +6,296 @@ package attestation
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"mainstay/log"
 	"io/ioutil"
 	confpkg "mainstay/config"
+	"mainstay/metrics"
 	"net/http"
 	"strings"
+	"time"
 	"github.com/btcsuite/btcd/wire"
 )
 
-// AttestSignerFake struct
+// error / warning consts
+const (
+	ErrorSignerRequest        = "Signer request failed"
+	ErrorSignerResponseStatus = "Signer request failed with status"
+	ErrorSignerResponse       = "Invalid signer response"
+	ErrorSignerWitnessCount   = "Signer returned wrong number of witnesses"
+	ErrorSignerWitness        = "Invalid signer witness"
+
+	WarningSignerRetry = "Signer request failed - retrying"
+
+	WarningInvalidSignerTimeoutArg   = "Invalid signer timeout config value"
+	WarningInvalidSignerRetriesArg   = "Invalid signer retries config value"
+	WarningInvalidSignerRetryBaseArg = "Invalid signer retry base config value"
+)
+
+// signer request schedules
+const (
+	// default timeout of each signer request
+	DefaultSignerTimeout = 30 * time.Second
+
+	// default number of retries of failed signer requests
+	DefaultSignerRetries = 3
+
+	// default waiting time before first retry, doubled on each failed attempt
+	DefaultSignerRetryBase = 1 * time.Second
+
+	// maximum waiting time between retries
+	SignerRetryMax = 30 * time.Second
+)
+
+// AttestSignerHttp struct
 //
-// Implements AttestSigner interface and provides
-// mock functionality for receiving sigs from signers
+// Implements AttestSigner interface and requests
+// signatures from a signer through an HTTP api
 type AttestSignerHttp struct {
+	ctx    context.Context
 	client http.Client
 	url    string
+
+	// request and response signing - nil if not configured
+	auth *SignerAuth
+
+	// request timeout and retry schedule
+	timeout   time.Duration
+	retries   int
+	retryBase time.Duration
+
+	// store latest hash and transaction
+	txPreImageBytes    []byte
+	confirmedHashBytes []byte
 }
 
 type RequestBody struct {
-	SighashString   []string `json:"sighash_string"`
-	MerkleRoot      string `json:"merkle_root"`
+	SighashString []string `json:"sighash_string"`
+	MerkleRoot    string   `json:"merkle_root"`
 }
 
-// store latest hash and transaction
-var signerTxPreImageBytes []byte
-var signerConfirmedHashBytes []byte
+// Signer response body
+// Each witness consists of a hex signature and pubkey separated by a space
+type ResponseBody struct {
+	Witness []string `json:"witness"`
+}
 
-// Return new AttestSignerFake instance
-func NewAttestSignerHttp(config confpkg.SignerConfig) AttestSignerHttp {
-	return AttestSignerHttp{
-		client: http.Client{},
-		url:    config.Url,
+// Return new AttestSignerHttp instance
+// Requests and retries are cancelled once ctx is done
+func NewAttestSignerHttp(ctx context.Context, config confpkg.SignerConfig) (*AttestSignerHttp, error) {
+	timeout := DefaultSignerTimeout
+	if config.TimeoutSeconds > 0 {
+		timeout = time.Duration(config.TimeoutSeconds) * time.Second
+	} else {
+		log.Warnf("%s (%v)\n", WarningInvalidSignerTimeoutArg, config.TimeoutSeconds)
 	}
+	retries := DefaultSignerRetries
+	if config.Retries >= 0 {
+		retries = config.Retries
+	} else {
+		log.Warnf("%s (%v)\n", WarningInvalidSignerRetriesArg, config.Retries)
+	}
+	retryBase := DefaultSignerRetryBase
+	if config.RetryBaseMillis > 0 {
+		retryBase = time.Duration(config.RetryBaseMillis) * time.Millisecond
+	} else {
+		log.Warnf("%s (%v)\n", WarningInvalidSignerRetryBaseArg, config.RetryBaseMillis)
+	}
+
+	client := http.Client{}
+	tlsConfig, tlsErr := newSignerTlsConfig(config.Auth)
+	if tlsErr != nil {
+		return nil, tlsErr
+	} else if tlsConfig != nil {
+		client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+	auth, authErr := newSignerAuth(config.Auth)
+	if authErr != nil {
+		return nil, authErr
+	}
+
+	return &AttestSignerHttp{
+		ctx:       ctx,
+		client:    client,
+		url:       config.Url,
+		auth:      auth,
+		timeout:   timeout,
+		retries:   retries,
+		retryBase: retryBase,
+	}, nil
 }
 
 // Resubscribe - do nothing
-func (f AttestSignerHttp) ReSubscribe() {
+func (f *AttestSignerHttp) ReSubscribe() {
 	return
 }
 
+// Return signer name
+func (f *AttestSignerHttp) Name() string {
+	return f.url
+}
+
 // Store received confirmed hash
-func (f AttestSignerHttp) SendConfirmedHash(hash []byte) {
-	signerConfirmedHashBytes = hash
+func (f *AttestSignerHttp) SendConfirmedHash(hash []byte) {
+	f.confirmedHashBytes = hash
 }
 
 // Store received new tx
-func (f AttestSignerHttp) SendTxPreImages(txs [][]byte) {
-	signerTxPreImageBytes = SerializeBytes(txs)
+func (f *AttestSignerHttp) SendTxPreImages(txs [][]byte) error {
+	f.txPreImageBytes = SerializeBytes(txs)
+	return nil
 }
 
 // Return signatures for received tx and hashes
-func (f AttestSignerHttp) GetSigs(sigHashes [][]byte, merkle_root string) []wire.TxWitness {
-
-	witness := make([]wire.TxWitness, len(sigHashes)) // init witness
+// Failed requests are retried with exponential backoff
+func (f *AttestSignerHttp) GetSigs(sigHashes [][]byte, merkle_root string) ([]wire.TxWitness, error) {
 
 	sigHashesStr := make([]string, len(sigHashes))
 	for i := 0; i < len(sigHashes); i++ {
 		sigHashesStr[i] = hex.EncodeToString(sigHashes[i])
-	} 
+	}
 
 	requestBody := &RequestBody{
-		SighashString:  sigHashesStr,
-		MerkleRoot:      merkle_root,
+		SighashString: sigHashesStr,
+		MerkleRoot:    merkle_root,
 	}
 
 	// Encode the request body to JSON
 	requestBodyJSON, err := json.Marshal(requestBody)
 	if err != nil {
-		log.Info("Error marshalling request body: ", err)
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorSignerRequest, err))
+	}
+
+	var witness []wire.TxWitness
+	err = f.request(requestBodyJSON, func(body []byte) error {
+		var parseErr error
+		witness, parseErr = parseWitness(body, len(sigHashes))
+		return parseErr
+	})
+	return witness, err
+}
+
+// Send request to the signer and parse the response body
+// Failed requests or invalid responses are retried with exponential backoff
+// Client error responses, e.g. signer policy refusals, are not retried
+func (f *AttestSignerHttp) request(requestBodyJSON []byte, parse func([]byte) error) error {
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		body, status, err := f.post(requestBodyJSON)
+		if err == nil {
+			err = parse(body)
+		}
+		metrics.ObserveSignerRequest(f.url, time.Since(start), err)
+		if err == nil || attempt >= f.retries || (status >= 400 && status < 500) {
+			return err
+		}
+		delay := signerRetryDelay(f.retryBase, attempt)
+		log.Warnf("%s (%d/%d) in %s: %v\n", WarningSignerRetry, attempt+1, f.retries, delay, err)
+		select {
+		case <-f.ctx.Done():
+			return errors.New(fmt.Sprintf("%s %v", ErrorSignerRequest, f.ctx.Err()))
+		case <-time.After(delay):
+		}
 	}
+}
+
+// Send a single request to the signer and return the response body
+// along with the response status code, or 0 if no response is received
+// Requests are signed and response signatures verified if auth is set
+func (f *AttestSignerHttp) post(requestBodyJSON []byte) ([]byte, int, error) {
+	ctx, cancel := context.WithTimeout(f.ctx, f.timeout)
+	defer cancel()
 
 	// Create the HTTP request
-	req, err := http.NewRequest(http.MethodPost, f.url, bytes.NewReader(requestBodyJSON))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.url, bytes.NewReader(requestBodyJSON))
 	if err != nil {
-		log.Info("Error creating request: ", err)
+		return nil, 0, errors.New(fmt.Sprintf("%s %v", ErrorSignerRequest, err))
 	}
 
 	// Set the request headers
 	req.Header.Set("Content-Type", "application/json")
+	var nonce string
+	if f.auth != nil {
+		if nonce, err = f.auth.SignRequest(req, requestBodyJSON); err != nil {
+			return nil, 0, errors.New(fmt.Sprintf("%s %v", ErrorSignerRequest, err))
+		}
+	}
 
 	resp, err := f.client.Do(req)
 	if err != nil {
-		log.Info("Error sending request: ", err)
+		return nil, 0, errors.New(fmt.Sprintf("%s %v", ErrorSignerRequest, err))
 	}
-
-	// Close the response body
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, errors.New(fmt.Sprintf("%s %s", ErrorSignerResponseStatus, resp.Status))
+	}
+
 	// Read the response body
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Info("Error reading response body: ", err)
+		return nil, resp.StatusCode, errors.New(fmt.Sprintf("%s %v", ErrorSignerResponse, err))
+	}
+	if f.auth != nil {
+		if authErr := f.auth.VerifyResponse(resp, nonce, body); authErr != nil {
+			return nil, resp.StatusCode, errors.New(fmt.Sprintf("%s %v", ErrorSignerResponse, authErr))
+		}
+	}
+	return body, resp.StatusCode, nil
+}
+
+// Parse the witness for each sighash from the signer response body
+func parseWitness(body []byte, numOfSigs int) ([]wire.TxWitness, error) {
+	var data ResponseBody
+	if jsonErr := json.Unmarshal(body, &data); jsonErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorSignerResponse, jsonErr))
+	}
+	if len(data.Witness) != numOfSigs {
+		return nil, errors.New(fmt.Sprintf("%s: %d != %d", ErrorSignerWitnessCount, len(data.Witness), numOfSigs))
 	}
 
-	var data map[string]interface{}
-	jsonErr := json.Unmarshal([]byte(body), &data)
-	if jsonErr != nil {
-		log.Info("Error unmarshaling JSON:", err)
+	witness := make([]wire.TxWitness, numOfSigs)
+	for i, witnessStr := range data.Witness {
+		sigWitness, witnessErr := parseWitnessString(witnessStr)
+		if witnessErr != nil {
+			return nil, errors.New(fmt.Sprintf("%s for input %d", witnessErr, i))
+		}
+		witness[i] = sigWitness
 	}
 
-	for i := 0; i < len(sigHashesStr); i++ {
-		witnessStr := data["witness"].([]interface{})[i].(string)
-		witnessData := strings.Split(witnessStr, " ")
-		sig, _ := hex.DecodeString(witnessData[0])
-		sigBytes := append(sig, []byte{byte(1)}...)
-		pubkey, _ := hex.DecodeString(witnessData[1])
-		witness[i] = wire.TxWitness{sigBytes, pubkey}
+	return witness, nil
+}
+
+// Parse witness of a hex signature and pubkey separated by a space
+// The sighash all type is appended to the signature
+func parseWitnessString(witnessStr string) (wire.TxWitness, error) {
+	witnessData := strings.Split(witnessStr, " ")
+	if len(witnessData) != 2 {
+		return nil, errors.New(ErrorSignerWitness)
+	}
+	sig, sigErr := hex.DecodeString(witnessData[0])
+	pubkey, pubkeyErr := hex.DecodeString(witnessData[1])
+	if sigErr != nil || pubkeyErr != nil || len(sig) == 0 || len(pubkey) == 0 {
+		return nil, errors.New(ErrorSignerWitness)
 	}
+	sigBytes := append(sig, []byte{byte(1)}...)
+	return wire.TxWitness{sigBytes, pubkey}, nil
+}
 
-	return witness
+// Return waiting time before retrying a failed signer request
+func signerRetryDelay(retryBase time.Duration, attempt int) time.Duration {
+	delay := retryBase
+	for i := 0; i < attempt; i++ {
+		delay *= 2
+		if delay >= SignerRetryMax {
+			return SignerRetryMax
+		}
+	}
+	return delay
 }
 
 // Transform received list of bytes into a single byte
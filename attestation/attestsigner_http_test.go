@@ -0,0 +1,183 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	confpkg "mainstay/config"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test http signer signature requests and response parsing
+func TestAttestSignerHttp(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		var body RequestBody
+		assert.Equal(t, nil, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, []string{"aa", "bb"}, body.SighashString)
+		assert.Equal(t, "root", body.MerkleRoot)
+		json.NewEncoder(w).Encode(ResponseBody{[]string{"3001 02aa", "3002 02bb"}})
+	}))
+	defer server.Close()
+
+	signer, _ := NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: server.URL, TimeoutSeconds: 1, Retries: 2, RetryBaseMillis: 1})
+	assert.Equal(t, nil, signer.SendTxPreImages([][]byte{[]byte{1}}))
+	witness, err := signer.GetSigs([][]byte{[]byte{0xaa}, []byte{0xbb}}, "root")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []wire.TxWitness{
+		wire.TxWitness{[]byte{0x30, 0x01, 0x01}, []byte{0x02, 0xaa}},
+		wire.TxWitness{[]byte{0x30, 0x02, 0x01}, []byte{0x02, 0xbb}}}, witness)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+// Test http signer retries failed requests and returns errors
+func TestAttestSignerHttp_Errors(t *testing.T) {
+	var requests int32
+	var response func(w http.ResponseWriter)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		response(w)
+	}))
+	defer server.Close()
+
+	signer, _ := NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: server.URL, TimeoutSeconds: 1, Retries: 2, RetryBaseMillis: 1})
+	sigHashes := [][]byte{[]byte{0xaa}}
+
+	// failing status retried until successful
+	response = func(w http.ResponseWriter) {
+		if atomic.LoadInt32(&requests) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(ResponseBody{[]string{"3001 02aa"}})
+	}
+	witness, err := signer.GetSigs(sigHashes, "root")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(witness))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// failing status after all retries
+	atomic.StoreInt32(&requests, 0)
+	response = func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	witness, err = signer.GetSigs(sigHashes, "root")
+	assert.Equal(t, []wire.TxWitness(nil), witness)
+	assert.Equal(t, errors.New(fmt.Sprintf("%s %s", ErrorSignerResponseStatus, "500 Internal Server Error")), err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// client error status, e.g. policy refusal, not retried
+	atomic.StoreInt32(&requests, 0)
+	response = func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusForbidden)
+	}
+	_, err = signer.GetSigs(sigHashes, "root")
+	assert.Equal(t, errors.New(fmt.Sprintf("%s %s", ErrorSignerResponseStatus, "403 Forbidden")), err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// invalid responses
+	response = func(w http.ResponseWriter) {
+		w.Write([]byte(`{"witness": "3001 02aa"}`))
+	}
+	_, err = signer.GetSigs(sigHashes, "root")
+	assert.Contains(t, err.Error(), ErrorSignerResponse)
+
+	response = func(w http.ResponseWriter) {
+		json.NewEncoder(w).Encode(ResponseBody{[]string{"3001 02aa", "3002 02bb"}})
+	}
+	_, err = signer.GetSigs(sigHashes, "root")
+	assert.Equal(t, errors.New(fmt.Sprintf("%s: %d != %d", ErrorSignerWitnessCount, 2, 1)), err)
+
+	response = func(w http.ResponseWriter) {
+		json.NewEncoder(w).Encode(ResponseBody{[]string{"3001"}})
+	}
+	_, err = signer.GetSigs(sigHashes, "root")
+	assert.Equal(t, errors.New(fmt.Sprintf("%s for input %d", ErrorSignerWitness, 0)), err)
+
+	response = func(w http.ResponseWriter) {
+		json.NewEncoder(w).Encode(ResponseBody{[]string{"30zz 02aa"}})
+	}
+	_, err = signer.GetSigs(sigHashes, "root")
+	assert.Equal(t, errors.New(fmt.Sprintf("%s for input %d", ErrorSignerWitness, 0)), err)
+
+	// signer not available
+	server.Close()
+	_, err = signer.GetSigs(sigHashes, "root")
+	assert.Contains(t, err.Error(), ErrorSignerRequest)
+}
+
+// Test http signer request timeout
+func TestAttestSignerHttp_Timeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	signer, _ := NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: server.URL, TimeoutSeconds: 1, RetryBaseMillis: 1})
+	start := time.Now()
+	_, err := signer.GetSigs([][]byte{[]byte{0xaa}}, "root")
+	assert.Contains(t, err.Error(), ErrorSignerRequest)
+	assert.Equal(t, true, time.Since(start) < 5*time.Second)
+}
+
+// Test http signer defaults and retry delays
+func TestAttestSignerHttp_Config(t *testing.T) {
+	signer, _ := NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: "host", TimeoutSeconds: -1, Retries: -1, RetryBaseMillis: -1})
+	assert.Equal(t, DefaultSignerTimeout, signer.timeout)
+	assert.Equal(t, DefaultSignerRetries, signer.retries)
+	assert.Equal(t, DefaultSignerRetryBase, signer.retryBase)
+
+	signer, _ = NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: "host", TimeoutSeconds: 5, RetryBaseMillis: 200})
+	assert.Equal(t, 5*time.Second, signer.timeout)
+	assert.Equal(t, 0, signer.retries)
+	assert.Equal(t, 200*time.Millisecond, signer.retryBase)
+
+	assert.Equal(t, 1*time.Second, signerRetryDelay(time.Second, 0))
+	assert.Equal(t, 2*time.Second, signerRetryDelay(time.Second, 1))
+	assert.Equal(t, 16*time.Second, signerRetryDelay(time.Second, 4))
+	assert.Equal(t, SignerRetryMax, signerRetryDelay(time.Second, 5))
+	assert.Equal(t, SignerRetryMax, signerRetryDelay(time.Second, 20))
+}
+
+// Test http signer retries stopped once the service context is cancelled
+func TestAttestSignerHttp_Cancel(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signer, _ := NewAttestSignerHttp(ctx, confpkg.SignerConfig{Url: server.URL, TimeoutSeconds: 1, Retries: 2, RetryBaseMillis: 60000})
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := signer.GetSigs([][]byte{[]byte{0xaa}}, "root")
+	assert.Equal(t, errors.New(fmt.Sprintf("%s %v", ErrorSignerRequest, context.Canceled)), err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	assert.Equal(t, true, time.Since(start) < 5*time.Second)
+
+	// no request sent once cancelled
+	_, err = signer.GetSigs([][]byte{[]byte{0xaa}}, "root")
+	assert.Contains(t, err.Error(), ErrorSignerRequest)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	confpkg "mainstay/config"
+	"mainstay/crypto"
+	"mainstay/log"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"golang.org/x/term"
+)
+
+// error consts
+const (
+	ErrorKeystoreMultisig   = "Signer keystore does not support multisig staychains"
+	ErrorKeystorePassphrase = "Keystore passphrase file required when not running in a terminal"
+	ErrorKeystorePubkey     = "Keystore key does not match the staychain public key"
+	ErrorKeystoreChaincode  = "Keystore chaincode does not match the staychain chaincode"
+	ErrorKeystoreTopup      = "Keystore topup key does not match the topup address"
+)
+
+// AttestSignerKeystore struct
+//
+// Implements AttestSigner interface and signs attestations in-process
+// with keys from an encrypted keystore, for single operator deployments
+// that do not run a separate signer
+//
+// The keystore is unlocked at startup with a passphrase read from the
+// passphrase file, e.g. a mounted secret, or prompted for otherwise, and
+// the keys are checked against the staychain config. Tweaked keys are
+// derived for each signature and zeroed once the signature is created
+type AttestSignerKeystore struct {
+	mainChainCfg *chaincfg.Params
+	taproot      bool
+
+	// base key and chaincode used for tweaking and topup key
+	priv      *btcec.PrivateKey
+	chaincode []byte
+	topup     *btcec.PrivateKey
+
+	// store latest hash
+	confirmedHashBytes []byte
+}
+
+// Return new AttestSignerKeystore instance for the keystore in the signer
+// config, which is decrypted with the passphrase read at startup
+func NewAttestSignerKeystore(config *confpkg.Config) (*AttestSignerKeystore, error) {
+	if config.InitScript() != "" {
+		return nil, errors.New(ErrorKeystoreMultisig)
+	}
+	keystoreConfig := config.SignerConfig().Keystore
+	data, readErr := ioutil.ReadFile(keystoreConfig.File)
+	if readErr != nil {
+		return nil, readErr
+	}
+	passphrase, passErr := readKeystorePassphrase(keystoreConfig.PassFile, keystoreConfig.File)
+	if passErr != nil {
+		return nil, passErr
+	}
+	keys, decryptErr := crypto.DecryptKeystore(data, passphrase)
+	crypto.ZeroBytes(passphrase)
+	if decryptErr != nil {
+		return nil, decryptErr
+	}
+	defer keys.Zero()
+
+	signer, signerErr := newAttestSignerKeystore(keys, config.InitPublicKey(), config.InitChaincode(),
+		config.TopupAddress(), config.Taproot(), config.MainChainCfg())
+	if signerErr != nil {
+		return nil, signerErr
+	}
+	log.Infof("*Signer* unlocked keystore %s\n", keystoreConfig.File)
+	return signer, nil
+}
+
+// Return new AttestSignerKeystore instance for the keystore keys provided
+// Keys are copied, checking that the base key and chaincode match the
+// staychain public key and chaincode and the topup key the topup address
+func newAttestSignerKeystore(keys *crypto.KeystoreKeys, initPublicKey string, initChaincode string,
+	addrTopup string, taproot bool, cfg *chaincfg.Params) (*AttestSignerKeystore, error) {
+	priv, _ := btcec.PrivKeyFromBytes(keys.PrivKey)
+	if hex.EncodeToString(priv.PubKey().SerializeCompressed()) != initPublicKey {
+		priv.Zero()
+		return nil, errors.New(ErrorKeystorePubkey)
+	}
+	if !taproot && hex.EncodeToString(keys.Chaincode) != initChaincode {
+		priv.Zero()
+		return nil, errors.New(ErrorKeystoreChaincode)
+	}
+
+	var topup *btcec.PrivateKey
+	if len(keys.TopupPrivKey) > 0 {
+		topup, _ = btcec.PrivKeyFromBytes(keys.TopupPrivKey)
+		topupAddr, topupAddrErr := crypto.GetAddressFromPubKey(topup.PubKey(), cfg)
+		if addrTopup != "" && (topupAddrErr != nil || topupAddr.String() != addrTopup) {
+			priv.Zero()
+			topup.Zero()
+			return nil, errors.New(ErrorKeystoreTopup)
+		}
+	}
+
+	return &AttestSignerKeystore{
+		mainChainCfg: cfg,
+		taproot:      taproot,
+		priv:         priv,
+		chaincode:    append([]byte{}, keys.Chaincode...),
+		topup:        topup,
+	}, nil
+}
+
+// Read keystore passphrase from the passphrase file provided
+// or prompt for the passphrase if running in a terminal
+// The prompt names the keystore file, as staychains with a keystore
+// and no passphrase file are each prompted for in turn at startup
+func readKeystorePassphrase(passFile string, keystoreFile string) ([]byte, error) {
+	if passFile != "" {
+		passBytes, readErr := ioutil.ReadFile(passFile)
+		if readErr != nil {
+			return nil, readErr
+		}
+		passphrase := append([]byte{}, bytes.TrimRight(passBytes, "\r\n")...)
+		crypto.ZeroBytes(passBytes)
+		return passphrase, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, errors.New(ErrorKeystorePassphrase)
+	}
+	fmt.Fprintf(os.Stderr, "Keystore passphrase (%s): ", keystoreFile)
+	passphrase, readErr := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return passphrase, readErr
+}
+
+// Return the key tweaked with the commitment hash for the attestation input
+// The base key is used for the initial unspent of non taproot staychains
+func (k *AttestSignerKeystore) tweakedKey(hash chainhash.Hash) (*btcec.PrivateKey, error) {
+	if k.taproot {
+		return crypto.TweakTaprootPrivKey(k.priv, hash.CloneBytes()), nil
+	}
+	privBytes := k.priv.Serialize()
+	defer crypto.ZeroBytes(privBytes)
+	if hash.IsEqual(&chainhash.Hash{}) {
+		priv, _ := btcec.PrivKeyFromBytes(privBytes)
+		return priv, nil
+	}
+
+	// pseudo bip-32 child derivation to do priv key tweaking
+	// fields except key/chain code are irrelevant for child derivation
+	extndKey := hdkeychain.NewExtendedKey([]byte{}, privBytes, k.chaincode, []byte{}, 0, 0, true)
+	tweakedExtndKey, tweakErr := crypto.TweakExtendedKey(extndKey, hash.CloneBytes())
+	if tweakErr != nil {
+		return nil, tweakErr
+	}
+	return tweakedExtndKey.ECPrivKey()
+}
+
+// Return witness of the topup key signature of the sighash provided
+// Used for the topup inputs of fee-only child transactions
+func (k *AttestSignerKeystore) SignTopup(sigHash []byte) (wire.TxWitness, error) {
+	if k.topup == nil {
+		return nil, errors.New(ErrorTopupKeyMissing)
+	}
+	sig := ecdsa.Sign(k.topup, sigHash)
+	return wire.TxWitness{append(sig.Serialize(), byte(1)), k.topup.PubKey().SerializeCompressed()}, nil
+}
+
+// Resubscribe - do nothing
+func (k *AttestSignerKeystore) ReSubscribe() {
+	return
+}
+
+// Return signer name
+func (k *AttestSignerKeystore) Name() string {
+	return "keystore"
+}
+
+// Store received confirmed hash
+func (k *AttestSignerKeystore) SendConfirmedHash(hash []byte) {
+	k.confirmedHashBytes = hash
+}
+
+// Transaction pre-images not required - do nothing
+func (k *AttestSignerKeystore) SendTxPreImages(txs [][]byte) error {
+	return nil
+}
+
+// Return signatures for the sighashes provided, signing the first input
+// with the key tweaked by the merkle root and any remaining inputs with
+// the topup key. The tweaked key is zeroed after signing
+func (k *AttestSignerKeystore) GetSigs(sigHashes [][]byte, merkle_root string) ([]wire.TxWitness, error) {
+	hash, hashErr := chainhash.NewHashFromStr(merkle_root)
+	if hashErr != nil {
+		return nil, hashErr
+	}
+	if len(sigHashes) > 1 && k.topup == nil {
+		return nil, &AttestSignerError{k.Name(), 1, ErrorSigsMissingForVin}
+	}
+
+	witness := make([]wire.TxWitness, len(sigHashes))
+	for i, sigHash := range sigHashes {
+		if i > 0 {
+			sig := ecdsa.Sign(k.topup, sigHash)
+			witness[i] = wire.TxWitness{append(sig.Serialize(), byte(1)), k.topup.PubKey().SerializeCompressed()}
+			continue
+		}
+
+		priv, privErr := k.tweakedKey(*hash)
+		if privErr != nil {
+			return nil, privErr
+		}
+		if k.taproot {
+			sig, sigErr := schnorr.Sign(priv, sigHash)
+			if sigErr != nil {
+				priv.Zero()
+				return nil, sigErr
+			}
+			witness[i] = wire.TxWitness{append(sig.Serialize(), byte(1)), schnorr.SerializePubKey(priv.PubKey())}
+		} else {
+			sig := ecdsa.Sign(priv, sigHash)
+			witness[i] = wire.TxWitness{append(sig.Serialize(), byte(1)), priv.PubKey().SerializeCompressed()}
+		}
+		priv.Zero()
+	}
+	return witness, nil
+}
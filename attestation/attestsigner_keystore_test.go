@@ -0,0 +1,123 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mainstay/crypto"
+	testpkg "mainstay/test"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/assert"
+)
+
+// Return keystore keys of the test staychain keys
+func keystoreTestKeys() *crypto.KeystoreKeys {
+	wif, _ := btcutil.DecodeWIF(testpkg.PrivMain)
+	wifTopup, _ := btcutil.DecodeWIF(testpkg.TopupPrivMain)
+	chaincode, _ := hex.DecodeString(testpkg.InitChaincode)
+	return &crypto.KeystoreKeys{
+		PrivKey:      wif.PrivKey.Serialize(),
+		Chaincode:    chaincode,
+		TopupPrivKey: wifTopup.PrivKey.Serialize()}
+}
+
+// Test keystore signer signatures verified for each staychain type
+func TestAttestSignerKeystore(t *testing.T) {
+	chainCfg := &chaincfg.RegressionNetParams
+	keys := keystoreTestKeys()
+	wif, _ := btcutil.DecodeWIF(testpkg.PrivMain)
+	pubkeyStr := hex.EncodeToString(wif.PrivKey.PubKey().SerializeCompressed())
+
+	sigHashes := [][]byte{bytes.Repeat([]byte{0xaa}, 32), bytes.Repeat([]byte{0xbb}, 32)}
+	hash, _ := chainhash.NewHashFromStr("aaaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+
+	for _, taproot := range []bool{false, true} {
+		signer, err := newAttestSignerKeystore(keys, pubkeyStr, testpkg.InitChaincode, testpkg.TopupAddress,
+			taproot, chainCfg)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "keystore", signer.Name())
+
+		client := &AttestClient{
+			MainChainCfg:    chainCfg,
+			pubkey:          signer.priv.PubKey(),
+			chaincode:       keys.Chaincode,
+			numOfSigs:       1,
+			addrTopup:       testpkg.TopupAddress,
+			taproot:         taproot,
+			WalletChainCode: keys.Chaincode}
+
+		// test with tweaked and base keys
+		for _, h := range []chainhash.Hash{*hash, chainhash.Hash{}} {
+			witness, err := signer.GetSigs(sigHashes, h.String())
+			assert.Equal(t, nil, err)
+			assert.Equal(t, 2, len(witness))
+			assert.Equal(t, nil, client.verifyWitness(witness, sigHashes, h, signer.Name()))
+			if taproot {
+				assert.Equal(t, schnorr.SignatureSize+1, len(witness[0][0]))
+			}
+		}
+	}
+
+	// base key kept after signing
+	signer, _ := newAttestSignerKeystore(keys, pubkeyStr, testpkg.InitChaincode, testpkg.TopupAddress,
+		false, chainCfg)
+	_, err := signer.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, pubkeyStr, hex.EncodeToString(signer.priv.PubKey().SerializeCompressed()))
+	topupWif, _ := btcutil.DecodeWIF(testpkg.TopupPrivMain)
+	topupWitness, topupErr := signer.SignTopup(sigHashes[1])
+	assert.Equal(t, nil, topupErr)
+	topupClient := &AttestClient{WalletPrivTopup: topupWif}
+	clientWitness, _ := topupClient.signTopup(sigHashes[1])
+	assert.Equal(t, clientWitness, topupWitness)
+
+	// topup key missing
+	signer.topup = nil
+	_, err = signer.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, &AttestSignerError{"keystore", 1, ErrorSigsMissingForVin}, err)
+	_, err = signer.SignTopup(sigHashes[1])
+	assert.Equal(t, errors.New(ErrorTopupKeyMissing), err)
+	witness, err := signer.GetSigs(sigHashes[:1], hash.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(witness))
+
+	// keys not matching the staychain config
+	_, err = newAttestSignerKeystore(keys, testpkg.InitChaincode, testpkg.InitChaincode, testpkg.TopupAddress,
+		false, chainCfg)
+	assert.Equal(t, errors.New(ErrorKeystorePubkey), err)
+	_, err = newAttestSignerKeystore(keys, pubkeyStr, pubkeyStr, testpkg.TopupAddress, false, chainCfg)
+	assert.Equal(t, errors.New(ErrorKeystoreChaincode), err)
+	_, err = newAttestSignerKeystore(keys, pubkeyStr, pubkeyStr, testpkg.TopupAddress, true, chainCfg)
+	assert.Equal(t, nil, err)
+	addr, _ := crypto.GetAddressFromPubKey(wif.PrivKey.PubKey(), chainCfg)
+	_, err = newAttestSignerKeystore(keys, pubkeyStr, testpkg.InitChaincode, addr.String(), false, chainCfg)
+	assert.Equal(t, errors.New(ErrorKeystoreTopup), err)
+}
+
+// Test keystore passphrase read from passphrase file
+func TestAttestSignerKeystore_Passphrase(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "keystore")
+	defer os.RemoveAll(dir)
+	passFile := filepath.Join(dir, "passphrase")
+
+	ioutil.WriteFile(passFile, []byte("passphrase\n"), 0600)
+	passphrase, err := readKeystorePassphrase(passFile, "keystore.json")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte("passphrase"), passphrase)
+
+	_, err = readKeystorePassphrase(filepath.Join(dir, "missing"), "keystore.json")
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,245 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	confpkg "mainstay/config"
+	"mainstay/crypto"
+	"mainstay/log"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// error / warning consts
+const (
+	ErrorSignerThreshold  = "Not enough valid signatures from signers"
+	ErrorSignersPreImages = "Not enough signers received transaction pre-images"
+	ErrorSignerMerkleRoot = "Invalid merkle root for signers"
+	WarningSignerFailure  = "Signer failure"
+	WarningSignerInvalid  = "Invalid signer response"
+)
+
+// AttestSignerMultisig struct
+//
+// Implements AttestSigner interface and gathers partial
+// signatures for an m-of-n multisig from multiple signers
+//
+// Signers are queried in parallel and each partial signature is
+// verified against the multisig pubkeys tweaked with the commitment
+// Once m valid signatures are received, the witness of the multisig
+// input is assembled with the tweaked redeem script
+type AttestSignerMultisig struct {
+	signers []AttestSigner
+	names   []string
+
+	// multisig base pubkeys and number of sigs required
+	mainChainCfg    *chaincfg.Params
+	pubkeysExtended []*hdkeychain.ExtendedKey
+	numOfSigs       int
+
+	// topup address of topup input signatures
+	addrTopup string
+}
+
+// Return new AttestSignerMultisig instance with an http signer for
+// each of the signer urls and multisig keys from the staychain config
+func NewAttestSignerMultisig(ctx context.Context, config *confpkg.Config) (*AttestSignerMultisig, error) {
+	var signers []AttestSigner
+	for i := range config.SignerConfig().Urls {
+		signer, signerErr := newAttestSignerHttpUrl(ctx, config.SignerConfig(), i)
+		if signerErr != nil {
+			return nil, signerErr
+		}
+		signers = append(signers, signer)
+	}
+	pubkeysExtended, numOfSigs := parseMultisigKeys(config.InitScript(), config.InitChaincodes())
+	return newAttestSignerMultisig(signers, config.SignerConfig().Urls, pubkeysExtended, numOfSigs,
+		config.TopupAddress(), config.MainChainCfg()), nil
+}
+
+// Return new AttestSignerMultisig instance for the signers provided
+func newAttestSignerMultisig(signers []AttestSigner, names []string, pubkeysExtended []*hdkeychain.ExtendedKey,
+	numOfSigs int, addrTopup string, mainChainCfg *chaincfg.Params) *AttestSignerMultisig {
+	return &AttestSignerMultisig{
+		signers:         signers,
+		names:           names,
+		mainChainCfg:    mainChainCfg,
+		pubkeysExtended: pubkeysExtended,
+		numOfSigs:       numOfSigs,
+		addrTopup:       addrTopup,
+	}
+}
+
+// Return signer name listing the names of all signers
+func (m *AttestSignerMultisig) Name() string {
+	return strings.Join(m.names, ",")
+}
+
+// Resubscribe all signers
+func (m *AttestSignerMultisig) ReSubscribe() {
+	for _, signer := range m.signers {
+		signer.ReSubscribe()
+	}
+}
+
+// Send confirmed hash to all signers
+func (m *AttestSignerMultisig) SendConfirmedHash(hash []byte) {
+	for _, signer := range m.signers {
+		signer.SendConfirmedHash(hash)
+	}
+}
+
+// Send new tx pre images to all signers
+// Fails only if not enough signers are left to reach the threshold
+func (m *AttestSignerMultisig) SendTxPreImages(txs [][]byte) error {
+	var numOfSent int
+	for i, signer := range m.signers {
+		if err := signer.SendTxPreImages(txs); err != nil {
+			log.Warnf("%s %s: %v\n", WarningSignerFailure, m.names[i], err)
+			continue
+		}
+		numOfSent++
+	}
+	if numOfSent < m.numOfSigs {
+		return errors.New(fmt.Sprintf("%s: %d < %d", ErrorSignersPreImages, numOfSent, m.numOfSigs))
+	}
+	return nil
+}
+
+// signer response received by GetSigs
+type signerResponse struct {
+	index   int
+	witness []wire.TxWitness
+	err     error
+}
+
+// Return signatures for received tx and hashes
+// Signers are requested in parallel and the multisig witness is
+// returned as soon as m valid signatures have been received
+// Any additional (topup) input witness is taken from the first signer
+// that returns a valid signature for this input
+func (m *AttestSignerMultisig) GetSigs(sigHashes [][]byte, merkle_root string) ([]wire.TxWitness, error) {
+	if len(sigHashes) == 0 {
+		return []wire.TxWitness{}, nil
+	}
+
+	// get tweaked multisig pubkeys for the latest commitment
+	hash, hashErr := chainhash.NewHashFromStr(merkle_root)
+	if hashErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorSignerMerkleRoot, hashErr))
+	}
+	tweakedPubs, tweakErr := tweakPubkeys(m.pubkeysExtended, *hash)
+	if tweakErr != nil {
+		return nil, tweakErr
+	}
+	_, redeemScript := crypto.CreateMultisig(tweakedPubs, m.numOfSigs, m.mainChainCfg)
+	redeemScriptBytes, _ := hex.DecodeString(redeemScript)
+
+	// request sigs from all signers in parallel
+	// channel is buffered so that late responses are not blocked
+	responses := make(chan signerResponse, len(m.signers))
+	for i, signer := range m.signers {
+		go func(i int, signer AttestSigner) {
+			witness, err := signer.GetSigs(sigHashes, merkle_root)
+			responses <- signerResponse{i, witness, err}
+		}(i, signer)
+	}
+
+	witness := make([]wire.TxWitness, len(sigHashes))
+	multisigSigs := make([][]byte, len(tweakedPubs))
+	var numOfSigs int
+	for received := 0; received < len(m.signers); received++ {
+		response := <-responses
+		name := m.names[response.index]
+		if response.err != nil {
+			log.Warnf("%s %s: %v\n", WarningSignerFailure, name, response.err)
+			continue
+		}
+
+		for i_tx := 0; i_tx < len(sigHashes) && i_tx < len(response.witness); i_tx++ {
+			sigWitness := response.witness[i_tx]
+			if i_tx == 0 {
+				// multisig input - match pubkey with tweaked multisig pubkeys
+				pubIndex, sigErr := verifyPartialWitness(sigWitness, sigHashes[0], tweakedPubs)
+				if sigErr != nil {
+					log.Warnf("%s %v\n", WarningSignerInvalid, &AttestSignerError{name, i_tx, sigErr.Error()})
+					continue
+				}
+				if multisigSigs[pubIndex] == nil {
+					multisigSigs[pubIndex] = sigWitness[0]
+					numOfSigs++
+				}
+			} else if witness[i_tx] == nil {
+				// topup input - any valid signature for the topup address is accepted
+				if sigErr := verifyTopupWitness(sigWitness, sigHashes[i_tx], m.addrTopup, m.mainChainCfg); sigErr != nil {
+					log.Warnf("%s %v\n", WarningSignerInvalid, &AttestSignerError{name, i_tx, sigErr.Error()})
+					continue
+				}
+				witness[i_tx] = sigWitness
+			}
+		}
+
+		if numOfSigs >= m.numOfSigs && witnessComplete(witness[1:]) {
+			break
+		}
+	}
+
+	if numOfSigs < m.numOfSigs {
+		return nil, errors.New(fmt.Sprintf("%s: %d < %d", ErrorSignerThreshold, numOfSigs, m.numOfSigs))
+	}
+	for i_tx := 1; i_tx < len(witness); i_tx++ {
+		if witness[i_tx] == nil {
+			return nil, &AttestSignerError{m.Name(), i_tx, ErrorSigsMissingForVin} // topup signature missing
+		}
+	}
+
+	// assemble multisig witness with sigs in the order of the pubkeys
+	// and an empty element required by the checkmultisig off-by-one bug
+	multisigWitness := wire.TxWitness{[]byte{}}
+	for _, sig := range multisigSigs {
+		if sig != nil && len(multisigWitness) <= m.numOfSigs {
+			multisigWitness = append(multisigWitness, sig)
+		}
+	}
+	witness[0] = append(multisigWitness, redeemScriptBytes)
+
+	return witness, nil
+}
+
+// Return whether all witnesses provided have been set
+func witnessComplete(witness []wire.TxWitness) bool {
+	for _, w := range witness {
+		if w == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify a signature / pubkey witness for the multisig input and return
+// the index of the witness pubkey in the tweaked multisig pubkeys
+func verifyPartialWitness(witness wire.TxWitness, sigHash []byte, tweakedPubs []*btcec.PublicKey) (int, error) {
+	pubkey, verifyErr := verifySigWitness(witness, sigHash)
+	if verifyErr != nil {
+		return -1, verifyErr
+	}
+	for i, tweakedPub := range tweakedPubs {
+		if bytes.Equal(tweakedPub.SerializeCompressed(), pubkey.SerializeCompressed()) {
+			return i, nil
+		}
+	}
+	return -1, errors.New(ErrorSignerPubkey)
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+
+	"mainstay/crypto"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+// stub signer signing the first sighash with the key tweaked
+// by the merkle root and any remaining sighashes with the topup key
+type attestSignerStub struct {
+	priv      *btcec.PrivateKey
+	chaincode []byte
+	topup     *btcec.PrivateKey
+	err       error
+}
+
+func (s *attestSignerStub) Name() string                   { return "stub" }
+func (s *attestSignerStub) ReSubscribe()                   {}
+func (s *attestSignerStub) SendConfirmedHash([]byte)       {}
+func (s *attestSignerStub) SendTxPreImages([][]byte) error { return s.err }
+func (s *attestSignerStub) GetSigs(sigHashes [][]byte, merkle_root string) ([]wire.TxWitness, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	hash, _ := chainhash.NewHashFromStr(merkle_root)
+	priv := s.priv
+	if !hash.IsEqual(&chainhash.Hash{}) {
+		extndKey := hdkeychain.NewExtendedKey([]byte{}, s.priv.Serialize(), s.chaincode, []byte{}, 0, 0, true)
+		tweakedKey, _ := crypto.TweakExtendedKey(extndKey, hash.CloneBytes())
+		priv, _ = tweakedKey.ECPrivKey()
+	}
+	witness := make([]wire.TxWitness, len(sigHashes))
+	for i, sigHash := range sigHashes {
+		key := priv
+		if i > 0 {
+			key = s.topup
+		}
+		sigBytes := append(ecdsa.Sign(key, sigHash).Serialize(), byte(1))
+		witness[i] = wire.TxWitness{sigBytes, key.PubKey().SerializeCompressed()}
+	}
+	return witness, nil
+}
+
+// Return multisig test keys and stub signers for each key
+func multisigTestSigners(n int) ([]*btcec.PrivateKey, []*attestSignerStub, []*hdkeychain.ExtendedKey) {
+	topup, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0xff}, 32))
+	var privs []*btcec.PrivateKey
+	var stubs []*attestSignerStub
+	var pubkeysExtended []*hdkeychain.ExtendedKey
+	for i := 0; i < n; i++ {
+		priv, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{byte(i + 1)}, 32))
+		chaincode := bytes.Repeat([]byte{byte(0x10 + i)}, 32)
+		privs = append(privs, priv)
+		stubs = append(stubs, &attestSignerStub{priv: priv, chaincode: chaincode, topup: topup})
+		pubkeysExtended = append(pubkeysExtended,
+			hdkeychain.NewExtendedKey([]byte{}, priv.PubKey().SerializeCompressed(), chaincode, []byte{}, 0, 0, false))
+	}
+	return privs, stubs, pubkeysExtended
+}
+
+// Return new multisig signer for the stub signers provided
+func newMultisigTestSigner(stubs []*attestSignerStub, pubkeysExtended []*hdkeychain.ExtendedKey, numOfSigs int) *AttestSignerMultisig {
+	var signers []AttestSigner
+	var names []string
+	for i, stub := range stubs {
+		signers = append(signers, stub)
+		names = append(names, fmt.Sprintf("signer%d", i))
+	}
+	addrTopup, _ := crypto.GetAddressFromPubKey(stubs[0].topup.PubKey(), &chaincfg.RegressionNetParams)
+	return newAttestSignerMultisig(signers, names, pubkeysExtended, numOfSigs, addrTopup.String(), &chaincfg.RegressionNetParams)
+}
+
+// Test multisig signer assembles witness with tweaked redeem script
+func TestAttestSignerMultisig(t *testing.T) {
+	_, stubs, pubkeysExtended := multisigTestSigners(3)
+	signer := newMultisigTestSigner(stubs, pubkeysExtended, 2)
+	assert.Equal(t, nil, signer.SendTxPreImages([][]byte{[]byte{1}}))
+
+	hash, _ := chainhash.NewHashFromStr("3a7e4ed8ec6c5c5a8b5c9c2e8cbb5ab3d8e2b1e7f7b3c0a2b2c0ac5e8e3c8f9a")
+	sigHashes := [][]byte{bytes.Repeat([]byte{0xaa}, 32), bytes.Repeat([]byte{0xbb}, 32)}
+
+	// test with tweaked and base keys
+	for _, h := range []chainhash.Hash{*hash, chainhash.Hash{}} {
+		witness, err := signer.GetSigs(sigHashes, h.String())
+		assert.Equal(t, nil, err)
+		assert.Equal(t, 2, len(witness))
+
+		tweakedPubs, _ := tweakPubkeys(pubkeysExtended, h)
+		_, redeemScript := crypto.CreateMultisig(tweakedPubs, 2, &chaincfg.RegressionNetParams)
+
+		// empty element, 2 sigs and redeem script
+		assert.Equal(t, 4, len(witness[0]))
+		assert.Equal(t, []byte{}, witness[0][0])
+		assert.Equal(t, redeemScript, hex.EncodeToString(witness[0][3]))
+
+		// sigs ordered by pubkey
+		pubIndex := 0
+		for _, sigBytes := range witness[0][1:3] {
+			sig, sigErr := ecdsa.ParseDERSignature(sigBytes[:len(sigBytes)-1])
+			assert.Equal(t, nil, sigErr)
+			for !sig.Verify(sigHashes[0], tweakedPubs[pubIndex]) {
+				pubIndex++
+				assert.Equal(t, true, pubIndex < len(tweakedPubs))
+			}
+			pubIndex++
+		}
+
+		// topup witness
+		topupErr := verifyTopupWitness(witness[1], sigHashes[1], signer.addrTopup, &chaincfg.RegressionNetParams)
+		assert.Equal(t, nil, topupErr)
+	}
+}
+
+// Test multisig signer threshold with failing and invalid signers
+func TestAttestSignerMultisig_Threshold(t *testing.T) {
+	_, stubs, pubkeysExtended := multisigTestSigners(3)
+	hash, _ := chainhash.NewHashFromStr("3a7e4ed8ec6c5c5a8b5c9c2e8cbb5ab3d8e2b1e7f7b3c0a2b2c0ac5e8e3c8f9a")
+	sigHashes := [][]byte{bytes.Repeat([]byte{0xaa}, 32)}
+
+	// single failing signer still reaches threshold
+	stubs[0].err = errors.New("signer down")
+	signer := newMultisigTestSigner(stubs, pubkeysExtended, 2)
+	assert.Equal(t, nil, signer.SendTxPreImages([][]byte{[]byte{1}}))
+	witness, err := signer.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, len(witness[0]))
+
+	// signer with key not in multisig ignored
+	unknown, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x99}, 32))
+	stubs[1].priv = unknown
+	witness, err = signer.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, errors.New(fmt.Sprintf("%s: %d < %d", ErrorSignerThreshold, 1, 2)), err)
+	assert.Equal(t, []wire.TxWitness(nil), witness)
+
+	// failing signers below threshold for pre images
+	stubs[1].err = errors.New("signer down")
+	assert.Equal(t, errors.New(fmt.Sprintf("%s: %d < %d", ErrorSignersPreImages, 1, 2)),
+		signer.SendTxPreImages([][]byte{[]byte{1}}))
+
+	// invalid merkle root
+	_, err = signer.GetSigs(sigHashes, "zz")
+	assert.NotEqual(t, nil, err)
+
+	// topup signature missing from all signers
+	_, stubs, pubkeysExtended = multisigTestSigners(3)
+	signer = newMultisigTestSigner(stubs, pubkeysExtended, 2)
+	for _, stub := range stubs {
+		stub.topup = unknown
+	}
+	topupSigHashes := [][]byte{sigHashes[0], bytes.Repeat([]byte{0xbb}, 32)}
+	witness, err = signer.GetSigs(topupSigHashes, hash.String())
+	assert.Equal(t, &AttestSignerError{signer.Name(), 1, ErrorSigsMissingForVin}, err)
+	assert.Equal(t, []wire.TxWitness(nil), witness)
+}
+
+// Test verification of signer witness for multisig input
+func TestAttestSignerMultisig_VerifyWitness(t *testing.T) {
+	privs, _, pubkeysExtended := multisigTestSigners(2)
+	pubs, _ := tweakPubkeys(pubkeysExtended, chainhash.Hash{})
+	sigHash := bytes.Repeat([]byte{0xaa}, 32)
+
+	sigBytes := append(ecdsa.Sign(privs[1], sigHash).Serialize(), byte(1))
+	index, err := verifyPartialWitness(wire.TxWitness{sigBytes, pubs[1].SerializeCompressed()}, sigHash, pubs)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, index)
+
+	// signature for another sighash
+	_, err = verifyPartialWitness(wire.TxWitness{sigBytes, pubs[1].SerializeCompressed()}, bytes.Repeat([]byte{0xbb}, 32), pubs)
+	assert.Equal(t, errors.New(ErrorSignerSig), err)
+
+	// signature for another pubkey
+	_, err = verifyPartialWitness(wire.TxWitness{sigBytes, pubs[0].SerializeCompressed()}, sigHash, pubs)
+	assert.Equal(t, errors.New(ErrorSignerSig), err)
+
+	// malformed witness
+	_, err = verifyPartialWitness(wire.TxWitness{sigBytes}, sigHash, pubs)
+	assert.Equal(t, errors.New(ErrorSignerWitness), err)
+}
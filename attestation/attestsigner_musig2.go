@@ -0,0 +1,555 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	confpkg "mainstay/config"
+	"mainstay/crypto"
+	"mainstay/log"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr/musig2"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// error / warning consts
+const (
+	ErrorMusig2Taproot     = "Musig2 signer requires a taproot staychain"
+	ErrorMusig2Pubkeys     = "Invalid musig2 signer pubkeys"
+	ErrorMusig2InternalKey = "Musig2 aggregate key does not match the staychain public key"
+	ErrorMusig2Nonce       = "Invalid musig2 nonce"
+	ErrorMusig2PartialSig  = "Invalid musig2 partial signature"
+	ErrorMusig2Signers     = "Musig2 signers failed"
+	ErrorMusig2Sig         = "Invalid musig2 aggregate signature"
+	ErrorMusig2Session     = "Failed storing musig2 session"
+	WarningMusig2Session   = "Failed loading musig2 session - starting new session"
+)
+
+// musig2 signer protocol rounds
+const (
+	Musig2RoundNonce = "nonce"
+	Musig2RoundSign  = "sign"
+)
+
+// AttestSignerMusig2 struct
+//
+// Implements AttestSigner interface and aggregates a single schnorr
+// signature for the P2TR output of a taproot staychain from multiple
+// signers through the two round MuSig2 (BIP-327) protocol
+//
+// In the first round each signer returns a public nonce for the session
+// In the second round the public nonces of all signers are sent to each
+// signer, which returns a partial signature for the attestation input
+// under the aggregate key tweaked with the commitment. Partial signatures
+// are verified and aggregated to the final key path signature
+//
+// Signers are sorted by pubkey for key aggregation (BIP-327 KeySort) and
+// the untweaked aggregate key must be the internal key of the staychain
+//
+// The session, i.e. the nonces and partial signatures received so far,
+// is stored in the session file so that a session can be continued after
+// a ReSubscribe or restart of the service without re-requesting nonces
+type AttestSignerMusig2 struct {
+	signers []*AttestSignerHttp
+	names   []string
+
+	// signer pubkeys in the order of the signers and internal key
+	mainChainCfg *chaincfg.Params
+	pubkeys      []*btcec.PublicKey
+	internalKey  *btcec.PublicKey
+
+	// topup address of topup input signatures
+	addrTopup string
+
+	// current signing session and the file it is stored in
+	session     *musig2Session
+	sessionFile string
+
+	// store latest hash
+	confirmedHashBytes []byte
+}
+
+// Musig2 signer request body
+// All sighashes and the pubkeys of the signers are sent in both rounds,
+// while the public nonces of all signers are only sent in the sign round
+type Musig2RequestBody struct {
+	SessionId     string   `json:"session_id"`
+	Round         string   `json:"round"`
+	SighashString []string `json:"sighash_string"`
+	MerkleRoot    string   `json:"merkle_root"`
+	Pubkeys       []string `json:"pubkeys"`
+	Nonces        []string `json:"nonces,omitempty"`
+}
+
+// Musig2 signer response body
+// The nonce is returned in the nonce round and the partial signature of
+// the attestation input in the sign round, along with a witness of a
+// hex signature and pubkey for each of the remaining (topup) inputs
+type Musig2ResponseBody struct {
+	Nonce      string   `json:"nonce,omitempty"`
+	PartialSig string   `json:"partial_sig,omitempty"`
+	Witness    []string `json:"witness,omitempty"`
+}
+
+// musig2 signing session of the attestation input sighash
+// Nonces and partial signatures are hex and in the order of the signers
+type musig2Session struct {
+	Id          string   `json:"id"`
+	MerkleRoot  string   `json:"merkle_root"`
+	Sighash     string   `json:"sighash"`
+	Nonces      []string `json:"nonces"`
+	PartialSigs []string `json:"partial_sigs"`
+	Witness     []string `json:"witness"`
+}
+
+// Return new AttestSignerMusig2 instance with an http signer for each
+// of the signer urls and the musig2 pubkeys from the signer config
+func NewAttestSignerMusig2(ctx context.Context, config *confpkg.Config) (*AttestSignerMusig2, error) {
+	if !config.Taproot() {
+		return nil, errors.New(ErrorMusig2Taproot)
+	}
+	signerConfig := config.SignerConfig()
+	if len(signerConfig.Urls) == 0 || len(signerConfig.Musig2Pubkeys) != len(signerConfig.Urls) {
+		return nil, errors.New(ErrorMusig2Pubkeys)
+	}
+	var signers []*AttestSignerHttp
+	var pubkeys []*btcec.PublicKey
+	for i := range signerConfig.Urls {
+		signer, signerErr := newAttestSignerHttpUrl(ctx, signerConfig, i)
+		if signerErr != nil {
+			return nil, signerErr
+		}
+		signers = append(signers, signer)
+		pubkeyBytes, _ := hex.DecodeString(signerConfig.Musig2Pubkeys[i])
+		pubkey, pubkeyErr := btcec.ParsePubKey(pubkeyBytes)
+		if pubkeyErr != nil {
+			return nil, errors.New(fmt.Sprintf("%s %v", ErrorMusig2Pubkeys, pubkeyErr))
+		}
+		pubkeys = append(pubkeys, pubkey)
+	}
+
+	return newAttestSignerMusig2(signers, pubkeys, config.InitPublicKey(), config.TopupAddress(),
+		signerConfig.SessionFile, config.MainChainCfg())
+}
+
+// Return new AttestSignerMusig2 instance for the signers provided
+// The aggregate key of the signer pubkeys must match the internal key
+// and any session stored in the session file is loaded
+func newAttestSignerMusig2(signers []*AttestSignerHttp, pubkeys []*btcec.PublicKey, internalKeyStr string,
+	addrTopup string, sessionFile string, mainChainCfg *chaincfg.Params) (*AttestSignerMusig2, error) {
+	aggregateKey, _, _, aggregateErr := musig2.AggregateKeys(copyPubkeys(pubkeys), true)
+	if aggregateErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorMusig2Pubkeys, aggregateErr))
+	}
+	internalKeyBytes, _ := hex.DecodeString(internalKeyStr)
+	internalKey, internalKeyErr := btcec.ParsePubKey(internalKeyBytes)
+	if internalKeyErr != nil || !bytes.Equal(schnorr.SerializePubKey(internalKey),
+		schnorr.SerializePubKey(aggregateKey.PreTweakedKey)) {
+		return nil, errors.New(fmt.Sprintf("%s (%s)", ErrorMusig2InternalKey,
+			hex.EncodeToString(aggregateKey.PreTweakedKey.SerializeCompressed())))
+	}
+
+	var names []string
+	for _, signer := range signers {
+		names = append(names, signer.Name())
+	}
+	m := &AttestSignerMusig2{
+		signers:      signers,
+		names:        names,
+		mainChainCfg: mainChainCfg,
+		pubkeys:      pubkeys,
+		internalKey:  aggregateKey.PreTweakedKey,
+		addrTopup:    addrTopup,
+		sessionFile:  sessionFile,
+	}
+	m.loadSession()
+	return m, nil
+}
+
+// Return signer name listing the names of all signers
+func (m *AttestSignerMusig2) Name() string {
+	return strings.Join(m.names, ",")
+}
+
+// Resubscribe - do nothing
+// The signing session is kept so that it can be continued
+func (m *AttestSignerMusig2) ReSubscribe() {
+	return
+}
+
+// Store received confirmed hash
+func (m *AttestSignerMusig2) SendConfirmedHash(hash []byte) {
+	m.confirmedHashBytes = hash
+}
+
+// Store received new tx - do nothing
+// Signers receive the sighashes to sign in each round
+func (m *AttestSignerMusig2) SendTxPreImages(txs [][]byte) error {
+	return nil
+}
+
+// Return signatures for received tx and hashes
+// The session of the attestation input sighash is continued or a new
+// session is started for a new sighash or commitment. Missing nonces are
+// requested from all signers, followed by missing partial signatures,
+// which are aggregated to the key path witness of the attestation input
+// Any failure of the sign round discards the session so that the next
+// attempt starts a new session with new nonces
+func (m *AttestSignerMusig2) GetSigs(sigHashes [][]byte, merkle_root string) ([]wire.TxWitness, error) {
+	if len(sigHashes) == 0 {
+		return []wire.TxWitness{}, nil
+	}
+	hash, hashErr := chainhash.NewHashFromStr(merkle_root)
+	if hashErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorSignerMerkleRoot, hashErr))
+	}
+	sigHashesStr := make([]string, len(sigHashes))
+	for i, sigHash := range sigHashes {
+		sigHashesStr[i] = hex.EncodeToString(sigHash)
+	}
+
+	if m.session == nil || m.session.MerkleRoot != merkle_root || m.session.Sighash != sigHashesStr[0] {
+		if sessionErr := m.newSession(merkle_root, sigHashesStr[0]); sessionErr != nil {
+			return nil, sessionErr
+		}
+	}
+
+	// first round - get missing nonces of all signers
+	request := Musig2RequestBody{
+		SessionId:     m.session.Id,
+		Round:         Musig2RoundNonce,
+		SighashString: sigHashesStr,
+		MerkleRoot:    merkle_root,
+		Pubkeys:       m.pubkeysStr(),
+	}
+	nonceErr := m.requestRound(request, m.session.Nonces, func(i int, response Musig2ResponseBody) error {
+		if _, parseErr := parseMusig2Nonce(response.Nonce); parseErr != nil {
+			return parseErr
+		}
+		m.session.Nonces[i] = response.Nonce
+		return nil
+	})
+	if nonceErr != nil {
+		return nil, nonceErr
+	}
+
+	// second round - get missing partial sigs of all signers
+	// verified against the nonce of each signer and the aggregate nonce
+	var msg [32]byte
+	copy(msg[:], sigHashes[0])
+	nonces := make([][musig2.PubNonceSize]byte, len(m.signers))
+	for i, nonceStr := range m.session.Nonces {
+		nonces[i], _ = parseMusig2Nonce(nonceStr)
+	}
+	aggregateNonce, aggregateErr := musig2.AggregateNonces(nonces)
+	if aggregateErr != nil {
+		m.discardSession()
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorMusig2Nonce, aggregateErr))
+	}
+	request.Round = Musig2RoundSign
+	request.Nonces = m.session.Nonces
+	signOpts := []musig2.SignOption{musig2.WithSortedKeys(), musig2.WithTaprootSignTweak(hash.CloneBytes())}
+	if hash.IsEqual(&chainhash.Hash{}) {
+		signOpts = []musig2.SignOption{musig2.WithSortedKeys(), musig2.WithBip86SignTweak()}
+	}
+	signErr := m.requestRound(request, m.session.PartialSigs, func(i int, response Musig2ResponseBody) error {
+		partialSig, parseErr := parseMusig2PartialSig(response.PartialSig)
+		if parseErr != nil {
+			return parseErr
+		}
+		if !partialSig.Verify(nonces[i], aggregateNonce, copyPubkeys(m.pubkeys), m.pubkeys[i], msg, signOpts...) {
+			return errors.New(ErrorMusig2PartialSig)
+		}
+		m.session.PartialSigs[i] = response.PartialSig
+		if len(m.session.Witness) == 0 {
+			m.setTopupWitness(response.Witness, sigHashes[1:], m.names[i])
+		}
+		return nil
+	})
+	if signErr != nil {
+		m.discardSession()
+		return nil, signErr
+	}
+	if len(m.session.Witness) != len(sigHashes)-1 {
+		m.discardSession()
+		return nil, &AttestSignerError{m.Name(), 1, ErrorSigsMissingForVin}
+	}
+
+	sig, sigErr := m.aggregateSig(aggregateNonce, msg, *hash)
+	if sigErr != nil {
+		m.discardSession()
+		return nil, sigErr
+	}
+
+	outputKey := crypto.GetTaprootOutputKey(m.internalKey, hash.CloneBytes())
+	witness := make([]wire.TxWitness, len(sigHashes))
+	witness[0] = wire.TxWitness{append(sig.Serialize(), byte(txscript.SigHashAll)), schnorr.SerializePubKey(outputKey)}
+	for i := 1; i < len(sigHashes); i++ {
+		witness[i], _ = parseWitnessString(m.session.Witness[i-1])
+	}
+	return witness, nil
+}
+
+// Request the round from all signers without a value in the session yet
+// Signers are requested in parallel and each response is handled in order
+// The session is stored after handling responses and an error returned if
+// any of the signers failed, as all signers are required to sign
+func (m *AttestSignerMusig2) requestRound(request Musig2RequestBody, values []string,
+	handle func(int, Musig2ResponseBody) error) error {
+	requestBodyJSON, jsonErr := json.Marshal(request)
+	if jsonErr != nil {
+		return errors.New(fmt.Sprintf("%s %v", ErrorSignerRequest, jsonErr))
+	}
+
+	responses := make([]chan signerMusig2Response, len(m.signers))
+	for i, signer := range m.signers {
+		if values[i] != "" {
+			continue
+		}
+		responses[i] = make(chan signerMusig2Response, 1)
+		go func(signer *AttestSignerHttp, response chan signerMusig2Response) {
+			var data Musig2ResponseBody
+			err := signer.request(requestBodyJSON, func(body []byte) error {
+				if jsonErr := json.Unmarshal(body, &data); jsonErr != nil {
+					return errors.New(fmt.Sprintf("%s %v", ErrorSignerResponse, jsonErr))
+				}
+				return nil
+			})
+			response <- signerMusig2Response{data, err}
+		}(signer, responses[i])
+	}
+
+	var failed []string
+	for i, response := range responses {
+		if response == nil {
+			continue
+		}
+		result := <-response
+		err := result.err
+		if err == nil {
+			err = handle(i, result.data)
+		}
+		if err != nil {
+			log.Warnf("%s %s: %v\n", WarningSignerFailure, m.names[i], err)
+			failed = append(failed, m.names[i])
+		}
+	}
+	if storeErr := m.storeSession(); storeErr != nil {
+		return storeErr
+	}
+	if len(failed) > 0 {
+		return errors.New(fmt.Sprintf("%s in %s round: %s", ErrorMusig2Signers, request.Round, strings.Join(failed, ",")))
+	}
+	return nil
+}
+
+// musig2 signer response received by requestRound
+type signerMusig2Response struct {
+	data Musig2ResponseBody
+	err  error
+}
+
+// Set the topup input witnesses of the session if all witnesses
+// provided by the signer are valid for the topup input sighashes
+func (m *AttestSignerMusig2) setTopupWitness(witnessStr []string, sigHashes [][]byte, name string) {
+	if len(sigHashes) == 0 || len(witnessStr) != len(sigHashes) {
+		return
+	}
+	for i, sigHash := range sigHashes {
+		witness, witnessErr := parseWitnessString(witnessStr[i])
+		if witnessErr == nil {
+			witnessErr = verifyTopupWitness(witness, sigHash, m.addrTopup, m.mainChainCfg)
+		}
+		if witnessErr != nil {
+			log.Warnf("%s %v\n", WarningSignerInvalid, &AttestSignerError{name, i + 1, witnessErr.Error()})
+			return
+		}
+	}
+	m.session.Witness = witnessStr
+}
+
+// Aggregate the partial sigs of the session to the final schnorr signature
+// and verify it against the output key tweaked with the commitment
+func (m *AttestSignerMusig2) aggregateSig(aggregateNonce [musig2.PubNonceSize]byte, msg [32]byte,
+	hash chainhash.Hash) (*schnorr.Signature, error) {
+	outputKey := crypto.GetTaprootOutputKey(m.internalKey, hash.CloneBytes())
+	finalNonce, nonceErr := musig2FinalNonce(aggregateNonce, outputKey, msg)
+	if nonceErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorMusig2Nonce, nonceErr))
+	}
+
+	var partialSigs []*musig2.PartialSignature
+	for _, partialSigStr := range m.session.PartialSigs {
+		partialSig, _ := parseMusig2PartialSig(partialSigStr)
+		partialSigs = append(partialSigs, partialSig)
+	}
+	combineOpt := musig2.WithTaprootTweakedCombine(msg, copyPubkeys(m.pubkeys), hash.CloneBytes(), true)
+	if hash.IsEqual(&chainhash.Hash{}) {
+		combineOpt = musig2.WithBip86TweakedCombine(msg, copyPubkeys(m.pubkeys), true)
+	}
+	sig := musig2.CombineSigs(finalNonce, partialSigs, combineOpt)
+	if !sig.Verify(msg[:], outputKey) {
+		return nil, errors.New(ErrorMusig2Sig)
+	}
+	return sig, nil
+}
+
+// Return the final nonce R = R1 + b*R2 of the aggregate nonce (R1, R2)
+// with b = H_noncecoef(aggregate nonce || output key || msg) (BIP-327)
+func musig2FinalNonce(aggregateNonce [musig2.PubNonceSize]byte, outputKey *btcec.PublicKey,
+	msg [32]byte) (*btcec.PublicKey, error) {
+	var nonceMsg bytes.Buffer
+	nonceMsg.Write(aggregateNonce[:])
+	nonceMsg.Write(schnorr.SerializePubKey(outputKey))
+	nonceMsg.Write(msg[:])
+	nonceHash := chainhash.TaggedHash(musig2.NonceBlindTag, nonceMsg.Bytes())
+	var nonceCoef btcec.ModNScalar
+	nonceCoef.SetByteSlice(nonceHash[:])
+
+	r1, r1Err := btcec.ParseJacobian(aggregateNonce[:btcec.PubKeyBytesLenCompressed])
+	if r1Err != nil {
+		return nil, r1Err
+	}
+	r2, r2Err := btcec.ParseJacobian(aggregateNonce[btcec.PubKeyBytesLenCompressed:])
+	if r2Err != nil {
+		return nil, r2Err
+	}
+	var finalNonce btcec.JacobianPoint
+	btcec.ScalarMultNonConst(&nonceCoef, &r2, &r2)
+	btcec.AddNonConst(&r1, &r2, &finalNonce)
+
+	// generator is used if the final nonce is the point at infinity
+	if finalNonce == (btcec.JacobianPoint{}) {
+		btcec.GeneratorJacobian(&finalNonce)
+	}
+	finalNonce.ToAffine()
+	return btcec.NewPublicKey(&finalNonce.X, &finalNonce.Y), nil
+}
+
+// Parse hex public nonce of two compressed points
+func parseMusig2Nonce(nonceStr string) ([musig2.PubNonceSize]byte, error) {
+	var nonce [musig2.PubNonceSize]byte
+	nonceBytes, nonceErr := hex.DecodeString(nonceStr)
+	if nonceErr != nil || len(nonceBytes) != musig2.PubNonceSize {
+		return nonce, errors.New(ErrorMusig2Nonce)
+	}
+	for _, point := range [][]byte{nonceBytes[:btcec.PubKeyBytesLenCompressed], nonceBytes[btcec.PubKeyBytesLenCompressed:]} {
+		if _, pointErr := btcec.ParsePubKey(point); pointErr != nil {
+			return nonce, errors.New(ErrorMusig2Nonce)
+		}
+	}
+	copy(nonce[:], nonceBytes)
+	return nonce, nil
+}
+
+// Parse hex partial signature
+func parseMusig2PartialSig(partialSigStr string) (*musig2.PartialSignature, error) {
+	partialSigBytes, partialSigErr := hex.DecodeString(partialSigStr)
+	if partialSigErr != nil || len(partialSigBytes) != 32 {
+		return nil, errors.New(ErrorMusig2PartialSig)
+	}
+	var partialSig musig2.PartialSignature
+	if decodeErr := partialSig.Decode(bytes.NewReader(partialSigBytes)); decodeErr != nil {
+		return nil, errors.New(ErrorMusig2PartialSig)
+	}
+	return &partialSig, nil
+}
+
+// Return copy of the pubkeys provided
+// Key aggregation sorts the pubkeys in place, while the
+// pubkeys of the signers must be kept in the signer order
+func copyPubkeys(pubkeys []*btcec.PublicKey) []*btcec.PublicKey {
+	return append([]*btcec.PublicKey{}, pubkeys...)
+}
+
+// Return hex pubkeys of the signers
+func (m *AttestSignerMusig2) pubkeysStr() []string {
+	pubkeysStr := make([]string, len(m.pubkeys))
+	for i, pubkey := range m.pubkeys {
+		pubkeysStr[i] = hex.EncodeToString(pubkey.SerializeCompressed())
+	}
+	return pubkeysStr
+}
+
+// Start new session with a random id for the commitment and sighash
+func (m *AttestSignerMusig2) newSession(merkleRoot string, sigHash string) error {
+	id := make([]byte, 32)
+	if _, randErr := rand.Read(id); randErr != nil {
+		return errors.New(fmt.Sprintf("%s %v", ErrorMusig2Session, randErr))
+	}
+	m.session = &musig2Session{
+		Id:          hex.EncodeToString(id),
+		MerkleRoot:  merkleRoot,
+		Sighash:     sigHash,
+		Nonces:      make([]string, len(m.signers)),
+		PartialSigs: make([]string, len(m.signers)),
+	}
+	return m.storeSession()
+}
+
+// Discard the current session and remove it from the session file
+func (m *AttestSignerMusig2) discardSession() {
+	m.session = nil
+	if m.sessionFile != "" {
+		os.Remove(m.sessionFile)
+	}
+}
+
+// Store the current session in the session file if set
+// The session is written to a temporary file and renamed
+// so that the session file is never partially written
+func (m *AttestSignerMusig2) storeSession() error {
+	if m.sessionFile == "" || m.session == nil {
+		return nil
+	}
+	data, jsonErr := json.Marshal(m.session)
+	if jsonErr != nil {
+		return errors.New(fmt.Sprintf("%s %v", ErrorMusig2Session, jsonErr))
+	}
+	tmpFile := m.sessionFile + ".tmp"
+	if writeErr := ioutil.WriteFile(tmpFile, data, 0600); writeErr != nil {
+		return errors.New(fmt.Sprintf("%s %v", ErrorMusig2Session, writeErr))
+	}
+	if renameErr := os.Rename(tmpFile, m.sessionFile); renameErr != nil {
+		return errors.New(fmt.Sprintf("%s %v", ErrorMusig2Session, renameErr))
+	}
+	return nil
+}
+
+// Load the session stored in the session file if set
+// Sessions for a different number of signers are ignored
+func (m *AttestSignerMusig2) loadSession() {
+	if m.sessionFile == "" {
+		return
+	}
+	data, readErr := ioutil.ReadFile(m.sessionFile)
+	if os.IsNotExist(readErr) {
+		return
+	}
+	var session musig2Session
+	if readErr == nil {
+		readErr = json.Unmarshal(data, &session)
+	}
+	if readErr != nil || len(session.Nonces) != len(m.signers) || len(session.PartialSigs) != len(m.signers) {
+		log.Warnf("%s (%v)\n", WarningMusig2Session, readErr)
+		return
+	}
+	m.session = &session
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	confpkg "mainstay/config"
+	"mainstay/crypto"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr/musig2"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/assert"
+)
+
+// test musig2 signer keeping the secret nonce of each session
+type musig2TestSigner struct {
+	priv       *btcec.PrivateKey
+	topup      *btcec.PrivateKey
+	nonces     map[string]*musig2.Nonces
+	numOfNonce int
+	numOfSign  int
+	corrupt    bool
+}
+
+// Return test server for the musig2 signer provided
+func musig2TestServer(t *testing.T, s *musig2TestSigner) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body Musig2RequestBody
+		assert.Equal(t, nil, json.NewDecoder(r.Body).Decode(&body))
+
+		if body.Round == Musig2RoundNonce {
+			s.numOfNonce++
+			nonces, _ := musig2.GenNonces(musig2.WithPublicKey(s.priv.PubKey()))
+			s.nonces[body.SessionId] = nonces
+			json.NewEncoder(w).Encode(Musig2ResponseBody{Nonce: hex.EncodeToString(nonces.PubNonce[:])})
+			return
+		}
+
+		s.numOfSign++
+		nonces, ok := s.nonces[body.SessionId]
+		if !ok {
+			http.Error(w, "unknown session", http.StatusConflict)
+			return
+		}
+		var pubkeys []*btcec.PublicKey
+		for _, pubkeyStr := range body.Pubkeys {
+			pubkeyBytes, _ := hex.DecodeString(pubkeyStr)
+			pubkey, _ := btcec.ParsePubKey(pubkeyBytes)
+			pubkeys = append(pubkeys, pubkey)
+		}
+		var pubNonces [][musig2.PubNonceSize]byte
+		for _, nonceStr := range body.Nonces {
+			nonce, _ := parseMusig2Nonce(nonceStr)
+			pubNonces = append(pubNonces, nonce)
+		}
+		aggregateNonce, _ := musig2.AggregateNonces(pubNonces)
+		hash, _ := chainhash.NewHashFromStr(body.MerkleRoot)
+		tweakOpt := musig2.WithTaprootSignTweak(hash.CloneBytes())
+		if hash.IsEqual(&chainhash.Hash{}) {
+			tweakOpt = musig2.WithBip86SignTweak()
+		}
+		var msg [32]byte
+		sigHash, _ := hex.DecodeString(body.SighashString[0])
+		copy(msg[:], sigHash)
+		partialSig, signErr := musig2.Sign(nonces.SecNonce, s.priv, aggregateNonce, pubkeys, msg,
+			musig2.WithSortedKeys(), tweakOpt)
+		assert.Equal(t, nil, signErr)
+		delete(s.nonces, body.SessionId)
+
+		var partialSigBuf bytes.Buffer
+		partialSig.Encode(&partialSigBuf)
+		response := Musig2ResponseBody{PartialSig: hex.EncodeToString(partialSigBuf.Bytes())}
+		if s.corrupt {
+			response.PartialSig = hex.EncodeToString(bytes.Repeat([]byte{0x01}, 32))
+		}
+		for _, topupSigHashStr := range body.SighashString[1:] {
+			topupSigHash, _ := hex.DecodeString(topupSigHashStr)
+			response.Witness = append(response.Witness, hex.EncodeToString(ecdsa.Sign(s.topup, topupSigHash).Serialize())+
+				" "+hex.EncodeToString(s.topup.PubKey().SerializeCompressed()))
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+}
+
+// Return musig2 test signers with servers and the aggregate key
+func musig2TestSigners(t *testing.T, n int) ([]*musig2TestSigner, []*httptest.Server, []*btcec.PublicKey, *btcec.PublicKey) {
+	topup, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0xff}, 32))
+	var signers []*musig2TestSigner
+	var servers []*httptest.Server
+	var pubkeys []*btcec.PublicKey
+	for i := 0; i < n; i++ {
+		priv, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{byte(i + 1)}, 32))
+		signer := &musig2TestSigner{priv: priv, topup: topup, nonces: make(map[string]*musig2.Nonces)}
+		signers = append(signers, signer)
+		servers = append(servers, musig2TestServer(t, signer))
+		pubkeys = append(pubkeys, priv.PubKey())
+	}
+	aggregateKey, _, _, _ := musig2.AggregateKeys(copyPubkeys(pubkeys), true)
+	return signers, servers, pubkeys, aggregateKey.PreTweakedKey
+}
+
+// Return new musig2 signer for the test servers provided
+func newMusig2TestSigner(t *testing.T, servers []*httptest.Server, pubkeys []*btcec.PublicKey,
+	internalKey *btcec.PublicKey, sessionFile string) *AttestSignerMusig2 {
+	var signers []*AttestSignerHttp
+	for _, server := range servers {
+		signer, _ := NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: server.URL, TimeoutSeconds: 1, RetryBaseMillis: 1, Protocol: SignerProtocolMusig2})
+		signers = append(signers, signer)
+	}
+	topup, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0xff}, 32))
+	addrTopup, _ := crypto.GetAddressFromPubKey(topup.PubKey(), &chaincfg.RegressionNetParams)
+	signer, err := newAttestSignerMusig2(signers, pubkeys, hex.EncodeToString(internalKey.SerializeCompressed()),
+		addrTopup.String(), sessionFile, &chaincfg.RegressionNetParams)
+	assert.Equal(t, nil, err)
+	return signer
+}
+
+// Test musig2 signer aggregating a single schnorr signature
+func TestAttestSignerMusig2(t *testing.T) {
+	testSigners, servers, pubkeys, internalKey := musig2TestSigners(t, 3)
+	for _, server := range servers {
+		defer server.Close()
+	}
+	signer := newMusig2TestSigner(t, servers, pubkeys, internalKey, "")
+	assert.Equal(t, strings.Join([]string{servers[0].URL, servers[1].URL, servers[2].URL}, ","), signer.Name())
+
+	client := &AttestClient{
+		MainChainCfg: &chaincfg.RegressionNetParams,
+		pubkey:       internalKey,
+		taproot:      true,
+		addrTopup:    signer.addrTopup}
+
+	hash, _ := chainhash.NewHashFromStr("3a7e4ed8ec6c5c5a8b5c9c2e8cbb5ab3d8e2b1e7f7b3c0a2b2c0ac5e8e3c8f9a")
+	sigHashes := [][]byte{bytes.Repeat([]byte{0xaa}, 32), bytes.Repeat([]byte{0xbb}, 32)}
+
+	// test with tweaked and base keys
+	for _, h := range []chainhash.Hash{*hash, chainhash.Hash{}} {
+		witness, err := signer.GetSigs(sigHashes, h.String())
+		assert.Equal(t, nil, err)
+		assert.Equal(t, 2, len(witness))
+		assert.Equal(t, schnorr.SignatureSize+1, len(witness[0][0]))
+		assert.Equal(t, nil, client.verifyWitness(witness, sigHashes, h, signer.Name()))
+	}
+
+	// internal key not matching the aggregate key
+	_, err := newAttestSignerMusig2(signer.signers, pubkeys[:2], hex.EncodeToString(internalKey.SerializeCompressed()),
+		signer.addrTopup, "", &chaincfg.RegressionNetParams)
+	assert.Contains(t, err.Error(), ErrorMusig2InternalKey)
+
+	// invalid partial signature discards the session
+	testSigners[1].corrupt = true
+	_, err = signer.GetSigs(sigHashes, hash.String())
+	assert.Contains(t, err.Error(), ErrorMusig2Signers)
+	assert.Nil(t, signer.session)
+	testSigners[1].corrupt = false
+	numOfNonce := testSigners[0].numOfNonce
+	witness, err := signer.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, client.verifyWitness(witness, sigHashes, *hash, signer.Name()))
+	assert.Equal(t, numOfNonce+1, testSigners[0].numOfNonce)
+}
+
+// Test musig2 session continued after signer failures and restarts
+func TestAttestSignerMusig2_Session(t *testing.T) {
+	testSigners, servers, pubkeys, internalKey := musig2TestSigners(t, 2)
+	dir, _ := ioutil.TempDir("", "musig2session")
+	defer os.RemoveAll(dir)
+	sessionFile := filepath.Join(dir, "session.json")
+
+	client := &AttestClient{
+		MainChainCfg: &chaincfg.RegressionNetParams,
+		pubkey:       internalKey,
+		taproot:      true}
+	hash, _ := chainhash.NewHashFromStr("3a7e4ed8ec6c5c5a8b5c9c2e8cbb5ab3d8e2b1e7f7b3c0a2b2c0ac5e8e3c8f9a")
+	sigHashes := [][]byte{bytes.Repeat([]byte{0xaa}, 32)}
+
+	// second signer unavailable during the nonce round
+	servers[1].Close()
+	signer := newMusig2TestSigner(t, servers, pubkeys, internalKey, sessionFile)
+	_, err := signer.GetSigs(sigHashes, hash.String())
+	assert.Contains(t, err.Error(), ErrorMusig2Signers)
+	assert.Equal(t, 1, testSigners[0].numOfNonce)
+	sessionId := signer.session.Id
+	assert.NotEqual(t, "", signer.session.Nonces[0])
+	assert.Equal(t, "", signer.session.Nonces[1])
+
+	// restart with the second signer available
+	servers[1] = musig2TestServer(t, testSigners[1])
+	defer servers[0].Close()
+	defer servers[1].Close()
+	signer.ReSubscribe()
+	signer = newMusig2TestSigner(t, servers, pubkeys, internalKey, sessionFile)
+	assert.Equal(t, sessionId, signer.session.Id)
+
+	// only the missing nonce is requested and the session completed
+	witness, err := signer.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, client.verifyWitness(witness, sigHashes, *hash, signer.Name()))
+	assert.Equal(t, 1, testSigners[0].numOfNonce)
+	assert.Equal(t, 1, testSigners[1].numOfNonce)
+
+	// restart after signing reuses the partial signatures
+	signer = newMusig2TestSigner(t, servers, pubkeys, internalKey, sessionFile)
+	reloadedWitness, err := signer.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, witness, reloadedWitness)
+	assert.Equal(t, 1, testSigners[0].numOfSign)
+
+	// new sighash starts a new session
+	sigHashes = [][]byte{bytes.Repeat([]byte{0xbb}, 32)}
+	witness, err = signer.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, sessionId, signer.session.Id)
+	assert.Equal(t, nil, client.verifyWitness(witness, sigHashes, *hash, signer.Name()))
+	assert.Equal(t, 2, testSigners[0].numOfNonce)
+}
@@ -0,0 +1,397 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	confpkg "mainstay/config"
+	"mainstay/crypto"
+	"mainstay/log"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// error / warning consts
+const (
+	ErrorPsbtTxMissing  = "Transaction missing for psbt signer"
+	ErrorPsbtTx         = "Invalid transaction for psbt signer"
+	ErrorPsbtCreate     = "Failed creating psbt"
+	ErrorPsbtResponse   = "Invalid psbt signer response"
+	ErrorPsbtTxMismatch = "Psbt signer returned a different transaction"
+	ErrorPsbtSigners    = "No valid psbt signer responses"
+)
+
+// psbt proprietary key (BIP174) of the commitment hash used to tweak
+// the key(s) of the attestation input, set in the first psbt input as:
+// 0xfc | <len> "mainstay" | 0x00 -> 32 byte commitment hash (internal byte order)
+const (
+	PsbtProprietaryType       = 0xfc
+	PsbtProprietaryIdentifier = "mainstay"
+	PsbtCommitmentSubtype     = 0x00
+)
+
+// AttestSignerPsbt struct
+//
+// Implements AttestSigner interface and requests signatures
+// by sending a full PSBT (BIP174) to signers through an HTTP api
+//
+// The PSBT includes the witness utxo of each input, the tweaked
+// multisig witness script in the multisig case and the commitment
+// hash used for key tweaking, so that signers can independently
+// validate the attestation before signing. Signed or partially signed
+// PSBTs returned by signers are combined to get the input witnesses
+type AttestSignerPsbt struct {
+	signers []*AttestSignerHttp
+	names   []string
+
+	// fetch previous outputs of transaction inputs
+	fetchPrevOut func(wire.OutPoint) (*wire.TxOut, error)
+
+	// multisig base pubkeys and number of sigs required
+	// no pubkeys are set in the single key case
+	mainChainCfg    *chaincfg.Params
+	pubkeysExtended []*hdkeychain.ExtendedKey
+	numOfSigs       int
+
+	// internal key of taproot staychains - nil otherwise
+	taprootKey *btcec.PublicKey
+
+	// store latest hash and transaction
+	tx                 *wire.MsgTx
+	confirmedHashBytes []byte
+}
+
+// Psbt signer request and response body
+// The psbt is base64 encoded
+type PsbtRequestBody struct {
+	Psbt string `json:"psbt"`
+}
+
+type PsbtResponseBody struct {
+	Psbt string `json:"psbt"`
+}
+
+// Return new AttestSignerPsbt instance with an http signer for the
+// signer url or each of the signer urls in the multisig case
+func NewAttestSignerPsbt(ctx context.Context, config *confpkg.Config) (*AttestSignerPsbt, error) {
+	signerConfig := config.SignerConfig()
+	if len(signerConfig.Urls) == 0 {
+		signerConfig.Urls = []string{signerConfig.Url}
+	}
+	var signers []*AttestSignerHttp
+	for i := range signerConfig.Urls {
+		signer, signerErr := newAttestSignerHttpUrl(ctx, signerConfig, i)
+		if signerErr != nil {
+			return nil, signerErr
+		}
+		signers = append(signers, signer)
+	}
+
+	var pubkeysExtended []*hdkeychain.ExtendedKey
+	numOfSigs := 1
+	if config.InitScript() != "" {
+		pubkeysExtended, numOfSigs = parseMultisigKeys(config.InitScript(), config.InitChaincodes())
+	}
+	signer := newAttestSignerPsbt(signers, rpcPrevOutFetcher(config.MainClient()), pubkeysExtended, numOfSigs,
+		config.MainChainCfg())
+	if config.Taproot() {
+		pubkeyBytes, _ := hex.DecodeString(config.InitPublicKey())
+		taprootKey, taprootKeyErr := btcec.ParsePubKey(pubkeyBytes)
+		if taprootKeyErr != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid public key %v", taprootKeyErr))
+		}
+		signer.taprootKey = taprootKey
+	}
+	return signer, nil
+}
+
+// Return new AttestSignerPsbt instance for the signers provided
+func newAttestSignerPsbt(signers []*AttestSignerHttp, fetchPrevOut func(wire.OutPoint) (*wire.TxOut, error),
+	pubkeysExtended []*hdkeychain.ExtendedKey, numOfSigs int, mainChainCfg *chaincfg.Params) *AttestSignerPsbt {
+	var names []string
+	for _, signer := range signers {
+		names = append(names, signer.Name())
+	}
+	return &AttestSignerPsbt{
+		signers:         signers,
+		names:           names,
+		fetchPrevOut:    fetchPrevOut,
+		mainChainCfg:    mainChainCfg,
+		pubkeysExtended: pubkeysExtended,
+		numOfSigs:       numOfSigs,
+	}
+}
+
+// Return previous output fetcher using the main client rpc connection
+func rpcPrevOutFetcher(client *rpcclient.Client) func(wire.OutPoint) (*wire.TxOut, error) {
+	return func(outpoint wire.OutPoint) (*wire.TxOut, error) {
+		prevTx, prevTxErr := client.GetRawTransaction(&outpoint.Hash)
+		if prevTxErr != nil {
+			return nil, prevTxErr
+		}
+		if int(outpoint.Index) >= len(prevTx.MsgTx().TxOut) {
+			return nil, errors.New(ErrorInputMissingForTx)
+		}
+		return prevTx.MsgTx().TxOut[outpoint.Index], nil
+	}
+}
+
+// Return signer name listing the names of all signers
+func (f *AttestSignerPsbt) Name() string {
+	return strings.Join(f.names, ",")
+}
+
+// Resubscribe - do nothing
+func (f *AttestSignerPsbt) ReSubscribe() {
+	return
+}
+
+// Store received confirmed hash
+func (f *AttestSignerPsbt) SendConfirmedHash(hash []byte) {
+	f.confirmedHashBytes = hash
+}
+
+// Store received new tx
+// All pre-images are copies of the unsigned transaction
+func (f *AttestSignerPsbt) SendTxPreImages(txs [][]byte) error {
+	if len(txs) == 0 {
+		return errors.New(ErrorPsbtTxMissing)
+	}
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(txs[0])); err != nil {
+		return errors.New(fmt.Sprintf("%s %v", ErrorPsbtTx, err))
+	}
+	f.tx = &tx
+	return nil
+}
+
+// Return signatures for received tx and hashes
+// The psbt of the latest tx is sent to all signers and the
+// signed or partially signed psbts returned are combined
+func (f *AttestSignerPsbt) GetSigs(sigHashes [][]byte, merkle_root string) ([]wire.TxWitness, error) {
+	if f.tx == nil {
+		return nil, errors.New(ErrorPsbtTxMissing)
+	}
+	hash, hashErr := chainhash.NewHashFromStr(merkle_root)
+	if hashErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorSignerMerkleRoot, hashErr))
+	}
+	packet, tweakedPubs, createErr := f.createPsbt(*hash)
+	if createErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorPsbtCreate, createErr))
+	}
+	packetStr, encodeErr := packet.B64Encode()
+	if encodeErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorPsbtCreate, encodeErr))
+	}
+	requestBodyJSON, jsonErr := json.Marshal(&PsbtRequestBody{Psbt: packetStr})
+	if jsonErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorSignerRequest, jsonErr))
+	}
+
+	// request signed psbts from all signers in parallel
+	type psbtResponse struct {
+		packet *psbt.Packet
+		err    error
+	}
+	responses := make([]chan psbtResponse, len(f.signers))
+	for i, signer := range f.signers {
+		responses[i] = make(chan psbtResponse, 1)
+		go func(signer *AttestSignerHttp, response chan psbtResponse) {
+			var signedPacket *psbt.Packet
+			err := signer.request(requestBodyJSON, func(body []byte) error {
+				var parseErr error
+				signedPacket, parseErr = parsePsbtResponse(body, packet.UnsignedTx)
+				return parseErr
+			})
+			response <- psbtResponse{signedPacket, err}
+		}(signer, responses[i])
+	}
+
+	// combine signatures of all signed psbts
+	var numOfSigned int
+	var signerErr error
+	for i, response := range responses {
+		result := <-response
+		if result.err != nil {
+			log.Warnf("%s %s: %v\n", WarningSignerFailure, f.names[i], result.err)
+			signerErr = result.err
+			continue
+		}
+		combinePsbt(packet, result.packet)
+		numOfSigned++
+	}
+	if numOfSigned == 0 {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorPsbtSigners, signerErr))
+	}
+
+	return f.extractWitness(packet, tweakedPubs), nil
+}
+
+// Create psbt for the latest tx including the witness utxo of each input
+// In the multisig case the witness script of the attestation input is set
+// to the multisig tweaked with the commitment and the tweaked pubkeys are returned
+// In the taproot case the internal key and the commitment as taproot merkle
+// root (BIP-371) are set and the taproot output key is returned
+func (f *AttestSignerPsbt) createPsbt(hash chainhash.Hash) (*psbt.Packet, []*btcec.PublicKey, error) {
+	packet, packetErr := psbt.NewFromUnsignedTx(f.tx.Copy())
+	if packetErr != nil {
+		return nil, nil, packetErr
+	}
+	for i, txIn := range packet.UnsignedTx.TxIn {
+		prevOut, prevOutErr := f.fetchPrevOut(txIn.PreviousOutPoint)
+		if prevOutErr != nil {
+			return nil, nil, prevOutErr
+		}
+		packet.Inputs[i].WitnessUtxo = prevOut
+		packet.Inputs[i].SighashType = txscript.SigHashAll
+	}
+
+	var tweakedPubs []*btcec.PublicKey
+	if len(f.pubkeysExtended) > 0 {
+		var tweakErr error
+		tweakedPubs, tweakErr = tweakPubkeys(f.pubkeysExtended, hash)
+		if tweakErr != nil {
+			return nil, nil, tweakErr
+		}
+		_, redeemScript := crypto.CreateMultisig(tweakedPubs, f.numOfSigs, f.mainChainCfg)
+		packet.Inputs[0].WitnessScript, _ = hex.DecodeString(redeemScript)
+	} else if f.taprootKey != nil {
+		packet.Inputs[0].TaprootInternalKey = schnorr.SerializePubKey(f.taprootKey)
+		if !hash.IsEqual(&chainhash.Hash{}) {
+			packet.Inputs[0].TaprootMerkleRoot = hash.CloneBytes()
+		}
+		tweakedPubs = []*btcec.PublicKey{crypto.GetTaprootOutputKey(f.taprootKey, hash.CloneBytes())}
+	}
+	packet.Inputs[0].Unknowns = append(packet.Inputs[0].Unknowns,
+		&psbt.Unknown{Key: PsbtCommitmentKey(), Value: hash.CloneBytes()})
+
+	return packet, tweakedPubs, nil
+}
+
+// Return psbt proprietary key of the commitment hash
+func PsbtCommitmentKey() []byte {
+	key := []byte{PsbtProprietaryType, byte(len(PsbtProprietaryIdentifier))}
+	key = append(key, []byte(PsbtProprietaryIdentifier)...)
+	return append(key, PsbtCommitmentSubtype)
+}
+
+// Parse signed psbt from the signer response body and check
+// that the unsigned transaction of the psbt has not changed
+func parsePsbtResponse(body []byte, unsignedTx *wire.MsgTx) (*psbt.Packet, error) {
+	var data PsbtResponseBody
+	if jsonErr := json.Unmarshal(body, &data); jsonErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorPsbtResponse, jsonErr))
+	}
+	packet, packetErr := psbt.NewFromRawBytes(strings.NewReader(data.Psbt), true)
+	if packetErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorPsbtResponse, packetErr))
+	}
+	if packet.UnsignedTx.TxHash() != unsignedTx.TxHash() {
+		return nil, errors.New(ErrorPsbtTxMismatch)
+	}
+	return packet, nil
+}
+
+// Combine partial sigs and final witnesses of the signed psbt into the psbt provided
+func combinePsbt(packet *psbt.Packet, signedPacket *psbt.Packet) {
+	for i := range packet.Inputs {
+		for _, partialSig := range signedPacket.Inputs[i].PartialSigs {
+			isNew := true
+			for _, existingSig := range packet.Inputs[i].PartialSigs {
+				if bytes.Equal(existingSig.PubKey, partialSig.PubKey) {
+					isNew = false
+					break
+				}
+			}
+			if isNew {
+				packet.Inputs[i].PartialSigs = append(packet.Inputs[i].PartialSigs, partialSig)
+			}
+		}
+		if len(packet.Inputs[i].FinalScriptWitness) == 0 {
+			packet.Inputs[i].FinalScriptWitness = signedPacket.Inputs[i].FinalScriptWitness
+		}
+	}
+}
+
+// Extract the witness of each input from the combined psbt
+// Final witnesses are used if set by signers, otherwise the witness
+// is assembled from partial sigs, ordering multisig sigs by pubkey
+// Inputs without enough signatures are returned with an empty witness
+// Taproot key path signatures are returned along with the x-only output key
+func (f *AttestSignerPsbt) extractWitness(packet *psbt.Packet, tweakedPubs []*btcec.PublicKey) []wire.TxWitness {
+	witness := make([]wire.TxWitness, len(packet.Inputs))
+	for i, input := range packet.Inputs {
+		if i == 0 && f.taprootKey != nil {
+			outputKey := schnorr.SerializePubKey(tweakedPubs[0])
+			if len(input.TaprootKeySpendSig) > 0 {
+				witness[i] = wire.TxWitness{input.TaprootKeySpendSig, outputKey}
+			} else if finalWitness, witnessErr := parseTxWitness(input.FinalScriptWitness); witnessErr == nil &&
+				len(finalWitness) == 1 {
+				witness[i] = wire.TxWitness{finalWitness[0], outputKey}
+			}
+			continue
+		}
+		if len(input.FinalScriptWitness) > 0 {
+			finalWitness, witnessErr := parseTxWitness(input.FinalScriptWitness)
+			if witnessErr == nil {
+				witness[i] = finalWitness
+				continue
+			}
+		}
+		if i == 0 && len(tweakedPubs) > 0 {
+			multisigWitness := wire.TxWitness{[]byte{}}
+			for _, pub := range tweakedPubs {
+				for _, partialSig := range input.PartialSigs {
+					if bytes.Equal(partialSig.PubKey, pub.SerializeCompressed()) && len(multisigWitness) <= f.numOfSigs {
+						multisigWitness = append(multisigWitness, partialSig.Signature)
+					}
+				}
+			}
+			if len(multisigWitness) > f.numOfSigs {
+				witness[i] = append(multisigWitness, input.WitnessScript)
+			}
+		} else if len(input.PartialSigs) > 0 {
+			witness[i] = wire.TxWitness{input.PartialSigs[0].Signature, input.PartialSigs[0].PubKey}
+		}
+	}
+	return witness
+}
+
+// Parse serialized transaction witness of a finalized psbt input
+func parseTxWitness(witnessBytes []byte) (wire.TxWitness, error) {
+	r := bytes.NewReader(witnessBytes)
+	count, countErr := wire.ReadVarInt(r, 0)
+	if countErr != nil {
+		return nil, countErr
+	}
+	if count > uint64(len(witnessBytes)) {
+		return nil, errors.New(ErrorSignerWitness)
+	}
+	witness := make(wire.TxWitness, count)
+	for i := range witness {
+		item, itemErr := wire.ReadVarBytes(r, 0, txscript.MaxScriptSize, "witness")
+		if itemErr != nil {
+			return nil, itemErr
+		}
+		witness[i] = item
+	}
+	return witness, nil
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	confpkg "mainstay/config"
+	"mainstay/crypto"
+
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+// Return test psbt signer server signing psbt inputs independently
+// using the witness utxos and commitment hash of the psbt
+func psbtTestServer(t *testing.T, stub *attestSignerStub, finalize bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body PsbtRequestBody
+		assert.Equal(t, nil, json.NewDecoder(r.Body).Decode(&body))
+		packet, packetErr := psbt.NewFromRawBytes(strings.NewReader(body.Psbt), true)
+		assert.Equal(t, nil, packetErr)
+
+		// commitment hash from proprietary field
+		var hash chainhash.Hash
+		for _, unknown := range packet.Inputs[0].Unknowns {
+			if bytes.Equal(unknown.Key, PsbtCommitmentKey()) {
+				copy(hash[:], unknown.Value)
+			}
+		}
+		priv := stub.priv
+		if !hash.IsEqual(&chainhash.Hash{}) {
+			extndKey := hdkeychain.NewExtendedKey([]byte{}, stub.priv.Serialize(), stub.chaincode, []byte{}, 0, 0, true)
+			tweakedKey, _ := crypto.TweakExtendedKey(extndKey, hash.CloneBytes())
+			priv, _ = tweakedKey.ECPrivKey()
+		}
+
+		// sign each input with the sighash calculated from the psbt
+		prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+		for i, txIn := range packet.UnsignedTx.TxIn {
+			prevOuts.AddPrevOut(txIn.PreviousOutPoint, packet.Inputs[i].WitnessUtxo)
+		}
+		txSigHashes := txscript.NewTxSigHashes(packet.UnsignedTx, prevOuts)
+		for i := range packet.Inputs {
+			key, script := priv, packet.Inputs[i].WitnessScript
+			if i > 0 {
+				key = stub.topup
+			}
+			if script == nil {
+				script = packet.Inputs[i].WitnessUtxo.PkScript
+			}
+			sigHash, _ := txscript.CalcWitnessSigHash(script, txSigHashes, txscript.SigHashAll,
+				packet.UnsignedTx, i, packet.Inputs[i].WitnessUtxo.Value)
+			sigBytes := append(ecdsa.Sign(key, sigHash).Serialize(), byte(1))
+			if finalize {
+				var witnessBuf bytes.Buffer
+				psbt.WriteTxWitness(&witnessBuf, [][]byte{sigBytes, key.PubKey().SerializeCompressed()})
+				packet.Inputs[i].FinalScriptWitness = witnessBuf.Bytes()
+			} else {
+				packet.Inputs[i].PartialSigs = append(packet.Inputs[i].PartialSigs,
+					&psbt.PartialSig{PubKey: key.PubKey().SerializeCompressed(), Signature: sigBytes})
+			}
+		}
+		packetStr, _ := packet.B64Encode()
+		json.NewEncoder(w).Encode(PsbtResponseBody{packetStr})
+	}))
+}
+
+// Return test transaction spending a previous attestation and topup output
+func psbtTestTx(stubs []*attestSignerStub, pkScript []byte) (*wire.MsgTx, map[wire.OutPoint]*wire.TxOut, [][]byte) {
+	topupAddr, _ := crypto.GetAddressFromPubKey(stubs[0].topup.PubKey(), &chaincfg.RegressionNetParams)
+	topupScript, _ := txscript.PayToAddrScript(topupAddr)
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	prevOuts := make(map[wire.OutPoint]*wire.TxOut)
+	for i, prevOut := range []*wire.TxOut{wire.NewTxOut(100000, pkScript), wire.NewTxOut(50000, topupScript)} {
+		outpoint := wire.OutPoint{Hash: chainhash.Hash{byte(i + 1)}, Index: uint32(i)}
+		tx.AddTxIn(wire.NewTxIn(&outpoint, nil, nil))
+		prevOuts[outpoint] = prevOut
+	}
+	tx.AddTxOut(wire.NewTxOut(140000, pkScript))
+
+	var txBuf bytes.Buffer
+	tx.Serialize(&txBuf)
+	return tx, prevOuts, [][]byte{txBuf.Bytes(), txBuf.Bytes()}
+}
+
+// Calculate test transaction sighashes for the attestation input script code
+func psbtTestSigHashes(tx *wire.MsgTx, prevOuts map[wire.OutPoint]*wire.TxOut, scriptCode []byte) [][]byte {
+	fetcher := txscript.NewMultiPrevOutFetcher(prevOuts)
+	txSigHashes := txscript.NewTxSigHashes(tx, fetcher)
+	var sigHashes [][]byte
+	for i, txIn := range tx.TxIn {
+		prevOut := prevOuts[txIn.PreviousOutPoint]
+		script := prevOut.PkScript
+		if i == 0 && scriptCode != nil {
+			script = scriptCode
+		}
+		sigHash, _ := txscript.CalcWitnessSigHash(script, txSigHashes, txscript.SigHashAll, tx, i, prevOut.Value)
+		sigHashes = append(sigHashes, sigHash)
+	}
+	return sigHashes
+}
+
+// Return test fetcher of previous outputs
+func psbtTestFetcher(prevOuts map[wire.OutPoint]*wire.TxOut) func(wire.OutPoint) (*wire.TxOut, error) {
+	return func(outpoint wire.OutPoint) (*wire.TxOut, error) {
+		prevOut, ok := prevOuts[outpoint]
+		if !ok {
+			return nil, errors.New(ErrorInputMissingForTx)
+		}
+		return prevOut, nil
+	}
+}
+
+// Test psbt signer for a single key staychain
+func TestAttestSignerPsbt(t *testing.T) {
+	_, stubs, pubkeysExtended := multisigTestSigners(1)
+	hash, _ := chainhash.NewHashFromStr("3a7e4ed8ec6c5c5a8b5c9c2e8cbb5ab3d8e2b1e7f7b3c0a2b2c0ac5e8e3c8f9a")
+	tweakedPubs, _ := tweakPubkeys(pubkeysExtended, *hash)
+	addr, _ := crypto.GetAddressFromPubKey(tweakedPubs[0], &chaincfg.RegressionNetParams)
+	pkScript, _ := txscript.PayToAddrScript(addr)
+	tx, prevOuts, txPreImages := psbtTestTx(stubs, pkScript)
+	sigHashes := psbtTestSigHashes(tx, prevOuts, nil)
+
+	client := &AttestClient{
+		MainChainCfg:    &chaincfg.RegressionNetParams,
+		pubkey:          stubs[0].priv.PubKey(),
+		numOfSigs:       1,
+		WalletChainCode: stubs[0].chaincode}
+	topupAddr, _ := crypto.GetAddressFromPubKey(stubs[0].topup.PubKey(), &chaincfg.RegressionNetParams)
+	client.addrTopup = topupAddr.String()
+
+	// signers returning partially signed and finalized psbts
+	for _, finalize := range []bool{false, true} {
+		server := psbtTestServer(t, stubs[0], finalize)
+		httpSigner, _ := NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: server.URL, TimeoutSeconds: 1, RetryBaseMillis: 1, Protocol: SignerProtocolPsbt})
+		signer := newAttestSignerPsbt([]*AttestSignerHttp{httpSigner},
+			psbtTestFetcher(prevOuts), nil, 1, &chaincfg.RegressionNetParams)
+		assert.Equal(t, server.URL, signer.Name())
+
+		assert.Equal(t, nil, signer.SendTxPreImages(txPreImages))
+		witness, err := signer.GetSigs(sigHashes, hash.String())
+		assert.Equal(t, nil, err)
+		assert.Equal(t, 2, len(witness))
+		assert.Equal(t, nil, client.verifyWitness(witness, sigHashes, *hash, signer.Name()))
+		server.Close()
+	}
+}
+
+// Test psbt signer combining partially signed psbts of a multisig staychain
+func TestAttestSignerPsbt_Multisig(t *testing.T) {
+	_, stubs, pubkeysExtended := multisigTestSigners(3)
+	hash, _ := chainhash.NewHashFromStr("3a7e4ed8ec6c5c5a8b5c9c2e8cbb5ab3d8e2b1e7f7b3c0a2b2c0ac5e8e3c8f9a")
+
+	client := &AttestClient{
+		MainChainCfg:    &chaincfg.RegressionNetParams,
+		pubkeysExtended: pubkeysExtended,
+		numOfSigs:       2}
+	topupAddr, _ := crypto.GetAddressFromPubKey(stubs[0].topup.PubKey(), &chaincfg.RegressionNetParams)
+	client.addrTopup = topupAddr.String()
+	addr, redeemScript, _ := client.GetNextAttestationScript(*hash)
+	pkScript, _ := txscript.PayToAddrScript(addr)
+	tx, prevOuts, txPreImages := psbtTestTx(stubs, pkScript)
+	redeemScriptBytes, _ := hex.DecodeString(redeemScript)
+	sigHashes := psbtTestSigHashes(tx, prevOuts, redeemScriptBytes)
+
+	// two of three signers available
+	var signers []*AttestSignerHttp
+	for i, stub := range stubs {
+		url := "http://127.0.0.1:0/sign"
+		if i > 0 {
+			server := psbtTestServer(t, stub, false)
+			defer server.Close()
+			url = server.URL
+		}
+		httpSigner, _ := NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: url, TimeoutSeconds: 1, RetryBaseMillis: 1, Protocol: SignerProtocolPsbt})
+		signers = append(signers, httpSigner)
+	}
+	signer := newAttestSignerPsbt(signers, psbtTestFetcher(prevOuts), pubkeysExtended, 2, &chaincfg.RegressionNetParams)
+
+	assert.Equal(t, nil, signer.SendTxPreImages(txPreImages))
+	witness, err := signer.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, len(witness[0]))
+	assert.Equal(t, redeemScriptBytes, []byte(witness[0][3]))
+	assert.Equal(t, nil, client.verifyWitness(witness, sigHashes, *hash, signer.Name()))
+
+	// below threshold the multisig witness is missing
+	signer = newAttestSignerPsbt(signers[:2], psbtTestFetcher(prevOuts), pubkeysExtended, 2, &chaincfg.RegressionNetParams)
+	assert.Equal(t, nil, signer.SendTxPreImages(txPreImages))
+	witness, err = signer.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, wire.TxWitness(nil), witness[0])
+	assert.Equal(t, &AttestSignerError{signer.Name(), 0, ErrorSigsMissingForVin},
+		client.verifyWitness(witness, sigHashes, *hash, signer.Name()))
+
+	// all signers failing
+	signer = newAttestSignerPsbt(signers[:1], psbtTestFetcher(prevOuts), pubkeysExtended, 2, &chaincfg.RegressionNetParams)
+	assert.Equal(t, nil, signer.SendTxPreImages(txPreImages))
+	_, err = signer.GetSigs(sigHashes, hash.String())
+	assert.Equal(t, true, strings.HasPrefix(err.Error(), ErrorPsbtSigners))
+}
+
+// Test psbt signer errors for missing or invalid transactions
+func TestAttestSignerPsbt_Errors(t *testing.T) {
+	_, stubs, _ := multisigTestSigners(1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// return psbt of a different transaction
+		otherTx := wire.NewMsgTx(wire.TxVersion)
+		otherTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{0xff}}, nil, nil))
+		otherTx.AddTxOut(wire.NewTxOut(1, []byte{txscript.OP_TRUE}))
+		packet, _ := psbt.NewFromUnsignedTx(otherTx)
+		packetStr, _ := packet.B64Encode()
+		json.NewEncoder(w).Encode(PsbtResponseBody{packetStr})
+	}))
+	defer server.Close()
+
+	tx, prevOuts, txPreImages := psbtTestTx(stubs, []byte{txscript.OP_TRUE})
+	httpSigner, _ := NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: server.URL, TimeoutSeconds: 1, RetryBaseMillis: 1, Protocol: SignerProtocolPsbt})
+	signers := []*AttestSignerHttp{httpSigner}
+	signer := newAttestSignerPsbt(signers, psbtTestFetcher(prevOuts), nil, 1, &chaincfg.RegressionNetParams)
+	sigHashes := psbtTestSigHashes(tx, prevOuts, nil)
+
+	// no transaction
+	_, err := signer.GetSigs(sigHashes, chainhash.Hash{}.String())
+	assert.Equal(t, errors.New(ErrorPsbtTxMissing), err)
+	assert.NotEqual(t, nil, signer.SendTxPreImages([][]byte{[]byte{1}}))
+
+	// different transaction returned
+	assert.Equal(t, nil, signer.SendTxPreImages(txPreImages))
+	_, err = signer.GetSigs(sigHashes, chainhash.Hash{}.String())
+	assert.Equal(t, errors.New(ErrorPsbtSigners+" "+ErrorPsbtTxMismatch), err)
+
+	// unknown previous output
+	signer.fetchPrevOut = psbtTestFetcher(nil)
+	_, err = signer.GetSigs(sigHashes, chainhash.Hash{}.String())
+	assert.Equal(t, errors.New(ErrorPsbtCreate+" "+ErrorInputMissingForTx), err)
+
+	// witness parsing
+	var witnessBuf bytes.Buffer
+	psbt.WriteTxWitness(&witnessBuf, [][]byte{[]byte{1, 2}, []byte{3}})
+	witness, witnessErr := parseTxWitness(witnessBuf.Bytes())
+	assert.Equal(t, nil, witnessErr)
+	assert.Equal(t, wire.TxWitness{[]byte{1, 2}, []byte{3}}, witness)
+	_, witnessErr = parseTxWitness([]byte{0xff})
+	assert.NotEqual(t, nil, witnessErr)
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	confpkg "mainstay/config"
+	"mainstay/log"
+	"mainstay/models"
+)
+
+// Attestation webhook delivers attestation service events to
+// external webhook urls. Events are first stored in a db outbox
+// and then posted as signed JSON, retrying failed deliveries
+
+// webhook header names
+const (
+	WebhookHeaderEvent     = "X-Mainstay-Event"
+	WebhookHeaderSignature = "X-Mainstay-Signature"
+)
+
+// error / warning consts
+const (
+	ErrorWebhookResponse = "Webhook delivery failed with status"
+
+	WarningWebhookNoSecret          = "No webhook secret set - webhook events will not be signed"
+	WarningWebhookEventSave         = "Failed storing webhook event"
+	WarningWebhookEventGet          = "Failed fetching pending webhook events"
+	WarningWebhookDeliveryFailed    = "Webhook delivery failed"
+	WarningWebhookDeliveryAbandoned = "Webhook delivery abandoned after max attempts"
+)
+
+// webhook delivery schedules
+const (
+	// default maximum number of delivery attempts for each event
+	DefaultWebhookMaxAttempts = 10
+
+	// waiting time before first retry, doubled on each failed attempt
+	WebhookRetryBase = 30 * time.Second
+
+	// maximum waiting time between retries
+	WebhookRetryMax = 1 * time.Hour
+
+	// waiting time between checks for pending events
+	WebhookPollInterval = 1 * time.Minute
+
+	// timeout of webhook requests
+	WebhookTimeout = 10 * time.Second
+)
+
+// AttestWebhook structure
+//
+// Implements AttestSubscriber interface and delivers
+// events to all configured webhook urls via the db outbox
+type AttestWebhook struct {
+	// context required for safe service cancellation
+	ctx context.Context
+
+	// waitgroup required to maintain all goroutines
+	wg *sync.WaitGroup
+
+	// server connection for storing webhook outbox events
+	server *AttestServer
+
+	// clock used for retry scheduling
+	clock AttestClock
+
+	client      http.Client
+	urls        []string
+	secret      []byte
+	maxAttempts int32
+
+	notify chan struct{} // notifications of new outbox events
+}
+
+// Return new AttestWebhook instance
+func NewAttestWebhook(ctx context.Context, wg *sync.WaitGroup, server *AttestServer, clock AttestClock, config confpkg.WebhookConfig) *AttestWebhook {
+	if config.Secret == "" {
+		log.Warnln(WarningWebhookNoSecret)
+	}
+	maxAttempts := int32(DefaultWebhookMaxAttempts)
+	if config.MaxAttempts > 0 {
+		maxAttempts = int32(config.MaxAttempts)
+	}
+
+	return &AttestWebhook{
+		ctx:         ctx,
+		wg:          wg,
+		server:      server,
+		clock:       clock,
+		client:      http.Client{Timeout: WebhookTimeout},
+		urls:        config.Urls,
+		secret:      []byte(config.Secret),
+		maxAttempts: maxAttempts,
+		notify:      make(chan struct{}, 1),
+	}
+}
+
+// Store event in the outbox for each webhook url
+// and notify delivery of new outbox events
+func (w *AttestWebhook) HandleEvent(event AttestEvent) {
+	payload, marshalErr := json.Marshal(event)
+	if marshalErr != nil {
+		log.Warnf("%s %v\n", WarningWebhookEventSave, marshalErr)
+		return
+	}
+
+	now := w.clock.Now()
+	for _, url := range w.urls {
+		idHash := sha256.Sum256(append([]byte(url), payload...))
+		webhookEvent := models.WebhookEvent{
+			Id:          hex.EncodeToString(idHash[:]),
+			Url:         url,
+			Payload:     string(payload),
+			NextAttempt: now,
+			CreatedAt:   now,
+		}
+		if saveErr := w.server.UpdateWebhookEvent(webhookEvent); saveErr != nil {
+			log.Warnf("%s %v\n", WarningWebhookEventSave, saveErr)
+		}
+	}
+
+	select {
+	case w.notify <- struct{}{}:
+	default: // notification already pending
+	}
+}
+
+// Run webhook delivery of pending outbox events
+// until the context is cancelled
+func (w *AttestWebhook) Run() {
+	defer w.wg.Done()
+
+	for {
+		w.deliverPending()
+
+		timer := w.clock.NewTimer(WebhookPollInterval)
+		select {
+		case <-w.ctx.Done():
+			timer.Stop()
+			log.Infoln("Shutting down Attestation Webhook...")
+			return
+		case <-w.notify:
+			timer.Stop()
+		case <-timer.C():
+		}
+	}
+}
+
+// Deliver all pending outbox events that are due
+// Failed deliveries are retried with exponential backoff
+// until the maximum number of attempts has been reached
+func (w *AttestWebhook) deliverPending() {
+	events, eventsErr := w.server.GetPendingWebhookEvents()
+	if eventsErr != nil {
+		log.Warnf("%s %v\n", WarningWebhookEventGet, eventsErr)
+		return
+	}
+
+	for _, event := range events {
+		if event.NextAttempt.After(w.clock.Now()) {
+			continue
+		}
+
+		event.Attempts++
+		if deliverErr := w.deliver(event); deliverErr != nil {
+			log.Warnf("%s (%s) %v\n", WarningWebhookDeliveryFailed, event.Url, deliverErr)
+			if event.Attempts >= w.maxAttempts {
+				log.Warnf("%s (%s)\n", WarningWebhookDeliveryAbandoned, event.Url)
+				event.Failed = true
+			} else {
+				event.NextAttempt = w.clock.Now().Add(webhookRetryDelay(event.Attempts))
+			}
+		} else {
+			event.Delivered = true
+		}
+
+		if saveErr := w.server.UpdateWebhookEvent(event); saveErr != nil {
+			log.Warnf("%s %v\n", WarningWebhookEventSave, saveErr)
+		}
+	}
+}
+
+// Post event payload to the webhook url
+// Payload is signed with HMAC-SHA256 using the webhook secret
+func (w *AttestWebhook) deliver(event models.WebhookEvent) error {
+	payload := []byte(event.Payload)
+	req, reqErr := http.NewRequest(http.MethodPost, event.Url, bytes.NewReader(payload))
+	if reqErr != nil {
+		return reqErr
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookHeaderEvent, event.Id)
+	if len(w.secret) > 0 {
+		req.Header.Set(WebhookHeaderSignature, "sha256="+SignWebhookPayload(w.secret, payload))
+	}
+
+	resp, respErr := w.client.Do(req)
+	if respErr != nil {
+		return respErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New(fmt.Sprintf("%s %d", ErrorWebhookResponse, resp.StatusCode))
+	}
+	return nil
+}
+
+// Return hex encoded HMAC-SHA256 signature of the payload
+// Allows webhook receivers to verify event authenticity
+func SignWebhookPayload(secret []byte, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Return waiting time until the next delivery attempt
+func webhookRetryDelay(attempts int32) time.Duration {
+	delay := WebhookRetryBase
+	for i := int32(1); i < attempts; i++ {
+		delay *= 2
+		if delay >= WebhookRetryMax {
+			return WebhookRetryMax
+		}
+	}
+	return delay
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package attestation
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	confpkg "mainstay/config"
+	"mainstay/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test event bus publishing to subscribers
+func TestAttestEventBus(t *testing.T) {
+	bus := NewAttestEventBus()
+
+	var received []AttestEvent
+	bus.Subscribe(attestSubscriberFunc(func(event AttestEvent) { received = append(received, event) }))
+	bus.Subscribe(attestSubscriberFunc(func(event AttestEvent) { received = append(received, event) }))
+
+	event := AttestEvent{Type: AEventAttestationSent, Txid: "aa", MerkleRoot: "bb", Fee: 10, State: AStateSendAttestation}
+	bus.Publish(event)
+	assert.Equal(t, []AttestEvent{event, event}, received)
+}
+
+// Test webhook outbox delivery with signed payload and retries
+func TestAttestWebhook(t *testing.T) {
+	// webhook receiver failing the first two requests
+	var requests []*http.Request
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		if len(requests) <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	dbFake := db.NewDbFake()
+	clock := NewAttestClockFake(time.Unix(1542121293, 0))
+	webhook := NewAttestWebhook(nil, nil, NewAttestServer(dbFake), clock,
+		confpkg.WebhookConfig{Urls: []string{server.URL}, Secret: "secret", MaxAttempts: 3})
+
+	// event stored in outbox
+	event := AttestEvent{Type: AEventAttestationConfirmed, Txid: "aa", MerkleRoot: "bb", Fee: 10,
+		State: AStateAwaitConfirmation, Time: clock.Now()}
+	webhook.HandleEvent(event)
+	assert.Equal(t, 1, len(dbFake.WebhookEvents))
+	assert.Equal(t, server.URL, dbFake.WebhookEvents[0].Url)
+	assert.Equal(t, false, dbFake.WebhookEvents[0].Delivered)
+	assert.Equal(t, 1, len(webhook.notify))
+
+	// first attempt fails - retry scheduled
+	webhook.deliverPending()
+	assert.Equal(t, 1, len(requests))
+	assert.Equal(t, int32(1), dbFake.WebhookEvents[0].Attempts)
+	assert.Equal(t, clock.Now().Add(WebhookRetryBase), dbFake.WebhookEvents[0].NextAttempt)
+
+	// verify signed payload
+	var receivedEvent AttestEvent
+	assert.Equal(t, nil, json.Unmarshal(bodies[0], &receivedEvent))
+	assert.Equal(t, event.Type, receivedEvent.Type)
+	assert.Equal(t, event.Txid, receivedEvent.Txid)
+	assert.Equal(t, event.Fee, receivedEvent.Fee)
+	assert.Equal(t, "sha256="+SignWebhookPayload([]byte("secret"), bodies[0]),
+		requests[0].Header.Get(WebhookHeaderSignature))
+	assert.Equal(t, dbFake.WebhookEvents[0].Id, requests[0].Header.Get(WebhookHeaderEvent))
+
+	// retry not due yet
+	webhook.deliverPending()
+	assert.Equal(t, 1, len(requests))
+
+	// second attempt fails - retry delay doubled
+	clock.Advance(WebhookRetryBase)
+	webhook.deliverPending()
+	assert.Equal(t, 2, len(requests))
+	assert.Equal(t, int32(2), dbFake.WebhookEvents[0].Attempts)
+	assert.Equal(t, clock.Now().Add(2*WebhookRetryBase), dbFake.WebhookEvents[0].NextAttempt)
+
+	// third attempt delivered
+	clock.Advance(2 * WebhookRetryBase)
+	webhook.deliverPending()
+	assert.Equal(t, 3, len(requests))
+	assert.Equal(t, true, dbFake.WebhookEvents[0].Delivered)
+	assert.Equal(t, bodies[0], bodies[2])
+	pending, _ := dbFake.GetPendingWebhookEvents()
+	assert.Equal(t, 0, len(pending))
+
+	// event abandoned after max attempts
+	webhook.urls = []string{"http://127.0.0.1:0"}
+	webhook.HandleEvent(AttestEvent{Type: AEventAttestationFailed, Error: "failure"})
+	for i := 0; i < 3; i++ {
+		webhook.deliverPending()
+		clock.Advance(WebhookRetryMax)
+	}
+	assert.Equal(t, 2, len(dbFake.WebhookEvents))
+	assert.Equal(t, int32(3), dbFake.WebhookEvents[1].Attempts)
+	assert.Equal(t, true, dbFake.WebhookEvents[1].Failed)
+	assert.Equal(t, false, dbFake.WebhookEvents[1].Delivered)
+}
+
+// Test webhook retry delay backoff
+func TestAttestWebhookRetryDelay(t *testing.T) {
+	assert.Equal(t, WebhookRetryBase, webhookRetryDelay(1))
+	assert.Equal(t, 2*WebhookRetryBase, webhookRetryDelay(2))
+	assert.Equal(t, 4*WebhookRetryBase, webhookRetryDelay(3))
+	assert.Equal(t, WebhookRetryMax, webhookRetryDelay(20))
+}
+
+// attestSubscriberFunc implements AttestSubscriber for testing
+type attestSubscriberFunc func(AttestEvent)
+
+func (f attestSubscriberFunc) HandleEvent(event AttestEvent) {
+	f(event)
+}
@@ -0,0 +1,17 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// Package signerpb contains the grpc signer api served by the attestation
+// service to signers connecting from behind firewalls
+//
+// The api is generated from signer.proto with go generate, which requires
+// protoc 23.4 and installs the pinned protoc-gen-go and protoc-gen-go-grpc
+// plugins. The license header of the generated files is copied by the
+// plugins from the leading comments of signer.proto
+package signerpb
+
+//go:generate sh -c "protoc --version | grep -qx 'libprotoc 23.4' || { echo 'protoc 23.4 required' >&2; exit 1; }"
+//go:generate go install google.golang.org/protobuf/cmd/protoc-gen-go@v1.31.0
+//go:generate go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.3.0
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative signer.proto
@@ -0,0 +1,145 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: signer.proto
+
+package signerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Signer_Connect_FullMethodName = "/mainstay.signer.Signer/Connect"
+)
+
+// SignerClient is the client API for Signer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SignerClient interface {
+	Connect(ctx context.Context, opts ...grpc.CallOption) (Signer_ConnectClient, error)
+}
+
+type signerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSignerClient(cc grpc.ClientConnInterface) SignerClient {
+	return &signerClient{cc}
+}
+
+func (c *signerClient) Connect(ctx context.Context, opts ...grpc.CallOption) (Signer_ConnectClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Signer_ServiceDesc.Streams[0], Signer_Connect_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &signerConnectClient{stream}
+	return x, nil
+}
+
+type Signer_ConnectClient interface {
+	Send(*SignerMessage) error
+	Recv() (*ServiceMessage, error)
+	grpc.ClientStream
+}
+
+type signerConnectClient struct {
+	grpc.ClientStream
+}
+
+func (x *signerConnectClient) Send(m *SignerMessage) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *signerConnectClient) Recv() (*ServiceMessage, error) {
+	m := new(ServiceMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SignerServer is the server API for Signer service.
+// All implementations must embed UnimplementedSignerServer
+// for forward compatibility
+type SignerServer interface {
+	Connect(Signer_ConnectServer) error
+	mustEmbedUnimplementedSignerServer()
+}
+
+// UnimplementedSignerServer must be embedded to have forward compatible implementations.
+type UnimplementedSignerServer struct {
+}
+
+func (UnimplementedSignerServer) Connect(Signer_ConnectServer) error {
+	return status.Errorf(codes.Unimplemented, "method Connect not implemented")
+}
+func (UnimplementedSignerServer) mustEmbedUnimplementedSignerServer() {}
+
+// UnsafeSignerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SignerServer will
+// result in compilation errors.
+type UnsafeSignerServer interface {
+	mustEmbedUnimplementedSignerServer()
+}
+
+func RegisterSignerServer(s grpc.ServiceRegistrar, srv SignerServer) {
+	s.RegisterService(&Signer_ServiceDesc, srv)
+}
+
+func _Signer_Connect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SignerServer).Connect(&signerConnectServer{stream})
+}
+
+type Signer_ConnectServer interface {
+	Send(*ServiceMessage) error
+	Recv() (*SignerMessage, error)
+	grpc.ServerStream
+}
+
+type signerConnectServer struct {
+	grpc.ServerStream
+}
+
+func (x *signerConnectServer) Send(m *ServiceMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *signerConnectServer) Recv() (*SignerMessage, error) {
+	m := new(SignerMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Signer_ServiceDesc is the grpc.ServiceDesc for Signer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Signer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mainstay.signer.Signer",
+	HandlerType: (*SignerServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Connect",
+			Handler:       _Signer_Connect_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "signer.proto",
+}
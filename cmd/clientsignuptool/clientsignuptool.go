@@ -85,7 +85,11 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	dbMongo = db.NewDbMongo(ctx, mainConfig.DbConfig())
+	var dbErr error
+	dbMongo, dbErr = db.NewDbMongo(ctx, mainConfig.DbConfig())
+	if dbErr != nil {
+		log.Error(dbErr)
+	}
 
 	log.Infoln()
 	log.Infoln("*********************************************")
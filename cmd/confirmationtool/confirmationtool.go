@@ -29,6 +29,7 @@ var (
 	tx          string
 	script      string
 	chaincodes  string
+	taprootKey  string
 	apiHost     string
 	position    int
 	showDetails bool
@@ -42,13 +43,14 @@ func init() {
 	flag.StringVar(&tx, "tx", "", "Tx id from which to start searching the staychain")
 	flag.StringVar(&script, "script", "", "Redeem script of multisig used by attestaton service")
 	flag.StringVar(&chaincodes, "chaincodes", "", "Chaincodes for multisig pubkeys")
+	flag.StringVar(&taprootKey, "taprootKey", "", "Internal pubkey of taproot staychain used instead of -script and -chaincodes")
 	flag.StringVar(&apiHost, "apiHost", DefaultApiHost, "Host address for mainstay API")
 	flag.IntVar(&position, "position", -1, "Client merkle commitment position")
 	flag.Parse()
 
-	if tx == "" || script == "" || position == -1 || chaincodes == "" {
+	if tx == "" || position == -1 || (taprootKey == "" && (script == "" || chaincodes == "")) {
 		flag.PrintDefaults()
-		log.Error("Need to provide all -tx, -script, -chaincodes and -position argument.")
+		log.Error("Need to provide all -tx, -script, -chaincodes (or -taprootKey) and -position argument.")
 	}
 
 	confFile, confErr := config.GetConfFile(os.Getenv("GOPATH") + ConfPath)
@@ -71,8 +73,14 @@ func main() {
 	txraw := getRawTxFromHash(tx)
 	fetcher := staychain.NewChainFetcher(mainConfig.MainClient(), txraw)
 	chain := staychain.NewChain(fetcher)
-	verifier := staychain.NewChainVerifier(mainConfig.MainChainCfg(),
-		client, position, script, strings.Split(chaincodes, ","), apiHost)
+	var verifier staychain.ChainVerifier
+	if taprootKey != "" {
+		verifier = staychain.NewChainVerifierTaproot(mainConfig.MainChainCfg(),
+			client, position, taprootKey, apiHost)
+	} else {
+		verifier = staychain.NewChainVerifier(mainConfig.MainChainCfg(),
+			client, position, script, strings.Split(chaincodes, ","), apiHost)
+	}
 
 	// await new attestations and verify
 	for transaction := range chain.Updates() {
@@ -0,0 +1,789 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+// Reference signer server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"mainstay/attestation"
+	"mainstay/attestation/signerpb"
+	"mainstay/crypto"
+	"mainstay/log"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr/musig2"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// consts
+const (
+	DefaultHost     = "localhost:8000" // default signer host
+	SignUrl         = "/sign"          // url to receive sign requests at
+	PassphraseEnv   = "SIGNER_PASSPHRASE"
+	MaxRequestBytes = 1 << 20
+	GrpcRetryDelay  = 5 * time.Second // waiting time before reconnecting to the service
+	MaxSignedRoots  = 1000            // number of signed merkle roots kept in the state file
+
+	ErrorPolicyReplay  = "Merkle root signed before the last signed merkle root"
+	ErrorTopupKey      = "No topup key to sign topup input"
+	ErrorSighash       = "Invalid sighash"
+	ErrorMerkleRoot    = "Invalid merkle root"
+	ErrorRequestMethod = "Invalid request method"
+	ErrorRequestBody   = "Invalid request body"
+	ErrorRequestAuth   = "Request authentication failed"
+	ErrorSession       = "Musig2 session does not match request"
+	ErrorSessionPubkey = "Signer pubkey not in musig2 pubkeys"
+	ErrorSessionNonce  = "Signer nonce not in musig2 nonces"
+	ErrorSessionUsed   = "Musig2 session secret nonce already used"
+)
+
+// vars
+var (
+	host      string // signer host
+	keyFile   string // encrypted key file
+	passFile  string // passphrase file (optional)
+	stateFile string // file storing signed merkle roots
+	sessFile  string // file storing musig2 sessions
+	isInit    bool   // init flag
+	taproot   bool   // taproot staychain flag
+
+	tlsCert        string // server certificate file
+	tlsKey         string // server key file
+	tlsClientCa    string // CA certificate file of client certificates
+	authSecretFile string // file containing HMAC request signing secret
+	authKeyFile    string // file containing hex ECDSA response signing key
+	authPubkey     string // hex ECDSA pubkey of the attestation service
+
+	grpcHost string // attestation service grpc host to connect to
+	grpcName string // signer name sent to the attestation service
+	grpcCa   string // CA certificate file of the attestation service certificate
+
+	pk        string // base private key (init mode)
+	chaincode string // base chaincode (init mode)
+	pkTopup   string // topup private key (init mode)
+)
+
+// init
+func init() {
+	flag.StringVar(&host, "host", DefaultHost, "Host address to listen for sign requests at")
+	flag.StringVar(&keyFile, "keyfile", "signerkeys.json", "Encrypted key file")
+	flag.StringVar(&passFile, "passfile", "", "File containing the key file passphrase (default env SIGNER_PASSPHRASE)")
+	flag.StringVar(&stateFile, "state", "signerstate.json", "File storing merkle roots signed")
+	flag.StringVar(&sessFile, "sessions", "signersessions.json", "File storing musig2 signing sessions")
+	flag.BoolVar(&taproot, "taproot", false, "Sign taproot staychain attestation inputs with schnorr signatures")
+
+	// signer channel authentication options
+	flag.StringVar(&tlsCert, "tlsCert", "", "Server TLS certificate file")
+	flag.StringVar(&tlsKey, "tlsKey", "", "Server TLS key file")
+	flag.StringVar(&tlsClientCa, "tlsClientCa", "", "CA certificate file required for client certificates (mTLS)")
+	flag.StringVar(&authSecretFile, "authSecretFile", "", "File containing the HMAC secret shared with the attestation service")
+	flag.StringVar(&authKeyFile, "authKeyFile", "", "File containing the hex ECDSA key signing responses")
+	flag.StringVar(&authPubkey, "authPubkey", "", "Hex ECDSA pubkey of the attestation service verifying requests")
+
+	// grpc mode options
+	flag.StringVar(&grpcHost, "grpc", "", "Attestation service grpc host to connect to instead of listening for requests")
+	flag.StringVar(&grpcName, "name", "", "Signer name sent to the attestation service (default hostname)")
+	flag.StringVar(&grpcCa, "grpcCa", "", "CA certificate file of the attestation service certificate (grpc mode)")
+
+	// init mode options
+	flag.BoolVar(&isInit, "init", false, "Init mode - create encrypted key file")
+	flag.StringVar(&pk, "pk", "", "Base private key (init mode)")
+	flag.StringVar(&chaincode, "chaincode", "", "Base chaincode (init mode)")
+	flag.StringVar(&pkTopup, "pkTopup", "", "Topup private key (init mode)")
+}
+
+// Read key file passphrase from passphrase file or environment
+func readPassphrase() []byte {
+	if passFile != "" {
+		passBytes, readErr := ioutil.ReadFile(passFile)
+		if readErr != nil {
+			log.Error(readErr)
+		}
+		return []byte(strings.TrimRight(string(passBytes), "\r\n"))
+	}
+	passphrase := os.Getenv(PassphraseEnv)
+	if passphrase == "" {
+		log.Errorf("Key file passphrase required in -passfile or %s\n", PassphraseEnv)
+	}
+	return []byte(passphrase)
+}
+
+// Init mode
+// Encrypt base key, chaincode and topup key in a new key file
+func doInitMode() {
+	log.Infoln("****************************")
+	log.Infoln("****** Init mode ***********")
+	log.Infoln("****************************")
+
+	if _, statErr := os.Stat(keyFile); statErr == nil {
+		log.Errorf("Key file %s already exists\n", keyFile)
+	}
+
+	keys := &crypto.KeystoreKeys{}
+	wif, wifErr := crypto.GetWalletPrivKey(pk)
+	if wifErr != nil {
+		log.Errorf("Invalid private key %v\n", wifErr)
+	}
+	keys.PrivKey = wif.PrivKey.Serialize()
+
+	var chaincodeErr error
+	keys.Chaincode, chaincodeErr = hex.DecodeString(chaincode)
+	if chaincodeErr != nil {
+		log.Errorf("Invalid chaincode %v\n", chaincodeErr)
+	}
+
+	if pkTopup != "" {
+		wifTopup, wifTopupErr := crypto.GetWalletPrivKey(pkTopup)
+		if wifTopupErr != nil {
+			log.Errorf("Invalid topup private key %v\n", wifTopupErr)
+		}
+		keys.TopupPrivKey = wifTopup.PrivKey.Serialize()
+	}
+
+	passphrase := readPassphrase()
+	data, encryptErr := crypto.EncryptKeystore(keys, passphrase)
+	keys.Zero()
+	crypto.ZeroBytes(passphrase)
+	if encryptErr != nil {
+		log.Error(encryptErr)
+	}
+
+	if writeErr := ioutil.WriteFile(keyFile, data, 0600); writeErr != nil {
+		log.Error(writeErr)
+	}
+	log.Infof("Key file written to %s\n", keyFile)
+}
+
+// signer with base extended key and policy state
+type signer struct {
+	extndKey *hdkeychain.ExtendedKey
+	topup    *btcec.PrivateKey
+
+	// request authentication - nil if not configured
+	auth   *attestation.SignerAuth
+	nonces *attestation.SignerNonceCache
+
+	mtx      sync.Mutex
+	roots    []string                  // merkle roots signed in order
+	sessions map[string]*musig2Session // musig2 sessions by id
+}
+
+// musig2 signing session of the signer
+// The secret nonce is removed from the sessions file before the partial
+// signature is created and the sign round response is kept to reply to
+// repeated requests
+type musig2Session struct {
+	MerkleRoot string                          `json:"merkle_root"`
+	Sighash    string                          `json:"sighash"`
+	SecNonce   string                          `json:"sec_nonce,omitempty"`
+	PubNonce   string                          `json:"pub_nonce"`
+	Response   *attestation.Musig2ResponseBody `json:"response,omitempty"`
+}
+
+// Load signer keys from the encrypted key file and signed merkle roots
+func newSigner() *signer {
+	data, readErr := ioutil.ReadFile(keyFile)
+	if readErr != nil {
+		log.Error(readErr)
+	}
+	passphrase := readPassphrase()
+	keys, decryptErr := crypto.DecryptKeystore(data, passphrase)
+	crypto.ZeroBytes(passphrase)
+	if decryptErr != nil {
+		log.Error(decryptErr)
+	}
+	defer keys.Zero()
+
+	s := &signer{}
+	s.extndKey = hdkeychain.NewExtendedKey([]byte{}, append([]byte{}, keys.PrivKey...),
+		append([]byte{}, keys.Chaincode...), []byte{}, 0, 0, true)
+	if len(keys.TopupPrivKey) > 0 {
+		s.topup, _ = btcec.PrivKeyFromBytes(keys.TopupPrivKey)
+	}
+
+	s.loadState()
+	return s
+}
+
+// Load signed merkle roots and musig2 sessions from the state files
+func (s *signer) loadState() {
+	stateBytes, stateErr := ioutil.ReadFile(stateFile)
+	if stateErr == nil {
+		if jsonErr := json.Unmarshal(stateBytes, &s.roots); jsonErr != nil {
+			log.Errorf("Invalid state file %s %v\n", stateFile, jsonErr)
+		}
+	} else if !os.IsNotExist(stateErr) {
+		log.Error(stateErr)
+	}
+
+	s.sessions = make(map[string]*musig2Session)
+	sessBytes, sessErr := ioutil.ReadFile(sessFile)
+	if sessErr == nil {
+		if jsonErr := json.Unmarshal(sessBytes, &s.sessions); jsonErr != nil {
+			log.Errorf("Invalid sessions file %s %v\n", sessFile, jsonErr)
+		}
+	} else if !os.IsNotExist(sessErr) {
+		log.Error(sessErr)
+	}
+}
+
+// Check merkle root against signing policy and store it as signed
+// The merkle root is accepted if it is the last one signed (re-signing
+// or fee bumping) or a new one that has not been signed before, so that
+// old merkle roots are not replayed. The signer only receives sighashes
+// and does not verify that the spent output is tweaked by the last root
+// Only the last MaxSignedRoots merkle roots are kept, as the outputs of
+// older attestations are long spent, and the state file is only written
+// when a new merkle root is signed
+func (s *signer) checkPolicy(hash chainhash.Hash) error {
+	root := hash.String()
+	if len(s.roots) > 0 {
+		if s.roots[len(s.roots)-1] == root {
+			return nil
+		}
+		if hash.IsEqual(&chainhash.Hash{}) {
+			return errors.New(ErrorPolicyReplay)
+		}
+		for _, signed := range s.roots {
+			if signed == root {
+				return errors.New(ErrorPolicyReplay)
+			}
+		}
+	}
+
+	roots := append(append([]string{}, s.roots...), root)
+	if len(roots) > MaxSignedRoots {
+		roots = roots[len(roots)-MaxSignedRoots:]
+	}
+	rootsBytes, _ := json.Marshal(roots)
+	if writeErr := writeFileAtomic(stateFile, rootsBytes); writeErr != nil {
+		return writeErr
+	}
+	s.roots = roots
+	return nil
+}
+
+// Write file by renaming a temporary file written next to it
+// so that a failed write does not corrupt the previous file
+func writeFileAtomic(name string, data []byte) error {
+	tmpName := name + ".tmp"
+	if writeErr := ioutil.WriteFile(tmpName, data, 0600); writeErr != nil {
+		return writeErr
+	}
+	return os.Rename(tmpName, name)
+}
+
+// Parse merkle root and sighashes of a sign request
+// A topup key is required to sign sighashes of topup inputs
+func (s *signer) parseRequest(merkleRoot string, sigHashesStr []string) (*chainhash.Hash, [][]byte, error) {
+	hash, hashErr := chainhash.NewHashFromStr(merkleRoot)
+	if hashErr != nil {
+		return nil, nil, errors.New(fmt.Sprintf("%s %v", ErrorMerkleRoot, hashErr))
+	}
+
+	sigHashes := make([][]byte, len(sigHashesStr))
+	for i, sigHashStr := range sigHashesStr {
+		sigHash, sigHashErr := hex.DecodeString(sigHashStr)
+		if sigHashErr != nil || len(sigHash) != chainhash.HashSize {
+			return nil, nil, errors.New(fmt.Sprintf("%s for input %d", ErrorSighash, i))
+		}
+		sigHashes[i] = sigHash
+	}
+	if len(sigHashes) == 0 {
+		return nil, nil, errors.New(fmt.Sprintf("%s for input %d", ErrorSighash, 0))
+	}
+	if len(sigHashes) > 1 && s.topup == nil {
+		return nil, nil, errors.New(ErrorTopupKey)
+	}
+	return hash, sigHashes, nil
+}
+
+// Return witness of the topup key signature for each topup sighash
+func (s *signer) signTopup(sigHashes [][]byte) []string {
+	var witness []string
+	for _, sigHash := range sigHashes {
+		sig := ecdsa.Sign(s.topup, sigHash)
+		witness = append(witness, fmt.Sprintf("%s %s", hex.EncodeToString(sig.Serialize()),
+			hex.EncodeToString(s.topup.PubKey().SerializeCompressed())))
+	}
+	return witness
+}
+
+// Sign sighashes with the key tweaked by the merkle root for the
+// first input and the topup key for any remaining inputs
+func (s *signer) sign(request attestation.RequestBody) (attestation.ResponseBody, error) {
+	hash, sigHashes, parseErr := s.parseRequest(request.MerkleRoot, request.SighashString)
+	if parseErr != nil {
+		return attestation.ResponseBody{}, parseErr
+	}
+
+	// base key used for the initial unspent, tweaked key otherwise
+	// taproot staychains tweak the base key with the tap tweak instead
+	extndKey := s.extndKey
+	if !taproot && !hash.IsEqual(&chainhash.Hash{}) {
+		var tweakErr error
+		extndKey, tweakErr = crypto.TweakExtendedKey(s.extndKey, hash.CloneBytes())
+		if tweakErr != nil {
+			return attestation.ResponseBody{}, tweakErr
+		}
+	}
+	priv, privErr := extndKey.ECPrivKey()
+	if privErr != nil {
+		return attestation.ResponseBody{}, privErr
+	}
+	if taproot {
+		priv = crypto.TweakTaprootPrivKey(priv, hash.CloneBytes())
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if policyErr := s.checkPolicy(*hash); policyErr != nil {
+		return attestation.ResponseBody{}, policyErr
+	}
+
+	var witness string
+	if taproot {
+		sig, sigErr := schnorr.Sign(priv, sigHashes[0])
+		if sigErr != nil {
+			return attestation.ResponseBody{}, sigErr
+		}
+		witness = fmt.Sprintf("%s %s", hex.EncodeToString(sig.Serialize()),
+			hex.EncodeToString(schnorr.SerializePubKey(priv.PubKey())))
+	} else {
+		sig := ecdsa.Sign(priv, sigHashes[0])
+		witness = fmt.Sprintf("%s %s", hex.EncodeToString(sig.Serialize()),
+			hex.EncodeToString(priv.PubKey().SerializeCompressed()))
+	}
+	return attestation.ResponseBody{Witness: append([]string{witness}, s.signTopup(sigHashes[1:])...)}, nil
+}
+
+// Handle musig2 nonce and sign round requests with the base key
+// A nonce is generated and stored for each new session, which is bound
+// to the merkle root and sighash of the attestation input. The secret
+// nonce is used once in the sign round for the partial signature of the
+// aggregate key tweaked with the merkle root, after the signing policy
+// check. Repeated requests for a session return the same response
+func (s *signer) signMusig2(request attestation.Musig2RequestBody) (attestation.Musig2ResponseBody, error) {
+	hash, sigHashes, parseErr := s.parseRequest(request.MerkleRoot, request.SighashString)
+	if parseErr != nil {
+		return attestation.Musig2ResponseBody{}, parseErr
+	}
+	var msg [32]byte
+	copy(msg[:], sigHashes[0])
+
+	priv, privErr := s.extndKey.ECPrivKey()
+	if privErr != nil {
+		return attestation.Musig2ResponseBody{}, privErr
+	}
+	var pubkeys []*btcec.PublicKey
+	var isSigner bool
+	for _, pubkeyStr := range request.Pubkeys {
+		pubkeyBytes, _ := hex.DecodeString(pubkeyStr)
+		pubkey, pubkeyErr := btcec.ParsePubKey(pubkeyBytes)
+		if pubkeyErr != nil {
+			return attestation.Musig2ResponseBody{}, pubkeyErr
+		}
+		isSigner = isSigner || pubkey.IsEqual(priv.PubKey())
+		pubkeys = append(pubkeys, pubkey)
+	}
+	if !isSigner {
+		return attestation.Musig2ResponseBody{}, errors.New(ErrorSessionPubkey)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	session, ok := s.sessions[request.SessionId]
+	if ok && (session.MerkleRoot != request.MerkleRoot || session.Sighash != request.SighashString[0]) {
+		return attestation.Musig2ResponseBody{}, errors.New(ErrorSession)
+	}
+
+	if request.Round == attestation.Musig2RoundNonce {
+		if !ok {
+			nonces, nonceErr := musig2.GenNonces(musig2.WithPublicKey(priv.PubKey()),
+				musig2.WithNonceSecretKeyAux(priv), musig2.WithNonceMessageAux(msg))
+			if nonceErr != nil {
+				return attestation.Musig2ResponseBody{}, nonceErr
+			}
+			session = &musig2Session{
+				MerkleRoot: request.MerkleRoot,
+				Sighash:    request.SighashString[0],
+				SecNonce:   hex.EncodeToString(nonces.SecNonce[:]),
+				PubNonce:   hex.EncodeToString(nonces.PubNonce[:]),
+			}
+			if storeErr := s.storeSession(request.SessionId, session); storeErr != nil {
+				return attestation.Musig2ResponseBody{}, storeErr
+			}
+		}
+		return attestation.Musig2ResponseBody{Nonce: session.PubNonce}, nil
+	}
+
+	if !ok {
+		return attestation.Musig2ResponseBody{}, errors.New(ErrorSession)
+	}
+	if session.Response != nil {
+		return *session.Response, nil
+	}
+	if session.SecNonce == "" {
+		return attestation.Musig2ResponseBody{}, errors.New(ErrorSessionUsed)
+	}
+	var pubNonces [][musig2.PubNonceSize]byte
+	var hasNonce bool
+	for _, nonceStr := range request.Nonces {
+		var nonce [musig2.PubNonceSize]byte
+		nonceBytes, _ := hex.DecodeString(nonceStr)
+		copy(nonce[:], nonceBytes)
+		hasNonce = hasNonce || nonceStr == session.PubNonce
+		pubNonces = append(pubNonces, nonce)
+	}
+	if !hasNonce || len(pubNonces) != len(pubkeys) {
+		return attestation.Musig2ResponseBody{}, errors.New(ErrorSessionNonce)
+	}
+	aggregateNonce, aggregateErr := musig2.AggregateNonces(pubNonces)
+	if aggregateErr != nil {
+		return attestation.Musig2ResponseBody{}, aggregateErr
+	}
+	if policyErr := s.checkPolicy(*hash); policyErr != nil {
+		return attestation.Musig2ResponseBody{}, policyErr
+	}
+
+	var secNonce [musig2.SecNonceSize]byte
+	secNonceBytes, _ := hex.DecodeString(session.SecNonce)
+	copy(secNonce[:], secNonceBytes)
+	crypto.ZeroBytes(secNonceBytes)
+
+	// secret nonce removed from disk before signing so that it is never
+	// used again after a restart, even if signing or storing fails
+	session.SecNonce = ""
+	if storeErr := s.storeSession(request.SessionId, session); storeErr != nil {
+		crypto.ZeroBytes(secNonce[:])
+		return attestation.Musig2ResponseBody{}, storeErr
+	}
+
+	tweakOpt := musig2.WithTaprootSignTweak(hash.CloneBytes())
+	if hash.IsEqual(&chainhash.Hash{}) {
+		tweakOpt = musig2.WithBip86SignTweak()
+	}
+	partialSig, signErr := musig2.Sign(secNonce, priv, aggregateNonce, pubkeys, msg, musig2.WithSortedKeys(), tweakOpt)
+	crypto.ZeroBytes(secNonce[:])
+	if signErr != nil {
+		return attestation.Musig2ResponseBody{}, signErr
+	}
+	var partialSigBuf bytes.Buffer
+	partialSig.Encode(&partialSigBuf)
+
+	session.Response = &attestation.Musig2ResponseBody{
+		PartialSig: hex.EncodeToString(partialSigBuf.Bytes()),
+		Witness:    s.signTopup(sigHashes[1:]),
+	}
+	if storeErr := s.storeSession(request.SessionId, session); storeErr != nil {
+		return attestation.Musig2ResponseBody{}, storeErr
+	}
+	return *session.Response, nil
+}
+
+// Store musig2 session in the sessions file
+// Sessions of previous merkle roots are dropped
+func (s *signer) storeSession(id string, session *musig2Session) error {
+	sessions := map[string]*musig2Session{id: session}
+	for otherId, other := range s.sessions {
+		if otherId != id && other.MerkleRoot == session.MerkleRoot {
+			sessions[otherId] = other
+		}
+	}
+	sessionsBytes, _ := json.Marshal(sessions)
+	if writeErr := writeFileAtomic(sessFile, sessionsBytes); writeErr != nil {
+		return writeErr
+	}
+	s.sessions = sessions
+	return nil
+}
+
+// Handle sign requests
+func (s *signer) handleSign(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, ErrorRequestMethod, http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, readErr := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestBytes))
+	if readErr != nil {
+		http.Error(w, ErrorRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	var nonce string
+	if s.auth != nil {
+		var authErr error
+		if nonce, authErr = s.auth.VerifyRequest(r, body, s.nonces); authErr != nil {
+			log.Warnf("%s: %v\n", ErrorRequestAuth, authErr)
+			http.Error(w, ErrorRequestAuth, http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// musig2 requests are identified by the session id
+	var request attestation.Musig2RequestBody
+	if jsonErr := json.Unmarshal(body, &request); jsonErr != nil {
+		http.Error(w, ErrorRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	var response interface{}
+	var signErr error
+	if request.SessionId != "" {
+		response, signErr = s.signMusig2(request)
+	} else {
+		response, signErr = s.sign(attestation.RequestBody{SighashString: request.SighashString, MerkleRoot: request.MerkleRoot})
+	}
+	if signErr != nil {
+		log.Warnf("Refused sign request for merkle root %s: %v\n", request.MerkleRoot, signErr)
+		http.Error(w, signErr.Error(), http.StatusForbidden)
+		return
+	}
+	if request.SessionId != "" {
+		log.Infof("Musig2 %s round of session %s for merkle root %s\n", request.Round, request.SessionId, request.MerkleRoot)
+	} else {
+		log.Infof("Signed %d sighashes for merkle root %s\n", len(request.SighashString), request.MerkleRoot)
+	}
+
+	responseBytes, _ := json.Marshal(response)
+	if s.auth != nil {
+		s.auth.SignResponse(w, nonce, responseBytes)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(responseBytes)
+}
+
+// Return request authentication from the auth flags or nil if not set
+func newAuth() *attestation.SignerAuth {
+	if authSecretFile != "" {
+		secret, readErr := ioutil.ReadFile(authSecretFile)
+		if readErr != nil {
+			log.Error(readErr)
+		}
+		return attestation.NewSignerAuthHmac([]byte(strings.TrimRight(string(secret), "\r\n")))
+	}
+	if authKeyFile == "" {
+		return nil
+	}
+	keyBytes, readErr := ioutil.ReadFile(authKeyFile)
+	if readErr != nil {
+		log.Error(readErr)
+	}
+	privBytes, privErr := hex.DecodeString(strings.TrimSpace(string(keyBytes)))
+	crypto.ZeroBytes(keyBytes)
+	if privErr != nil || len(privBytes) != btcec.PrivKeyBytesLen {
+		log.Errorf("Invalid auth key %v\n", privErr)
+	}
+	priv, _ := btcec.PrivKeyFromBytes(privBytes)
+	crypto.ZeroBytes(privBytes)
+	pubBytes, pubErr := hex.DecodeString(authPubkey)
+	if pubErr != nil {
+		log.Errorf("Invalid auth pubkey %v\n", pubErr)
+	}
+	pub, parseErr := btcec.ParsePubKey(pubBytes)
+	if parseErr != nil {
+		log.Errorf("Invalid auth pubkey %v\n", parseErr)
+	}
+	return attestation.NewSignerAuthEcdsa(priv, pub)
+}
+
+// Serve sign requests over TLS if a server certificate is set
+// Client certificates signed by the client CA are required if set
+func listenAndServe() error {
+	if tlsCert == "" {
+		if tlsClientCa != "" {
+			log.Errorf("Server TLS certificate required for client certificates\n")
+		}
+		return http.ListenAndServe(host, nil)
+	}
+	server := &http.Server{Addr: host, TLSConfig: &tls.Config{MinVersion: tls.VersionTLS12}}
+	if tlsClientCa != "" {
+		caBytes, caErr := ioutil.ReadFile(tlsClientCa)
+		if caErr != nil {
+			log.Error(caErr)
+		}
+		server.TLSConfig.ClientCAs = x509.NewCertPool()
+		if !server.TLSConfig.ClientCAs.AppendCertsFromPEM(caBytes) {
+			log.Errorf("Invalid client CA certificate %s\n", tlsClientCa)
+		}
+		server.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return server.ListenAndServeTLS(tlsCert, tlsKey)
+}
+
+// Return witness stack of a hex signature and pubkey witness string
+// with the sighash all type appended to the signature
+func witnessItems(witnessStr string) [][]byte {
+	var items [][]byte
+	for i, itemStr := range strings.Split(witnessStr, " ") {
+		item, _ := hex.DecodeString(itemStr)
+		if i == 0 {
+			item = append(item, byte(1))
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// Sign request streamed by the attestation service
+// Refused requests are answered with the error instead
+func (s *signer) signStream(request *signerpb.SignRequest) *signerpb.Signatures {
+	body := attestation.RequestBody{MerkleRoot: request.GetMerkleRoot()}
+	for _, sigHash := range request.GetSighashes() {
+		body.SighashString = append(body.SighashString, hex.EncodeToString(sigHash))
+	}
+	sigs := &signerpb.Signatures{RequestId: request.GetId()}
+	response, signErr := s.sign(body)
+	if signErr != nil {
+		log.Warnf("Refused sign request for merkle root %s: %v\n", body.MerkleRoot, signErr)
+		sigs.Error = signErr.Error()
+		return sigs
+	}
+	log.Infof("Signed %d sighashes for merkle root %s\n", len(body.SighashString), body.MerkleRoot)
+	for _, witnessStr := range response.Witness {
+		sigs.Witness = append(sigs.Witness, &signerpb.Witness{Items: witnessItems(witnessStr)})
+	}
+	return sigs
+}
+
+// Return grpc transport credentials from the tls flags
+// The client certificate is presented to the attestation service and the
+// service certificate is verified against the grpc CA certificate if set
+func grpcCredentials() credentials.TransportCredentials {
+	if tlsCert == "" && grpcCa == "" {
+		return insecure.NewCredentials()
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if tlsCert != "" {
+		cert, certErr := tls.LoadX509KeyPair(tlsCert, tlsKey)
+		if certErr != nil {
+			log.Error(certErr)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if grpcCa != "" {
+		caBytes, caErr := ioutil.ReadFile(grpcCa)
+		if caErr != nil {
+			log.Error(caErr)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caBytes) {
+			log.Errorf("Invalid grpc CA certificate %s\n", grpcCa)
+		}
+	}
+	return credentials.NewTLS(tlsConfig)
+}
+
+// Connect to the attestation service and sign requests streamed by the
+// service until the stream fails. Each request is signed once received
+func (s *signer) serveStream(conn *grpc.ClientConn) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, streamErr := signerpb.NewSignerClient(conn).Connect(ctx)
+	if streamErr != nil {
+		return streamErr
+	}
+	hello := &signerpb.SignerMessage{Event: &signerpb.SignerMessage_Hello{Hello: &signerpb.Hello{Name: grpcName}}}
+	if sendErr := stream.Send(hello); sendErr != nil {
+		return sendErr
+	}
+	log.Infof("Connected to attestation service at %s as %s\n", grpcHost, grpcName)
+
+	for {
+		msg, recvErr := stream.Recv()
+		if recvErr != nil {
+			return recvErr
+		}
+		switch event := msg.GetEvent().(type) {
+		case *signerpb.ServiceMessage_ConfirmedHash:
+			log.Infof("Received confirmed hash %s\n", hex.EncodeToString(event.ConfirmedHash.GetHash()))
+		case *signerpb.ServiceMessage_TxPreImages:
+			log.Infof("Received %d transaction pre-images\n", len(event.TxPreImages.GetTxPreImages()))
+		case *signerpb.ServiceMessage_SignRequest:
+			sigs := &signerpb.SignerMessage{Event: &signerpb.SignerMessage_Signatures{
+				Signatures: s.signStream(event.SignRequest)}}
+			if sendErr := stream.Send(sigs); sendErr != nil {
+				return sendErr
+			}
+		}
+	}
+}
+
+// Connect to the attestation service grpc host, reconnecting after failures
+func connectAndServe(s *signer) {
+	if grpcName == "" {
+		grpcName, _ = os.Hostname()
+	}
+	conn, dialErr := grpc.Dial(grpcHost, grpc.WithTransportCredentials(grpcCredentials()))
+	if dialErr != nil {
+		log.Error(dialErr)
+	}
+	defer conn.Close()
+	for {
+		streamErr := s.serveStream(conn)
+		log.Warnf("Attestation service stream failed: %v - reconnecting in %s\n", streamErr, GrpcRetryDelay)
+		time.Sleep(GrpcRetryDelay)
+	}
+}
+
+// main
+func main() {
+	flag.Parse()
+	if isInit {
+		doInitMode()
+		return
+	}
+
+	log.Infoln("****************************")
+	log.Infoln("****** Signer server *******")
+	log.Infoln("****************************")
+
+	s := newSigner()
+	s.auth = newAuth()
+	s.nonces = attestation.NewSignerNonceCache(attestation.SignerAuthWindow)
+	if s.auth == nil {
+		log.Warnf("No request authentication set - sign requests are not authenticated\n")
+	}
+	pub, _ := s.extndKey.ECPubKey()
+	log.Infof("Base pubkey %s\n", hex.EncodeToString(pub.SerializeCompressed()))
+	if s.topup != nil {
+		log.Infof("Topup pubkey %s\n", hex.EncodeToString(s.topup.PubKey().SerializeCompressed()))
+	}
+	if len(s.roots) > 0 {
+		log.Infof("Last signed merkle root %s\n", s.roots[len(s.roots)-1])
+	}
+
+	if grpcHost != "" {
+		connectAndServe(s)
+		return
+	}
+
+	http.HandleFunc(SignUrl, s.handleSign)
+	log.Infof("Listening for sign requests at %s%s\n", host, SignUrl)
+	log.Error(listenAndServe())
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"mainstay/attestation"
+	confpkg "mainstay/config"
+	"mainstay/crypto"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr/musig2"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/assert"
+)
+
+// Return signer with test base and topup keys storing
+// its state in a temporary directory
+func newTestSigner(t *testing.T) *signer {
+	dir := t.TempDir()
+	stateFile = filepath.Join(dir, "signerstate.json")
+	sessFile = filepath.Join(dir, "signersessions.json")
+	taproot = false
+
+	s := &signer{}
+	s.extndKey = hdkeychain.NewExtendedKey([]byte{}, chainhash.HashB([]byte("base")),
+		chainhash.HashB([]byte("chaincode")), []byte{}, 0, 0, true)
+	s.topup, _ = btcec.PrivKeyFromBytes(chainhash.HashB([]byte("topup")))
+	s.loadState()
+	return s
+}
+
+// Return signer restarted from the state files of the signer provided
+func restartTestSigner(s *signer) *signer {
+	restarted := &signer{extndKey: s.extndKey, topup: s.topup}
+	restarted.loadState()
+	return restarted
+}
+
+// Test signing policy of repeated, old and zero merkle roots
+func TestSignerPolicy(t *testing.T) {
+	s := newTestSigner(t)
+	root1 := chainhash.HashH([]byte("root1"))
+	root2 := chainhash.HashH([]byte("root2"))
+
+	// zero merkle root of the initial unspent accepted first
+	assert.Equal(t, nil, s.checkPolicy(chainhash.Hash{}))
+	assert.Equal(t, nil, s.checkPolicy(root1))
+
+	// repeated last merkle root accepted, e.g. fee bumping
+	assert.Equal(t, nil, s.checkPolicy(root1))
+	assert.Equal(t, nil, s.checkPolicy(root2))
+	assert.Equal(t, []string{chainhash.Hash{}.String(), root1.String(), root2.String()}, s.roots)
+
+	// old and zero merkle roots refused
+	assert.Equal(t, errors.New(ErrorPolicyReplay), s.checkPolicy(root1))
+	assert.Equal(t, errors.New(ErrorPolicyReplay), s.checkPolicy(chainhash.Hash{}))
+	assert.Equal(t, root2.String(), s.roots[len(s.roots)-1])
+
+	// signed merkle roots kept across restarts
+	s = restartTestSigner(s)
+	assert.Equal(t, []string{chainhash.Hash{}.String(), root1.String(), root2.String()}, s.roots)
+	assert.Equal(t, nil, s.checkPolicy(root2))
+	assert.Equal(t, errors.New(ErrorPolicyReplay), s.checkPolicy(root1))
+}
+
+// Test signed merkle roots kept are bounded
+func TestSignerPolicy_MaxSignedRoots(t *testing.T) {
+	s := newTestSigner(t)
+	first := chainhash.HashH([]byte{0})
+	assert.Equal(t, nil, s.checkPolicy(first))
+	for i := 1; i <= MaxSignedRoots; i++ {
+		assert.Equal(t, nil, s.checkPolicy(chainhash.HashH([]byte{byte(i), byte(i >> 8)})))
+	}
+	assert.Equal(t, MaxSignedRoots, len(s.roots))
+	assert.Equal(t, chainhash.HashH([]byte{1, 0}).String(), s.roots[0])
+
+	var stored []string
+	stateBytes, _ := ioutil.ReadFile(stateFile)
+	assert.Equal(t, nil, json.Unmarshal(stateBytes, &stored))
+	assert.Equal(t, s.roots, stored)
+}
+
+// Test /sign contract against the http signer of the attestation service
+func TestSignerHandleSign(t *testing.T) {
+	s := newTestSigner(t)
+	server := httptest.NewServer(http.HandlerFunc(s.handleSign))
+	defer server.Close()
+
+	httpSigner, _ := attestation.NewAttestSignerHttp(context.Background(), confpkg.SignerConfig{Url: server.URL, TimeoutSeconds: 1, RetryBaseMillis: 1})
+	root := chainhash.HashH([]byte("root"))
+	sigHashes := [][]byte{chainhash.HashB([]byte("sighash0")), chainhash.HashB([]byte("sighash1"))}
+
+	witness, err := httpSigner.GetSigs(sigHashes, root.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(witness))
+
+	// first input signed by the base key tweaked by the merkle root
+	basePriv, _ := s.extndKey.ECPrivKey()
+	basePub := hdkeychain.NewExtendedKey([]byte{}, basePriv.PubKey().SerializeCompressed(),
+		chainhash.HashB([]byte("chaincode")), []byte{}, 0, 0, false)
+	tweakedPub, _ := crypto.TweakExtendedKey(basePub, root.CloneBytes())
+	pub, _ := tweakedPub.ECPubKey()
+	assert.Equal(t, pub.SerializeCompressed(), witness[0][1])
+	sig, sigErr := ecdsa.ParseDERSignature(witness[0][0][:len(witness[0][0])-1])
+	assert.Equal(t, nil, sigErr)
+	assert.Equal(t, true, sig.Verify(sigHashes[0], pub))
+
+	// topup input signed by the topup key
+	assert.Equal(t, s.topup.PubKey().SerializeCompressed(), witness[1][1])
+	sig, sigErr = ecdsa.ParseDERSignature(witness[1][0][:len(witness[1][0])-1])
+	assert.Equal(t, nil, sigErr)
+	assert.Equal(t, true, sig.Verify(sigHashes[1], s.topup.PubKey()))
+
+	// old merkle root refused
+	_, err = httpSigner.GetSigs(sigHashes, chainhash.HashH([]byte("root2")).String())
+	assert.Equal(t, nil, err)
+	_, err = httpSigner.GetSigs(sigHashes, root.String())
+	assert.Contains(t, err.Error(), attestation.ErrorSignerResponseStatus)
+
+	// invalid requests refused
+	resp, _ := http.Get(server.URL)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	resp, _ = http.Post(server.URL, "application/json", bytes.NewReader([]byte("{")))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// Test musig2 secret nonce is used once across signer restarts
+func TestSignerMusig2Restart(t *testing.T) {
+	s := newTestSigner(t)
+	priv, _ := s.extndKey.ECPrivKey()
+	otherPriv, _ := btcec.PrivKeyFromBytes(chainhash.HashB([]byte("other")))
+	pubkeys := []*btcec.PublicKey{priv.PubKey(), otherPriv.PubKey()}
+	pubkeysStr := []string{hex.EncodeToString(pubkeys[0].SerializeCompressed()),
+		hex.EncodeToString(pubkeys[1].SerializeCompressed())}
+
+	root := chainhash.HashH([]byte("root"))
+	sigHash := chainhash.HashH([]byte("sighash"))
+	request := attestation.Musig2RequestBody{
+		SessionId:     "session",
+		Round:         attestation.Musig2RoundNonce,
+		SighashString: []string{hex.EncodeToString(sigHash[:])},
+		MerkleRoot:    root.String(),
+		Pubkeys:       pubkeysStr,
+	}
+	nonceResp, nonceErr := s.signMusig2(request)
+	assert.Equal(t, nil, nonceErr)
+
+	// same nonce returned after restart
+	s = restartTestSigner(s)
+	repeatResp, repeatErr := s.signMusig2(request)
+	assert.Equal(t, nil, repeatErr)
+	assert.Equal(t, nonceResp.Nonce, repeatResp.Nonce)
+
+	otherNonces, _ := musig2.GenNonces(musig2.WithPublicKey(otherPriv.PubKey()))
+	var pubNonce [musig2.PubNonceSize]byte
+	pubNonceBytes, _ := hex.DecodeString(nonceResp.Nonce)
+	copy(pubNonce[:], pubNonceBytes)
+	request.Round = attestation.Musig2RoundSign
+	request.Nonces = []string{nonceResp.Nonce, hex.EncodeToString(otherNonces.PubNonce[:])}
+	signResp, signErr := s.signMusig2(request)
+	assert.Equal(t, nil, signErr)
+
+	// partial signature valid for the aggregate key tweaked by the merkle root
+	var partialSig musig2.PartialSignature
+	partialSigBytes, _ := hex.DecodeString(signResp.PartialSig)
+	assert.Equal(t, nil, partialSig.Decode(bytes.NewReader(partialSigBytes)))
+	aggregateNonce, _ := musig2.AggregateNonces([][musig2.PubNonceSize]byte{pubNonce, otherNonces.PubNonce})
+	assert.Equal(t, true, partialSig.Verify(pubNonce, aggregateNonce, pubkeys, priv.PubKey(), sigHash,
+		musig2.WithSortedKeys(), musig2.WithTaprootSignTweak(root.CloneBytes())))
+
+	// secret nonce removed from the sessions file once used
+	var sessions map[string]*musig2Session
+	sessBytes, _ := ioutil.ReadFile(sessFile)
+	assert.Equal(t, nil, json.Unmarshal(sessBytes, &sessions))
+	assert.Equal(t, "", sessions["session"].SecNonce)
+
+	// stored response returned after restart instead of signing again,
+	// even with different nonces of the other signers
+	s = restartTestSigner(s)
+	otherNonces, _ = musig2.GenNonces(musig2.WithPublicKey(otherPriv.PubKey()))
+	request.Nonces = []string{nonceResp.Nonce, hex.EncodeToString(otherNonces.PubNonce[:])}
+	repeatResp, repeatErr = s.signMusig2(request)
+	assert.Equal(t, nil, repeatErr)
+	assert.Equal(t, signResp, repeatResp)
+
+	// session bound to the merkle root and sighash
+	request.MerkleRoot = chainhash.HashH([]byte("root2")).String()
+	_, sessionErr := s.signMusig2(request)
+	assert.Equal(t, errors.New(ErrorSession), sessionErr)
+}
+
+// Test musig2 partial signature refused if the secret nonce removal
+// cannot be stored, and the secret nonce never used again afterwards
+func TestSignerMusig2StoreFailure(t *testing.T) {
+	s := newTestSigner(t)
+	priv, _ := s.extndKey.ECPrivKey()
+	otherPriv, _ := btcec.PrivKeyFromBytes(chainhash.HashB([]byte("other")))
+	pubkeysStr := []string{hex.EncodeToString(priv.PubKey().SerializeCompressed()),
+		hex.EncodeToString(otherPriv.PubKey().SerializeCompressed())}
+
+	sigHash := chainhash.HashH([]byte("sighash"))
+	request := attestation.Musig2RequestBody{
+		SessionId:     "session",
+		Round:         attestation.Musig2RoundNonce,
+		SighashString: []string{hex.EncodeToString(sigHash[:])},
+		MerkleRoot:    chainhash.HashH([]byte("root")).String(),
+		Pubkeys:       pubkeysStr,
+	}
+	nonceResp, nonceErr := s.signMusig2(request)
+	assert.Equal(t, nil, nonceErr)
+
+	otherNonces, _ := musig2.GenNonces(musig2.WithPublicKey(otherPriv.PubKey()))
+	request.Round = attestation.Musig2RoundSign
+	request.Nonces = []string{nonceResp.Nonce, hex.EncodeToString(otherNonces.PubNonce[:])}
+
+	// sessions file not writable - no partial signature
+	validSessFile := sessFile
+	sessFile = filepath.Join(t.TempDir(), "missing", "signersessions.json")
+	signResp, signErr := s.signMusig2(request)
+	assert.NotEqual(t, nil, signErr)
+	assert.Equal(t, "", signResp.PartialSig)
+
+	// secret nonce not used again once removed
+	sessFile = validSessFile
+	_, signErr = s.signMusig2(request)
+	assert.Equal(t, errors.New(ErrorSessionUsed), signErr)
+}
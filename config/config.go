@@ -5,6 +5,7 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"strconv"
 	"strings"
@@ -28,12 +29,20 @@ const (
 	StaychainInitPublicKeyName   = "initPublicKey"
 	StaychainTopupAddressName    = "topupAddress"
 	StaychainTopupPkName         = "topupPK"
+	StaychainConfirmationDepthName = "confirmationDepth"
+	StaychainDryRunName          = "dryRun"
+	StaychainInitScriptName      = "initScript"
+	StaychainInitChaincodesName  = "initChaincodes"
+	StaychainTaprootName         = "taproot"
 )
 
 // Config struct
 // Client connections and other parameters required
 // by ocean attestation service and testing
 type Config struct {
+	// staychain name - set when running multiple staychains
+	name string
+
 	// main bitcoin rpc connectivity
 	mainClient   *rpcclient.Client
 	mainChainCfg *chaincfg.Params
@@ -47,11 +56,37 @@ type Config struct {
 	topupAddress    string
 	topupPK         string
 
+	// multisig redeem script and pubkey chaincodes for P2WSH staychains
+	initScript     string
+	initChaincodes []string
+
+	// pay to taproot (P2TR) staychain with the commitment as tap tweak
+	taproot bool
+
+	// number of confirmations required for attestations
+	confirmationDepth int
+
+	// build and sign attestations without broadcasting or storing them
+	dryRun bool
+
 	// additional parameter categories
-	signerConfig SignerConfig
-	dbConfig     DbConfig
-	feesConfig   FeesConfig
-	timingConfig TimingConfig
+	signerConfig  SignerConfig
+	dbConfig      DbConfig
+	feesConfig    FeesConfig
+	timingConfig  TimingConfig
+	webhookConfig WebhookConfig
+	adminConfig   AdminConfig
+	metricsConfig MetricsConfig
+}
+
+// Get staychain name
+func (c Config) Name() string {
+	return c.name
+}
+
+// Set staychain name
+func (c *Config) SetName(name string) {
+	c.name = name
 }
 
 // Get Main Client
@@ -79,6 +114,11 @@ func (c Config) FeesConfig() FeesConfig {
 	return c.feesConfig
 }
 
+// Set fees configuration
+func (c *Config) SetFeesConfig(feesConfig FeesConfig) {
+	c.feesConfig = feesConfig
+}
+
 // Get Timing configuration
 func (c Config) TimingConfig() TimingConfig {
 	return c.timingConfig
@@ -89,6 +129,36 @@ func (c *Config) SetTimingConfig(timingConfig TimingConfig) {
 	c.timingConfig = timingConfig
 }
 
+// Get Webhook configuration
+func (c Config) WebhookConfig() WebhookConfig {
+	return c.webhookConfig
+}
+
+// Set webhook configuration
+func (c *Config) SetWebhookConfig(webhookConfig WebhookConfig) {
+	c.webhookConfig = webhookConfig
+}
+
+// Get Admin configuration
+func (c Config) AdminConfig() AdminConfig {
+	return c.adminConfig
+}
+
+// Set admin configuration
+func (c *Config) SetAdminConfig(adminConfig AdminConfig) {
+	c.adminConfig = adminConfig
+}
+
+// Get Metrics configuration
+func (c Config) MetricsConfig() MetricsConfig {
+	return c.metricsConfig
+}
+
+// Set metrics configuration
+func (c *Config) SetMetricsConfig(metricsConfig MetricsConfig) {
+	c.metricsConfig = metricsConfig
+}
+
 // Get regtest flag
 func (c Config) Regtest() bool {
 	return c.regtest
@@ -139,6 +209,26 @@ func (c *Config) SetInitChaincode(chaincode string) {
 	c.initChaincode = chaincode
 }
 
+// Get init multisig redeem script
+func (c *Config) InitScript() string {
+	return c.initScript
+}
+
+// Set init multisig redeem script
+func (c *Config) SetInitScript(script string) {
+	c.initScript = script
+}
+
+// Get init chaincodes of multisig pubkeys
+func (c *Config) InitChaincodes() []string {
+	return c.initChaincodes
+}
+
+// Set init chaincodes of multisig pubkeys
+func (c *Config) SetInitChaincodes(chaincodes []string) {
+	c.initChaincodes = chaincodes
+}
+
 // Get init Public key
 func (c *Config) InitPublicKey() string {
 	return c.initPublicKey
@@ -159,6 +249,36 @@ func (c *Config) SetTopupPK(pk string) {
 	c.topupPK = pk
 }
 
+// Get taproot flag
+func (c Config) Taproot() bool {
+	return c.taproot
+}
+
+// Set taproot flag
+func (c *Config) SetTaproot(taproot bool) {
+	c.taproot = taproot
+}
+
+// Get confirmation depth
+func (c Config) ConfirmationDepth() int {
+	return c.confirmationDepth
+}
+
+// Set confirmation depth
+func (c *Config) SetConfirmationDepth(depth int) {
+	c.confirmationDepth = depth
+}
+
+// Get dry run flag
+func (c Config) DryRun() bool {
+	return c.dryRun
+}
+
+// Set dry run flag
+func (c *Config) SetDryRun(dryRun bool) {
+	c.dryRun = dryRun
+}
+
 // Return Config instance
 func NewConfig(customConf ...[]byte) (*Config, error) {
 	var conf []byte
@@ -192,6 +312,9 @@ func NewConfig(customConf ...[]byte) (*Config, error) {
 
 	feesConfig := GetFeesConfig(conf)
 	timingConfig := GetTimingConfig(conf)
+	webhookConfig := GetWebhookConfig(conf)
+	adminConfig := GetAdminConfig(conf)
+	metricsConfig := GetMetricsConfig(conf)
 
 	signerConfig, signerConfigErr := GetSignerConfig(conf)
 	if signerConfigErr != nil {
@@ -201,6 +324,8 @@ func NewConfig(customConf ...[]byte) (*Config, error) {
 	// get staychain config parameters
 	// most of these can be overriden from command line
 	regtestStr := TryGetParamFromConf(StaychainName, StaychainRegtestName, conf)
+	dryRunStr := TryGetParamFromConf(StaychainName, StaychainDryRunName, conf)
+	taprootStr := TryGetParamFromConf(StaychainName, StaychainTaprootName, conf)
 	initTxStr := TryGetParamFromConf(StaychainName, StaychainInitTxName, conf)
 	initPKStr := TryGetParamFromConf(StaychainName, StaychainInitPkName, conf)
 	topupAddrStr := TryGetParamFromConf(StaychainName, StaychainTopupAddressName, conf)
@@ -210,6 +335,28 @@ func NewConfig(customConf ...[]byte) (*Config, error) {
 	initChaincodeStr := TryGetParamFromConf(StaychainName, StaychainInitChaincodeName, conf)
 	initChaincode := strings.TrimSpace(initChaincodeStr) // trim whitespace
 
+	initScriptStr := TryGetParamFromConf(StaychainName, StaychainInitScriptName, conf)
+	initScript := strings.TrimSpace(initScriptStr) // trim whitespace
+
+	var initChaincodes []string
+	initChaincodesStr := TryGetParamFromConf(StaychainName, StaychainInitChaincodesName, conf)
+	for _, chaincode := range strings.Split(initChaincodesStr, ",") {
+		if chaincode = strings.TrimSpace(chaincode); chaincode != "" {
+			initChaincodes = append(initChaincodes, chaincode)
+		}
+	}
+
+	// keys are only read from the keystore when it is used
+	if signerConfig.Keystore.File != "" && (initPKStr != "" || topupPKStr != "") {
+		return nil, errors.New(ErrorSignerKeystoreKeys)
+	}
+
+	confirmationDepthStr := TryGetParamFromConf(StaychainName, StaychainConfirmationDepthName, conf)
+	confirmationDepth, confirmationDepthErr := strconv.Atoi(confirmationDepthStr)
+	if confirmationDepthErr != nil {
+		confirmationDepth = -1
+	}
+
 	return &Config{
 		mainClient:      mainClient,
 		mainChainCfg:    mainClientCfg,
@@ -220,10 +367,18 @@ func NewConfig(customConf ...[]byte) (*Config, error) {
 		initChaincode:  initChaincode,
 		topupAddress:    topupAddrStr,
 		topupPK:         topupPKStr,
+		initScript:      initScript,
+		initChaincodes:  initChaincodes,
+		taproot:         (taprootStr == "1"),
+		confirmationDepth: confirmationDepth,
+		dryRun:          (dryRunStr == "1"),
 		signerConfig:    signerConfig,
 		dbConfig:        dbConnectivity,
 		feesConfig:      feesConfig,
 		timingConfig:    timingConfig,
+		webhookConfig:   webhookConfig,
+		adminConfig:     adminConfig,
+		metricsConfig:   metricsConfig,
 	}, nil
 }
 
@@ -260,17 +415,21 @@ const (
 	DbHostName     = "host"
 	DbPortName     = "port"
 	DbNameName     = "name"
+	DbNamespace    = "namespace"
 	DbName         = "db"
 )
 
 // DbConfig struct
 // Database connectivity details
+// Optional namespace used to prefix collection names
+// allowing multiple staychains to share a single database
 type DbConfig struct {
-	User     string
-	Password string
-	Host     string
-	Port     string
-	Name     string
+	User      string
+	Password  string
+	Host      string
+	Port      string
+	Name      string
+	Namespace string
 }
 
 // Return DbConfig from conf options
@@ -305,12 +464,15 @@ func GetDbConfig(conf []byte) (DbConfig, error) {
 		return DbConfig{}, nameErr
 	}
 
+	namespace := TryGetParamFromConf(DbName, DbNamespace, conf)
+
 	return DbConfig{
-		User:     user,
-		Password: password,
-		Host:     host,
-		Port:     port,
-		Name:     name,
+		User:      user,
+		Password:  password,
+		Host:      host,
+		Port:      port,
+		Name:      name,
+		Namespace: namespace,
 	}, nil
 }
 
@@ -320,14 +482,49 @@ const (
 	FeesMinFeeName       = "minFee"
 	FeesMaxFeeName       = "maxFee"
 	FeesFeeIncrementName = "feeIncrement"
+	FeesBumpStrategyName = "bumpStrategy"
+	FeesEstimatorName    = "estimator"
+	FeesEstimatorUrlName = "estimatorUrl"
+	FeesConfTargetName   = "confTarget"
+	FeesStaticFeeName    = "staticFee"
+
+	FeesBumpPolicyName          = "bumpPolicy"
+	FeesBumpFactorName          = "bumpFactor"
+	FeesBumpConfTargetName      = "bumpConfTarget"
+	FeesBumpDeadlineMinutesName = "bumpDeadlineMinutes"
+
+	FeesMonthlyBudgetName   = "monthlyBudget"
+	FeesRunwayAlertDaysName = "runwayAlertDays"
 )
 
 // FeeConfig struct
 // Configuration on fee limits for attestation service
+// and the strategy used for bumping unconfirmed attestation fees
+// Estimators set the fee estimators used, combined by their median
+// if several are set, and the confirmation target of estimates
+// BumpPolicy sets how fees are bumped, with the factor, target and
+// deadline options of the multiply, target and deadline policies
+// MonthlyBudget sets the fees in satoshis attestations can spend
+// each month before attestation frequency is reduced
+// RunwayAlertDays sets the days of staychain funds runway below which
+// escalating low funds alerts are raised
 type FeesConfig struct {
 	MinFee       int
 	MaxFee       int
 	FeeIncrement int
+	BumpStrategy string
+	Estimators   []string
+	EstimatorUrl string
+	ConfTarget   int
+	StaticFee    int
+
+	BumpPolicy          string
+	BumpFactor          float64
+	BumpConfTarget      int
+	BumpDeadlineMinutes int
+
+	MonthlyBudget   int
+	RunwayAlertDays []int
 }
 
 // Return FeeConfig from conf options
@@ -364,10 +561,99 @@ func GetFeesConfig(conf []byte) FeesConfig {
 		feeIncrement = feeIncrementInt
 	}
 
+	bumpStrategy := TryGetParamFromConf(FeesName, FeesBumpStrategyName, conf)
+
+	var estimators []string
+	estimatorStr := TryGetParamFromConf(FeesName, FeesEstimatorName, conf)
+	if estimatorStr != "" {
+		for _, estimator := range strings.Split(estimatorStr, ",") {
+			estimators = append(estimators, strings.TrimSpace(estimator))
+		}
+	}
+
+	confTargetStr := TryGetParamFromConf(FeesName, FeesConfTargetName, conf)
+	var confTarget int
+	confTargetInt, confTargetErr := strconv.Atoi(confTargetStr)
+	if confTargetErr != nil {
+		confTarget = -1
+	} else {
+		confTarget = confTargetInt
+	}
+
+	staticFeeStr := TryGetParamFromConf(FeesName, FeesStaticFeeName, conf)
+	var staticFee int
+	staticFeeInt, staticFeeErr := strconv.Atoi(staticFeeStr)
+	if staticFeeErr != nil {
+		staticFee = -1
+	} else {
+		staticFee = staticFeeInt
+	}
+
+	bumpFactorStr := TryGetParamFromConf(FeesName, FeesBumpFactorName, conf)
+	var bumpFactor float64
+	bumpFactorFloat, bumpFactorErr := strconv.ParseFloat(bumpFactorStr, 64)
+	if bumpFactorErr != nil {
+		bumpFactor = -1
+	} else {
+		bumpFactor = bumpFactorFloat
+	}
+
+	bumpConfTargetStr := TryGetParamFromConf(FeesName, FeesBumpConfTargetName, conf)
+	var bumpConfTarget int
+	bumpConfTargetInt, bumpConfTargetErr := strconv.Atoi(bumpConfTargetStr)
+	if bumpConfTargetErr != nil {
+		bumpConfTarget = -1
+	} else {
+		bumpConfTarget = bumpConfTargetInt
+	}
+
+	bumpDeadlineStr := TryGetParamFromConf(FeesName, FeesBumpDeadlineMinutesName, conf)
+	var bumpDeadline int
+	bumpDeadlineInt, bumpDeadlineErr := strconv.Atoi(bumpDeadlineStr)
+	if bumpDeadlineErr != nil {
+		bumpDeadline = -1
+	} else {
+		bumpDeadline = bumpDeadlineInt
+	}
+
+	monthlyBudgetStr := TryGetParamFromConf(FeesName, FeesMonthlyBudgetName, conf)
+	var monthlyBudget int
+	monthlyBudgetInt, monthlyBudgetErr := strconv.Atoi(monthlyBudgetStr)
+	if monthlyBudgetErr != nil {
+		monthlyBudget = -1
+	} else {
+		monthlyBudget = monthlyBudgetInt
+	}
+
+	var runwayAlertDays []int
+	runwayAlertDaysStr := TryGetParamFromConf(FeesName, FeesRunwayAlertDaysName, conf)
+	if runwayAlertDaysStr != "" {
+		for _, daysStr := range strings.Split(runwayAlertDaysStr, ",") {
+			days, daysErr := strconv.Atoi(strings.TrimSpace(daysStr))
+			if daysErr != nil {
+				days = -1
+			}
+			runwayAlertDays = append(runwayAlertDays, days)
+		}
+	}
+
 	return FeesConfig{
 		MinFee:       minFee,
 		MaxFee:       maxFee,
 		FeeIncrement: feeIncrement,
+		BumpStrategy: bumpStrategy,
+		Estimators:   estimators,
+		EstimatorUrl: TryGetParamFromConf(FeesName, FeesEstimatorUrlName, conf),
+		ConfTarget:   confTarget,
+		StaticFee:    staticFee,
+
+		BumpPolicy:          TryGetParamFromConf(FeesName, FeesBumpPolicyName, conf),
+		BumpFactor:          bumpFactor,
+		BumpConfTarget:      bumpConfTarget,
+		BumpDeadlineMinutes: bumpDeadline,
+
+		MonthlyBudget:   monthlyBudget,
+		RunwayAlertDays: runwayAlertDays,
 	}
 }
 
@@ -376,6 +662,9 @@ const (
 	TimingName                         = "timing"
 	TimingNewAttestationMinutesName    = "newAttestationMinutes"
 	TimingHandleUnconfirmedMinutesName = "handleUnconfirmedMinutes"
+	TimingMinAttestationMinutesName    = "minAttestationMinutes"
+	TimingMaxAttestationMinutesName    = "maxAttestationMinutes"
+	TimingBudgetAttestationMinutesName = "budgetAttestationMinutes"
 )
 
 // Timing config struct
@@ -383,6 +672,9 @@ const (
 type TimingConfig struct {
 	NewAttestationMinutes    int
 	HandleUnconfirmedMinutes int
+	MinAttestationMinutes    int
+	MaxAttestationMinutes    int
+	BudgetAttestationMinutes int
 }
 
 // Return TimingConfig from conf options
@@ -406,35 +698,291 @@ func GetTimingConfig(conf []byte) TimingConfig {
 		uncMin = uncMinInt
 	}
 
+	minAttStr := TryGetParamFromConf(TimingName, TimingMinAttestationMinutesName, conf)
+	var minAtt int
+	minAttInt, minAttIntErr := strconv.Atoi(minAttStr)
+	if minAttIntErr != nil {
+		minAtt = -1
+	} else {
+		minAtt = minAttInt
+	}
+
+	maxAttStr := TryGetParamFromConf(TimingName, TimingMaxAttestationMinutesName, conf)
+	var maxAtt int
+	maxAttInt, maxAttIntErr := strconv.Atoi(maxAttStr)
+	if maxAttIntErr != nil {
+		maxAtt = -1
+	} else {
+		maxAtt = maxAttInt
+	}
+
+	budgetAttStr := TryGetParamFromConf(TimingName, TimingBudgetAttestationMinutesName, conf)
+	var budgetAtt int
+	budgetAttInt, budgetAttIntErr := strconv.Atoi(budgetAttStr)
+	if budgetAttIntErr != nil {
+		budgetAtt = -1
+	} else {
+		budgetAtt = budgetAttInt
+	}
+
 	return TimingConfig{
 		NewAttestationMinutes:    attMin,
 		HandleUnconfirmedMinutes: uncMin,
+		MinAttestationMinutes:    minAtt,
+		MaxAttestationMinutes:    maxAtt,
+		BudgetAttestationMinutes: budgetAtt,
 	}
 }
 
 // signer config parameter names
 const (
-	Signer = "signer"
-	Url    = "url"
+	Signer                   = "signer"
+	Url                      = "url"
+	SignerUrlsName           = "urls"
+	SignerTimeoutSecondsName = "timeoutSeconds"
+	SignerRetriesName        = "retries"
+	SignerRetryBaseMsName    = "retryBaseMillis"
+	SignerProtocolName       = "protocol"
+	SignerTlsCertName        = "tlsCert"
+	SignerTlsKeyName         = "tlsKey"
+	SignerTlsCaName          = "tlsCa"
+	SignerAuthSecretName     = "authSecret"
+	SignerAuthKeyName        = "authKey"
+	SignerAuthPubkeysName    = "authPubkeys"
+	SignerMusig2PubkeysName  = "musig2Pubkeys"
+	SignerSessionFileName    = "sessionFile"
+	SignerKeystoreName       = "keystore"
+	SignerKeystorePassName   = "keystorePassFile"
+	SignerGrpcHostName       = "grpcHost"
+)
+
+// signer config error consts
+const (
+	ErrorSignerKeystoreKeys = "initPK and topupPK not allowed in config when using a signer keystore"
 )
 
 // Signer config struct
 // Configuration on communication between service and signers
-// Configure host addresses and zmq TOPIC config
+// Configure signer url and request timeout and retry schedule
+// Multisig staychains request signatures from each of the signer urls
+// Protocol sets the signer request format, i.e. sighashes or psbt
+// Auth sets the signer channel authentication
+// Musig2 signers are set with the pubkey of each signer url and
+// a file that the signing session is stored in between rounds
+// Keystore sets an encrypted keystore file for in-process signing
+// GrpcHost sets the host that signers connect to for streaming signing
 type SignerConfig struct {
-	Url string
+	Url             string
+	Urls            []string
+	TimeoutSeconds  int
+	Retries         int
+	RetryBaseMillis int
+	Protocol        string
+	Auth            SignerAuthConfig
+	Musig2Pubkeys   []string
+	SessionFile     string
+	Keystore        SignerKeystoreConfig
+	GrpcHost        string
+}
+
+// Signer auth config struct
+// Client certificate, key and CA certificate files for mTLS
+// Requests and responses are signed with either a shared HMAC
+// secret or an ECDSA key, with responses verified against the
+// pubkey of each signer in the order of the signer urls
+type SignerAuthConfig struct {
+	TlsCert string
+	TlsKey  string
+	TlsCa   string
+	Secret  string
+	Key     string
+	Pubkeys []string
+}
+
+// Signer keystore config struct
+// Keystore file with the base, chaincode and topup keys encrypted
+// under a passphrase, which is read from the passphrase file if
+// set, e.g. a mounted secret, or prompted for at startup otherwise
+type SignerKeystoreConfig struct {
+	File     string
+	PassFile string
 }
 
 // Return SignerConfig from conf options
+// Either a single signer url, a list of signer urls, a keystore or a grpc host is required
 func GetSignerConfig(conf []byte) (SignerConfig, error) {
-	_, signersErr := GetParamFromConf(Signer, Url, conf)
-	if signersErr != nil {
-		return SignerConfig{}, signersErr
+	var urls []string
+	urlsStr := TryGetParamFromConf(Signer, SignerUrlsName, conf)
+	for _, url := range strings.Split(urlsStr, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+
+	keystore := TryGetParamFromConf(Signer, SignerKeystoreName, conf)
+	grpcHost := TryGetParamFromConf(Signer, SignerGrpcHostName, conf)
+	if len(urls) == 0 && keystore == "" && grpcHost == "" {
+		_, signersErr := GetParamFromConf(Signer, Url, conf)
+		if signersErr != nil {
+			return SignerConfig{}, signersErr
+		}
 	}
 
 	url := TryGetParamFromConf(Signer, Url, conf)
 
+	timeoutStr := TryGetParamFromConf(Signer, SignerTimeoutSecondsName, conf)
+	timeout, timeoutErr := strconv.Atoi(timeoutStr)
+	if timeoutErr != nil {
+		timeout = -1
+	}
+
+	retriesStr := TryGetParamFromConf(Signer, SignerRetriesName, conf)
+	retries, retriesErr := strconv.Atoi(retriesStr)
+	if retriesErr != nil {
+		retries = -1
+	}
+
+	retryBaseStr := TryGetParamFromConf(Signer, SignerRetryBaseMsName, conf)
+	retryBase, retryBaseErr := strconv.Atoi(retryBaseStr)
+	if retryBaseErr != nil {
+		retryBase = -1
+	}
+
+	protocol := TryGetParamFromConf(Signer, SignerProtocolName, conf)
+
+	var pubkeys []string
+	pubkeysStr := TryGetParamFromConf(Signer, SignerAuthPubkeysName, conf)
+	for _, pubkey := range strings.Split(pubkeysStr, ",") {
+		if pubkey = strings.TrimSpace(pubkey); pubkey != "" {
+			pubkeys = append(pubkeys, pubkey)
+		}
+	}
+
+	var musig2Pubkeys []string
+	musig2PubkeysStr := TryGetParamFromConf(Signer, SignerMusig2PubkeysName, conf)
+	for _, pubkey := range strings.Split(musig2PubkeysStr, ",") {
+		if pubkey = strings.TrimSpace(pubkey); pubkey != "" {
+			musig2Pubkeys = append(musig2Pubkeys, pubkey)
+		}
+	}
+
 	return SignerConfig{
-		Url: url,
+		Url:             url,
+		Urls:            urls,
+		TimeoutSeconds:  timeout,
+		Retries:         retries,
+		RetryBaseMillis: retryBase,
+		Protocol:        protocol,
+		Auth: SignerAuthConfig{
+			TlsCert: TryGetParamFromConf(Signer, SignerTlsCertName, conf),
+			TlsKey:  TryGetParamFromConf(Signer, SignerTlsKeyName, conf),
+			TlsCa:   TryGetParamFromConf(Signer, SignerTlsCaName, conf),
+			Secret:  TryGetParamFromConf(Signer, SignerAuthSecretName, conf),
+			Key:     TryGetParamFromConf(Signer, SignerAuthKeyName, conf),
+			Pubkeys: pubkeys,
+		},
+		Musig2Pubkeys: musig2Pubkeys,
+		SessionFile:   TryGetParamFromConf(Signer, SignerSessionFileName, conf),
+		Keystore: SignerKeystoreConfig{
+			File:     keystore,
+			PassFile: TryGetParamFromConf(Signer, SignerKeystorePassName, conf),
+		},
+		GrpcHost: grpcHost,
 	}, nil
 }
+
+// webhook config parameter names
+const (
+	WebhookName            = "webhook"
+	WebhookUrlsName        = "urls"
+	WebhookSecretName      = "secret"
+	WebhookMaxAttemptsName = "maxAttempts"
+)
+
+// Webhook config struct
+// Configuration on webhook delivery of attestation service events
+// Events are posted to each url and signed using the secret
+type WebhookConfig struct {
+	Urls        []string
+	Secret      string
+	MaxAttempts int
+}
+
+// Return WebhookConfig from conf options
+// All Webhook Config fields are optional
+func GetWebhookConfig(conf []byte) WebhookConfig {
+	var urls []string
+	urlsStr := TryGetParamFromConf(WebhookName, WebhookUrlsName, conf)
+	for _, url := range strings.Split(urlsStr, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+
+	secret := TryGetParamFromConf(WebhookName, WebhookSecretName, conf)
+
+	maxAttemptsStr := TryGetParamFromConf(WebhookName, WebhookMaxAttemptsName, conf)
+	var maxAttempts int
+	maxAttemptsInt, maxAttemptsErr := strconv.Atoi(maxAttemptsStr)
+	if maxAttemptsErr != nil {
+		maxAttempts = -1
+	} else {
+		maxAttempts = maxAttemptsInt
+	}
+
+	return WebhookConfig{
+		Urls:        urls,
+		Secret:      secret,
+		MaxAttempts: maxAttempts,
+	}
+}
+
+// admin config parameter names
+const (
+	AdminName      = "admin"
+	AdminHostName  = "host"
+	AdminTokenName = "token"
+)
+
+// Admin config struct
+// Configuration on the operator admin api of the attestation service
+// The api is only enabled if both host and token are set
+type AdminConfig struct {
+	Host  string
+	Token string
+}
+
+// Return AdminConfig from conf options
+// All Admin Config fields are optional
+func GetAdminConfig(conf []byte) AdminConfig {
+	host := TryGetParamFromConf(AdminName, AdminHostName, conf)
+	token := TryGetParamFromConf(AdminName, AdminTokenName, conf)
+
+	return AdminConfig{
+		Host:  host,
+		Token: token,
+	}
+}
+
+// metrics config parameter names
+const (
+	MetricsName     = "metrics"
+	MetricsHostName = "host"
+)
+
+// Metrics config struct
+// Configuration on the prometheus metrics endpoint
+// The endpoint is only enabled if host is set
+type MetricsConfig struct {
+	Host string
+}
+
+// Return MetricsConfig from conf options
+// All Metrics Config fields are optional
+func GetMetricsConfig(conf []byte) MetricsConfig {
+	host := TryGetParamFromConf(MetricsName, MetricsHostName, conf)
+
+	return MetricsConfig{
+		Host: host,
+	}
+}
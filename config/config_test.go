@@ -241,7 +241,12 @@ func TestConfigStaychain(t *testing.T) {
             "initPK": "cQca2KvrBnJJUCYa2tD4RXhiQshWLNMSK2A96ZKWo1SZkHhh3YLz",
             "topupAddress": "2MxBi6eodnuoVCw8McGrf1nuoVhastqoBXB",
             "topupPK": "cQca2KvrBnJJUCYa2tD4RXhiQshWLNMSK2A96ZKWo1SZkHhh3YLa",
-            "regtest": "1"
+            "regtest": "1",
+            "confirmationDepth": "6",
+            "dryRun": "1",
+            "taproot": "1",
+            "initScript": "512103e52cf15e0a5cf6612314f077bb65cf9a6596b76c0fcb34b682f673a8314c7b332102f3a78a7bd6cf01c56312e7e828bef74134dfb109e59afd088526212d87518d7652ae",
+            "initChaincodes": "14df7ece79e83f0f479a37832d770294014edc6884b0c8bfa2e0aaf51fb00229, 0a090f710e47968aee906804f211cf10cde9a11e14908ca0f78cc55dd190ceaa"
         }
     }
     `)
@@ -255,6 +260,12 @@ func TestConfigStaychain(t *testing.T) {
 	assert.Equal(t, "2MxBi6eodnuoVCw8McGrf1nuoVhastqoBXB", config.TopupAddress())
 	assert.Equal(t, "cQca2KvrBnJJUCYa2tD4RXhiQshWLNMSK2A96ZKWo1SZkHhh3YLa", config.TopupPK())
 	assert.Equal(t, true, config.Regtest())
+	assert.Equal(t, 6, config.ConfirmationDepth())
+	assert.Equal(t, true, config.DryRun())
+	assert.Equal(t, true, config.Taproot())
+	assert.Equal(t, "512103e52cf15e0a5cf6612314f077bb65cf9a6596b76c0fcb34b682f673a8314c7b332102f3a78a7bd6cf01c56312e7e828bef74134dfb109e59afd088526212d87518d7652ae", config.InitScript())
+	assert.Equal(t, []string{"14df7ece79e83f0f479a37832d770294014edc6884b0c8bfa2e0aaf51fb00229",
+		"0a090f710e47968aee906804f211cf10cde9a11e14908ca0f78cc55dd190ceaa"}, config.InitChaincodes())
 
 	config.SetRegtest(false)
 	assert.Equal(t, false, config.Regtest())
@@ -277,6 +288,21 @@ func TestConfigStaychain(t *testing.T) {
 	config.SetInitChaincode("chaincode3")
 	assert.Equal(t, "chaincode3", config.InitChaincode())
 
+	config.SetConfirmationDepth(2)
+	assert.Equal(t, 2, config.ConfirmationDepth())
+
+	config.SetDryRun(false)
+	assert.Equal(t, false, config.DryRun())
+
+	config.SetTaproot(false)
+	assert.Equal(t, false, config.Taproot())
+
+	config.SetInitScript("script")
+	assert.Equal(t, "script", config.InitScript())
+
+	config.SetInitChaincodes([]string{"chaincode4"})
+	assert.Equal(t, []string{"chaincode4"}, config.InitChaincodes())
+
 	testConf = []byte(`
     {
         "main": {
@@ -295,6 +321,11 @@ func TestConfigStaychain(t *testing.T) {
 	assert.Equal(t, "", config.InitTx())
 	assert.Equal(t, "", config.TopupAddress())
 	assert.Equal(t, false, config.Regtest())
+	assert.Equal(t, -1, config.ConfirmationDepth())
+	assert.Equal(t, false, config.DryRun())
+	assert.Equal(t, false, config.Taproot())
+	assert.Equal(t, "", config.InitScript())
+	assert.Equal(t, []string(nil), config.InitChaincodes())
 }
 
 // Test config for Optional fees parameters
@@ -315,7 +346,7 @@ func TestConfigFees(t *testing.T) {
     `)
 	config, configErr = NewConfig(testConf)
 	assert.Equal(t, nil, configErr)
-	assert.Equal(t, FeesConfig{-1, -1, -1}, config.FeesConfig())
+	assert.Equal(t, FeesConfig{-1, -1, -1, "", nil, "", -1, -1, "", -1, -1, -1, -1, nil}, config.FeesConfig())
 
 	testConf = []byte(`
     {
@@ -332,7 +363,7 @@ func TestConfigFees(t *testing.T) {
     `)
 	config, configErr = NewConfig(testConf)
 	assert.Equal(t, nil, configErr)
-	assert.Equal(t, FeesConfig{1, -1, -1}, config.FeesConfig())
+	assert.Equal(t, FeesConfig{1, -1, -1, "", nil, "", -1, -1, "", -1, -1, -1, -1, nil}, config.FeesConfig())
 
 	testConf = []byte(`
     {
@@ -349,7 +380,7 @@ func TestConfigFees(t *testing.T) {
     `)
 	config, configErr = NewConfig(testConf)
 	assert.Equal(t, nil, configErr)
-	assert.Equal(t, FeesConfig{-1, -1, -1}, config.FeesConfig())
+	assert.Equal(t, FeesConfig{-1, -1, -1, "", nil, "", -1, -1, "", -1, -1, -1, -1, nil}, config.FeesConfig())
 
 	testConf = []byte(`
     {
@@ -363,13 +394,58 @@ func TestConfigFees(t *testing.T) {
             "maxFee": "10",
             "minFee": "5",
             "feeIncrement": "11",
+            "bumpStrategy": "cpfp",
             "something-else": "nice-value"
         }
     }
     `)
 	config, configErr = NewConfig(testConf)
 	assert.Equal(t, nil, configErr)
-	assert.Equal(t, FeesConfig{5, 10, 11}, config.FeesConfig())
+	assert.Equal(t, FeesConfig{5, 10, 11, "cpfp", nil, "", -1, -1, "", -1, -1, -1, -1, nil}, config.FeesConfig())
+
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "localhost:18443",
+            "rpcuser": "user",
+            "rpcpass": "pass",
+            "chain": "regtest"
+        },
+        "fees": {
+            "estimator": "bitcoind, mempool,static",
+            "estimatorUrl": "http://localhost:8999/api/v1/fees/recommended",
+            "confTarget": "3",
+            "staticFee": "12"
+        }
+    }
+    `)
+	config, configErr = NewConfig(testConf)
+	assert.Equal(t, nil, configErr)
+	assert.Equal(t, FeesConfig{-1, -1, -1, "", []string{"bitcoind", "mempool", "static"},
+		"http://localhost:8999/api/v1/fees/recommended", 3, 12, "", -1, -1, -1, -1, nil}, config.FeesConfig())
+
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "localhost:18443",
+            "rpcuser": "user",
+            "rpcpass": "pass",
+            "chain": "regtest"
+        },
+        "fees": {
+            "bumpPolicy": "deadline",
+            "bumpFactor": "1.25",
+            "bumpConfTarget": "2",
+            "bumpDeadlineMinutes": "180",
+            "monthlyBudget": "2000000",
+            "runwayAlertDays": "30, 14,x"
+        }
+    }
+    `)
+	config, configErr = NewConfig(testConf)
+	assert.Equal(t, nil, configErr)
+	assert.Equal(t, FeesConfig{-1, -1, -1, "", nil, "", -1, -1, "deadline", 1.25, 2, 180, 2000000,
+		[]int{30, 14, -1}}, config.FeesConfig())
 }
 
 // Test config for Optional timing parameters
@@ -390,7 +466,7 @@ func TestConfigTiming(t *testing.T) {
     `)
 	config, configErr = NewConfig(testConf)
 	assert.Equal(t, nil, configErr)
-	assert.Equal(t, TimingConfig{-1, -1}, config.TimingConfig())
+	assert.Equal(t, TimingConfig{-1, -1, -1, -1, -1}, config.TimingConfig())
 
 	testConf = []byte(`
     {
@@ -407,7 +483,7 @@ func TestConfigTiming(t *testing.T) {
     `)
 	config, configErr = NewConfig(testConf)
 	assert.Equal(t, nil, configErr)
-	assert.Equal(t, TimingConfig{0, -1}, config.TimingConfig())
+	assert.Equal(t, TimingConfig{0, -1, -1, -1, -1}, config.TimingConfig())
 
 	testConf = []byte(`
     {
@@ -424,7 +500,7 @@ func TestConfigTiming(t *testing.T) {
     `)
 	config, configErr = NewConfig(testConf)
 	assert.Equal(t, nil, configErr)
-	assert.Equal(t, TimingConfig{-1, 0}, config.TimingConfig())
+	assert.Equal(t, TimingConfig{-1, 0, -1, -1, -1}, config.TimingConfig())
 
 	testConf = []byte(`
     {
@@ -442,7 +518,26 @@ func TestConfigTiming(t *testing.T) {
     `)
 	config, configErr = NewConfig(testConf)
 	assert.Equal(t, nil, configErr)
-	assert.Equal(t, TimingConfig{10, 60}, config.TimingConfig())
+	assert.Equal(t, TimingConfig{10, 60, -1, -1, -1}, config.TimingConfig())
+
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "localhost:18443",
+            "rpcuser": "user",
+            "rpcpass": "pass",
+            "chain": "regtest"
+        },
+        "timing": {
+            "minAttestationMinutes": "5",
+            "maxAttestationMinutes": "1440",
+            "budgetAttestationMinutes": "240"
+        }
+    }
+    `)
+	config, configErr = NewConfig(testConf)
+	assert.Equal(t, nil, configErr)
+	assert.Equal(t, TimingConfig{-1, -1, 5, 1440, 240}, config.TimingConfig())
 }
 
 // Test config for Optional signer parameters
@@ -480,4 +575,259 @@ func TestConfigSigner(t *testing.T) {
 	config, configErr = NewConfig(testConf)
 	assert.Equal(t, nil, configErr)
 	assert.Equal(t, "host", config.SignerConfig().Url)
+	assert.Equal(t, SignerConfig{"host", nil, -1, -1, -1, "", SignerAuthConfig{}, nil, "", SignerKeystoreConfig{}, ""}, config.SignerConfig())
+
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": ""
+        },
+        "signer": {
+            "url": "host",
+            "timeoutSeconds": "10",
+            "retries": "5",
+            "retryBaseMillis": "500",
+            "protocol": "psbt"
+        }
+    }
+    `)
+	config, configErr = NewConfig(testConf)
+	assert.Equal(t, nil, configErr)
+	assert.Equal(t, SignerConfig{"host", nil, 10, 5, 500, "psbt", SignerAuthConfig{}, nil, "", SignerKeystoreConfig{}, ""}, config.SignerConfig())
+
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": ""
+        },
+        "signer": {
+            "urls": "http://host0/sign, http://host1/sign,http://host2/sign"
+        }
+    }
+    `)
+	config, configErr = NewConfig(testConf)
+	assert.Equal(t, nil, configErr)
+	assert.Equal(t, SignerConfig{"", []string{"http://host0/sign", "http://host1/sign", "http://host2/sign"}, -1, -1, -1, "", SignerAuthConfig{}, nil, "", SignerKeystoreConfig{}, ""},
+		config.SignerConfig())
+
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": ""
+        },
+        "signer": {
+            "urls": "http://host0/sign,http://host1/sign",
+            "tlsCert": "client.crt",
+            "tlsKey": "client.key",
+            "tlsCa": "ca.crt",
+            "authKey": "aa",
+            "authPubkeys": "02bb, 02cc"
+        }
+    }
+    `)
+	config, configErr = NewConfig(testConf)
+	assert.Equal(t, nil, configErr)
+	assert.Equal(t, SignerAuthConfig{"client.crt", "client.key", "ca.crt", "", "aa", []string{"02bb", "02cc"}},
+		config.SignerConfig().Auth)
+
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": ""
+        },
+        "signer": {
+            "urls": "http://host0/sign,http://host1/sign",
+            "protocol": "musig2",
+            "musig2Pubkeys": "02bb, 02cc",
+            "sessionFile": "musig2session.json"
+        }
+    }
+    `)
+	config, configErr = NewConfig(testConf)
+	assert.Equal(t, nil, configErr)
+	assert.Equal(t, "musig2", config.SignerConfig().Protocol)
+	assert.Equal(t, []string{"02bb", "02cc"}, config.SignerConfig().Musig2Pubkeys)
+	assert.Equal(t, "musig2session.json", config.SignerConfig().SessionFile)
+
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": ""
+        },
+        "signer": {
+            "keystore": "/run/secrets/keystore.json",
+            "keystorePassFile": "/run/secrets/passphrase"
+        }
+    }
+    `)
+	config, configErr = NewConfig(testConf)
+	assert.Equal(t, nil, configErr)
+	assert.Equal(t, SignerKeystoreConfig{"/run/secrets/keystore.json", "/run/secrets/passphrase"},
+		config.SignerConfig().Keystore)
+
+	// keys not allowed in config with keystore
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": ""
+        },
+        "staychain": {
+            "topupPK": "cQca2KvrBnJJUCYa2tD4RXhiQshWLNMSK2A96ZKWo1SZkHhh3YLz"
+        },
+        "signer": {
+            "keystore": "/run/secrets/keystore.json"
+        }
+    }
+    `)
+	_, configErr = NewConfig(testConf)
+	assert.Equal(t, errors.New(ErrorSignerKeystoreKeys), configErr)
+
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": ""
+        },
+        "signer": {
+            "grpcHost": "0.0.0.0:5050",
+            "timeoutSeconds": "30"
+        }
+    }
+    `)
+	config, configErr = NewConfig(testConf)
+	assert.Equal(t, nil, configErr)
+	assert.Equal(t, SignerConfig{"", nil, 30, -1, -1, "", SignerAuthConfig{}, nil, "", SignerKeystoreConfig{}, "0.0.0.0:5050"},
+		config.SignerConfig())
+}
+
+// Test config for Optional webhook parameters
+func TestConfigWebhook(t *testing.T) {
+	var configErr error
+	var config *Config
+	var testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": ""
+        }
+    }
+    `)
+	config, configErr = NewConfig(testConf)
+	assert.Equal(t, nil, configErr)
+	assert.Equal(t, WebhookConfig{nil, "", -1}, config.WebhookConfig())
+
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": ""
+        },
+        "webhook": {
+            "urls": "https://host0/events, https://host1/events",
+            "secret": "secret",
+            "maxAttempts": "5"
+        }
+    }
+    `)
+	config, configErr = NewConfig(testConf)
+	assert.Equal(t, nil, configErr)
+	assert.Equal(t, WebhookConfig{[]string{"https://host0/events", "https://host1/events"}, "secret", 5},
+		config.WebhookConfig())
+}
+
+// Test config for Optional admin parameters
+func TestConfigAdmin(t *testing.T) {
+	var configErr error
+	var config *Config
+	var testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": ""
+        }
+    }
+    `)
+	config, configErr = NewConfig(testConf)
+	assert.Equal(t, nil, configErr)
+	assert.Equal(t, AdminConfig{"", ""}, config.AdminConfig())
+
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": ""
+        },
+        "admin": {
+            "host": "127.0.0.1:8000",
+            "token": "token"
+        }
+    }
+    `)
+	config, configErr = NewConfig(testConf)
+	assert.Equal(t, nil, configErr)
+	assert.Equal(t, AdminConfig{"127.0.0.1:8000", "token"}, config.AdminConfig())
+}
+
+// Test config for Optional metrics parameters
+func TestConfigMetrics(t *testing.T) {
+	var configErr error
+	var config *Config
+	var testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": ""
+        }
+    }
+    `)
+	config, configErr = NewConfig(testConf)
+	assert.Equal(t, nil, configErr)
+	assert.Equal(t, MetricsConfig{""}, config.MetricsConfig())
+
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": ""
+        },
+        "metrics": {
+            "host": "127.0.0.1:9100"
+        }
+    }
+    `)
+	config, configErr = NewConfig(testConf)
+	assert.Equal(t, nil, configErr)
+	assert.Equal(t, MetricsConfig{"127.0.0.1:9100"}, config.MetricsConfig())
 }
@@ -23,12 +23,12 @@ type ClientCfg map[string]interface{}
 func getCfg(name string, conf []byte) (ClientCfg, error) {
 	file := bytes.NewReader(conf)
 	dec := json.NewDecoder(file)
-	var j map[string]map[string]interface{}
+	var j map[string]interface{}
 	err := dec.Decode(&j)
 	if err != nil {
 		return ClientCfg{}, errors.New(ErroConfigNameNotFound)
 	}
-	val, ok := j[name]
+	val, ok := j[name].(map[string]interface{})
 	if !ok {
 		return ClientCfg{}, errors.New(ErroConfigNameNotFound)
 	}
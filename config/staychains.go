@@ -0,0 +1,175 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Handle configuration of multiple independent staychains in a single conf file
+//
+// A "staychains" list can be included in the conf file. Each entry has a
+// unique "name" and any of the top level config categories (main, staychain,
+// signer, db, fees, timing). Categories of an entry are merged on top of the
+// top level categories, so that shared options only need to be set once.
+// The metrics endpoint is shared by all staychains and can only be set at
+// the top level.
+//
+// {
+//     "main": {...},
+//     "db": {...},
+//     "staychains": [
+//         {"name": "mainnet", "staychain": {...}, "signer": {...}},
+//         {"name": "testnet", "main": {...}, "staychain": {...}, "db": {"namespace": "testnet"}}
+//     ]
+// }
+
+// staychains config parameter names
+const (
+	StaychainsName    = "staychains"
+	StaychainNameName = "name"
+)
+
+// error consts
+const (
+	ErrorStaychainsInvalid        = "invalid staychains config list"
+	ErrorStaychainNameMissing     = "staychain name missing"
+	ErrorStaychainNameDuplicate   = "duplicate staychain name"
+	ErrorStaychainDbNamespaceUsed = "staychain db namespace already used"
+	ErrorStaychainMetrics         = "metrics config only supported at top level"
+)
+
+// Return a Config instance for each staychain in conf options
+// If no staychains list is found a single Config is returned
+// using the top level categories, as returned by NewConfig
+func NewConfigs(customConf ...[]byte) ([]*Config, error) {
+	var conf []byte
+	if len(customConf) > 0 { //custom config provided
+		conf = customConf[0]
+	} else {
+		var confErr error
+		conf, confErr = GetConfFile(os.Getenv("GOPATH") + ConfPath)
+		if confErr != nil {
+			return nil, confErr
+		}
+	}
+
+	staychainConfs, confsErr := getStaychainConfs(conf)
+	if confsErr != nil {
+		return nil, confsErr
+	}
+
+	// single staychain case
+	if staychainConfs == nil {
+		config, configErr := NewConfig(conf)
+		if configErr != nil {
+			return nil, configErr
+		}
+		return []*Config{config}, nil
+	}
+
+	var configs []*Config
+	names := make(map[string]bool)
+	namespaces := make(map[string]bool)
+	for _, staychainConf := range staychainConfs {
+		name := TryGetParamFromConf(StaychainsName, StaychainNameName, staychainConf)
+		if name == "" {
+			return nil, errors.New(ErrorStaychainNameMissing)
+		} else if names[name] {
+			return nil, errors.New(fmt.Sprintf("%s: %s", ErrorStaychainNameDuplicate, name))
+		}
+		names[name] = true
+
+		config, configErr := NewConfig(staychainConf)
+		if configErr != nil {
+			return nil, errors.New(fmt.Sprintf("%s: %s", configErr, name))
+		}
+		config.SetName(name)
+
+		// each staychain requires its own db namespace
+		dbConfig := config.DbConfig()
+		namespace := fmt.Sprintf("%s:%s/%s/%s", dbConfig.Host, dbConfig.Port, dbConfig.Name, dbConfig.Namespace)
+		if namespaces[namespace] {
+			return nil, errors.New(fmt.Sprintf("%s: %s", ErrorStaychainDbNamespaceUsed, name))
+		}
+		namespaces[namespace] = true
+
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+// Return conf bytes for each staychain in the staychains list
+// Staychain categories are merged on top of the top level ones
+// and the staychain name is stored under the staychains category
+// Nil is returned if the conf does not include a staychains list
+func getStaychainConfs(conf []byte) ([][]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(conf))
+	var j map[string]interface{}
+	if err := dec.Decode(&j); err != nil {
+		return nil, nil // let NewConfig handle decoding errors
+	}
+
+	staychainsVal, ok := j[StaychainsName]
+	if !ok {
+		return nil, nil
+	}
+	staychains, ok := staychainsVal.([]interface{})
+	if !ok || len(staychains) == 0 {
+		return nil, errors.New(ErrorStaychainsInvalid)
+	}
+
+	var staychainConfs [][]byte
+	for _, staychainVal := range staychains {
+		staychain, ok := staychainVal.(map[string]interface{})
+		if !ok {
+			return nil, errors.New(ErrorStaychainsInvalid)
+		}
+
+		// copy top level categories
+		merged := make(map[string]interface{})
+		for category, val := range j {
+			if category == StaychainsName {
+				continue
+			}
+			merged[category] = val
+		}
+
+		// merge staychain categories on top of top level categories
+		for category, val := range staychain {
+			if category == StaychainNameName {
+				merged[StaychainsName] = map[string]interface{}{StaychainNameName: val}
+				continue
+			} else if category == MetricsName {
+				return nil, errors.New(ErrorStaychainMetrics)
+			}
+			categoryVal, ok := val.(map[string]interface{})
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("%s: %s", ErrorStaychainsInvalid, category))
+			}
+			mergedCategory := make(map[string]interface{})
+			if topCategoryVal, ok := merged[category].(map[string]interface{}); ok {
+				for key, keyVal := range topCategoryVal {
+					mergedCategory[key] = keyVal
+				}
+			}
+			for key, keyVal := range categoryVal {
+				mergedCategory[key] = keyVal
+			}
+			merged[category] = mergedCategory
+		}
+
+		staychainConf, marshalErr := json.Marshal(merged)
+		if marshalErr != nil {
+			return nil, marshalErr
+		}
+		staychainConfs = append(staychainConfs, staychainConf)
+	}
+	return staychainConfs, nil
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test config for multiple staychains
+func TestConfigStaychains(t *testing.T) {
+	// no staychains list - single config returned
+	var testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": "testnet"
+        },
+        "staychain": {
+            "initTx": "aa"
+        }
+    }
+    `)
+	configs, configsErr := NewConfigs(testConf)
+	assert.Equal(t, nil, configsErr)
+	assert.Equal(t, 1, len(configs))
+	assert.Equal(t, "", configs[0].Name())
+	assert.Equal(t, "aa", configs[0].InitTx())
+
+	// staychains list merged on top level config
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": "main"
+        },
+        "db": {
+            "user": "user",
+            "password": "pass",
+            "host": "localhost",
+            "port": "27017",
+            "name": "mainstay"
+        },
+        "fees": {
+            "minFee": "5",
+            "maxFee": "50"
+        },
+        "staychains": [
+            {
+                "name": "mainnet",
+                "staychain": {
+                    "initTx": "aa"
+                },
+                "signer": {
+                    "url": "host0"
+                }
+            },
+            {
+                "name": "testnet",
+                "main": {
+                    "chain": "testnet"
+                },
+                "staychain": {
+                    "initTx": "bb"
+                },
+                "signer": {
+                    "url": "host1"
+                },
+                "db": {
+                    "namespace": "testnet"
+                },
+                "fees": {
+                    "maxFee": "20"
+                }
+            }
+        ]
+    }
+    `)
+	configs, configsErr = NewConfigs(testConf)
+	assert.Equal(t, nil, configsErr)
+	assert.Equal(t, 2, len(configs))
+
+	assert.Equal(t, "mainnet", configs[0].Name())
+	assert.Equal(t, &chaincfg.MainNetParams, configs[0].MainChainCfg())
+	assert.Equal(t, "aa", configs[0].InitTx())
+	assert.Equal(t, "host0", configs[0].SignerConfig().Url)
+	assert.Equal(t, "", configs[0].DbConfig().Namespace)
+	assert.Equal(t, "mainstay", configs[0].DbConfig().Name)
+	assert.Equal(t, 5, configs[0].FeesConfig().MinFee)
+	assert.Equal(t, 50, configs[0].FeesConfig().MaxFee)
+
+	assert.Equal(t, "testnet", configs[1].Name())
+	assert.Equal(t, &chaincfg.TestNet3Params, configs[1].MainChainCfg())
+	assert.Equal(t, "bb", configs[1].InitTx())
+	assert.Equal(t, "host1", configs[1].SignerConfig().Url)
+	assert.Equal(t, "testnet", configs[1].DbConfig().Namespace)
+	assert.Equal(t, "mainstay", configs[1].DbConfig().Name)
+	assert.Equal(t, 5, configs[1].FeesConfig().MinFee)
+	assert.Equal(t, 20, configs[1].FeesConfig().MaxFee)
+	assert.Equal(t, true, configs[0].MainClient() != configs[1].MainClient())
+
+	// staychains sharing db namespace
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": "main"
+        },
+        "staychains": [
+            {"name": "mainnet"},
+            {"name": "testnet"}
+        ]
+    }
+    `)
+	_, configsErr = NewConfigs(testConf)
+	assert.Equal(t, errors.New(fmt.Sprintf("%s: %s", ErrorStaychainDbNamespaceUsed, "testnet")), configsErr)
+
+	// staychains with duplicate names
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": "main"
+        },
+        "staychains": [
+            {"name": "mainnet"},
+            {"name": "mainnet", "db": {"namespace": "other"}}
+        ]
+    }
+    `)
+	_, configsErr = NewConfigs(testConf)
+	assert.Equal(t, errors.New(fmt.Sprintf("%s: %s", ErrorStaychainNameDuplicate, "mainnet")), configsErr)
+
+	// staychain with missing name
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": "main"
+        },
+        "staychains": [
+            {"staychain": {"initTx": "aa"}}
+        ]
+    }
+    `)
+	_, configsErr = NewConfigs(testConf)
+	assert.Equal(t, errors.New(ErrorStaychainNameMissing), configsErr)
+
+	// invalid staychains list
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": "main"
+        },
+        "staychains": {}
+    }
+    `)
+	_, configsErr = NewConfigs(testConf)
+	assert.Equal(t, errors.New(ErrorStaychainsInvalid), configsErr)
+
+	// metrics config not supported per staychain
+	testConf = []byte(`
+    {
+        "main": {
+            "rpcurl": "",
+            "rpcuser": "",
+            "rpcpass": "",
+            "chain": "main"
+        },
+        "metrics": {"host": "localhost:9090"},
+        "staychains": [
+            {"name": "mainnet"},
+            {"name": "testnet", "metrics": {"host": "localhost:9091"}, "db": {"namespace": "testnet"}}
+        ]
+    }
+    `)
+	_, configsErr = NewConfigs(testConf)
+	assert.Equal(t, errors.New(ErrorStaychainMetrics), configsErr)
+
+	// staychain config error includes staychain name
+	testConf = []byte(`
+    {
+        "staychains": [
+            {"name": "mainnet"}
+        ]
+    }
+    `)
+	_, configsErr = NewConfigs(testConf)
+	assert.Equal(t, errors.New(fmt.Sprintf("%s: %s: %s", ErroConfigNameNotFound, MainChainName, "mainnet")), configsErr)
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted keystore for signer keys
+//
+// Keys are encrypted with AES-256-GCM using a key derived from
+// a passphrase with scrypt. The keystore is stored as json with
+// the kdf parameters, salt, nonce and ciphertext
+
+// error consts
+const (
+	ErrorKeystoreFormat     = "Invalid keystore format"
+	ErrorKeystoreVersion    = "Unsupported keystore version"
+	ErrorKeystoreDecrypt    = "Failed decrypting keystore - wrong passphrase or corrupted file"
+	ErrorKeystoreKeys       = "Invalid keystore keys"
+	ErrorKeystorePassphrase = "Empty keystore passphrase"
+)
+
+// keystore consts
+const (
+	KeystoreVersion = 1
+
+	keystoreScryptN   = 1 << 18
+	keystoreScryptR   = 8
+	keystoreScryptP   = 1
+	keystoreKeyLen    = 32
+	keystoreSaltLen   = 32
+	keystoreKeySize   = 32
+	keystoreNumOfKeys = 3
+)
+
+// Keys stored in the keystore
+// Base private key and chaincode used for tweaking and optional topup private key
+type KeystoreKeys struct {
+	PrivKey      []byte
+	Chaincode    []byte
+	TopupPrivKey []byte
+}
+
+// Zero all key material
+func (k *KeystoreKeys) Zero() {
+	ZeroBytes(k.PrivKey)
+	ZeroBytes(k.Chaincode)
+	ZeroBytes(k.TopupPrivKey)
+}
+
+// Keystore file format
+type keystoreFile struct {
+	Version    int    `json:"version"`
+	ScryptN    int    `json:"scrypt_n"`
+	ScryptR    int    `json:"scrypt_r"`
+	ScryptP    int    `json:"scrypt_p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Overwrite byte slice with zeros
+func ZeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// Encrypt keys with passphrase and return the keystore json
+func EncryptKeystore(keys *KeystoreKeys, passphrase []byte) ([]byte, error) {
+	return encryptKeystore(keys, passphrase, keystoreScryptN)
+}
+
+// Encrypt keys with passphrase and scrypt cost parameter provided
+func encryptKeystore(keys *KeystoreKeys, passphrase []byte, scryptN int) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New(ErrorKeystorePassphrase)
+	}
+	if len(keys.PrivKey) != keystoreKeySize || len(keys.Chaincode) != keystoreKeySize ||
+		(len(keys.TopupPrivKey) != 0 && len(keys.TopupPrivKey) != keystoreKeySize) {
+		return nil, errors.New(ErrorKeystoreKeys)
+	}
+
+	salt := make([]byte, keystoreSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, derivedKey, err := keystoreCipher(passphrase, salt, scryptN, keystoreScryptR, keystoreScryptP)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroBytes(derivedKey)
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, 0, keystoreNumOfKeys*keystoreKeySize)
+	plaintext = append(plaintext, keys.PrivKey...)
+	plaintext = append(plaintext, keys.Chaincode...)
+	plaintext = append(plaintext, keys.TopupPrivKey...)
+	defer ZeroBytes(plaintext)
+
+	return json.Marshal(keystoreFile{
+		Version:    KeystoreVersion,
+		ScryptN:    scryptN,
+		ScryptR:    keystoreScryptR,
+		ScryptP:    keystoreScryptP,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, nil),
+	})
+}
+
+// Decrypt keystore json with passphrase and return the keys
+// Keys should be zeroed by the caller once no longer required
+func DecryptKeystore(data []byte, passphrase []byte) (*KeystoreKeys, error) {
+	var file keystoreFile
+	if jsonErr := json.Unmarshal(data, &file); jsonErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorKeystoreFormat, jsonErr))
+	}
+	if file.Version != KeystoreVersion {
+		return nil, errors.New(fmt.Sprintf("%s %d", ErrorKeystoreVersion, file.Version))
+	}
+
+	gcm, derivedKey, err := keystoreCipher(passphrase, file.Salt, file.ScryptN, file.ScryptR, file.ScryptP)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s %v", ErrorKeystoreFormat, err))
+	}
+	defer ZeroBytes(derivedKey)
+	if len(file.Nonce) != gcm.NonceSize() {
+		return nil, errors.New(ErrorKeystoreFormat)
+	}
+
+	plaintext, openErr := gcm.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if openErr != nil {
+		return nil, errors.New(ErrorKeystoreDecrypt)
+	}
+	if len(plaintext) != 2*keystoreKeySize && len(plaintext) != keystoreNumOfKeys*keystoreKeySize {
+		ZeroBytes(plaintext)
+		return nil, errors.New(ErrorKeystoreKeys)
+	}
+
+	keys := &KeystoreKeys{
+		PrivKey:   plaintext[:keystoreKeySize],
+		Chaincode: plaintext[keystoreKeySize : 2*keystoreKeySize],
+	}
+	if len(plaintext) > 2*keystoreKeySize {
+		keys.TopupPrivKey = plaintext[2*keystoreKeySize:]
+	}
+	return keys, nil
+}
+
+// Return AES-GCM cipher and the scrypt key derived from the passphrase
+func keystoreCipher(passphrase []byte, salt []byte, n, r, p int) (cipher.AEAD, []byte, error) {
+	derivedKey, err := scrypt.Key(passphrase, salt, n, r, p, keystoreKeyLen)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		ZeroBytes(derivedKey)
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		ZeroBytes(derivedKey)
+		return nil, nil, err
+	}
+	return gcm, derivedKey, nil
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test keystore encryption and decryption
+func TestKeystore(t *testing.T) {
+	keys := &KeystoreKeys{
+		PrivKey:      bytes.Repeat([]byte{0x01}, 32),
+		Chaincode:    bytes.Repeat([]byte{0x02}, 32),
+		TopupPrivKey: bytes.Repeat([]byte{0x03}, 32),
+	}
+	passphrase := []byte("passphrase")
+
+	data, err := encryptKeystore(keys, passphrase, 1<<4)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, bytes.Contains(data, keys.PrivKey))
+
+	decrypted, err := DecryptKeystore(data, passphrase)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, keys, decrypted)
+
+	decrypted.Zero()
+	assert.Equal(t, make([]byte, 32), decrypted.PrivKey)
+	assert.Equal(t, make([]byte, 32), decrypted.TopupPrivKey)
+
+	// wrong passphrase
+	_, err = DecryptKeystore(data, []byte("wrong"))
+	assert.Equal(t, errors.New(ErrorKeystoreDecrypt), err)
+
+	// no topup key
+	keys.TopupPrivKey = nil
+	data, err = encryptKeystore(keys, passphrase, 1<<4)
+	assert.Equal(t, nil, err)
+	decrypted, err = DecryptKeystore(data, passphrase)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte(nil), decrypted.TopupPrivKey)
+
+	// invalid keys and passphrase
+	_, err = encryptKeystore(&KeystoreKeys{PrivKey: []byte{1}}, passphrase, 1<<4)
+	assert.Equal(t, errors.New(ErrorKeystoreKeys), err)
+	_, err = encryptKeystore(keys, []byte{}, 1<<4)
+	assert.Equal(t, errors.New(ErrorKeystorePassphrase), err)
+
+	// invalid format
+	_, err = DecryptKeystore([]byte("{}"), passphrase)
+	assert.NotEqual(t, nil, err)
+}
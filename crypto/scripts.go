@@ -5,6 +5,7 @@
 package crypto
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"strconv"
@@ -78,6 +79,18 @@ func CreateMultisig(pubkeys []*btcec.PublicKey, nSigs int, chainCfg *chaincfg.Pa
 	return multisigAddr, script
 }
 
+// Raw method to create a multisig from pubkeys and return P2WSH address and redeemScript
+func CreateMultisigWitness(pubkeys []*btcec.PublicKey, nSigs int, chainCfg *chaincfg.Params) (btcutil.Address, string) {
+
+	_, script := CreateMultisig(pubkeys, nSigs, chainCfg)
+
+	scriptBytes, _ := hex.DecodeString(script)
+	scriptHash := sha256.Sum256(scriptBytes)
+	multisigAddr, _ := btcutil.NewAddressWitnessScriptHash(scriptHash[:], chainCfg)
+
+	return multisigAddr, script
+}
+
 // type def for signature
 type Sig []byte
 
@@ -50,6 +50,12 @@ func TestMultisig(t *testing.T) {
 	msAddrTest, msTest := CreateMultisig([]*btcec.PublicKey{msPubTest[0], msPubTest[1]}, nSigs, mainChainCfg)
 	assert.Equal(t, multisigAddr, msAddrTest.String())
 	assert.Equal(t, multisig, msTest)
+
+	// Test CreateMultisigWitness
+	msWitnessAddr := "bcrt1qs68fk8mt767nju7jy890khl35uh8fx2uwfme3mzpkzj6z0cmn7gs8u7g9k"
+	msWitnessAddrTest, msWitnessTest := CreateMultisigWitness([]*btcec.PublicKey{msPubTest[0], msPubTest[1]}, nSigs, mainChainCfg)
+	assert.Equal(t, msWitnessAddr, msWitnessAddrTest.String())
+	assert.Equal(t, multisig, msWitnessTest)
 }
 
 // Test Script utility
@@ -0,0 +1,54 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package crypto
+
+import (
+	"bytes"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// Various utility functionalities concerning taproot (BIP-341) staychains
+//
+// The commitment hash is applied to the internal key as the tap tweak
+// script root, i.e. the output key is P + H_TapTweak(P || hash)G,
+// which is a pay-to-contract commitment that can be spent with the key path
+// The zero hash of the initial staychain output uses the key only tweak
+// of BIP-86 so that the initial output can be funded by any taproot wallet
+
+// Return the tap tweak script root of the commitment hash provided
+// No script root is used for the zero hash
+func taprootScriptRoot(hash []byte) []byte {
+	if len(hash) == 0 || bytes.Equal(hash, make([]byte, chainhash.HashSize)) {
+		return []byte{}
+	}
+	return hash
+}
+
+// Get taproot output key by tweaking the internal key with the commitment hash
+func GetTaprootOutputKey(internalKey *btcec.PublicKey, hash []byte) *btcec.PublicKey {
+	scriptRoot := taprootScriptRoot(hash)
+	if len(scriptRoot) == 0 {
+		return txscript.ComputeTaprootKeyNoScript(internalKey)
+	}
+	return txscript.ComputeTaprootOutputKey(internalKey, scriptRoot)
+}
+
+// Get P2TR address by tweaking the internal key with the commitment hash
+func GetTaprootAddress(internalKey *btcec.PublicKey, hash []byte, chainCfg *chaincfg.Params) (*btcutil.AddressTaproot, error) {
+	outputKey := GetTaprootOutputKey(internalKey, hash)
+	return btcutil.NewAddressTaproot(schnorr.SerializePubKey(outputKey), chainCfg)
+}
+
+// Get private key of the taproot output key for key path spending
+// by tweaking the internal private key with the commitment hash
+func TweakTaprootPrivKey(internalPriv *btcec.PrivateKey, hash []byte) *btcec.PrivateKey {
+	return txscript.TweakTaprootPrivKey(*internalPriv, taprootScriptRoot(hash))
+}
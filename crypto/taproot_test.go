@@ -0,0 +1,53 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test taproot output key and address tweaking with commitment hash
+func TestTaproot(t *testing.T) {
+	// BIP-86 test vector for key only tweak of the zero hash
+	privBytes, _ := hex.DecodeString("41f41d69260df4cf277826a9b65a3717e4eeddbeedf637f212ca096576479361")
+	priv, pub := btcec.PrivKeyFromBytes(privBytes)
+	assert.Equal(t, "cc8a4bc64d897bddc5fbc2f670f7a8ba0b386779106cf1223c6fc5d7cd6fc115",
+		hex.EncodeToString(schnorr.SerializePubKey(pub)))
+
+	for _, hash := range [][]byte{nil, make([]byte, chainhash.HashSize)} {
+		outputKey := GetTaprootOutputKey(pub, hash)
+		assert.Equal(t, "a60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c",
+			hex.EncodeToString(schnorr.SerializePubKey(outputKey)))
+
+		addr, addrErr := GetTaprootAddress(pub, hash, &chaincfg.MainNetParams)
+		assert.Equal(t, nil, addrErr)
+		assert.Equal(t, "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr", addr.String())
+
+		tweakedPriv := TweakTaprootPrivKey(priv, hash)
+		assert.Equal(t, schnorr.SerializePubKey(outputKey), schnorr.SerializePubKey(tweakedPriv.PubKey()))
+	}
+
+	// commitment hash tweak differs from key only tweak and between commitments
+	hash, _ := chainhash.NewHashFromStr("aaaaaaa1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	hash2, _ := chainhash.NewHashFromStr("bbbbbbb1111d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	outputKey := GetTaprootOutputKey(pub, hash.CloneBytes())
+	assert.NotEqual(t, GetTaprootOutputKey(pub, nil).SerializeCompressed(), outputKey.SerializeCompressed())
+	assert.NotEqual(t, GetTaprootOutputKey(pub, hash2.CloneBytes()).SerializeCompressed(), outputKey.SerializeCompressed())
+
+	// tweaked private key signs for the output key
+	tweakedPriv := TweakTaprootPrivKey(priv, hash.CloneBytes())
+	assert.Equal(t, schnorr.SerializePubKey(outputKey), schnorr.SerializePubKey(tweakedPriv.PubKey()))
+	sigHash := hash2.CloneBytes()
+	sig, sigErr := schnorr.Sign(tweakedPriv, sigHash)
+	assert.Equal(t, nil, sigErr)
+	assert.Equal(t, true, sig.Verify(sigHash, outputKey))
+}
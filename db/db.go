@@ -5,6 +5,9 @@
 package db
 
 import (
+	"context"
+	"time"
+
 	"mainstay/models"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -20,6 +23,12 @@ type Db interface {
 	SaveAttestationInfo(models.AttestationInfo) error
 	SaveMerkleCommitments(commitments []models.CommitmentMerkleCommitment) error
 	SaveMerkleProofs(proofs []models.CommitmentMerkleProof) error
+	SaveAttestationCheckpoint(models.AttestationCheckpoint) error
+	SaveWebhookEvent(models.WebhookEvent) error
+	SaveFeeBump(models.FeeBump) error
+
+	// delete methods
+	DeleteAttestationInfo(chainhash.Hash) error
 
 	// util methods
 	getAttestationCount(...bool) (int64, error)
@@ -30,4 +39,10 @@ type Db interface {
 	GetLatestAttestationMerkleRoot(bool) (string, error)
 	GetClientCommitments() ([]models.ClientCommitment, error)
 	GetAttestationMerkleCommitments(chainhash.Hash) ([]models.CommitmentMerkleCommitment, error)
+	GetAttestationCheckpoint() (*models.AttestationCheckpoint, error)
+	GetPendingWebhookEvents() ([]models.WebhookEvent, error)
+	GetFeeSpend(string, time.Time) ([]models.FeeSpend, error)
+
+	// watch methods notifying of client commitment updates
+	WatchClientCommitments(context.Context) (<-chan struct{}, error)
 }
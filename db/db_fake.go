@@ -5,7 +5,11 @@
 package db
 
 import (
+	"context"
 	"errors"
+	"sort"
+	"time"
+
 	"mainstay/models"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -22,6 +26,10 @@ type DbFake struct {
 	MerkleProofs      []models.CommitmentMerkleProof
 	latestCommitments []models.ClientCommitment
 	latestAttestations []models.Attestation
+	checkpoint        *models.AttestationCheckpoint
+	commitmentWatches []chan struct{}
+	WebhookEvents     []models.WebhookEvent
+	FeeBumps          []models.FeeBump
 }
 
 // Return new DbFake instance
@@ -32,7 +40,11 @@ func NewDbFake() *DbFake {
 		[]models.CommitmentMerkleCommitment{},
 		[]models.CommitmentMerkleProof{},
 		[]models.ClientCommitment{},
-		[]models.Attestation{}}
+		[]models.Attestation{},
+		nil,
+		nil,
+		[]models.WebhookEvent{},
+		[]models.FeeBump{}}
 }
 
 // Save latest attestation to Attestations
@@ -101,6 +113,12 @@ func (d *DbFake) SaveMerkleProofs(proofs []models.CommitmentMerkleProof) error {
 	return nil
 }
 
+// Save attestation service checkpoint replacing any previous checkpoint
+func (d *DbFake) SaveAttestationCheckpoint(checkpoint models.AttestationCheckpoint) error {
+	d.checkpoint = &checkpoint
+	return nil
+}
+
 // Return attestation count with optional confirmed flag
 func (d *DbFake) getAttestationCount(confirmed ...bool) (int64, error) {
 	if len(confirmed) > 0 {
@@ -174,9 +192,94 @@ func (d *DbFake) GetAttestationMerkleCommitments(txid chainhash.Hash) ([]models.
 // Set latest commitments for testing
 func (d *DbFake) SetClientCommitments(latestCommitments []models.ClientCommitment) {
 	d.latestCommitments = latestCommitments
+
+	// notify watchers of client commitment update
+	for _, watch := range d.commitmentWatches {
+		select {
+		case watch <- struct{}{}:
+		default:
+		}
+	}
 }
 
 // Return latest commitment from fake client commitments
 func (d *DbFake) GetClientCommitments() ([]models.ClientCommitment, error) {
 	return d.latestCommitments, nil
 }
+
+// Return latest attestation service checkpoint or nil if none stored
+func (d *DbFake) GetAttestationCheckpoint() (*models.AttestationCheckpoint, error) {
+	return d.checkpoint, nil
+}
+
+// Return channel notified every time client commitments are set
+func (d *DbFake) WatchClientCommitments(ctx context.Context) (<-chan struct{}, error) {
+	watch := make(chan struct{}, 1)
+	d.commitmentWatches = append(d.commitmentWatches, watch)
+	return watch, nil
+}
+
+// Delete attestation info with txid from AttestationsInfo
+func (d *DbFake) DeleteAttestationInfo(txid chainhash.Hash) error {
+	for i, a := range d.AttestationsInfo {
+		if a.Txid == txid.String() {
+			d.AttestationsInfo = append(d.AttestationsInfo[:i], d.AttestationsInfo[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// Save webhook event to WebhookEvents
+func (d *DbFake) SaveWebhookEvent(event models.WebhookEvent) error {
+	for i, e := range d.WebhookEvents {
+		if e.Id == event.Id {
+			d.WebhookEvents[i] = event
+			return nil
+		}
+	}
+	d.WebhookEvents = append(d.WebhookEvents, event)
+	return nil
+}
+
+// Save fee bump decision to FeeBumps
+func (d *DbFake) SaveFeeBump(feeBump models.FeeBump) error {
+	d.FeeBumps = append(d.FeeBumps, feeBump)
+	return nil
+}
+
+// Return webhook events pending delivery
+func (d *DbFake) GetPendingWebhookEvents() ([]models.WebhookEvent, error) {
+	var events []models.WebhookEvent
+	for _, e := range d.WebhookEvents {
+		if !e.Delivered && !e.Failed {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// Return fees of attestation info since the time provided per day or month
+func (d *DbFake) GetFeeSpend(period string, from time.Time) ([]models.FeeSpend, error) {
+	var spend []models.FeeSpend
+	for _, a := range d.AttestationsInfo {
+		if a.Time < from.Unix() {
+			continue
+		}
+		key := models.FeeSpendPeriodOf(period, time.Unix(a.Time, 0))
+		found := false
+		for i := range spend {
+			if spend[i].Period == key {
+				spend[i].Fees += a.Fee
+				spend[i].Count++
+				found = true
+				break
+			}
+		}
+		if !found {
+			spend = append(spend, models.FeeSpend{Period: key, Fees: a.Fee, Count: 1})
+		}
+	}
+	sort.Slice(spend, func(i, j int) bool { return spend[i].Period < spend[j].Period })
+	return spend, nil
+}
@@ -8,9 +8,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"mainstay/config"
 	"mainstay/log"
+	"mainstay/metrics"
 	"mainstay/models"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -27,6 +29,9 @@ const (
 	ColNameMerkleProof      = "MerkleProof"
 	ColNameClientCommitment = "ClientCommitment"
 	ColNameClientDetails    = "ClientDetails"
+	ColNameCheckpoint       = "AttestationCheckpoint"
+	ColNameWebhookEvent     = "WebhookEvent"
+	ColNameFeeBump          = "AttestationFeeBump"
 
 	// error messages
 	ErrorMongoClient  = "could not create mongoDB client"
@@ -39,16 +44,28 @@ const (
 	ErrorMerkleProofSave      = "could not save merkle proof"
 	ErrorClientDetailsSave    = "could not save client details"
 	ErrorClientCommitmentSave = "could not save client commitment"
+	ErrorCheckpointSave       = "could not save attestation checkpoint"
+	ErrorWebhookEventSave     = "could not save webhook event"
+	ErrorFeeBumpSave          = "could not save fee bump"
 
 	ErrorAttestationGet      = "could not get attestation"
+	ErrorAttestationInfoGet  = "could not get attestation info"
 	ErrorMerkleCommitmentGet = "could not get merkle commitment"
 	ErrorMerkleProofGet      = "could not get merkle proof"
 	ErrorClientCommitmentGet = "could not get client commitment"
 	ErrorClientDetailsGet    = "could not get client details"
+	ErrorCheckpointGet       = "could not get attestation checkpoint"
+	ErrorWebhookEventGet     = "could not get webhook event"
+
+	ErrorClientCommitmentWatch = "could not watch client commitment"
+
+	ErrorAttestationInfoDelete = "could not delete attestation info"
 
 	BadDataClientCommitmentCol = "bad data in client commitment collection"
 	BadDataMerkleCommitmentCol = "bad data in merkle commitment collection"
 	BadDataClientDetailsCol    = "bad data in client details collection"
+	BadDataWebhookEventCol     = "bad data in webhook event collection"
+	BadDataAttestationInfoCol  = "bad data in attestation info collection"
 
 	BadDataAttestationModel      = "bad data in attestation model"
 	BadDataAttestationInfoModel  = "bad data in attestation info model"
@@ -56,6 +73,9 @@ const (
 	BadDataMerkleProofModel      = "bad data in merkle proof model"
 	BadDataClientDetailsModel    = "bad data in client details model"
 	BadDataClientCommitmentModel = "bad data in client commitment model"
+	BadDataCheckpointModel       = "bad data in attestation checkpoint model"
+	BadDataWebhookEventModel     = "bad data in webhook event model"
+	BadDataFeeBumpModel          = "bad data in fee bump model"
 )
 
 // Method to connect to mongo database through config
@@ -99,14 +119,30 @@ type DbMongo struct {
 	db *mongo.Database
 }
 
-// Return new DbMongo instance
-func NewDbMongo(ctx context.Context, dbConnectivity config.DbConfig) *DbMongo {
+// Return new DbMongo instance or an error if the db connection fails
+func NewDbMongo(ctx context.Context, dbConnectivity config.DbConfig) (*DbMongo, error) {
 	db, errConnect := dbConnect(ctx, dbConnectivity)
 	if errConnect != nil {
-		log.Error(errConnect)
+		return nil, errConnect
 	}
 
-	return &DbMongo{ctx, dbConnectivity, db}
+	return &DbMongo{ctx, dbConnectivity, db}, nil
+}
+
+// Return collection for name provided prefixed with the db namespace
+// Namespaces allow multiple staychains to share the same database
+func (d *DbMongo) collection(name string) *mongo.Collection {
+	if d.dbConnectivity.Namespace != "" {
+		return d.db.Collection(d.dbConnectivity.Namespace + "_" + name)
+	}
+	return d.db.Collection(name)
+}
+
+// Return error of a failed db operation
+// Failed operations are recorded in the db error metrics
+func (d *DbMongo) opError(errorMsg string, err error) error {
+	metrics.IncDbError(d.dbConnectivity.Namespace, errorMsg)
+	return errors.New(fmt.Sprintf("%s %v", errorMsg, err))
 }
 
 // Save latest attestation to the Attestation collection
@@ -115,7 +151,7 @@ func (d *DbMongo) SaveAttestation(attestation models.Attestation) error {
 	// get document representation of Attestation object
 	docAttestation, docErr := models.GetDocumentFromModel(attestation)
 	if docErr != nil {
-		return errors.New(fmt.Sprintf("%s %v", BadDataAttestationModel, docErr))
+		return d.opError(BadDataAttestationModel, docErr)
 	}
 
 	newAttestation := bsonx.Doc{
@@ -132,10 +168,10 @@ func (d *DbMongo) SaveAttestation(attestation models.Attestation) error {
 	var t bsonx.Doc
 	opts := &options.FindOneAndUpdateOptions{}
 	opts.SetUpsert(true)
-	res := d.db.Collection(ColNameAttestation).FindOneAndUpdate(d.ctx, filterAttestation, newAttestation, opts)
+	res := d.collection(ColNameAttestation).FindOneAndUpdate(d.ctx, filterAttestation, newAttestation, opts)
 	resErr := res.Decode(&t)
 	if resErr != nil && resErr != mongo.ErrNoDocuments {
-		return errors.New(fmt.Sprintf("%s %v", ErrorAttestationSave, resErr))
+		return d.opError(ErrorAttestationSave, resErr)
 	}
 
 	return nil
@@ -147,7 +183,7 @@ func (d *DbMongo) SaveAttestationInfo(attestationInfo models.AttestationInfo) er
 	// get document representation of AttestationInfo object
 	docAttestationInfo, docErr := models.GetDocumentFromModel(attestationInfo)
 	if docErr != nil {
-		return errors.New(fmt.Sprintf("%s %v", BadDataAttestationInfoModel, docErr))
+		return d.opError(BadDataAttestationInfoModel, docErr)
 	}
 	newAttestationInfo := bsonx.Doc{
 		{"$set", bsonx.Document(*docAttestationInfo)},
@@ -162,10 +198,10 @@ func (d *DbMongo) SaveAttestationInfo(attestationInfo models.AttestationInfo) er
 	var t bsonx.Doc
 	opts := &options.FindOneAndUpdateOptions{}
 	opts.SetUpsert(true)
-	res := d.db.Collection(ColNameAttestationInfo).FindOneAndUpdate(d.ctx, filterAttestationInfo, newAttestationInfo, opts)
+	res := d.collection(ColNameAttestationInfo).FindOneAndUpdate(d.ctx, filterAttestationInfo, newAttestationInfo, opts)
 	resErr := res.Decode(&t)
 	if resErr != nil && resErr != mongo.ErrNoDocuments {
-		return errors.New(fmt.Sprintf("%s %v", ErrorAttestationInfoSave, resErr))
+		return d.opError(ErrorAttestationInfoSave, resErr)
 	}
 
 	return nil
@@ -178,7 +214,7 @@ func (d *DbMongo) SaveMerkleCommitments(commitments []models.CommitmentMerkleCom
 		// get document representation of Attestation object
 		docCommitment, docErr := models.GetDocumentFromModel(commitments[pos])
 		if docErr != nil {
-			return errors.New(fmt.Sprintf("%s %v", BadDataMerkleCommitmentModel, docErr))
+			return d.opError(BadDataMerkleCommitmentModel, docErr)
 		}
 
 		newCommitment := bsonx.Doc{
@@ -197,10 +233,10 @@ func (d *DbMongo) SaveMerkleCommitments(commitments []models.CommitmentMerkleCom
 		var t bsonx.Doc
 		opts := &options.FindOneAndUpdateOptions{}
 		opts.SetUpsert(true)
-		res := d.db.Collection(ColNameMerkleCommitment).FindOneAndUpdate(d.ctx, filterMerkleCommitment, newCommitment, opts)
+		res := d.collection(ColNameMerkleCommitment).FindOneAndUpdate(d.ctx, filterMerkleCommitment, newCommitment, opts)
 		resErr := res.Decode(&t)
 		if resErr != nil && resErr != mongo.ErrNoDocuments {
-			return errors.New(fmt.Sprintf("%s %v", ErrorMerkleCommitmentSave, resErr))
+			return d.opError(ErrorMerkleCommitmentSave, resErr)
 		}
 	}
 	return nil
@@ -212,7 +248,7 @@ func (d *DbMongo) SaveMerkleProofs(proofs []models.CommitmentMerkleProof) error
 		// get document representation of merkle proof
 		docProof, docErr := models.GetDocumentFromModel(proofs[pos])
 		if docErr != nil {
-			return errors.New(fmt.Sprintf("%s %v", BadDataMerkleProofModel, docErr))
+			return d.opError(BadDataMerkleProofModel, docErr)
 		}
 
 		newProof := bsonx.Doc{
@@ -231,21 +267,46 @@ func (d *DbMongo) SaveMerkleProofs(proofs []models.CommitmentMerkleProof) error
 		var t bsonx.Doc
 		opts := &options.FindOneAndUpdateOptions{}
 		opts.SetUpsert(true)
-		res := d.db.Collection(ColNameMerkleProof).FindOneAndUpdate(d.ctx, filterMerkleProof, newProof, opts)
+		res := d.collection(ColNameMerkleProof).FindOneAndUpdate(d.ctx, filterMerkleProof, newProof, opts)
 		resErr := res.Decode(&t)
 		if resErr != nil && resErr != mongo.ErrNoDocuments {
-			return errors.New(fmt.Sprintf("%s %v", ErrorMerkleProofSave, resErr))
+			return d.opError(ErrorMerkleProofSave, resErr)
 		}
 	}
 	return nil
 }
 
+// Save attestation service checkpoint to the AttestationCheckpoint collection
+// A single checkpoint document is maintained and overwritten on every save
+func (d *DbMongo) SaveAttestationCheckpoint(checkpoint models.AttestationCheckpoint) error {
+	// get document representation of checkpoint
+	docCheckpoint, docErr := models.GetDocumentFromModel(checkpoint)
+	if docErr != nil {
+		return d.opError(BadDataCheckpointModel, docErr)
+	}
+
+	newCheckpoint := bsonx.Doc{
+		{"$set", bsonx.Document(*docCheckpoint)},
+	}
+
+	// insert or update the single checkpoint document
+	var t bsonx.Doc
+	opts := &options.FindOneAndUpdateOptions{}
+	opts.SetUpsert(true)
+	res := d.collection(ColNameCheckpoint).FindOneAndUpdate(d.ctx, bsonx.Doc{}, newCheckpoint, opts)
+	resErr := res.Decode(&t)
+	if resErr != nil && resErr != mongo.ErrNoDocuments {
+		return d.opError(ErrorCheckpointSave, resErr)
+	}
+	return nil
+}
+
 // Save client details to ClientDetails collection
 func (d *DbMongo) SaveClientDetails(details models.ClientDetails) error {
 	// get document representation of client details
 	docDetails, docErr := models.GetDocumentFromModel(details)
 	if docErr != nil {
-		return errors.New(fmt.Sprintf("%s %v", BadDataClientDetailsModel, docErr))
+		return d.opError(BadDataClientDetailsModel, docErr)
 	}
 
 	newDetails := bsonx.Doc{
@@ -262,10 +323,10 @@ func (d *DbMongo) SaveClientDetails(details models.ClientDetails) error {
 	var t bsonx.Doc
 	opts := &options.FindOneAndUpdateOptions{}
 	opts.SetUpsert(true)
-	res := d.db.Collection(ColNameClientDetails).FindOneAndUpdate(d.ctx, filterClientDetails, newDetails, opts)
+	res := d.collection(ColNameClientDetails).FindOneAndUpdate(d.ctx, filterClientDetails, newDetails, opts)
 	resErr := res.Decode(&t)
 	if resErr != nil && resErr != mongo.ErrNoDocuments {
-		return errors.New(fmt.Sprintf("%s %v", ErrorClientDetailsSave, resErr))
+		return d.opError(ErrorClientDetailsSave, resErr)
 	}
 	return nil
 }
@@ -275,7 +336,7 @@ func (d *DbMongo) SaveClientCommitment(commitment models.ClientCommitment) error
 	// get document representation of client details
 	docCommitment, docErr := models.GetDocumentFromModel(commitment)
 	if docErr != nil {
-		return errors.New(fmt.Sprintf("%s %v", BadDataClientCommitmentModel, docErr))
+		return d.opError(BadDataClientCommitmentModel, docErr)
 	}
 
 	newCommitment := bsonx.Doc{
@@ -292,10 +353,10 @@ func (d *DbMongo) SaveClientCommitment(commitment models.ClientCommitment) error
 	var t bsonx.Doc
 	opts := &options.FindOneAndUpdateOptions{}
 	opts.SetUpsert(true)
-	res := d.db.Collection(ColNameClientCommitment).FindOneAndUpdate(d.ctx, filterClientCommitment, newCommitment, opts)
+	res := d.collection(ColNameClientCommitment).FindOneAndUpdate(d.ctx, filterClientCommitment, newCommitment, opts)
 	resErr := res.Decode(&t)
 	if resErr != nil && resErr != mongo.ErrNoDocuments {
-		return errors.New(fmt.Sprintf("%s %v", ErrorClientCommitmentSave, resErr))
+		return d.opError(ErrorClientCommitmentSave, resErr)
 	}
 	return nil
 }
@@ -304,10 +365,10 @@ func (d *DbMongo) SaveClientCommitment(commitment models.ClientCommitment) error
 func (d *DbMongo) GetClientDetails() ([]models.ClientDetails, error) {
 	// sort by client position
 	sortFilter := bsonx.Doc{{models.ClientDetailsClientPositionName, bsonx.Int32(1)}}
-	res, resErr := d.db.Collection(ColNameClientDetails).Find(d.ctx, bsonx.Doc{}, &options.FindOptions{Sort: sortFilter})
+	res, resErr := d.collection(ColNameClientDetails).Find(d.ctx, bsonx.Doc{}, &options.FindOptions{Sort: sortFilter})
 	if resErr != nil {
 		return []models.ClientDetails{},
-			errors.New(fmt.Sprintf("%s %v", ErrorClientDetailsGet, resErr))
+			d.opError(ErrorClientDetailsGet, resErr)
 	}
 
 	// iterate through details
@@ -316,17 +377,17 @@ func (d *DbMongo) GetClientDetails() ([]models.ClientDetails, error) {
 		var detailsDoc bsonx.Doc
 		if err := res.Decode(&detailsDoc); err != nil {
 			return []models.ClientDetails{},
-				errors.New(fmt.Sprintf("%s %v", BadDataClientDetailsCol, err))
+				d.opError(BadDataClientDetailsCol, err)
 		}
 		detailsModel := &models.ClientDetails{}
 		modelErr := models.GetModelFromDocument(&detailsDoc, detailsModel)
 		if modelErr != nil {
-			return []models.ClientDetails{}, errors.New(fmt.Sprintf("%s %v", BadDataClientDetailsCol, modelErr))
+			return []models.ClientDetails{}, d.opError(BadDataClientDetailsCol, modelErr)
 		}
 		details = append(details, *detailsModel)
 	}
 	if err := res.Err(); err != nil {
-		return []models.ClientDetails{}, errors.New(fmt.Sprintf("%s %v", BadDataClientDetailsCol, err))
+		return []models.ClientDetails{}, d.opError(BadDataClientDetailsCol, err)
 	}
 	return details, nil
 }
@@ -341,9 +402,9 @@ func (d *DbMongo) getAttestationCount(confirmed ...bool) (int64, error) {
 	// find latest attestation count
 	opts := options.CountOptions{}
 	opts.SetLimit(1)
-	count, countErr := d.db.Collection(ColNameAttestation).CountDocuments(d.ctx, confirmedFilter, &opts)
+	count, countErr := d.collection(ColNameAttestation).CountDocuments(d.ctx, confirmedFilter, &opts)
 	if countErr != nil {
-		return 0, errors.New(fmt.Sprintf("%s %v", ErrorAttestationGet, countErr))
+		return 0, d.opError(ErrorAttestationGet, countErr)
 	}
 
 	return count, nil
@@ -364,10 +425,10 @@ func (d *DbMongo) GetLatestAttestationMerkleRoot(confirmed bool) (string, error)
 	confirmedFilter := bsonx.Doc{{models.AttestationConfirmedName, bsonx.Boolean(confirmed)}}
 
 	var attestationDoc bsonx.Doc
-	resErr := d.db.Collection(ColNameAttestation).FindOne(d.ctx,
+	resErr := d.collection(ColNameAttestation).FindOne(d.ctx,
 		confirmedFilter, &options.FindOneOptions{Sort: sortFilter}).Decode(&attestationDoc)
 	if resErr != nil {
-		return "", errors.New(fmt.Sprintf("%s %v", ErrorAttestationGet, resErr))
+		return "", d.opError(ErrorAttestationGet, resErr)
 	}
 	return attestationDoc.Lookup(models.AttestationMerkleRootName).StringValue(), nil
 }
@@ -388,12 +449,12 @@ func (d *DbMongo) getAttestationMerkleRoot(txid chainhash.Hash) (string, error)
 	}
 
 	var attestationDoc bsonx.Doc
-	resErr := d.db.Collection(ColNameAttestation).FindOne(d.ctx, filterAttestation).Decode(&attestationDoc)
+	resErr := d.collection(ColNameAttestation).FindOne(d.ctx, filterAttestation).Decode(&attestationDoc)
 	if resErr != nil {
 		if resErr == mongo.ErrNoDocuments {
 			return "", nil
 		}
-		return "", errors.New(fmt.Sprintf("%s %v", ErrorAttestationGet, resErr))
+		return "", d.opError(ErrorAttestationGet, resErr)
 	}
 	return attestationDoc.Lookup(models.CommitmentMerkleRootName).StringValue(), nil
 }
@@ -403,9 +464,9 @@ func (d *DbMongo) GetUnconfirmedAttestations() ([]models.Attestation, error) {
 	confirmedFilter := bsonx.Doc{{models.AttestationConfirmedName, bsonx.Boolean(false)}}
   
 	// Find all unconfirmed attestations
-	cursor, err := d.db.Collection(ColNameAttestation).Find(d.ctx, confirmedFilter)
+	cursor, err := d.collection(ColNameAttestation).Find(d.ctx, confirmedFilter)
 	if err != nil {
-	  return nil, errors.New(fmt.Sprintf("%s %v", ErrorAttestationGet, err))
+	  return nil, d.opError(ErrorAttestationGet, err)
 	}
 	defer func() {
 	  if err := cursor.Close(d.ctx); err != nil {
@@ -423,13 +484,13 @@ func (d *DbMongo) GetUnconfirmedAttestations() ([]models.Attestation, error) {
 		break
 	  }
 	  if err != nil {
-		return nil, errors.New(fmt.Sprintf("%s %v", ErrorAttestationGet, err))
+		return nil, d.opError(ErrorAttestationGet, err)
 	  }
   
 	  // Decode document into an attestation object (optional if using All)
 	  var attestation models.Attestation
 	  if err := cursor.Decode(d.ctx); err != nil {
-		return nil, errors.New(fmt.Sprintf("%s %v", ErrorAttestationGet, err))
+		return nil, d.opError(ErrorAttestationGet, err)
 	  }
 	  attestations = append(attestations, attestation)
 	}
@@ -450,10 +511,10 @@ func (d *DbMongo) GetAttestationMerkleCommitments(txid chainhash.Hash) ([]models
 	// filter MerkleCommitment collection by merkle_root and sort for client position
 	sortFilter := bsonx.Doc{{models.CommitmentClientPositionName, bsonx.Int32(1)}}
 	filterMerkleRoot := bsonx.Doc{{models.CommitmentMerkleRootName, bsonx.String(merkleRoot)}}
-	res, resErr := d.db.Collection(ColNameMerkleCommitment).Find(d.ctx, filterMerkleRoot, &options.FindOptions{Sort: sortFilter})
+	res, resErr := d.collection(ColNameMerkleCommitment).Find(d.ctx, filterMerkleRoot, &options.FindOptions{Sort: sortFilter})
 	if resErr != nil {
 		return []models.CommitmentMerkleCommitment{},
-			errors.New(fmt.Sprintf("%s %v", ErrorMerkleCommitmentGet, resErr))
+			d.opError(ErrorMerkleCommitmentGet, resErr)
 	}
 
 	// fetch commitments
@@ -475,7 +536,7 @@ func (d *DbMongo) GetAttestationMerkleCommitments(txid chainhash.Hash) ([]models
 	}
 	if err := res.Err(); err != nil {
 		return []models.CommitmentMerkleCommitment{},
-			errors.New(fmt.Sprintf("%s %v", BadDataMerkleCommitmentCol, err))
+			d.opError(BadDataMerkleCommitmentCol, err)
 	}
 	return merkleCommitments, nil
 }
@@ -485,10 +546,10 @@ func (d *DbMongo) GetClientCommitments() ([]models.ClientCommitment, error) {
 
 	// sort by client position to get correct commitment order
 	sortFilter := bsonx.Doc{{models.ClientCommitmentClientPositionName, bsonx.Int32(1)}}
-	res, resErr := d.db.Collection(ColNameClientCommitment).Find(d.ctx, bsonx.Doc{}, &options.FindOptions{Sort: sortFilter})
+	res, resErr := d.collection(ColNameClientCommitment).Find(d.ctx, bsonx.Doc{}, &options.FindOptions{Sort: sortFilter})
 	if resErr != nil {
 		return []models.ClientCommitment{},
-			errors.New(fmt.Sprintf("%s %v", ErrorClientCommitmentGet, resErr))
+			d.opError(ErrorClientCommitmentGet, resErr)
 	}
 
 	// iterate through commitments
@@ -497,17 +558,201 @@ func (d *DbMongo) GetClientCommitments() ([]models.ClientCommitment, error) {
 		var commitmentDoc bsonx.Doc
 		if err := res.Decode(&commitmentDoc); err != nil {
 			return []models.ClientCommitment{},
-				errors.New(fmt.Sprintf("%s %v", BadDataClientCommitmentCol, err))
+				d.opError(BadDataClientCommitmentCol, err)
 		}
 		commitmentModel := &models.ClientCommitment{}
 		modelErr := models.GetModelFromDocument(&commitmentDoc, commitmentModel)
 		if modelErr != nil {
-			return []models.ClientCommitment{}, errors.New(fmt.Sprintf("%s %v", BadDataClientCommitmentCol, modelErr))
+			return []models.ClientCommitment{}, d.opError(BadDataClientCommitmentCol, modelErr)
 		}
 		latestCommitments = append(latestCommitments, *commitmentModel)
 	}
 	if err := res.Err(); err != nil {
-		return []models.ClientCommitment{}, errors.New(fmt.Sprintf("%s %v", BadDataClientCommitmentCol, err))
+		return []models.ClientCommitment{}, d.opError(BadDataClientCommitmentCol, err)
 	}
 	return latestCommitments, nil
 }
+
+// Return latest attestation service checkpoint or nil if none stored
+func (d *DbMongo) GetAttestationCheckpoint() (*models.AttestationCheckpoint, error) {
+	var checkpointDoc bsonx.Doc
+	resErr := d.collection(ColNameCheckpoint).FindOne(d.ctx, bsonx.Doc{}).Decode(&checkpointDoc)
+	if resErr != nil {
+		if resErr == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, d.opError(ErrorCheckpointGet, resErr)
+	}
+
+	checkpointModel := &models.AttestationCheckpoint{}
+	modelErr := models.GetModelFromDocument(&checkpointDoc, checkpointModel)
+	if modelErr != nil {
+		return nil, d.opError(BadDataCheckpointModel, modelErr)
+	}
+	return checkpointModel, nil
+}
+
+// Return channel notified of any changes to the ClientCommitment collection
+// Uses mongo change streams that require the db to run as a replica set
+// The channel is closed when the context is cancelled or the stream fails
+func (d *DbMongo) WatchClientCommitments(ctx context.Context) (<-chan struct{}, error) {
+	stream, streamErr := d.collection(ColNameClientCommitment).Watch(ctx, mongo.Pipeline{})
+	if streamErr != nil {
+		return nil, d.opError(ErrorClientCommitmentWatch, streamErr)
+	}
+
+	watch := make(chan struct{}, 1)
+	go func() {
+		defer close(watch)
+		defer stream.Close(context.Background())
+		for stream.Next(ctx) {
+			select {
+			case watch <- struct{}{}:
+			default:
+			}
+		}
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			log.Warnf("%s %v\n", ErrorClientCommitmentWatch, err)
+		}
+	}()
+	return watch, nil
+}
+
+// Delete attestation info with txid from the AttestationInfo collection
+func (d *DbMongo) DeleteAttestationInfo(txid chainhash.Hash) error {
+	filterAttestationInfo := bsonx.Doc{
+		{models.AttestationInfoTxidName, bsonx.String(txid.String())},
+	}
+	_, resErr := d.collection(ColNameAttestationInfo).DeleteOne(d.ctx, filterAttestationInfo)
+	if resErr != nil {
+		return d.opError(ErrorAttestationInfoDelete, resErr)
+	}
+	return nil
+}
+
+// Save webhook event to the WebhookEvent outbox collection
+func (d *DbMongo) SaveWebhookEvent(event models.WebhookEvent) error {
+	// get document representation of webhook event
+	docEvent, docErr := models.GetDocumentFromModel(event)
+	if docErr != nil {
+		return d.opError(BadDataWebhookEventModel, docErr)
+	}
+
+	newEvent := bsonx.Doc{
+		{"$set", bsonx.Document(*docEvent)},
+	}
+
+	// search if webhook event already exists
+	filterEvent := bsonx.Doc{
+		{models.WebhookEventIdName, bsonx.String(event.Id)},
+	}
+
+	// insert or update webhook event
+	var t bsonx.Doc
+	opts := &options.FindOneAndUpdateOptions{}
+	opts.SetUpsert(true)
+	res := d.collection(ColNameWebhookEvent).FindOneAndUpdate(d.ctx, filterEvent, newEvent, opts)
+	resErr := res.Decode(&t)
+	if resErr != nil && resErr != mongo.ErrNoDocuments {
+		return d.opError(ErrorWebhookEventSave, resErr)
+	}
+	return nil
+}
+
+// Save fee bump decision to the AttestationFeeBump collection
+// Fee bumps are saved when decided, so that bumps of attestations
+// that are later replaced or rolled back are kept for audit
+func (d *DbMongo) SaveFeeBump(feeBump models.FeeBump) error {
+	// get document representation of fee bump
+	docFeeBump, docErr := models.GetDocumentFromModel(feeBump)
+	if docErr != nil {
+		return d.opError(BadDataFeeBumpModel, docErr)
+	}
+
+	_, resErr := d.collection(ColNameFeeBump).InsertOne(d.ctx, docFeeBump)
+	if resErr != nil {
+		return d.opError(ErrorFeeBumpSave, resErr)
+	}
+	return nil
+}
+
+// Return webhook events pending delivery ordered by creation time
+func (d *DbMongo) GetPendingWebhookEvents() ([]models.WebhookEvent, error) {
+	// filter and sort pending events
+	pendingFilter := bsonx.Doc{
+		{models.WebhookEventDeliveredName, bsonx.Boolean(false)},
+		{models.WebhookEventFailedName, bsonx.Boolean(false)},
+	}
+	sortFilter := bsonx.Doc{{models.WebhookEventCreatedAtName, bsonx.Int32(1)}}
+	res, resErr := d.collection(ColNameWebhookEvent).Find(d.ctx, pendingFilter, &options.FindOptions{Sort: sortFilter})
+	if resErr != nil {
+		return nil, d.opError(ErrorWebhookEventGet, resErr)
+	}
+
+	// iterate through events
+	var events []models.WebhookEvent
+	for res.Next(d.ctx) {
+		var eventDoc bsonx.Doc
+		if err := res.Decode(&eventDoc); err != nil {
+			return nil, d.opError(BadDataWebhookEventCol, err)
+		}
+		eventModel := &models.WebhookEvent{}
+		modelErr := models.GetModelFromDocument(&eventDoc, eventModel)
+		if modelErr != nil {
+			return nil, d.opError(BadDataWebhookEventCol, modelErr)
+		}
+		events = append(events, *eventModel)
+	}
+	if err := res.Err(); err != nil {
+		return nil, d.opError(BadDataWebhookEventCol, err)
+	}
+	return events, nil
+}
+
+// Return fees of confirmed attestations since the time provided aggregated
+// per day or month from the AttestationInfo collection ordered by period
+func (d *DbMongo) GetFeeSpend(period string, from time.Time) ([]models.FeeSpend, error) {
+	format := "%Y-%m-%d"
+	if period == models.FeeSpendPeriodMonth {
+		format = "%Y-%m"
+	}
+
+	// attestation info time is in unix seconds
+	date := bsonx.Document(bsonx.Doc{{"$add", bsonx.Array(bsonx.Arr{
+		bsonx.Time(time.Unix(0, 0)),
+		bsonx.Document(bsonx.Doc{{"$multiply", bsonx.Array(bsonx.Arr{
+			bsonx.String("$" + models.AttestationInfoTimeName), bsonx.Int64(1000)})}}),
+	})}})
+	pipeline := []bsonx.Doc{
+		{{"$match", bsonx.Document(bsonx.Doc{
+			{models.AttestationInfoTimeName, bsonx.Document(bsonx.Doc{{"$gte", bsonx.Int64(from.Unix())}})},
+		})}},
+		{{"$group", bsonx.Document(bsonx.Doc{
+			{models.FeeSpendPeriodName, bsonx.Document(bsonx.Doc{{"$dateToString", bsonx.Document(bsonx.Doc{
+				{"format", bsonx.String(format)}, {"date", date}, {"timezone", bsonx.String("UTC")},
+			})}})},
+			{models.FeeSpendFeesName, bsonx.Document(bsonx.Doc{{"$sum", bsonx.String("$" + models.AttestationInfoFeeName)}})},
+			{models.FeeSpendCountName, bsonx.Document(bsonx.Doc{{"$sum", bsonx.Int32(1)}})},
+		})}},
+		{{"$sort", bsonx.Document(bsonx.Doc{{models.FeeSpendPeriodName, bsonx.Int32(1)}})}},
+	}
+	res, resErr := d.collection(ColNameAttestationInfo).Aggregate(d.ctx, pipeline)
+	if resErr != nil {
+		return nil, d.opError(ErrorAttestationInfoGet, resErr)
+	}
+	defer res.Close(d.ctx)
+
+	// iterate through fee spend of each period
+	var spend []models.FeeSpend
+	for res.Next(d.ctx) {
+		var spendModel models.FeeSpend
+		if err := res.Decode(&spendModel); err != nil {
+			return nil, d.opError(BadDataAttestationInfoCol, err)
+		}
+		spend = append(spend, spendModel)
+	}
+	if err := res.Err(); err != nil {
+		return nil, d.opError(BadDataAttestationInfoCol, err)
+	}
+	return spend, nil
+}
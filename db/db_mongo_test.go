@@ -0,0 +1,87 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"mainstay/config"
+	"mainstay/models"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/assert"
+)
+
+// Integration test of a namespaced staychain writing to a db initialised
+// with scripts/db-init.js under the restricted mainstayService role
+// Requires a mongo instance initialised with the DB_NAMESPACE namespace:
+// mongo --eval "...; var db_namespaces='$DB_NAMESPACE'" scripts/db-init.js
+// and is skipped unless DB_HOST is set
+func TestDbMongoNamespaceServiceRole(t *testing.T) {
+	host := os.Getenv("DB_HOST")
+	if host == "" {
+		t.Skip("DB_HOST not set - skipping mongo integration test")
+	}
+	dbConfig := config.DbConfig{
+		User:      getEnv("DB_SERVICE_USER", "serviceUser"),
+		Password:  getEnv("DB_SERVICE_PASS", "servicePass"),
+		Host:      host,
+		Port:      getEnv("DB_PORT", "27017"),
+		Name:      getEnv("DB_NAME_MAINSTAY", "mainstay"),
+		Namespace: getEnv("DB_NAMESPACE", "testnet"),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	db, dbErr := NewDbMongo(ctx, dbConfig)
+	assert.Equal(t, nil, dbErr)
+
+	txid, _ := chainhash.NewHashFromStr("bf41c0da8047b1416d5ca680e2643967b27537cdf9a41527034698c336b55313")
+	root, _ := chainhash.NewHashFromStr("f5bcb7542ff4c8d3c42fbe0aa95ae5c5d9dcfb1fa8c18d8dc2e1ec1b4b2d3a0e")
+	commitment, _ := models.NewCommitment([]chainhash.Hash{*root})
+
+	// service role can write to all attestation collections of the namespace
+	attestation := models.NewAttestation(*txid, commitment)
+	assert.Equal(t, nil, db.SaveAttestation(*attestation))
+	assert.Equal(t, nil, db.SaveMerkleCommitments(commitment.GetMerkleCommitments()))
+	assert.Equal(t, nil, db.SaveMerkleProofs(commitment.GetMerkleProofs()))
+
+	info := models.AttestationInfo{Txid: txid.String(), Time: time.Now().Unix(), Fee: 1000}
+	assert.Equal(t, nil, db.SaveAttestationInfo(info))
+	spend, spendErr := db.GetFeeSpend(models.FeeSpendPeriodDay, time.Now().Add(-time.Hour))
+	assert.Equal(t, nil, spendErr)
+	assert.NotEqual(t, 0, len(spend))
+	assert.Equal(t, nil, db.DeleteAttestationInfo(*txid))
+
+	checkpoint := models.AttestationCheckpoint{Attestation: *models.NewAttestationDefault()}
+	assert.Equal(t, nil, db.SaveAttestationCheckpoint(checkpoint))
+	_, checkpointErr := db.GetAttestationCheckpoint()
+	assert.Equal(t, nil, checkpointErr)
+
+	feeBump := models.FeeBump{Txid: txid.String(), Time: time.Now().Unix(), Policy: "increment", PrevFee: 10, Fee: 15}
+	assert.Equal(t, nil, db.SaveFeeBump(feeBump))
+
+	event := models.WebhookEvent{Id: "namespace-test", Url: "http://localhost", CreatedAt: time.Now()}
+	assert.Equal(t, nil, db.SaveWebhookEvent(event))
+	_, eventsErr := db.GetPendingWebhookEvents()
+	assert.Equal(t, nil, eventsErr)
+
+	// service role can read but not write client collections
+	_, commitmentsErr := db.GetClientCommitments()
+	assert.Equal(t, nil, commitmentsErr)
+	_, detailsErr := db.GetClientDetails()
+	assert.Equal(t, nil, detailsErr)
+	assert.NotEqual(t, nil, db.SaveClientDetails(models.ClientDetails{ClientPosition: 0}))
+}
+
+// Return env variable value or the default provided if not set
+func getEnv(name string, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -17,15 +17,22 @@ import (
 	"mainstay/config"
 	"mainstay/db"
 	"mainstay/log"
+	"mainstay/metrics"
 	"mainstay/test"
 )
 
+// error consts
+const (
+	ErrorNoStaychains = "No staychains could be started"
+)
+
 var (
 	tx0         string
-	chaincode  string
+	chaincode   string
 	addrTopup   string
 	isRegtest   bool
-	mainConfig  *config.Config
+	isDryRun    bool
+	mainConfigs []*config.Config
 )
 
 func parseFlags() {
@@ -33,6 +40,7 @@ func parseFlags() {
 	flag.StringVar(&tx0, "tx", "", "Tx id for genesis attestation transaction")
 	flag.StringVar(&chaincode, "chaincode", "", "Chaincode for sig pubkey")
 	flag.StringVar(&addrTopup, "addrTopup", "", "Address for topup transaction")
+	flag.BoolVar(&isDryRun, "dryRun", false, "Build and sign attestations without broadcasting or storing them")
 	flag.Parse()
 }
 
@@ -41,46 +49,139 @@ func init() {
 
 	if isRegtest {
 		test := test.NewTest(true, true)
-		mainConfig = test.Config
-		log.Infof("Running regtest mode with -tx=%s\n", mainConfig.InitTx())
+		mainConfigs = []*config.Config{test.Config}
+		log.Infof("Running regtest mode with -tx=%s\n", test.Config.InitTx())
 	} else {
-		var mainConfigErr error
-		mainConfig, mainConfigErr = config.NewConfig()
-		if mainConfigErr != nil {
-			log.Error(mainConfigErr)
+		var mainConfigsErr error
+		mainConfigs, mainConfigsErr = config.NewConfigs()
+		if mainConfigsErr != nil {
+			log.Error(mainConfigsErr)
+		}
+
+		// command line arguments only supported for a single staychain
+		if len(mainConfigs) > 1 && (tx0 != "" || chaincode != "" || addrTopup != "") {
+			log.Error(`Command line arguments -tx, -chaincode and -addrTopup not supported
+                for multiple staychains. Set these in the staychains conf instead.`)
 		}
 
-		// if either tx or script not set throw error
-		if tx0 == "" || chaincode == "" {
-			if mainConfig.InitTx() == "" || mainConfig.InitChaincode() == "" {
-				flag.PrintDefaults()
-				log.Error(`Need to provide all -tx, -script and -chaincode arguments.
+		for _, mainConfig := range mainConfigs {
+			// if either tx or script not set throw error
+			if tx0 == "" || chaincode == "" {
+				if mainConfig.InitTx() == "" || (mainConfig.InitChaincode() == "" && mainConfig.InitScript() == "" && !mainConfig.Taproot()) {
+					flag.PrintDefaults()
+					log.Error(`Need to provide all -tx, -script and -chaincode arguments.
                     To use test configuration set the -regtest flag.`)
-			}
-		} else {
-			mainConfig.SetInitTx(tx0)
+				}
+			} else {
+				mainConfig.SetInitTx(tx0)
 
-			chaincodeStr := strings.TrimSpace(chaincode) // trim whitespace
-			mainConfig.SetInitChaincode(chaincodeStr)
+				chaincodeStr := strings.TrimSpace(chaincode) // trim whitespace
+				mainConfig.SetInitChaincode(chaincodeStr)
+			}
+			if addrTopup != "" {
+				mainConfig.SetTopupAddress(addrTopup)
+			}
+			mainConfig.SetRegtest(isRegtest)
 		}
-		if addrTopup != "" {
-			mainConfig.SetTopupAddress(addrTopup)
+	}
+
+	// dry run flag applies to all staychains
+	if isDryRun {
+		for _, mainConfig := range mainConfigs {
+			mainConfig.SetDryRun(true)
 		}
-		mainConfig.SetRegtest(isRegtest)
 	}
 }
 
-func main() {
-	defer mainConfig.MainClient().Shutdown()
+// Staychain struct
+// Attestation service of a single staychain with its own context,
+// db, signer, webhook and admin api
+type staychain struct {
+	config  *config.Config
+	db      *db.DbMongo
+	service *attestation.AttestService
+	webhook *attestation.AttestWebhook
+	admin   *attestation.AttestAdmin
+	cancel  context.CancelFunc
+}
 
+// Return new staychain for the config provided
+// All staychains are created before any staychain is started, so that
+// invalid config of any staychain aborts at startup, while a staychain
+// failing to connect to its db or to set up its signer is returned as
+// an error and skipped
+func newStaychain(ctx context.Context, wg *sync.WaitGroup, mainConfig *config.Config) (*staychain, error) {
+	staychainCtx, staychainCancel := context.WithCancel(ctx)
+
+	dbInterface, dbErr := db.NewDbMongo(staychainCtx, mainConfig.DbConfig())
+	if dbErr != nil {
+		staychainCancel()
+		return nil, dbErr
+	}
+	server := attestation.NewAttestServer(dbInterface)
+	signer, signerErr := attestation.NewAttestSigner(staychainCtx, mainConfig)
+	if signerErr != nil {
+		staychainCancel()
+		return nil, signerErr
+	}
+	clock := attestation.NewAttestClockSystem()
+	attestService := attestation.NewAttestService(staychainCtx, wg, server, signer, clock, mainConfig)
+	s := &staychain{config: mainConfig, db: dbInterface, service: attestService, cancel: staychainCancel}
+
+	// deliver attestation events to webhooks
+	// no events are stored for delivery in dry run mode
+	if len(mainConfig.WebhookConfig().Urls) > 0 && !mainConfig.DryRun() {
+		s.webhook = attestation.NewAttestWebhook(staychainCtx, wg, server, clock, mainConfig.WebhookConfig())
+		attestService.Subscribe(s.webhook)
+	}
+
+	// serve operator admin api
+	if mainConfig.AdminConfig().Host != "" {
+		s.admin = attestation.NewAttestAdmin(staychainCtx, wg, attestService, mainConfig.AdminConfig())
+	}
+	return s, nil
+}
+
+// Run function in a staychain goroutine recovering from any panic
+// A panic shuts down the staychain without affecting the others
+func (s *staychain) goRecover(wg *sync.WaitGroup, run func()) {
+	wg.Add(1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Warnf("Staychain %s failure: %v\n", s.config.Name(), r)
+				log.Warnf("Shutting down staychain %s...\n", s.config.Name())
+				s.cancel()
+			}
+		}()
+		run()
+	}()
+}
+
+// Start attestation service, webhook and admin api of the staychain
+// Each runs in its own goroutine that recovers from panics so that
+// a failure in one staychain does not stop the remaining staychains
+func (s *staychain) run(wg *sync.WaitGroup) {
+	if s.webhook != nil {
+		s.goRecover(wg, s.webhook.Run)
+	}
+	if s.admin != nil {
+		s.goRecover(wg, s.admin.Run)
+	}
+	s.goRecover(wg, func() {
+		defer s.config.MainClient().Shutdown()
+		defer s.cancel()
+		if s.config.Name() != "" {
+			log.Infof("Starting staychain %s\n", s.config.Name())
+		}
+		s.service.Run()
+	})
+}
+
+func main() {
 	wg := &sync.WaitGroup{}
 	ctx, cancel := context.WithCancel(context.Background())
 
-	dbInterface := db.NewDbMongo(ctx, mainConfig.DbConfig())
-	server := attestation.NewAttestServer(dbInterface)
-	signer := attestation.NewAttestSignerHttp(mainConfig.SignerConfig())
-	attestService := attestation.NewAttestService(ctx, wg, server, signer, mainConfig)
-
 	c := make(chan os.Signal)
 	signal.Notify(c, os.Interrupt)
 
@@ -96,15 +197,35 @@ func main() {
 		}
 	}()
 
-	wg.Add(1)
-	go attestService.Run()
+	// serve prometheus metrics of all staychains
+	// metrics are a top level option shared by all staychains
+	if metricsHost := mainConfigs[0].MetricsConfig().Host; metricsHost != "" {
+		wg.Add(1)
+		go metrics.Serve(ctx, wg, metricsHost)
+	}
+
+	var staychains []*staychain
+	for _, mainConfig := range mainConfigs {
+		s, staychainErr := newStaychain(ctx, wg, mainConfig)
+		if staychainErr != nil {
+			log.Warnf("Staychain %s failure: %v\n", mainConfig.Name(), staychainErr)
+			continue
+		}
+		staychains = append(staychains, s)
+	}
+	if len(staychains) == 0 {
+		log.Error(ErrorNoStaychains)
+	}
+	for _, s := range staychains {
+		s.run(wg)
+	}
 
 	// In regtest demo mode do block generation work
 	// Also auto commitment to ClientCommitment to
 	// allow easier testing without db intervention
 	if isRegtest {
 		wg.Add(1)
-		go test.DoRegtestWork(dbInterface, mainConfig, wg, ctx)
+		go test.DoRegtestWork(staychains[0].db, staychains[0].config, wg, ctx)
 	}
 	wg.Wait()
 }
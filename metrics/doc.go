@@ -0,0 +1,5 @@
+/*
+Package metrics exposes prometheus metrics on the health of staychain
+attestations, attestation fees, signers and database operations
+*/
+package metrics
@@ -0,0 +1,298 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"mainstay/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metric namespace and label names
+const (
+	Namespace = "mainstay"
+
+	LabelStaychain   = "staychain"
+	LabelSigner      = "signer"
+	LabelDbNamespace = "namespace"
+	LabelError       = "error"
+)
+
+// waiting time for pending scrapes on shutdown
+const ShutdownTimeout = 5 * time.Second
+
+// warning consts
+const (
+	WarningMetricsServer = "Metrics server failure"
+)
+
+// attestation, fee and signer metrics labelled by staychain
+var (
+	attestationState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "attestation_state",
+		Help:      "Current attestation service state",
+	}, []string{LabelStaychain})
+
+	feePerByte = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "fee_per_byte",
+		Help:      "Current attestation fee in satoshis per byte",
+	}, []string{LabelStaychain})
+
+	prevFeePerByte = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "previous_fee_per_byte",
+		Help:      "Previous attestation fee in satoshis per byte before the latest fee bump",
+	}, []string{LabelStaychain})
+
+	unspentValue = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "staychain_unspent_satoshis",
+		Help:      "Value of the staychain unspent output and any topup unspent",
+	}, []string{LabelStaychain})
+
+	runwayAttestations = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "staychain_runway_attestations",
+		Help:      "Estimated number of attestations the staychain unspent can pay for at the recent average fee",
+	}, []string{LabelStaychain})
+
+	runwayDays = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "staychain_runway_days",
+		Help:      "Estimated number of days of attestations the staychain unspent can pay for at the recent average fee",
+	}, []string{LabelStaychain})
+
+	monthlyFeeSpend = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "monthly_fee_spend_satoshis",
+		Help:      "Fees paid by attestations confirmed in the current month",
+	}, []string{LabelStaychain})
+
+	feeBudgetExceeded = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "fee_budget_exceeded",
+		Help:      "Whether the monthly fee budget is exceeded and attestation frequency reduced",
+	}, []string{LabelStaychain})
+
+	clientSlots = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "commitment_active_client_slots",
+		Help:      "Number of client slots with a commitment in the latest commitment",
+	}, []string{LabelStaychain})
+
+	signerRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "signer_request_duration_seconds",
+		Help:      "Latency of signature requests to signers",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{LabelSigner})
+
+	signerRequestFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "signer_request_failures_total",
+		Help:      "Number of failed signature requests to signers",
+	}, []string{LabelSigner})
+
+	dbErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "db_errors_total",
+		Help:      "Number of failed database operations",
+	}, []string{LabelDbNamespace, LabelError})
+
+	ages = newAgeCollector()
+)
+
+func init() {
+	prometheus.MustRegister(
+		attestationState,
+		feePerByte,
+		prevFeePerByte,
+		unspentValue,
+		runwayAttestations,
+		runwayDays,
+		monthlyFeeSpend,
+		feeBudgetExceeded,
+		clientSlots,
+		signerRequestDuration,
+		signerRequestFailures,
+		dbErrors,
+		ages,
+	)
+}
+
+// Return http handler serving all registered metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Serve metrics on the /metrics endpoint of host until the context is cancelled
+func Serve(ctx context.Context, wg *sync.WaitGroup, host string) {
+	defer wg.Done()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server := &http.Server{Addr: host, Handler: mux}
+	go func() {
+		log.Infof("********** serving metrics on: %s/metrics\n", host)
+		if serveErr := server.ListenAndServe(); serveErr != nil && serveErr != http.ErrServerClosed {
+			log.Warnf("%s %v\n", WarningMetricsServer, serveErr)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Infoln("Shutting down Metrics...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+}
+
+// Record request duration and failure of a signer request
+func ObserveSignerRequest(signer string, duration time.Duration, err error) {
+	signerRequestDuration.WithLabelValues(signer).Observe(duration.Seconds())
+	if err != nil {
+		signerRequestFailures.WithLabelValues(signer).Inc()
+	}
+}
+
+// Record failed database operation
+func IncDbError(namespace string, errorMsg string) {
+	dbErrors.WithLabelValues(namespace, errorMsg).Inc()
+}
+
+// StaychainMetrics structure
+//
+// Records attestation metrics of a single staychain
+// All metrics are labelled with the staychain name
+type StaychainMetrics struct {
+	staychain string
+}
+
+// Return new StaychainMetrics instance
+func NewStaychainMetrics(staychain string) *StaychainMetrics {
+	return &StaychainMetrics{staychain}
+}
+
+// Set current attestation state
+func (m *StaychainMetrics) SetAttestationState(state int) {
+	attestationState.WithLabelValues(m.staychain).Set(float64(state))
+}
+
+// Set current and previous fee per byte
+func (m *StaychainMetrics) SetFees(fee int, prevFee int) {
+	feePerByte.WithLabelValues(m.staychain).Set(float64(fee))
+	prevFeePerByte.WithLabelValues(m.staychain).Set(float64(prevFee))
+}
+
+// Set staychain unspent value in satoshis and runway estimate
+func (m *StaychainMetrics) SetUnspent(value int64, runway int64) {
+	unspentValue.WithLabelValues(m.staychain).Set(float64(value))
+	runwayAttestations.WithLabelValues(m.staychain).Set(float64(runway))
+}
+
+// Set runway estimate in days
+func (m *StaychainMetrics) SetRunwayDays(days float64) {
+	runwayDays.WithLabelValues(m.staychain).Set(days)
+}
+
+// Set fees spent in the current month and monthly budget status
+func (m *StaychainMetrics) SetFeeSpend(spend int64, budgetExceeded bool) {
+	monthlyFeeSpend.WithLabelValues(m.staychain).Set(float64(spend))
+	exceeded := 0.0
+	if budgetExceeded {
+		exceeded = 1
+	}
+	feeBudgetExceeded.WithLabelValues(m.staychain).Set(exceeded)
+}
+
+// Set number of active client slots in the latest commitment
+func (m *StaychainMetrics) SetClientSlots(slots int) {
+	clientSlots.WithLabelValues(m.staychain).Set(float64(slots))
+}
+
+// Set time of the last confirmed attestation
+func (m *StaychainMetrics) SetLastConfirmed(t time.Time) {
+	ages.set(ages.lastConfirmed, m.staychain, t)
+}
+
+// Set time the pending attestation was sent
+// A zero time clears the pending attestation
+func (m *StaychainMetrics) SetPending(t time.Time) {
+	ages.set(ages.pending, m.staychain, t)
+}
+
+// ageCollector structure
+//
+// Collects the age of the last confirmed and pending attestation
+// of each staychain, calculated at the time metrics are scraped
+type ageCollector struct {
+	mtx           sync.Mutex
+	lastConfirmed map[string]time.Time
+	pending       map[string]time.Time
+
+	lastConfirmedDesc *prometheus.Desc
+	pendingDesc       *prometheus.Desc
+
+	now func() time.Time
+}
+
+// Return new ageCollector instance
+func newAgeCollector() *ageCollector {
+	return &ageCollector{
+		lastConfirmed: make(map[string]time.Time),
+		pending:       make(map[string]time.Time),
+		lastConfirmedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "attestation_last_confirmed_age_seconds"),
+			"Seconds since the last confirmed attestation",
+			[]string{LabelStaychain}, nil),
+		pendingDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "attestation_pending_age_seconds"),
+			"Seconds since the pending attestation was sent or 0 if there is none",
+			[]string{LabelStaychain}, nil),
+		now: time.Now,
+	}
+}
+
+// Set staychain time in ages map
+func (c *ageCollector) set(ages map[string]time.Time, staychain string, t time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	ages[staychain] = t
+}
+
+// Implement prometheus.Collector Describe method
+func (c *ageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lastConfirmedDesc
+	ch <- c.pendingDesc
+}
+
+// Implement prometheus.Collector Collect method
+func (c *ageCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := c.now()
+	for staychain, t := range c.lastConfirmed {
+		if t.IsZero() {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.lastConfirmedDesc, prometheus.GaugeValue,
+			now.Sub(t).Seconds(), staychain)
+	}
+	for staychain, t := range c.pending {
+		age := 0.0
+		if !t.IsZero() {
+			age = now.Sub(t).Seconds()
+		}
+		ch <- prometheus.MustNewConstMetric(c.pendingDesc, prometheus.GaugeValue, age, staychain)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test staychain metrics are labelled by staychain
+func TestStaychainMetrics(t *testing.T) {
+	m0 := NewStaychainMetrics("chain0")
+	m1 := NewStaychainMetrics("chain1")
+
+	m0.SetAttestationState(6)
+	m1.SetAttestationState(1)
+	assert.Equal(t, float64(6), testutil.ToFloat64(attestationState.WithLabelValues("chain0")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(attestationState.WithLabelValues("chain1")))
+
+	m0.SetFees(25, 20)
+	assert.Equal(t, float64(25), testutil.ToFloat64(feePerByte.WithLabelValues("chain0")))
+	assert.Equal(t, float64(20), testutil.ToFloat64(prevFeePerByte.WithLabelValues("chain0")))
+
+	m0.SetUnspent(100000, 40)
+	assert.Equal(t, float64(100000), testutil.ToFloat64(unspentValue.WithLabelValues("chain0")))
+	assert.Equal(t, float64(40), testutil.ToFloat64(runwayAttestations.WithLabelValues("chain0")))
+	m0.SetRunwayDays(12.5)
+	assert.Equal(t, 12.5, testutil.ToFloat64(runwayDays.WithLabelValues("chain0")))
+
+	m0.SetFeeSpend(250000, true)
+	assert.Equal(t, float64(250000), testutil.ToFloat64(monthlyFeeSpend.WithLabelValues("chain0")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(feeBudgetExceeded.WithLabelValues("chain0")))
+
+	m1.SetClientSlots(3)
+	assert.Equal(t, float64(3), testutil.ToFloat64(clientSlots.WithLabelValues("chain1")))
+}
+
+// Test signer and db error counters
+func TestErrorMetrics(t *testing.T) {
+	ObserveSignerRequest("http://signer", time.Second, nil)
+	assert.Equal(t, float64(0), testutil.ToFloat64(signerRequestFailures.WithLabelValues("http://signer")))
+	ObserveSignerRequest("http://signer", time.Second, errors.New("500 Internal Server Error"))
+	assert.Equal(t, float64(1), testutil.ToFloat64(signerRequestFailures.WithLabelValues("http://signer")))
+
+	IncDbError("ns", "could not save attestation")
+	IncDbError("ns", "could not save attestation")
+	assert.Equal(t, float64(2), testutil.ToFloat64(dbErrors.WithLabelValues("ns", "could not save attestation")))
+}
+
+// Test attestation ages calculated when metrics are scraped
+func TestAgeMetrics(t *testing.T) {
+	now := time.Now()
+	ages.now = func() time.Time { return now }
+	defer func() { ages.now = time.Now }()
+
+	m := NewStaychainMetrics("chainAge")
+	m.SetLastConfirmed(now.Add(-90 * time.Second))
+	m.SetPending(now.Add(-30 * time.Second))
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+	assert.Equal(t, true, strings.Contains(string(body),
+		`mainstay_attestation_last_confirmed_age_seconds{staychain="chainAge"} 90`))
+	assert.Equal(t, true, strings.Contains(string(body),
+		`mainstay_attestation_pending_age_seconds{staychain="chainAge"} 30`))
+
+	// pending attestation cleared
+	m.SetPending(time.Time{})
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ = ioutil.ReadAll(rec.Body)
+	assert.Equal(t, true, strings.Contains(string(body),
+		`mainstay_attestation_pending_age_seconds{staychain="chainAge"} 0`))
+}
@@ -42,19 +42,46 @@ func NewAttestationDefault() *Attestation {
 }
 
 // Update info with details from wallet transaction
-func (a *Attestation) UpdateInfo(tx *btcjson.GetTransactionResult) {
+// The fee is the value of the previous outputs provided for all
+// transaction inputs less the transaction output values, along with
+// the fee of any fee-only child recorded for the attestation
+// Fee bumps recorded for the attestation are kept
+func (a *Attestation) UpdateInfo(tx *btcjson.GetTransactionResult, prevOuts []*wire.TxOut) {
 	amount := int64(0)
 	if len(a.Tx.TxOut) > 0 {
 		amount = a.Tx.TxOut[0].Value
 	}
+	fee := int64(0)
+	if len(prevOuts) > 0 && len(prevOuts) == len(a.Tx.TxIn) {
+		for _, prevOut := range prevOuts {
+			fee += prevOut.Value
+		}
+		for _, txOut := range a.Tx.TxOut {
+			fee -= txOut.Value
+		}
+	}
 	a.Info = AttestationInfo{
 		Txid:      a.Txid.String(),
 		Blockhash: tx.BlockHash,
 		Amount:    amount,
 		Time:      tx.Time,
+		Fee:       fee + a.Info.ChildFee,
+		ChildFee:  a.Info.ChildFee,
+		FeeBumps:  a.Info.FeeBumps,
 	}
 }
 
+// Record fee of the fee-only child transaction of the attestation
+// A replacement of the child replaces the previously recorded fee
+func (a *Attestation) SetChildFee(fee int64) {
+	a.Info.ChildFee = fee
+}
+
+// Record fee bump decision in attestation info
+func (a *Attestation) AddFeeBump(feeBump FeeBump) {
+	a.Info.FeeBumps = append(a.Info.FeeBumps, feeBump)
+}
+
 // Set commitment
 func (a *Attestation) SetCommitment(commitment *Commitment) {
 	a.commitment = commitment
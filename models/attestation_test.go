@@ -10,6 +10,7 @@ import (
 
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -56,13 +57,42 @@ func TestAttestation(t *testing.T) {
 		BlockHash: "abcde34e881d9a1e6cdc3418b54bb57747106bc75e9e84426661f27f98ada3b7",
 		Time:      int64(1542121293),
 		TxID:      "4444e34e881d9a1e6cdc3418b54bb57747106bc75e9e84426661f27f98ada3b7"}
-	attestation.UpdateInfo(&txRes)
+	attestation.UpdateInfo(&txRes, nil)
 	attestation.Info.Amount = int64(1)
 	assert.Equal(t, AttestationInfo{
 		Txid:      "4444e34e881d9a1e6cdc3418b54bb57747106bc75e9e84426661f27f98ada3b7",
 		Blockhash: "abcde34e881d9a1e6cdc3418b54bb57747106bc75e9e84426661f27f98ada3b7",
 		Amount:    int64(1),
 		Time:      int64(1542121293)}, attestation.Info)
+
+	// test fee of transaction from the previous outputs of its inputs in satoshis
+	attestation.Tx.AddTxIn(&wire.TxIn{})
+	attestation.Tx.AddTxIn(&wire.TxIn{})
+	attestation.Tx.AddTxOut(wire.NewTxOut(100000, nil))
+	attestation.Tx.AddTxOut(wire.NewTxOut(1000, nil))
+	prevOuts := []*wire.TxOut{wire.NewTxOut(90000, nil), wire.NewTxOut(23345, nil)}
+	attestation.UpdateInfo(&txRes, prevOuts)
+	assert.Equal(t, int64(12345), attestation.Info.Fee)
+	assert.Equal(t, int64(100000), attestation.Info.Amount)
+
+	// test no fee if previous outputs are missing for any input
+	attestation.UpdateInfo(&txRes, prevOuts[:1])
+	assert.Equal(t, int64(0), attestation.Info.Fee)
+
+	// test fee of fee-only child added to the attestation fee
+	attestation.SetChildFee(2000)
+	attestation.UpdateInfo(&txRes, prevOuts)
+	assert.Equal(t, int64(14345), attestation.Info.Fee)
+	assert.Equal(t, int64(2000), attestation.Info.ChildFee)
+	attestation.SetChildFee(3000)
+	attestation.UpdateInfo(&txRes, prevOuts)
+	assert.Equal(t, int64(15345), attestation.Info.Fee)
+
+	// test fee bumps kept on info update
+	feeBump := FeeBump{Time: 1542121293, Policy: "increment", PrevFee: 10, Fee: 15, Reason: "incremented by 5"}
+	attestation.AddFeeBump(feeBump)
+	attestation.UpdateInfo(&txRes, prevOuts)
+	assert.Equal(t, []FeeBump{feeBump}, attestation.Info.FeeBumps)
 }
 
 // Test Attestation BSON interface
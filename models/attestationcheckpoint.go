@@ -0,0 +1,189 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"bytes"
+	"encoding/hex"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// AttestationCheckpoint structure
+// Snapshot of the attestation service state machine stored after
+// every state transition, allowing the service to resume exactly
+// where it stopped after a restart or crash. Includes the current
+// attestation, fee levels, collected signatures, confirm timing
+// and the time the attestation was first sent for fee bump deadlines
+type AttestationCheckpoint struct {
+	State       int
+	Attestation Attestation
+	Fee         int
+	PrevFee     int
+	IsFeeBumped bool
+	Sigs        []wire.TxWitness
+	SpendHash   *chainhash.Hash
+	ConfirmTime time.Time
+	SentTime    time.Time
+}
+
+// Implement bson.Marshaler MarshalBSON() method for use with db_mongo interface
+func (c AttestationCheckpoint) MarshalBSON() ([]byte, error) {
+	// serialize tx only if it has been initialised
+	// as a tx with no inputs can not be deserialized
+	var txStr string
+	if len(c.Attestation.Tx.TxIn) > 0 {
+		var txBuffer bytes.Buffer
+		if err := c.Attestation.Tx.Serialize(&txBuffer); err != nil {
+			return nil, err
+		}
+		txStr = hex.EncodeToString(txBuffer.Bytes())
+	}
+
+	// store commitment leaves in order to rebuild the commitment tree
+	var commitments []string
+	if commitment, errCommitment := c.Attestation.Commitment(); errCommitment == nil {
+		for _, merkleCommitment := range commitment.GetMerkleCommitments() {
+			commitments = append(commitments, merkleCommitment.Commitment.String())
+		}
+	}
+
+	var sigs [][]string
+	for _, witness := range c.Sigs {
+		var witnessStr []string
+		for _, item := range witness {
+			witnessStr = append(witnessStr, hex.EncodeToString(item))
+		}
+		sigs = append(sigs, witnessStr)
+	}
+
+	var spendHashStr string
+	if c.SpendHash != nil {
+		spendHashStr = c.SpendHash.String()
+	}
+
+	checkpointBSON := AttestationCheckpointBSON{
+		State:       int32(c.State),
+		Txid:        c.Attestation.Txid.String(),
+		Tx:          txStr,
+		Confirmed:   c.Attestation.Confirmed,
+		Info:        c.Attestation.Info,
+		MerkleRoot:  c.Attestation.CommitmentHash().String(),
+		Commitments: commitments,
+		Fee:         int32(c.Fee),
+		PrevFee:     int32(c.PrevFee),
+		IsFeeBumped: c.IsFeeBumped,
+		Sigs:        sigs,
+		SpendHash:   spendHashStr,
+		ConfirmTime: c.ConfirmTime,
+		SentTime:    c.SentTime,
+		UpdatedAt:   time.Now(),
+	}
+	return bson.Marshal(checkpointBSON)
+}
+
+// Implement bson.Unmarshaler UnmarshalJSON() method for use with db_mongo interface
+func (c *AttestationCheckpoint) UnmarshalBSON(b []byte) error {
+	var checkpointBSON AttestationCheckpointBSON
+	if err := bson.Unmarshal(b, &checkpointBSON); err != nil {
+		return err
+	}
+
+	txidHash, errHash := chainhash.NewHashFromStr(checkpointBSON.Txid)
+	if errHash != nil {
+		return errHash
+	}
+
+	var tx wire.MsgTx
+	if checkpointBSON.Tx != "" {
+		txBytes, errDecode := hex.DecodeString(checkpointBSON.Tx)
+		if errDecode != nil {
+			return errDecode
+		}
+		if errTx := tx.Deserialize(bytes.NewReader(txBytes)); errTx != nil {
+			return errTx
+		}
+	}
+
+	// rebuild commitment from stored commitment leaves
+	commitment := (*Commitment)(nil)
+	if len(checkpointBSON.Commitments) > 0 {
+		var commitmentHashes []chainhash.Hash
+		for _, commitmentStr := range checkpointBSON.Commitments {
+			commitmentHash, errCommitmentHash := chainhash.NewHashFromStr(commitmentStr)
+			if errCommitmentHash != nil {
+				return errCommitmentHash
+			}
+			commitmentHashes = append(commitmentHashes, *commitmentHash)
+		}
+		var errCommitment error
+		commitment, errCommitment = NewCommitment(commitmentHashes)
+		if errCommitment != nil {
+			return errCommitment
+		}
+	}
+
+	var sigs []wire.TxWitness
+	for _, witnessStr := range checkpointBSON.Sigs {
+		var witness wire.TxWitness
+		for _, itemStr := range witnessStr {
+			item, errItem := hex.DecodeString(itemStr)
+			if errItem != nil {
+				return errItem
+			}
+			witness = append(witness, item)
+		}
+		sigs = append(sigs, witness)
+	}
+
+	var spendHash *chainhash.Hash
+	if checkpointBSON.SpendHash != "" {
+		var errSpendHash error
+		if spendHash, errSpendHash = chainhash.NewHashFromStr(checkpointBSON.SpendHash); errSpendHash != nil {
+			return errSpendHash
+		}
+	}
+
+	c.State = int(checkpointBSON.State)
+	c.Attestation = Attestation{*txidHash, tx, checkpointBSON.Confirmed, checkpointBSON.Info, commitment}
+	c.Fee = int(checkpointBSON.Fee)
+	c.PrevFee = int(checkpointBSON.PrevFee)
+	c.IsFeeBumped = checkpointBSON.IsFeeBumped
+	c.Sigs = sigs
+	c.SpendHash = spendHash
+	c.ConfirmTime = checkpointBSON.ConfirmTime
+	c.SentTime = checkpointBSON.SentTime
+	return nil
+}
+
+// AttestationCheckpoint field names
+const (
+	AttestationCheckpointStateName      = "state"
+	AttestationCheckpointTxidName       = "txid"
+	AttestationCheckpointMerkleRootName = "merkle_root"
+	AttestationCheckpointUpdatedAtName  = "updated_at"
+)
+
+// AttestationCheckpointBSON structure for mongoDB
+type AttestationCheckpointBSON struct {
+	State       int32           `bson:"state"`
+	Txid        string          `bson:"txid"`
+	Tx          string          `bson:"tx"`
+	Confirmed   bool            `bson:"confirmed"`
+	Info        AttestationInfo `bson:"info"`
+	MerkleRoot  string          `bson:"merkle_root"`
+	Commitments []string        `bson:"commitments"`
+	Fee         int32           `bson:"fee"`
+	PrevFee     int32           `bson:"prev_fee"`
+	IsFeeBumped bool            `bson:"is_fee_bumped"`
+	Sigs        [][]string      `bson:"sigs"`
+	SpendHash   string          `bson:"spend_hash,omitempty"`
+	ConfirmTime time.Time       `bson:"confirm_time"`
+	SentTime    time.Time       `bson:"sent_time"`
+	UpdatedAt   time.Time       `bson:"updated_at"`
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test AttestationCheckpoint BSON interface
+func TestAttestationCheckpointBSON(t *testing.T) {
+	hash0, _ := chainhash.NewHashFromStr("1a39e34e881d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	hash1, _ := chainhash.NewHashFromStr("2a39e34e881d9a1e6cdc3418b54aa57747106bc75e9e84426661f27f98ada3b7")
+	root, _ := chainhash.NewHashFromStr("bb088c106b3379b64243c1a4915f72a847d45c7513b152cad583eb3c0a1063c2")
+	commitment, _ := NewCommitment([]chainhash.Hash{*hash0, *hash1})
+
+	txid, _ := chainhash.NewHashFromStr("4444e34e881d9a1e6cdc3418b54bb57747106bc75e9e84426661f27f98ada3b7")
+	attestation := NewAttestation(*txid, commitment)
+
+	// add a tx with a single input and output
+	attestation.Tx = *wire.NewMsgTx(wire.TxVersion)
+	attestation.Tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(root, 0), nil, nil))
+	attestation.Tx.AddTxOut(wire.NewTxOut(100000, []byte{0x00, 0x14}))
+
+	confirmTime := time.Unix(1542121293, 0)
+	checkpoint := AttestationCheckpoint{
+		State:       3,
+		Attestation: *attestation,
+		Fee:         25,
+		PrevFee:     20,
+		IsFeeBumped: true,
+		Sigs:        []wire.TxWitness{wire.TxWitness{[]byte{0x30, 0x01}, []byte{0x02, 0x03}}},
+		SpendHash:   hash1,
+		ConfirmTime: confirmTime,
+		SentTime:    confirmTime.Add(-time.Hour),
+	}
+
+	// test marshal checkpoint model
+	bytes, errBytes := checkpoint.MarshalBSON()
+	assert.Equal(t, nil, errBytes)
+
+	// test unmarshal checkpoint model and verify reverse works
+	testCheckpoint := &AttestationCheckpoint{}
+	errUnmarshal := testCheckpoint.UnmarshalBSON(bytes)
+	assert.Equal(t, nil, errUnmarshal)
+	assert.Equal(t, checkpoint.State, testCheckpoint.State)
+	assert.Equal(t, checkpoint.Fee, testCheckpoint.Fee)
+	assert.Equal(t, checkpoint.PrevFee, testCheckpoint.PrevFee)
+	assert.Equal(t, checkpoint.IsFeeBumped, testCheckpoint.IsFeeBumped)
+	assert.Equal(t, checkpoint.Sigs, testCheckpoint.Sigs)
+	assert.Equal(t, *hash1, *testCheckpoint.SpendHash)
+	assert.Equal(t, confirmTime.Unix(), testCheckpoint.ConfirmTime.Unix())
+	assert.Equal(t, confirmTime.Add(-time.Hour).Unix(), testCheckpoint.SentTime.Unix())
+	assert.Equal(t, attestation.Txid, testCheckpoint.Attestation.Txid)
+	assert.Equal(t, attestation.Tx.TxHash(), testCheckpoint.Attestation.Tx.TxHash())
+	assert.Equal(t, attestation.CommitmentHash(), testCheckpoint.Attestation.CommitmentHash())
+
+	// test checkpoint model to document
+	doc, docErr := GetDocumentFromModel(testCheckpoint)
+	assert.Equal(t, nil, docErr)
+	assert.Equal(t, int32(3), doc.Lookup(AttestationCheckpointStateName).Int32())
+	assert.Equal(t, attestation.Txid.String(), doc.Lookup(AttestationCheckpointTxidName).StringValue())
+	assert.Equal(t, attestation.CommitmentHash().String(), doc.Lookup(AttestationCheckpointMerkleRootName).StringValue())
+
+	// test default checkpoint with no tx and no commitment
+	defaultCheckpoint := AttestationCheckpoint{Attestation: *NewAttestationDefault()}
+	bytes, errBytes = defaultCheckpoint.MarshalBSON()
+	assert.Equal(t, nil, errBytes)
+
+	testDefaultCheckpoint := &AttestationCheckpoint{}
+	errUnmarshal = testDefaultCheckpoint.UnmarshalBSON(bytes)
+	assert.Equal(t, nil, errUnmarshal)
+	assert.Equal(t, 0, len(testDefaultCheckpoint.Attestation.Tx.TxIn))
+	assert.Equal(t, (*chainhash.Hash)(nil), testDefaultCheckpoint.SpendHash)
+	assert.Equal(t, chainhash.Hash{}, testDefaultCheckpoint.Attestation.CommitmentHash())
+	_, errCommitment := testDefaultCheckpoint.Attestation.Commitment()
+	assert.Equal(t, ErrorCommitmentNotDefined, errCommitment.Error())
+}
@@ -5,11 +5,17 @@
 package models
 
 // struct for db AttestationInfo
+// Fee is the fee in satoshis paid by the confirmed attestation
+// including the child fee paid by any fee-only child transaction
+// Fee bumps record each fee bump decision made for the attestation
 type AttestationInfo struct {
-	Txid      string `bson:"txid"`
-	Blockhash string `bson:"blockhash"`
-	Amount    int64  `bson:"amount"`
-	Time      int64  `bson:"time"`
+	Txid      string    `bson:"txid"`
+	Blockhash string    `bson:"blockhash"`
+	Amount    int64     `bson:"amount"`
+	Time      int64     `bson:"time"`
+	Fee       int64     `bson:"fee"`
+	ChildFee  int64     `bson:"child_fee,omitempty"`
+	FeeBumps  []FeeBump `bson:"fee_bumps,omitempty"`
 }
 
 // AttestationInfo field names
@@ -18,4 +24,30 @@ const (
 	AttestationInfoBlockhashName = "blockhash"
 	AttestationInfoAmountName    = "amount"
 	AttestationInfoTimeName      = "time"
+	AttestationInfoFeeName       = "fee"
+	AttestationInfoChildFeeName  = "child_fee"
+	AttestationInfoFeeBumpsName  = "fee_bumps"
+)
+
+// struct for FeeBump decisions of the fee bump policy
+// Fees are in satoshis per byte and the reason explains
+// how the policy arrived at the new fee for later audit
+// Txid is the transaction id of the attestation bumped
+type FeeBump struct {
+	Txid    string `bson:"txid"`
+	Time    int64  `bson:"time"`
+	Policy  string `bson:"policy"`
+	PrevFee int    `bson:"prev_fee"`
+	Fee     int    `bson:"fee"`
+	Reason  string `bson:"reason"`
+}
+
+// FeeBump field names
+const (
+	FeeBumpTxidName    = "txid"
+	FeeBumpTimeName    = "time"
+	FeeBumpPolicyName  = "policy"
+	FeeBumpPrevFeeName = "prev_fee"
+	FeeBumpFeeName     = "fee"
+	FeeBumpReasonName  = "reason"
 )
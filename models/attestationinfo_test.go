@@ -62,3 +62,33 @@ func AttestationInfoBSON(t *testing.T) {
 	assert.Equal(t, info.Amount, testtestInfo.Amount)
 	assert.Equal(t, info.Time, testtestInfo.Time)
 }
+
+// Test AttestationInfo fee bumps BSON interface
+func TestAttestationInfoFeeBumpsBSON(t *testing.T) {
+	info := AttestationInfo{
+		Txid: "f123434e881d9a1e6cdc3418b54bb57747106bc75e9e84426661f27f98ada3b7",
+		FeeBumps: []FeeBump{
+			FeeBump{Txid: "a123434e881d9a1e6cdc3418b54bb57747106bc75e9e84426661f27f98ada3b7",
+				Time: 1542121293, Policy: "increment", PrevFee: 10, Fee: 15, Reason: "incremented by 5"},
+			FeeBump{Txid: "b123434e881d9a1e6cdc3418b54bb57747106bc75e9e84426661f27f98ada3b7",
+				Time: 1542124893, Policy: "increment", PrevFee: 15, Fee: 20, Reason: "incremented by 5"}}}
+
+	bytes, errBytes := bson.Marshal(info)
+	assert.Equal(t, nil, errBytes)
+	testInfo := &AttestationInfo{}
+	assert.Equal(t, nil, bson.Unmarshal(bytes, testInfo))
+	assert.Equal(t, info.FeeBumps, testInfo.FeeBumps)
+
+	doc, docErr := GetDocumentFromModel(testInfo)
+	assert.Equal(t, nil, docErr)
+	feeBumps := doc.Lookup(AttestationInfoFeeBumpsName).Array()
+	assert.Equal(t, 2, len(feeBumps))
+	assert.Equal(t, int32(20), feeBumps[1].Document().Lookup(FeeBumpFeeName).Int32())
+	assert.Equal(t, info.FeeBumps[1].Txid, feeBumps[1].Document().Lookup(FeeBumpTxidName).StringValue())
+
+	// no fee bumps omitted
+	doc, docErr = GetDocumentFromModel(AttestationInfo{Txid: info.Txid})
+	assert.Equal(t, nil, docErr)
+	_, lookupErr := doc.LookupErr(AttestationInfoFeeBumpsName)
+	assert.NotEqual(t, nil, lookupErr)
+}
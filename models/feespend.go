@@ -0,0 +1,47 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"time"
+
+	_ "go.mongodb.org/mongo-driver/bson"
+)
+
+// fee spend aggregation periods
+const (
+	FeeSpendPeriodDay   = "day"
+	FeeSpendPeriodMonth = "month"
+)
+
+// struct for db FeeSpend
+// Aggregation of the fees paid by confirmed attestations over
+// a day or a month, identified by the UTC date of the period
+// in the 2006-01-02 format for days and 2006-01 for months
+type FeeSpend struct {
+	Period string `bson:"_id"`
+	Fees   int64  `bson:"fees"`
+	Count  int64  `bson:"count"`
+}
+
+// FeeSpend field names
+const (
+	FeeSpendPeriodName = "_id"
+	FeeSpendFeesName   = "fees"
+	FeeSpendCountName  = "count"
+)
+
+// Return date format of the fee spend period provided
+func FeeSpendFormat(period string) string {
+	if period == FeeSpendPeriodMonth {
+		return "2006-01"
+	}
+	return "2006-01-02"
+}
+
+// Return fee spend period of the time provided
+func FeeSpendPeriodOf(period string, t time.Time) string {
+	return t.UTC().Format(FeeSpendFormat(period))
+}
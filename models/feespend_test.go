@@ -0,0 +1,28 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Test FeeSpend periods and BSON interface
+func TestFeeSpend(t *testing.T) {
+	// test periods are UTC dates
+	tm := time.Date(2024, 3, 31, 23, 30, 0, 0, time.FixedZone("", -3600))
+	assert.Equal(t, "2024-04-01", FeeSpendPeriodOf(FeeSpendPeriodDay, tm))
+	assert.Equal(t, "2024-04", FeeSpendPeriodOf(FeeSpendPeriodMonth, tm))
+
+	// test aggregation result unmarshalled
+	bytes, errBytes := bson.Marshal(bson.M{FeeSpendPeriodName: "2024-04", FeeSpendFeesName: int64(12000), FeeSpendCountName: int32(3)})
+	assert.Equal(t, nil, errBytes)
+	spend := FeeSpend{}
+	assert.Equal(t, nil, bson.Unmarshal(bytes, &spend))
+	assert.Equal(t, FeeSpend{Period: "2024-04", Fees: 12000, Count: 3}, spend)
+}
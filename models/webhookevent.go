@@ -0,0 +1,38 @@
+// Copyright (c) 2018 CommerceBlock Team
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+package models
+
+import (
+	"time"
+
+	_ "go.mongodb.org/mongo-driver/bson"
+)
+
+// struct for db WebhookEvent
+// Outbox entry of an attestation service event to be delivered
+// to a webhook url. Entries remain pending until delivered or
+// until the maximum number of delivery attempts has been reached
+type WebhookEvent struct {
+	Id          string    `bson:"id"`
+	Url         string    `bson:"url"`
+	Payload     string    `bson:"payload"`
+	Attempts    int32     `bson:"attempts"`
+	NextAttempt time.Time `bson:"next_attempt"`
+	Delivered   bool      `bson:"delivered"`
+	Failed      bool      `bson:"failed"`
+	CreatedAt   time.Time `bson:"created_at"`
+}
+
+// WebhookEvent field names
+const (
+	WebhookEventIdName          = "id"
+	WebhookEventUrlName         = "url"
+	WebhookEventPayloadName     = "payload"
+	WebhookEventAttemptsName    = "attempts"
+	WebhookEventNextAttemptName = "next_attempt"
+	WebhookEventDeliveredName   = "delivered"
+	WebhookEventFailedName      = "failed"
+	WebhookEventCreatedAtName   = "created_at"
+)
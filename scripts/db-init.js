@@ -12,22 +12,60 @@
 // Make sure mongo db running in auth mode:
 // mongod -auth
 // Run this using:
-// mongo --eval "var db_host='$DB_HOST'; db_name='$DB_NAME_MAINSTAY'; var db_user='$DB_USER'; var db_pass ='$DB_PASS'" scripts/db-init.js
+// mongo --eval "var db_host='$DB_HOST'; db_name='$DB_NAME_MAINSTAY'; var db_user='$DB_USER'; var db_pass ='$DB_PASS'; var db_namespaces='$DB_NAMESPACES'" scripts/db-init.js
 
 db = connect(db_user + ":" + db_pass + "@" + db_host + "/admin");
 
 // Connect/create mainstayX database
 db = db.getSiblingDB(db_name)
 
+// Staychains sharing the db use collections prefixed with their
+// db namespace. Collections and role privileges are created for
+// the un-prefixed collections and for each namespace provided
+// in the comma separated db_namespaces variable, e.g.
+// --eval "...; var db_namespaces='testnet,liquid'"
+var namespaces = [""]
+if (typeof db_namespaces !== "undefined" && db_namespaces != "") {
+    db_namespaces.split(",").forEach(function(namespace) {
+        namespaces.push(namespace.trim())
+    })
+}
+
+// Return collection name prefixed with the namespace
+function collectionName(namespace, name) {
+    if (namespace == "") {
+        return name
+    }
+    return namespace + "_" + name
+}
+
+// Return privileges for each namespace of the collection actions provided
+function namespacePrivileges(collectionActions) {
+    var privileges = []
+    namespaces.forEach(function(namespace) {
+        for (var name in collectionActions) {
+            privileges.push({ resource: { db: db_name, collection: collectionName(namespace, name) }, actions: collectionActions[name] })
+        }
+    })
+    return privileges
+}
+
 // Create collections
 print("creating collections")
-db.createCollection("Attestation")
-db.createCollection("AttestationInfo")
-db.createCollection("ClientCommitment")
-db.createCollection("ClientDetails")
-db.createCollection("ClientSignup")
-db.createCollection("MerkleCommitment")
-db.createCollection("MerkleProof")
+namespaces.forEach(function(namespace) {
+    ["Attestation",
+     "AttestationInfo",
+     "AttestationCheckpoint",
+     "AttestationFeeBump",
+     "ClientCommitment",
+     "ClientDetails",
+     "ClientSignup",
+     "MerkleCommitment",
+     "MerkleProof",
+     "WebhookEvent"].forEach(function(name) {
+        db.createCollection(collectionName(namespace, name))
+    })
+})
 print(db.getCollectionNames())
 
 // Create roles
@@ -41,16 +79,16 @@ db.dropRole("mainstayService")
 db.createRole(
 {
     role: "mainstayApi",
-    privileges: [
-        { resource: { db: db_name, collection: "Attestation" }, actions: [ "find"] },
-        { resource: { db: db_name, collection: "AttestationInfo" }, actions: [ "find"] },
-        { resource: { db: db_name, collection: "MerkleCommitment" }, actions: [ "find"] },
-        { resource: { db: db_name, collection: "MerkleProof" }, actions: [ "find"] },
-        { resource: { db: db_name, collection: "ClientCommitment" }, actions: [ "find", "update", "insert"] },
-        { resource: { db: db_name, collection: "ClientDetails" }, actions: [ "find", "update", "insert"] },
-        { resource: { db: db_name, collection: "ClientSignup" }, actions: [ "find", "update", "insert"] },
-
-    ],
+    privileges: namespacePrivileges({
+        "Attestation": [ "find"],
+        "AttestationInfo": [ "find"],
+        "AttestationFeeBump": [ "find"],
+        "MerkleCommitment": [ "find"],
+        "MerkleProof": [ "find"],
+        "ClientCommitment": [ "find", "update", "insert"],
+        "ClientDetails": [ "find", "update", "insert"],
+        "ClientSignup": [ "find", "update", "insert"],
+    }),
     roles: []
 }
 )
@@ -61,15 +99,18 @@ db.createRole(
 db.createRole(
 {
     role: "mainstayService",
-    privileges: [
-        { resource: { db: db_name, collection: "Attestation" }, actions: ["find", "update", "insert"] },
-        { resource: { db: db_name, collection: "AttestationInfo" }, actions: ["find", "update", "insert"] },
-        { resource: { db: db_name, collection: "MerkleCommitment" }, actions: ["find", "update", "insert"] },
-        { resource: { db: db_name, collection: "MerkleProof" }, actions: ["find", "update", "insert"] },
-        { resource: { db: db_name, collection: "ClientCommitment" }, actions: ["find"] },
-        { resource: { db: db_name, collection: "ClientDetails" }, actions: ["find"] },
-        { resource: { db: db_name, collection: "ClientSignup" }, actions: ["find"] },
-    ],
+    privileges: namespacePrivileges({
+        "Attestation": ["find", "update", "insert"],
+        "AttestationInfo": ["find", "update", "insert", "remove"],
+        "AttestationCheckpoint": ["find", "update", "insert"],
+        "AttestationFeeBump": ["find", "insert"],
+        "MerkleCommitment": ["find", "update", "insert"],
+        "MerkleProof": ["find", "update", "insert"],
+        "WebhookEvent": ["find", "update", "insert"],
+        "ClientCommitment": ["find", "changeStream"],
+        "ClientDetails": ["find"],
+        "ClientSignup": ["find"],
+    }),
     roles: []
 }
 )
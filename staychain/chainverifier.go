@@ -90,6 +90,7 @@ type ChainVerifier struct {
 	pubkeys      []*hdkeychain.ExtendedKey
 	numOfSigs    int
 	latestHeight int64
+	taprootKey   *btcec.PublicKey // internal key of taproot staychains
 }
 
 // Return new Chain Verifier instance that verifies attestations on the side chain
@@ -124,7 +125,22 @@ func NewChainVerifier(cfgMain *chaincfg.Params, side clients.SidechainClient, po
 			hdkeychain.NewExtendedKey([]byte{}, pub.SerializeCompressed(), chaincodes[i_p], []byte{}, 0, 0, false))
 	}
 
-	return ChainVerifier{side, host, cfgMain, position, pubkeysExtended, numOfSigs, 0}
+	return ChainVerifier{side, host, cfgMain, position, pubkeysExtended, numOfSigs, 0, nil}
+}
+
+// Return new Chain Verifier instance for taproot staychains that verifies
+// attestations on the side chain using the internal key of the attestation service
+func NewChainVerifierTaproot(cfgMain *chaincfg.Params, side clients.SidechainClient, position int, internalKey string, host string) ChainVerifier {
+	pubkeyBytes, pubkeyBytesErr := hex.DecodeString(internalKey)
+	if pubkeyBytesErr != nil {
+		log.Fatalf("Invalid taproot internal key provided %s", internalKey)
+	}
+	taprootKey, taprootKeyErr := btcec.ParsePubKey(pubkeyBytes)
+	if taprootKeyErr != nil {
+		log.Fatalf("Invalid taproot internal key provided %s", internalKey)
+	}
+
+	return ChainVerifier{side, host, cfgMain, position, nil, 0, 0, taprootKey}
 }
 
 // Basic verification for vout size and number of addresses
@@ -152,6 +168,18 @@ func (v *ChainVerifier) verifyTxAddr(tx Tx, root string) error {
 	var tweakedPubs []*btcec.PublicKey
 	commitmentBytes := rootHash.CloneBytes()
 
+	// tweak internal key with commitment from api for taproot staychains
+	if v.taprootKey != nil {
+		taprootAddr, taprootAddrErr := crypto.GetTaprootAddress(v.taprootKey, commitmentBytes, v.cfgMain)
+		if taprootAddrErr != nil {
+			return &ChainVerifierError{taprootAddrErr.Error()}
+		}
+		if taprootAddr.String() == txaddr {
+			return nil
+		}
+		return &ChainVerifierError{"Tweaked address does not match the transaction address"}
+	}
+
 	// tweak base pubkey with commitment from api
 	for _, pub := range v.pubkeys {
 		// tweak extended pubkeys